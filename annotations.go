@@ -0,0 +1,40 @@
+package main
+
+import "github.com/mark3labs/mcp-go/mcp"
+
+// Tool annotations let clients apply their own confirmation policies: read-only tools can
+// be called freely, destructive ones warrant asking the user first. Every tool only talks
+// to the configured Home Assistant, so none is open-world.
+
+// queryAnnotations marks a tool that only reads Home Assistant or the server's state
+func queryAnnotations() mcp.ToolOption {
+	return mcp.WithToolAnnotation(mcp.ToolAnnotation{
+		ReadOnlyHint:    mcp.ToBoolPtr(true),
+		DestructiveHint: mcp.ToBoolPtr(false),
+		IdempotentHint:  mcp.ToBoolPtr(true),
+		OpenWorldHint:   mcp.ToBoolPtr(false),
+	})
+}
+
+// controlAnnotations marks a tool that changes devices or the Home Assistant configuration.
+// It is idempotent when repeating a call with the same arguments has no further effect,
+// like turning a light on, unlike pressing a button.
+func controlAnnotations(idempotent bool) mcp.ToolOption {
+	return mcp.WithToolAnnotation(mcp.ToolAnnotation{
+		ReadOnlyHint:    mcp.ToBoolPtr(false),
+		DestructiveHint: mcp.ToBoolPtr(true),
+		IdempotentHint:  mcp.ToBoolPtr(idempotent),
+		OpenWorldHint:   mcp.ToBoolPtr(false),
+	})
+}
+
+// bookkeepingAnnotations marks a tool that only changes the server's own records, such as
+// snapshots and scheduled actions, without touching any device
+func bookkeepingAnnotations(idempotent bool) mcp.ToolOption {
+	return mcp.WithToolAnnotation(mcp.ToolAnnotation{
+		ReadOnlyHint:    mcp.ToBoolPtr(false),
+		DestructiveHint: mcp.ToBoolPtr(false),
+		IdempotentHint:  mcp.ToBoolPtr(idempotent),
+		OpenWorldHint:   mcp.ToBoolPtr(false),
+	})
+}
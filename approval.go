@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long a service call waits for an answer when approval.timeout is not set
+const defaultApprovalTimeout = 2 * time.Minute
+
+// ApprovalConfig holds service calls on dangerous entities until a human approves them,
+// e.g. through an n8n flow that pings the owner's phone
+type ApprovalConfig struct {
+	WebhookURL   string   `json:"webhook_url"`       // receives the approval requests
+	Secret       string   `json:"secret"`            // signs the requests with X-Signature-256, as webhooks do, and the callback URLs
+	Entities     []string `json:"entities"`          // domains, entity IDs, globs or regexes, e.g. ["lock"]
+	CallbackAddr string   `json:"callback_addr"`     // listen address of the approve/deny endpoint, e.g. ":8090"
+	CallbackURL  string   `json:"callback_url"`      // base URL the approver reaches callback_addr at, e.g. "http://bridge.lan:8090"
+	Timeout      string   `json:"timeout,omitempty"` // wait for an answer, 2m when empty
+}
+
+// ApprovalError is returned for a service call that was not approved
+type ApprovalError struct {
+	ID        string
+	EntityIDs []string
+	Service   string // domain.service
+	Outcome   string // "denied", "timed_out" or "failed"
+	Reason    string
+}
+
+func (e *ApprovalError) Error() string {
+	target := fmt.Sprintf("%s on %s", e.Service, strings.Join(e.EntityIDs, ", "))
+	switch e.Outcome {
+	case "denied":
+		return fmt.Sprintf("%s was denied by the approver", target)
+	case "timed_out":
+		return fmt.Sprintf("%s was not approved within %s", target, e.Reason)
+	}
+	return fmt.Sprintf("approval of %s could not be requested: %s", target, e.Reason)
+}
+
+// approvalRequest is the JSON POSTed to approval.webhook_url
+type approvalRequest struct {
+	ID          string                 `json:"approval_id"`
+	Service     string                 `json:"service"`
+	EntityIDs   []string               `json:"entity_ids"`
+	Data        map[string]interface{} `json:"data"`
+	RequestedAt string                 `json:"requested_at"`
+	ExpiresAt   string                 `json:"expires_at"`
+	ApproveURL  string                 `json:"approve_url"`
+	DenyURL     string                 `json:"deny_url"`
+}
+
+// pendingApproval is a service call waiting for its callback
+type pendingApproval struct {
+	request  approvalRequest
+	decision chan bool
+}
+
+// approvalStore holds the pending approvals by ID
+type approvalStore struct {
+	mu      sync.Mutex
+	pending map[string]*pendingApproval
+}
+
+var approvals = &approvalStore{pending: make(map[string]*pendingApproval)}
+
+// newApprovalID returns an ID long enough to not be guessed, since it is all the callback
+// URLs carry
+func newApprovalID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (s *approvalStore) add(pending *pendingApproval) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[pending.request.ID] = pending
+}
+
+func (s *approvalStore) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, id)
+}
+
+// lookup returns the call a pending approval is for
+func (s *approvalStore) lookup(id string) (approvalRequest, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending, exists := s.pending[id]
+	if !exists {
+		return approvalRequest{}, false
+	}
+	return pending.request, true
+}
+
+// decide delivers the approver's answer and reports the call it was for, or false when
+// the approval is unknown, expired or already answered
+func (s *approvalStore) decide(id string, approved bool) (approvalRequest, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending, exists := s.pending[id]
+	if !exists {
+		return approvalRequest{}, false
+	}
+	delete(s.pending, id)
+	pending.decision <- approved
+	return pending.request, true
+}
+
+// compileApproval checks the approval config and returns its entities and timeout
+func compileApproval(config *ApprovalConfig) ([]entityPattern, time.Duration, error) {
+	if config == nil {
+		return nil, 0, nil
+	}
+	switch {
+	case config.WebhookURL == "":
+		return nil, 0, fmt.Errorf("approval: webhook_url is required")
+	case config.Secret == "":
+		return nil, 0, fmt.Errorf("approval: secret is required")
+	case len(config.Entities) == 0:
+		return nil, 0, fmt.Errorf("approval: entities is required")
+	case config.CallbackAddr == "":
+		return nil, 0, fmt.Errorf("approval: callback_addr is required")
+	case config.CallbackURL == "":
+		return nil, 0, fmt.Errorf("approval: callback_url is required")
+	}
+
+	timeout := defaultApprovalTimeout
+	if config.Timeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(config.Timeout)
+		if err != nil || timeout <= 0 {
+			return nil, 0, fmt.Errorf("approval: invalid timeout %q", config.Timeout)
+		}
+	}
+
+	entities, err := compileDomainPatterns("approval.entities", config.Entities)
+	if err != nil {
+		return nil, 0, err
+	}
+	return entities, timeout, nil
+}
+
+// checkApproval holds service calls on approval entities until the approver answers, and
+// returns an ApprovalError unless the call was approved
+func (h *HAService) checkApproval(ctx context.Context, domain, service string, data map[string]interface{}) error {
+	if len(h.approvalEntities) == 0 {
+		return nil
+	}
+	var entityIDs []string
+	for _, entityID := range serviceEntityIDs(data) {
+		if matchesAny(h.approvalEntities, entityID) {
+			entityIDs = append(entityIDs, entityID)
+		}
+	}
+	if len(entityIDs) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	id := newApprovalID()
+	base := strings.TrimSuffix(h.config.Approval.CallbackURL, "/") + "/approvals/" + id
+	pending := &pendingApproval{
+		request: approvalRequest{
+			ID:          id,
+			Service:     domain + "." + service,
+			EntityIDs:   entityIDs,
+			Data:        data,
+			RequestedAt: now.Format(time.RFC3339),
+			ExpiresAt:   now.Add(h.approvalTimeout).Format(time.RFC3339),
+			ApproveURL:  base + "/approve?sig=" + approvalSignature(h.config.Approval.Secret, id, "approve"),
+			DenyURL:     base + "/deny?sig=" + approvalSignature(h.config.Approval.Secret, id, "deny"),
+		},
+		decision: make(chan bool, 1),
+	}
+	approvalErr := &ApprovalError{ID: id, EntityIDs: entityIDs, Service: pending.request.Service}
+
+	approvals.add(pending)
+	defer approvals.remove(id)
+
+	if err := h.sendApprovalRequest(ctx, pending.request); err != nil {
+		h.logger.Printf("Approval request %s for %s on %v failed: %v", id, approvalErr.Service, entityIDs, err)
+		approvalErr.Outcome, approvalErr.Reason = "failed", err.Error()
+		return approvalErr
+	}
+	h.logger.Printf("Waiting up to %v for approval %s of %s on %v", h.approvalTimeout, id, approvalErr.Service, entityIDs)
+
+	timer := time.NewTimer(h.approvalTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		h.logger.Printf("Approval %s timed out", id)
+		approvalErr.Outcome, approvalErr.Reason = "timed_out", h.approvalTimeout.String()
+		return approvalErr
+	case approved := <-pending.decision:
+		if !approved {
+			h.logger.Printf("Approval %s denied", id)
+			approvalErr.Outcome = "denied"
+			return approvalErr
+		}
+		h.logger.Printf("Approval %s granted", id)
+		return nil
+	}
+}
+
+// sendApprovalRequest POSTs the request to the approval webhook once; retrying could
+// ping the approver twice
+func (h *HAService) sendApprovalRequest(ctx context.Context, request approvalRequest) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", h.config.Approval.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ha-mcp-server/"+serverVersion)
+	req.Header.Set("X-Signature-256", "sha256="+signPayload(h.config.Approval.Secret, body))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("approval webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// approvalSignature signs a callback URL, so that only links the server handed out can
+// answer an approval
+func approvalSignature(secret, id, decision string) string {
+	return signPayload(secret, []byte(id+"/"+decision))
+}
+
+// approvalPage asks the approver to confirm the decision, which only a POST carries out:
+// link previews and scanners fetch URLs with GET and must not answer approvals
+var approvalPage = template.Must(template.New("approval").Parse(`<!DOCTYPE html>
+<html>
+<head><meta name="viewport" content="width=device-width, initial-scale=1"><title>{{.Verb}} {{.Service}}</title></head>
+<body>
+<p>{{.Service}} on {{.Entities}}, requested at {{.RequestedAt}}</p>
+<form method="post"><button type="submit">{{.Verb}}</button></form>
+</body>
+</html>
+`))
+
+// startApprovalServer serves the approve and deny callback URLs. Opening one shows a
+// confirmation page; the decision is POSTed from it, or directly by an n8n flow.
+func startApprovalServer(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/approvals/{id}/{decision}", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id, decision := r.PathValue("id"), r.PathValue("decision")
+		var approved bool
+		switch decision {
+		case "approve":
+			approved = true
+		case "deny":
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		signature := approvalSignature(haService.config.Approval.Secret, id, decision)
+		if !hmac.Equal([]byte(r.URL.Query().Get("sig")), []byte(signature)) {
+			http.Error(w, "invalid signature", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+
+		if r.Method == http.MethodGet {
+			request, ok := approvals.lookup(id)
+			if !ok {
+				http.Error(w, "unknown, expired or already answered approval", http.StatusNotFound)
+				return
+			}
+			verb := "Deny"
+			if approved {
+				verb = "Approve"
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			approvalPage.Execute(w, map[string]string{
+				"Verb":        verb,
+				"Service":     request.Service,
+				"Entities":    strings.Join(request.EntityIDs, ", "),
+				"RequestedAt": request.RequestedAt,
+			})
+			return
+		}
+
+		request, ok := approvals.decide(id, approved)
+		if !ok {
+			http.Error(w, "unknown, expired or already answered approval", http.StatusNotFound)
+			return
+		}
+		outcome := "Denied"
+		if approved {
+			outcome = "Approved"
+		}
+		fmt.Fprintf(w, "%s: %s on %s\n", outcome, request.Service, strings.Join(request.EntityIDs, ", "))
+	})
+
+	go func() {
+		haService.logger.Printf("Approval callbacks listening on %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			haService.logger.Printf("Approval server failed: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// AreaWords are the words heuristic_areas looks for in friendly names: area words name
+// rooms ("kitchen", "living room" as two words), device words mark a name that starts with
+// the device rather than the area ("Lamp ...")
+type AreaWords struct {
+	Area   []string `json:"area,omitempty"`
+	Device []string `json:"device,omitempty"`
+}
+
+// Built-in word lists by language, selected with heuristic_area_languages
+var builtinAreaWords = map[string]AreaWords{
+	"en": {
+		Area: []string{
+			"room", "bedroom", "bathroom", "kitchen", "office",
+			"living", "dining", "family", "master", "guest",
+			"hall", "hallway", "entrance", "foyer", "lobby",
+			"garage", "basement", "attic", "closet", "storage",
+			"porch", "patio", "deck", "balcony", "terrace",
+		},
+		Device: []string{
+			"lolin", "nodemcu", "esp", "arduino", "sonoff",
+			"shelly", "zigbee", "zwave", "wifi", "bluetooth",
+			"sensor", "switch", "light", "lamp", "bulb",
+			"device", "module", "controller", "hub",
+		},
+	},
+	"de": {
+		Area: []string{
+			"wohnzimmer", "schlafzimmer", "badezimmer", "bad", "küche", "büro",
+			"esszimmer", "kinderzimmer", "gästezimmer", "arbeitszimmer", "flur", "diele",
+			"eingang", "garage", "keller", "dachboden", "abstellraum", "waschküche",
+			"terrasse", "balkon", "garten", "zimmer",
+		},
+		Device: []string{
+			"licht", "lampe", "leuchte", "schalter", "steckdose", "sensor", "birne",
+			"gerät", "modul", "steuerung",
+		},
+	},
+	"cs": {
+		Area: []string{
+			"obývák", "obývací", "ložnice", "koupelna", "koupelně", "kuchyň", "kuchyně",
+			"kuchyni", "pracovna", "pracovně", "jídelna", "jídelně", "dětský", "dětském",
+			"pokoj", "pokoji", "chodba", "chodbě", "předsíň", "předsíni", "garáž", "garáži",
+			"sklep", "sklepě", "půda", "půdě", "terasa", "terase", "balkon", "balkoně",
+			"zahrada", "zahradě", "dílna", "dílně",
+		},
+		Device: []string{
+			"světlo", "lampa", "lampička", "žárovka", "vypínač", "zásuvka", "senzor",
+			"čidlo", "zařízení", "modul",
+		},
+	},
+	"fr": {
+		Area: []string{
+			"salon", "séjour", "chambre", "salle", "bain", "bains", "cuisine", "bureau",
+			"manger", "entrée", "couloir", "garage", "cave", "grenier", "cellier",
+			"buanderie", "terrasse", "balcon", "jardin", "véranda",
+		},
+		Device: []string{
+			"lumière", "lampe", "plafonnier", "applique", "interrupteur", "prise",
+			"capteur", "ampoule", "appareil", "module",
+		},
+	},
+	"es": {
+		Area: []string{
+			"salón", "salon", "sala", "estar", "dormitorio", "habitación", "baño", "cocina",
+			"oficina", "despacho", "comedor", "entrada", "pasillo", "recibidor", "garaje",
+			"sótano", "ático", "trastero", "terraza", "balcón", "jardín", "patio",
+		},
+		Device: []string{
+			"luz", "lámpara", "lampara", "bombilla", "interruptor", "enchufe", "sensor",
+			"dispositivo", "módulo",
+		},
+	},
+}
+
+// areaWordSet is the compiled, lower-cased word list used by guessAreaFromName
+type areaWordSet struct {
+	area   map[string]bool
+	device []string
+}
+
+// compileAreaWords merges the built-in lists of languages (English when empty) with the
+// configured extra words
+func compileAreaWords(languages []string, extra AreaWords) (*areaWordSet, error) {
+	if len(languages) == 0 {
+		languages = []string{"en"}
+	}
+
+	set := &areaWordSet{area: make(map[string]bool)}
+	add := func(words AreaWords) {
+		for _, word := range words.Area {
+			set.area[strings.ToLower(word)] = true
+		}
+		for _, word := range words.Device {
+			set.device = append(set.device, strings.ToLower(word))
+		}
+	}
+	for _, language := range languages {
+		words, exists := builtinAreaWords[strings.ToLower(strings.TrimSpace(language))]
+		if !exists {
+			known := make([]string, 0, len(builtinAreaWords))
+			for code := range builtinAreaWords {
+				known = append(known, code)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("invalid heuristic_area_languages entry %q: must be one of %s", language, strings.Join(known, ", "))
+		}
+		add(words)
+	}
+	add(extra)
+	return set, nil
+}
+
+func (s *areaWordSet) isAreaWord(word string) bool {
+	return s.area[strings.ToLower(word)]
+}
+
+func (s *areaWordSet) isDeviceName(name string) bool {
+	lowerName := strings.ToLower(name)
+	for _, deviceName := range s.device {
+		if strings.Contains(lowerName, deviceName) {
+			return true
+		}
+	}
+	return false
+}
+
+// guessAreaFromName guesses an area from a friendly name such as "Workshop Light", "Living
+// Room Lamp" or "Lampe Salon"; only used with heuristic_areas. A known area word anywhere in
+// the name wins (with a following area word, e.g. "Living Room"), otherwise the name is
+// assumed to start with the area.
+func (s *areaWordSet) guessAreaFromName(name string) string {
+	parts := strings.Fields(name)
+	if len(parts) < 2 {
+		return ""
+	}
+
+	for i, part := range parts {
+		if !s.isAreaWord(part) {
+			continue
+		}
+		if i+1 < len(parts) && s.isAreaWord(parts[i+1]) {
+			return part + " " + parts[i+1]
+		}
+		return part
+	}
+
+	// Only consider meaningful area names (avoid device names)
+	if possibleArea := parts[0]; len(possibleArea) > 3 && !s.isDeviceName(possibleArea) {
+		return possibleArea
+	}
+	return ""
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// BlueprintInput describes one input of a blueprint
+type BlueprintInput struct {
+	Name        string          `json:"name,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Default     interface{}     `json:"default,omitempty"`
+	Required    bool            `json:"required"`
+	Selector    json.RawMessage `json:"selector,omitempty"`
+}
+
+// Blueprint is an automation blueprint known to HA, identified by its path
+type Blueprint struct {
+	Path        string                    `json:"path"`
+	Name        string                    `json:"name"`
+	Description string                    `json:"description,omitempty"`
+	SourceURL   string                    `json:"source_url,omitempty"`
+	Inputs      map[string]BlueprintInput `json:"inputs"`
+}
+
+// blueprintMetadata is the raw metadata returned by blueprint/list
+type blueprintMetadata struct {
+	Name        string                     `json:"name"`
+	Description string                     `json:"description"`
+	SourceURL   string                     `json:"source_url"`
+	Input       map[string]json.RawMessage `json:"input"`
+}
+
+// flattenInputs collects the inputs of a blueprint; newer blueprints may group inputs into
+// sections, which carry their own input map
+func flattenInputs(raw map[string]json.RawMessage, inputs map[string]BlueprintInput) {
+	for key, data := range raw {
+		var entry struct {
+			BlueprintInput
+			Input map[string]json.RawMessage `json:"input"`
+		}
+		if err := json.Unmarshal(data, &entry); err != nil {
+			continue
+		}
+		if entry.Input != nil {
+			flattenInputs(entry.Input, inputs)
+			continue
+		}
+
+		input := entry.BlueprintInput
+		var fields map[string]json.RawMessage
+		json.Unmarshal(data, &fields)
+		_, hasDefault := fields["default"]
+		input.Required = !hasDefault
+		inputs[key] = input
+	}
+}
+
+// listBlueprints returns the automation blueprints, sorted by path
+func (h *HAService) listBlueprints(ctx context.Context) ([]Blueprint, error) {
+	var result map[string]struct {
+		Metadata *blueprintMetadata `json:"metadata"`
+		Error    string             `json:"error"`
+	}
+	if err := h.ws.CommandInto(ctx, "blueprint/list", map[string]interface{}{"domain": "automation"}, &result); err != nil {
+		return nil, err
+	}
+
+	blueprints := []Blueprint{}
+	for path, entry := range result {
+		if entry.Metadata == nil {
+			h.logger.Printf("Skipping blueprint %s: %s", path, entry.Error)
+			continue
+		}
+		blueprint := Blueprint{
+			Path:        path,
+			Name:        entry.Metadata.Name,
+			Description: entry.Metadata.Description,
+			SourceURL:   entry.Metadata.SourceURL,
+			Inputs:      make(map[string]BlueprintInput),
+		}
+		flattenInputs(entry.Metadata.Input, blueprint.Inputs)
+		blueprints = append(blueprints, blueprint)
+	}
+	sort.Slice(blueprints, func(i, j int) bool {
+		return blueprints[i].Path < blueprints[j].Path
+	})
+	return blueprints, nil
+}
+
+// checkBlueprintInputs rejects unknown inputs and reports missing required ones
+func checkBlueprintInputs(blueprint Blueprint, inputs map[string]interface{}) error {
+	var unknown, missing []string
+	for key := range inputs {
+		if _, ok := blueprint.Inputs[key]; !ok {
+			unknown = append(unknown, key)
+		}
+	}
+	for key, input := range blueprint.Inputs {
+		if _, ok := inputs[key]; input.Required && !ok {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(unknown)
+	sort.Strings(missing)
+
+	var problems []string
+	if len(unknown) > 0 {
+		problems = append(problems, "unknown inputs: "+strings.Join(unknown, ", "))
+	}
+	if len(missing) > 0 {
+		problems = append(problems, "missing required inputs: "+strings.Join(missing, ", "))
+	}
+	if len(problems) > 0 {
+		return &InvalidRequestError{fmt.Sprintf("blueprint %s: %s", blueprint.Path, strings.Join(problems, "; "))}
+	}
+	return nil
+}
+
+// referencedEntityIDs returns the strings in value that look like entity IDs
+func referencedEntityIDs(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		if entityIDPattern.MatchString(v) {
+			return []string{v}
+		}
+	case []interface{}:
+		var ids []string
+		for _, item := range v {
+			ids = append(ids, referencedEntityIDs(item)...)
+		}
+		return ids
+	case map[string]interface{}:
+		var ids []string
+		for _, item := range v {
+			ids = append(ids, referencedEntityIDs(item)...)
+		}
+		return ids
+	}
+	return nil
+}
+
+// createAutomationFromBlueprint saves a new automation using blueprint with inputs through the
+// config API, which also reloads automations, and returns its config ID
+func (h *HAService) createAutomationFromBlueprint(ctx context.Context, path, alias, description string, inputs map[string]interface{}) (string, error) {
+	blueprints, err := h.listBlueprints(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var blueprint *Blueprint
+	for i := range blueprints {
+		if blueprints[i].Path == path {
+			blueprint = &blueprints[i]
+		}
+	}
+	if blueprint == nil {
+		return "", &InvalidRequestError{fmt.Sprintf("blueprint %s not found", path)}
+	}
+	if err := checkBlueprintInputs(*blueprint, inputs); err != nil {
+		return "", err
+	}
+	// The automation must not act on entities the filters hide
+	for _, entityID := range referencedEntityIDs(inputs) {
+		if err := h.checkEntityAccess(ctx, entityID); err != nil {
+			return "", err
+		}
+	}
+
+	id := newID()
+	config := map[string]interface{}{
+		"id":          id,
+		"alias":       alias,
+		"description": description,
+		"use_blueprint": map[string]interface{}{
+			"path":  path,
+			"input": inputs,
+		},
+	}
+
+	resp, err := h.makeHARequest(ctx, "POST", "/api/config/automation/config/"+id, config)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		var body struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		if body.Message != "" {
+			return "", fmt.Errorf("HA API returned status %d: %s", resp.StatusCode, body.Message)
+		}
+		return "", fmt.Errorf("HA API returned status %d", resp.StatusCode)
+	}
+
+	h.logger.Printf("Created automation %q (id %s) from blueprint %s", alias, id, path)
+	return id, nil
+}
+
+// list_blueprints handler
+func listBlueprintsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	blueprints, err := haService.listBlueprints(ctx)
+	if err != nil {
+		return toolError("Failed to list blueprints", err), nil
+	}
+
+	blueprintsJSON, err := json.Marshal(blueprints)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize blueprints: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Found %d automation blueprints:\n%s", len(blueprints), string(blueprintsJSON))), nil
+}
+
+// create_automation_from_blueprint handler
+func createAutomationFromBlueprintHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	path, err := request.RequireString("blueprint")
+	if err != nil {
+		return mcp.NewToolResultError("blueprint parameter is required"), nil
+	}
+	alias, err := request.RequireString("alias")
+	if err != nil {
+		return mcp.NewToolResultError("alias parameter is required"), nil
+	}
+
+	inputs := map[string]interface{}{}
+	if raw, ok := request.GetArguments()["inputs"]; ok {
+		inputs, ok = raw.(map[string]interface{})
+		if !ok {
+			return mcp.NewToolResultError("inputs must be an object of blueprint input values"), nil
+		}
+	}
+
+	id, err := haService.createAutomationFromBlueprint(ctx, path, alias, request.GetString("description", ""), inputs)
+	if err != nil {
+		return toolError("Failed to create automation", err), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Created automation %q (id %s) from blueprint %s", alias, id, path)), nil
+}
@@ -13,6 +13,11 @@ fi
 
 echo "🔧 Building Home Assistant MCP Server..."
 
+# Embed commit and build date (shown by --version and get_server_info)
+COMMIT=$(git rev-parse --short HEAD 2>/dev/null)
+BUILD_DATE=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+LDFLAGS="-X main.buildCommit=${COMMIT} -X main.buildDate=${BUILD_DATE}"
+
 # Initialize go modules if needed
 if [ ! -f "go.sum" ]; then
     echo "📦 Initializing Go modules..."
@@ -21,7 +26,7 @@ fi
 
 # Build for current platform
 echo "🏗️  Building for current platform..."
-go build -o ha-mcp-server main.go
+go build -ldflags "$LDFLAGS" -o ha-mcp-server .
 
 if [ $? -eq 0 ]; then
     echo ""
@@ -55,23 +60,23 @@ if [ "$1" = "all" ]; then
     
     # Linux AMD64
     echo "🐧 Building for Linux AMD64..."
-    GOOS=linux GOARCH=amd64 go build -o ha-mcp-server-linux-amd64 main.go
+    GOOS=linux GOARCH=amd64 go build -ldflags "$LDFLAGS" -o ha-mcp-server-linux-amd64 .
     
     # Linux ARM64
     echo "🐧 Building for Linux ARM64..."
-    GOOS=linux GOARCH=arm64 go build -o ha-mcp-server-linux-arm64 main.go
+    GOOS=linux GOARCH=arm64 go build -ldflags "$LDFLAGS" -o ha-mcp-server-linux-arm64 .
     
     # Windows AMD64
     echo "🪟 Building for Windows AMD64..."
-    GOOS=windows GOARCH=amd64 go build -o ha-mcp-server-windows-amd64.exe main.go
+    GOOS=windows GOARCH=amd64 go build -ldflags "$LDFLAGS" -o ha-mcp-server-windows-amd64.exe .
     
     # macOS AMD64
     echo "🍎 Building for macOS AMD64..."
-    GOOS=darwin GOARCH=amd64 go build -o ha-mcp-server-macos-amd64 main.go
+    GOOS=darwin GOARCH=amd64 go build -ldflags "$LDFLAGS" -o ha-mcp-server-macos-amd64 .
     
     # macOS ARM64 (Apple Silicon)
     echo "🍎 Building for macOS ARM64..."
-    GOOS=darwin GOARCH=arm64 go build -o ha-mcp-server-macos-arm64 main.go
+    GOOS=darwin GOARCH=arm64 go build -ldflags "$LDFLAGS" -o ha-mcp-server-macos-arm64 .
     
     echo ""
     echo "✅ All builds completed!"
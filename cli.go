@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// cliOptions holds the command line flags and subcommand
+type cliOptions struct {
+	command    string // "serve", "validate" or "setup"
+	configFile string
+	logLevel   string
+	transport  string
+	listenAddr string
+	readOnly   bool
+	admin      bool
+	version    bool
+}
+
+// parseCLI parses "[validate|setup] [flags]"
+func parseCLI(args []string, output io.Writer) (cliOptions, error) {
+	opts := cliOptions{command: "serve"}
+	if len(args) > 0 && (args[0] == "validate" || args[0] == "setup") {
+		opts.command = args[0]
+		args = args[1:]
+	}
+
+	flags := flag.NewFlagSet("ha-mcp-server", flag.ContinueOnError)
+	flags.SetOutput(output)
+	flags.Usage = func() {
+		fmt.Fprintf(output, "Usage: ha-mcp-server [validate|setup] [flags]\n\n")
+		fmt.Fprintf(output, "  validate    check configuration, filters, webhooks, MQTT, the schedule file and Home Assistant connectivity, then exit\n")
+		fmt.Fprintf(output, "  setup       interactively create a config file (written to --config or config.json)\n\n")
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&opts.configFile, "config", "", "config file (JSON or YAML); overrides CONFIG_FILE and HA_* environment configuration")
+	flags.StringVar(&opts.logLevel, "log-level", "info", "log level: info or debug (debug logs every HA request)")
+	flags.StringVar(&opts.transport, "transport", transportStdio, "MCP transport: stdio, sse or http (streamable HTTP)")
+	flags.StringVar(&opts.listenAddr, "listen", ":8080", "listen address for the sse and http transports")
+	flags.BoolVar(&opts.readOnly, "read-only", false, "only expose tools that read state and reject every write to Home Assistant")
+	flags.BoolVar(&opts.admin, "admin", false, "offer administrative tools such as reload_integration")
+	flags.BoolVar(&opts.version, "version", false, "print the version and exit")
+
+	if err := flags.Parse(args); err != nil {
+		return opts, err
+	}
+	if flags.NArg() > 0 {
+		return opts, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	switch opts.logLevel {
+	case "info", "debug":
+	default:
+		return opts, fmt.Errorf("invalid --log-level %q (use info or debug)", opts.logLevel)
+	}
+
+	switch opts.transport {
+	case transportStdio, transportSSE, transportHTTP:
+	default:
+		return opts, fmt.Errorf("invalid --transport %q (use stdio, sse or http)", opts.transport)
+	}
+	return opts, nil
+}
+
+// runValidate checks an already loaded configuration and returns the process exit code
+// (filter patterns are compiled, and rejected when invalid, while loading it)
+func runValidate(h *HAService) int {
+	if len(h.config.Webhooks) > 0 {
+		if _, err := newWebhooks(h, h.config.Webhooks); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+			return 1
+		}
+	}
+	if h.config.MQTT != nil {
+		if err := validateMQTTConfig(*h.config.MQTT); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+			return 1
+		}
+	}
+	if _, err := loadScheduledActions(h.scheduleFilePath()); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		return 1
+	}
+	fmt.Println("Configuration OK")
+
+	if err := h.checkConnectivity(context.Background()); err != nil {
+		fmt.Fprintf(os.Stderr, "Connectivity check failed: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Connected to Home Assistant at %s\n", h.config.HAURL)
+	return 0
+}
+
+// writeTools are the tools removed in read-only mode
+var writeTools = []string{
+	"control_entity",
+	"control_multiple_entities",
+	"schedule_action",
+	"restore_snapshot",
+	"create_scene_from_area",
+	"control_climate",
+	"control_water_heater",
+	"control_valve",
+	"press_button",
+	"control_siren",
+	"send_remote_command",
+	"set_entity_value",
+	"control_lawn_mower",
+	"control_irrigation",
+	"run_macro",
+	"enable_scheduled_action",
+}
+
+// adminTools are only offered with admin_tools set, and never in read-only mode
+var adminTools = []string{
+	"reload_integration",
+	"create_automation_from_blueprint",
+	"ha_ws_command",
+	"purge_recorder",
+}
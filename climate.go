@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ClimateDevice is a climate or humidifier entity with its current settings and the
+// modes it supports, as reported by its attributes
+type ClimateDevice struct {
+	EntityID string  `json:"entity_id"`
+	Name     string  `json:"name,omitempty"`
+	Area     *HAArea `json:"area,omitempty"`
+	State    string  `json:"state"`
+
+	HVACModes          interface{} `json:"hvac_modes,omitempty"`
+	HVACAction         interface{} `json:"hvac_action,omitempty"`
+	CurrentTemperature interface{} `json:"current_temperature,omitempty"`
+	Temperature        interface{} `json:"temperature,omitempty"`
+	TargetTempLow      interface{} `json:"target_temp_low,omitempty"`
+	TargetTempHigh     interface{} `json:"target_temp_high,omitempty"`
+	MinTemp            interface{} `json:"min_temp,omitempty"`
+	MaxTemp            interface{} `json:"max_temp,omitempty"`
+	PresetMode         interface{} `json:"preset_mode,omitempty"`
+	PresetModes        interface{} `json:"preset_modes,omitempty"`
+	FanMode            interface{} `json:"fan_mode,omitempty"`
+	FanModes           interface{} `json:"fan_modes,omitempty"`
+	SwingMode          interface{} `json:"swing_mode,omitempty"`
+	SwingModes         interface{} `json:"swing_modes,omitempty"`
+
+	// Shared by climate entities with humidity control and humidifiers
+	CurrentHumidity interface{} `json:"current_humidity,omitempty"`
+	Humidity        interface{} `json:"humidity,omitempty"`
+	MinHumidity     interface{} `json:"min_humidity,omitempty"`
+	MaxHumidity     interface{} `json:"max_humidity,omitempty"`
+
+	// Humidifier only
+	Mode           interface{} `json:"mode,omitempty"`
+	AvailableModes interface{} `json:"available_modes,omitempty"`
+}
+
+func isClimateEntity(entityID string) bool {
+	return strings.HasPrefix(entityID, "climate.") || strings.HasPrefix(entityID, "humidifier.")
+}
+
+func climateDevice(state HAState) ClimateDevice {
+	attrs := state.Attributes
+	return ClimateDevice{
+		EntityID:           state.EntityID,
+		Name:               formatValue(attrs["friendly_name"]),
+		Area:               state.Area,
+		State:              state.State,
+		HVACModes:          attrs["hvac_modes"],
+		HVACAction:         attrs["hvac_action"],
+		CurrentTemperature: attrs["current_temperature"],
+		Temperature:        attrs["temperature"],
+		TargetTempLow:      attrs["target_temp_low"],
+		TargetTempHigh:     attrs["target_temp_high"],
+		MinTemp:            attrs["min_temp"],
+		MaxTemp:            attrs["max_temp"],
+		PresetMode:         attrs["preset_mode"],
+		PresetModes:        attrs["preset_modes"],
+		FanMode:            attrs["fan_mode"],
+		FanModes:           attrs["fan_modes"],
+		SwingMode:          attrs["swing_mode"],
+		SwingModes:         attrs["swing_modes"],
+		CurrentHumidity:    attrs["current_humidity"],
+		Humidity:           attrs["humidity"],
+		MinHumidity:        attrs["min_humidity"],
+		MaxHumidity:        attrs["max_humidity"],
+		Mode:               attrs["mode"],
+		AvailableModes:     attrs["available_modes"],
+	}
+}
+
+// checkMode verifies that value is listed in the entity's modes attribute; entities that
+// don't list their modes are left for HA to validate
+func checkMode(state *HAState, param, attribute, value string) error {
+	modes, ok := state.Attributes[attribute].([]interface{})
+	if !ok {
+		return nil
+	}
+	available := make([]string, 0, len(modes))
+	for _, mode := range modes {
+		name := formatValue(mode)
+		if name == value {
+			return nil
+		}
+		available = append(available, name)
+	}
+	return &InvalidRequestError{fmt.Sprintf("unsupported %s %q for %s; available: %s",
+		param, value, state.EntityID, strings.Join(available, ", "))}
+}
+
+// climateSteps turns the control_climate arguments into service calls, validating modes
+// against the entity's attributes
+func climateSteps(state *HAState, request mcp.CallToolRequest) ([]serviceStep, error) {
+	domain, _, _ := strings.Cut(state.EntityID, ".")
+	args := request.GetArguments()
+	var calls []serviceStep
+
+	switch action := request.GetString("action", ""); action {
+	case "":
+	case "on", "turn_on":
+		calls = append(calls, serviceStep{service: "turn_on"})
+	case "off", "turn_off":
+		calls = append(calls, serviceStep{service: "turn_off"})
+	default:
+		return nil, &InvalidRequestError{fmt.Sprintf("unsupported action: %s", action)}
+	}
+
+	modes := []struct{ param, attribute, service string }{
+		{"hvac_mode", "hvac_modes", "set_hvac_mode"},
+		{"preset_mode", "preset_modes", "set_preset_mode"},
+		{"fan_mode", "fan_modes", "set_fan_mode"},
+		{"swing_mode", "swing_modes", "set_swing_mode"},
+	}
+	if domain == "humidifier" {
+		modes = []struct{ param, attribute, service string }{
+			{"mode", "available_modes", "set_mode"},
+		}
+	}
+	for _, mode := range modes {
+		value := request.GetString(mode.param, "")
+		if value == "" {
+			continue
+		}
+		if err := checkMode(state, mode.param, mode.attribute, value); err != nil {
+			return nil, err
+		}
+		calls = append(calls, serviceStep{service: mode.service, data: map[string]interface{}{mode.param: value}})
+	}
+
+	if domain == "climate" {
+		temperature := map[string]interface{}{}
+		for _, key := range []string{"temperature", "target_temp_low", "target_temp_high"} {
+			if _, ok := args[key]; ok {
+				temperature[key] = request.GetFloat(key, 0)
+			}
+		}
+		if len(temperature) > 0 {
+			calls = append(calls, serviceStep{service: "set_temperature", data: temperature})
+		}
+	}
+
+	if _, ok := args["humidity"]; ok {
+		calls = append(calls, serviceStep{service: "set_humidity", data: map[string]interface{}{"humidity": request.GetInt("humidity", 0)}})
+	}
+
+	for _, param := range unsupportedClimateParams(domain) {
+		if _, ok := args[param]; ok {
+			return nil, &InvalidRequestError{fmt.Sprintf("%s is not supported by %s entities", param, domain)}
+		}
+	}
+	if len(calls) == 0 {
+		return nil, &InvalidRequestError{"nothing to change: give an action, a mode, a temperature or a humidity"}
+	}
+	return calls, nil
+}
+
+// unsupportedClimateParams lists the control_climate arguments that don't apply to domain
+func unsupportedClimateParams(domain string) []string {
+	if domain == "humidifier" {
+		return []string{"hvac_mode", "preset_mode", "fan_mode", "swing_mode", "temperature", "target_temp_low", "target_temp_high"}
+	}
+	return []string{"mode"}
+}
+
+// get_climate handler
+func getClimateHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	area := request.GetString("area", "")
+	maxAge := time.Duration(request.GetFloat("max_age", 0) * float64(time.Second))
+
+	states, err := haService.getRawStates(ctx, maxAge)
+	if err != nil {
+		return toolError("Failed to get states", err), nil
+	}
+
+	var climate []HAState
+	for _, state := range states {
+		if isClimateEntity(state.EntityID) {
+			climate = append(climate, state)
+		}
+	}
+
+	devices := []ClimateDevice{}
+	for _, state := range haService.exposeStates(ctx, climate) {
+		if area == "" || matchesArea(state.Area, area) {
+			devices = append(devices, climateDevice(state))
+		}
+	}
+
+	devicesJSON, err := json.Marshal(devices)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize climate devices: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Found %d climate and humidifier entities:\n%s", len(devices), string(devicesJSON))), nil
+}
+
+// control_climate handler
+func controlClimateHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	entityID, err := haService.resolveDomainEntity(ctx, request, "climate", "humidifier")
+	if err != nil {
+		return toolError("Failed to control climate", err), nil
+	}
+	state, err := haService.fetchEntityState(ctx, entityID, 0)
+	if err != nil {
+		return toolError("Failed to get entity state", err), nil
+	}
+
+	calls, err := climateSteps(state, request)
+	if err != nil {
+		return toolError("Failed to control climate", err), nil
+	}
+
+	domain, _, _ := strings.Cut(entityID, ".")
+	return runServiceCalls(ctx, domain, entityID, calls, "Failed to control climate"), nil
+}
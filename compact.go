@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Shorter keys used by compact_responses
+var compactKeys = map[string]string{
+	"entity_id":            "id",
+	"attributes":           "attr",
+	"friendly_name":        "name",
+	"unit_of_measurement":  "unit",
+	"device_class":         "class",
+	"capabilities":         "caps",
+	"seconds_since_change": "age_s",
+	"state_for":            "for",
+	"last_changed":         "changed",
+	"last_updated":         "updated",
+}
+
+// Attributes compact_responses leaves out: presentation details agents don't act on
+var compactDroppedKeys = map[string]bool{
+	"icon":                  true,
+	"entity_picture":        true,
+	"attribution":           true,
+	"supported_features":    true,
+	"supported_color_modes": true,
+	"context":               true,
+}
+
+// Timestamps compact_responses leaves out unless the call sets include_timestamps
+var compactTimestampKeys = map[string]bool{
+	"last_changed":  true,
+	"last_updated":  true,
+	"last_reported": true,
+}
+
+// includeTimestampsParam declares the include_timestamps argument of the state tools
+func includeTimestampsParam() mcp.ToolOption {
+	return mcp.WithBoolean("include_timestamps",
+		mcp.Description("Keep last_changed and last_updated when the server runs with compact_responses (default: false)"),
+	)
+}
+
+// compactMiddleware shrinks the JSON in tool results when compact_responses is set, for
+// small-context models
+func compactMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := next(ctx, request)
+		if err != nil || result == nil || !haService.config.CompactResponses {
+			return result, err
+		}
+
+		timestamps := request.GetBool("include_timestamps", false)
+		for i, content := range result.Content {
+			if text, ok := content.(mcp.TextContent); ok {
+				text.Text = compactText(text.Text, timestamps)
+				result.Content[i] = text
+			}
+		}
+		return result, nil
+	}
+}
+
+// compactText compacts a "summary:\n<json>" result, or a result that is all JSON; other
+// text, such as CSV or markdown, is returned unchanged
+func compactText(text string, timestamps bool) string {
+	summary, body, found := strings.Cut(text, "\n")
+	if !found || !json.Valid([]byte(body)) {
+		summary, body = "", text
+		if !json.Valid([]byte(body)) {
+			return text
+		}
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber() // keep integers as they are
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return text
+	}
+	value = compactValue("", value, timestamps)
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return text
+	}
+	compacted := strings.TrimSuffix(buf.String(), "\n")
+
+	if summary == "" {
+		return compacted
+	}
+	if counts := stateCounts(value); counts != "" {
+		summary = strings.TrimSuffix(summary, ":") + " (" + counts + "):"
+	}
+	return summary + "\n" + compacted
+}
+
+// compactValue drops nulls, empty values and noise keys, flattens areas to their name and
+// shortens keys
+func compactValue(key string, value interface{}, timestamps bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		// {"area_id": "kitchen", "name": "Kitchen"} says no more than "Kitchen"
+		if name, ok := v["name"].(string); ok && key == "area" {
+			return name
+		}
+		compacted := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			if compactDroppedKeys[k] || (compactTimestampKeys[k] && !timestamps) {
+				continue
+			}
+			item = compactValue(k, item, timestamps)
+			if isEmptyValue(item) {
+				continue
+			}
+			if short, ok := compactKeys[k]; ok {
+				if _, taken := v[short]; !taken {
+					k = short
+				}
+			}
+			compacted[k] = item
+		}
+		return compacted
+	case []interface{}:
+		compacted := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			compacted = append(compacted, compactValue(key, item, timestamps))
+		}
+		return compacted
+	}
+	return value
+}
+
+func isEmptyValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case map[string]interface{}:
+		return len(v) == 0
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+// stateCounts summarizes a list of compacted states by state, most common first, e.g.
+// "on 3, off 9"
+func stateCounts(value interface{}) string {
+	items, ok := value.([]interface{})
+	if !ok || len(items) < 2 {
+		return ""
+	}
+
+	counts := make(map[string]int)
+	for _, item := range items {
+		entity, ok := item.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		state, ok := entity["state"].(string)
+		if !ok {
+			return ""
+		}
+		counts[state]++
+	}
+
+	states := make([]string, 0, len(counts))
+	for state := range counts {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if counts[states[i]] != counts[states[j]] {
+			return counts[states[i]] > counts[states[j]]
+		}
+		return states[i] < states[j]
+	})
+
+	// The long tail of sensor values says nothing
+	const maxCounts = 5
+	parts := make([]string, 0, maxCounts+1)
+	for i, state := range states {
+		if i == maxCounts {
+			parts = append(parts, fmt.Sprintf("%d other states", len(states)-maxCounts))
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%s %d", state, counts[state]))
+	}
+	return strings.Join(parts, ", ")
+}
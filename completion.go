@@ -0,0 +1,369 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Most values one completion/complete response may carry, per the MCP spec
+const maxCompletionValues = 100
+
+// How old the cached states may be that entity completions are drawn from
+const completionMaxAge = time.Minute
+
+const methodComplete = "completion/complete"
+
+// completeArgument suggests values for an entity_id, entity_ids, area or scene argument:
+// those starting with value, with or without the domain, first, then those containing it
+// in their ID or name. It
+// returns at most maxCompletionValues values and the number of matches.
+func (h *HAService) completeArgument(ctx context.Context, argument, value string) ([]string, int) {
+	type candidate struct{ id, name string }
+	var candidates []candidate
+
+	switch argument {
+	case "entity_id", "entity_ids", "scene":
+		states, err := h.getRawStates(ctx, completionMaxAge)
+		if err != nil {
+			h.logger.Printf("Completion of %s failed: %v", argument, err)
+			return nil, 0
+		}
+		for _, state := range h.filterExposed(ctx, states) {
+			if argument == "scene" && !strings.HasPrefix(state.EntityID, "scene.") {
+				continue
+			}
+			name, _ := state.Attributes["friendly_name"].(string)
+			candidates = append(candidates, candidate{state.EntityID, name})
+		}
+	case "area":
+		if err := h.updateAreaCache(ctx); err != nil {
+			h.logger.Printf("Completion of area failed: %v", err)
+			return nil, 0
+		}
+		profile, enforced := profileFromContext(ctx)
+		if enforced && profile == nil {
+			return nil, 0
+		}
+		areaCache.mu.RLock()
+		// A profile sees the areas holding an entity it may use
+		var profileAreas map[string]bool
+		if enforced {
+			profileAreas = make(map[string]bool)
+			for entityID, areaID := range areaCache.entities {
+				if profile.allowsEntity(entityID) {
+					profileAreas[areaID] = true
+				}
+			}
+		}
+		for _, area := range areaCache.areas {
+			if !h.isAreaAllowed(area) || (enforced && !profileAreas[area.AreaID]) {
+				continue
+			}
+			candidates = append(candidates, candidate{area.AreaID, area.Name})
+		}
+		areaCache.mu.RUnlock()
+	default:
+		return nil, 0
+	}
+
+	value = strings.ToLower(strings.TrimSpace(value))
+	var prefixed, contained []string
+	for _, c := range candidates {
+		id := strings.ToLower(c.id)
+		_, objectID, _ := strings.Cut(id, ".")
+		switch {
+		case strings.HasPrefix(id, value) || strings.HasPrefix(objectID, value):
+			prefixed = append(prefixed, c.id)
+		case strings.Contains(id, value) || strings.Contains(strings.ToLower(c.name), value):
+			contained = append(contained, c.id)
+		}
+	}
+	sort.Strings(prefixed)
+	sort.Strings(contained)
+
+	values := append(prefixed, contained...)
+	total := len(values)
+	if total > maxCompletionValues {
+		values = values[:maxCompletionValues]
+	}
+	return values, total
+}
+
+// isCompletionRequest reports whether raw is a completion/complete request
+func isCompletionRequest(raw []byte) bool {
+	if !bytes.Contains(raw, []byte(methodComplete)) {
+		return false
+	}
+	var message struct {
+		Method string `json:"method"`
+	}
+	return json.Unmarshal(raw, &message) == nil && message.Method == methodComplete
+}
+
+// completionMessage answers a JSON-RPC completion/complete request, which the MCP library
+// doesn't route to the server. Suggestions go by argument name, so they serve the
+// resource templates as well as clients asking about tool arguments. It returns nil for
+// any other message.
+func completionMessage(ctx context.Context, raw []byte) []byte {
+	var request struct {
+		ID     mcp.RequestId      `json:"id"`
+		Method string             `json:"method"`
+		Params mcp.CompleteParams `json:"params"`
+	}
+	if err := json.Unmarshal(raw, &request); err != nil || request.Method != methodComplete {
+		return nil
+	}
+
+	var result mcp.CompleteResult
+	result.Completion.Values, result.Completion.Total = haService.completeArgument(ctx, request.Params.Argument.Name, request.Params.Argument.Value)
+	if result.Completion.Values == nil {
+		result.Completion.Values = []string{}
+	}
+	result.Completion.HasMore = result.Completion.Total > len(result.Completion.Values)
+
+	response, _ := json.Marshal(mcp.JSONRPCResponse{JSONRPC: mcp.JSONRPC_VERSION, ID: request.ID, Result: result})
+	return response
+}
+
+// advertiseCompletionsSSE adds the completions capability to an initialize result sent as
+// a server-sent event stream
+func advertiseCompletionsSSE(stream []byte) []byte {
+	lines := bytes.Split(stream, []byte("\n"))
+	for i, line := range lines {
+		data, found := bytes.CutPrefix(line, []byte("data:"))
+		if !found {
+			continue
+		}
+		data = bytes.TrimSpace(data)
+		lines[i] = append([]byte("data: "), advertiseCompletions(data)...)
+	}
+	return bytes.Join(lines, []byte("\n"))
+}
+
+// advertiseCompletions adds the completions capability to the server's initialize result
+func advertiseCompletions(raw []byte) []byte {
+	if !bytes.Contains(raw, []byte(`"protocolVersion"`)) {
+		return raw
+	}
+	var message map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &message); err != nil || message["result"] == nil {
+		return raw
+	}
+	var result map[string]json.RawMessage
+	if err := json.Unmarshal(message["result"], &result); err != nil || result["protocolVersion"] == nil {
+		return raw
+	}
+	var capabilities map[string]json.RawMessage
+	if err := json.Unmarshal(result["capabilities"], &capabilities); err != nil {
+		return raw
+	}
+
+	capabilities["completions"] = json.RawMessage("{}")
+	result["capabilities"], _ = json.Marshal(capabilities)
+	message["result"], _ = json.Marshal(result)
+	rewritten, err := json.Marshal(message)
+	if err != nil {
+		return raw
+	}
+	return rewritten
+}
+
+// completionWriter passes the server's newline-delimited messages through, adding the
+// completions capability to the initialize result, and serializes them with the
+// completion responses
+type completionWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	partial []byte
+}
+
+// writeMessage writes a complete message of our own between the server's messages
+func (c *completionWriter) writeMessage(message []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.w.Write(append(message, '\n'))
+	return err
+}
+
+func (c *completionWriter) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.partial = append(c.partial, p...)
+	for {
+		i := bytes.IndexByte(c.partial, '\n')
+		if i < 0 {
+			return len(p), nil
+		}
+		line := advertiseCompletions(c.partial[:i])
+		if _, err := c.w.Write(append(line, '\n')); err != nil {
+			return 0, err
+		}
+		c.partial = c.partial[i+1:]
+	}
+}
+
+// serveStdio runs the stdio transport like server.ServeStdio, answering completion
+// requests before they reach the server. They are answered in the background, so a slow
+// state read doesn't hold up the messages after them.
+func serveStdio(s *server.MCPServer) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer cancel()
+
+	out := &completionWriter{w: os.Stdout}
+	in, forward := io.Pipe()
+	go func() {
+		reader := bufio.NewReader(os.Stdin)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				if isCompletionRequest(line) {
+					go func(line []byte) {
+						if response := completionMessage(ctx, line); response != nil {
+							out.writeMessage(response)
+						}
+					}(line)
+				} else if _, werr := forward.Write(line); werr != nil {
+					return
+				}
+			}
+			if err != nil {
+				forward.CloseWithError(err)
+				return
+			}
+		}
+	}()
+
+	return server.NewStdioServer(s).Listen(ctx, in, out)
+}
+
+// completionHandler answers completion requests on the streamable HTTP transport and adds
+// the completions capability to its initialize result, whether that is sent as JSON or as
+// an event stream
+func completionHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "failed to read request", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if response := completionMessage(haService.profileContextFunc(r.Context(), r), body); response != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(response)
+			return
+		}
+
+		var message struct {
+			Method string `json:"method"`
+		}
+		if json.Unmarshal(body, &message) != nil || message.Method != string(mcp.MethodInitialize) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		recorder := &responseRecorder{header: make(http.Header), status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		for key, values := range recorder.header {
+			w.Header()[key] = values
+		}
+		response := recorder.body.Bytes()
+		switch contentType := recorder.header.Get("Content-Type"); {
+		case strings.HasPrefix(contentType, "application/json"):
+			response = advertiseCompletions(bytes.TrimSpace(response))
+			w.Header().Del("Content-Length")
+		case strings.HasPrefix(contentType, "text/event-stream"):
+			response = advertiseCompletionsSSE(response)
+			w.Header().Del("Content-Length")
+		}
+		w.WriteHeader(recorder.status)
+		w.Write(response)
+	})
+}
+
+// sseCompletionHandler answers completion requests on the legacy SSE transport: a message
+// posted for a session is acknowledged and its result sent down that session's event stream,
+// where the initialize result also gets the completions capability
+func sseCompletionHandler(sse *server.SSEServer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			if flusher, ok := w.(http.Flusher); ok {
+				w = &completionStreamWriter{ResponseWriter: w, flusher: flusher}
+			}
+			sse.ServeHTTP(w, r)
+			return
+		}
+
+		sessionID := r.URL.Query().Get("sessionId")
+		if r.Method != http.MethodPost || sessionID == "" {
+			sse.ServeHTTP(w, r)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "failed to read request", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		response := completionMessage(haService.profileContextFunc(r.Context(), r), body)
+		if response == nil {
+			sse.ServeHTTP(w, r)
+			return
+		}
+		if err := sse.SendEventToSession(sessionID, json.RawMessage(response)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// completionStreamWriter adds the completions capability to the initialize result written
+// to an SSE session's event stream; the server writes each event in one call
+type completionStreamWriter struct {
+	http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (w *completionStreamWriter) Write(p []byte) (int, error) {
+	if !bytes.Contains(p, []byte(`"protocolVersion"`)) {
+		return w.ResponseWriter.Write(p)
+	}
+	if _, err := w.ResponseWriter.Write(advertiseCompletionsSSE(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *completionStreamWriter) Flush() { w.flusher.Flush() }
+
+// responseRecorder buffers a response so it can be rewritten
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header         { return r.header }
+func (r *responseRecorder) Write(p []byte) (int, error) { return r.body.Write(p) }
+func (r *responseRecorder) WriteHeader(status int)      { r.status = status }
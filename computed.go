@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Domain of the virtual entities defined in computed_entities
+const computedDomain = "computed"
+
+// ComputedEntity is a virtual entity whose state is derived from other entities, either by
+// a Jinja template HA renders or by an expression the bridge evaluates over cached states
+type ComputedEntity struct {
+	Name       string `json:"name"`                 // becomes computed.<name>, e.g. "Any window open" -> computed.any_window_open
+	Template   string `json:"template,omitempty"`   // e.g. "{{ states.binary_sensor | selectattr('state', 'eq', 'on') | list | count }}"
+	Expression string `json:"expression,omitempty"` // e.g. any("binary_sensor.*window*", "on")
+	Unit       string `json:"unit,omitempty"`       // reported as unit_of_measurement
+}
+
+// computedExpression is a parsed expression: function(pattern[, state])
+type computedExpression struct {
+	function string
+	patterns []entityPattern
+	state    string
+}
+
+// computedEntity is a compiled ComputedEntity
+type computedEntity struct {
+	ComputedEntity
+	entityID   string
+	expression *computedExpression
+}
+
+// Expression functions; any and all need a state, sum, avg, min and max read numeric states
+var computedFunctions = map[string]bool{"any": true, "all": true, "count": true, "sum": true, "avg": true, "min": true, "max": true}
+
+var computedExpressionPattern = regexp.MustCompile(`^\s*([a-z]+)\(\s*"([^"]+)"\s*(?:,\s*"([^"]*)"\s*)?\)\s*$`)
+
+// computedEntityID turns a name into the object ID of its virtual entity
+func computedEntityID(name string) string {
+	var b strings.Builder
+	for _, r := range normalizeName(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteRune('_')
+		}
+	}
+	return computedDomain + "." + b.String()
+}
+
+// parseComputedExpression parses function("pattern") or function("pattern", "state"); the
+// pattern is an entity ID, glob or regex as in entity_filter
+func parseComputedExpression(expression string) (*computedExpression, error) {
+	match := computedExpressionPattern.FindStringSubmatch(expression)
+	if match == nil {
+		return nil, fmt.Errorf(`expected function("pattern") or function("pattern", "state")`)
+	}
+	function, pattern, state := match[1], match[2], match[3]
+	if !computedFunctions[function] {
+		return nil, fmt.Errorf("unknown function %s, use any, all, count, sum, avg, min or max", function)
+	}
+	if (function == "any" || function == "all") && state == "" {
+		return nil, fmt.Errorf("%s needs a state to compare with", function)
+	}
+
+	patterns, err := compilePatterns("expression", []string{pattern})
+	if err != nil {
+		return nil, err
+	}
+	return &computedExpression{function: function, patterns: patterns, state: state}, nil
+}
+
+// compileComputedEntities validates computed_entities at config load
+func compileComputedEntities(entities []ComputedEntity) ([]computedEntity, error) {
+	var compiled []computedEntity
+	seen := make(map[string]bool)
+	for _, entity := range entities {
+		entityID := computedEntityID(entity.Name)
+		if entityID == computedDomain+"." {
+			return nil, fmt.Errorf("computed_entities: name is required")
+		}
+		if seen[entityID] {
+			return nil, fmt.Errorf("computed_entities: %s is defined twice", entityID)
+		}
+		seen[entityID] = true
+
+		c := computedEntity{ComputedEntity: entity, entityID: entityID}
+		switch {
+		case (entity.Template == "") == (entity.Expression == ""):
+			return nil, fmt.Errorf("computed_entities: %s needs either a template or an expression", entityID)
+		case entity.Expression != "":
+			expression, err := parseComputedExpression(entity.Expression)
+			if err != nil {
+				return nil, fmt.Errorf("computed_entities: invalid expression for %s: %v", entityID, err)
+			}
+			c.expression = expression
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// evaluate applies the expression to the states matching its pattern
+func (e *computedExpression) evaluate(states []HAState) (string, error) {
+	var matched, inState int
+	var values []float64
+	for _, state := range states {
+		if !matchesAny(e.patterns, state.EntityID) {
+			continue
+		}
+		matched++
+		if e.state != "" && strings.EqualFold(state.State, e.state) {
+			inState++
+		}
+		if value, err := strconv.ParseFloat(state.State, 64); err == nil {
+			values = append(values, value)
+		}
+	}
+
+	formatNumber := func(value float64) string {
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+
+	switch e.function {
+	case "any":
+		return onOff(inState > 0), nil
+	case "all":
+		return onOff(matched > 0 && inState == matched), nil
+	case "count":
+		if e.state != "" {
+			return strconv.Itoa(inState), nil
+		}
+		return strconv.Itoa(matched), nil
+	}
+
+	if len(values) == 0 {
+		return "", fmt.Errorf("no entity matching the pattern has a numeric state")
+	}
+	result := values[0]
+	for _, value := range values[1:] {
+		switch e.function {
+		case "sum", "avg":
+			result += value
+		case "min":
+			result = min(result, value)
+		case "max":
+			result = max(result, value)
+		}
+	}
+	if e.function == "avg" {
+		result /= float64(len(values))
+	}
+	return formatNumber(result), nil
+}
+
+// onOff renders a boolean the way HA reports binary sensors
+func onOff(value bool) string {
+	if value {
+		return "on"
+	}
+	return "off"
+}
+
+// renderTemplate has HA render a Jinja template
+func (h *HAService) renderTemplate(ctx context.Context, template string) (string, error) {
+	resp, err := h.makeHARequest(ctx, "POST", "/api/template", map[string]string{"template": template})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("HA API returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return strings.TrimSpace(string(body)), nil
+}
+
+// findComputed returns the computed entity with entityID, if one is configured
+func (h *HAService) findComputed(entityID string) *computedEntity {
+	for i := range h.computed {
+		if h.computed[i].entityID == entityID {
+			return &h.computed[i]
+		}
+	}
+	return nil
+}
+
+// evaluateComputed builds the state of a computed entity; exposed holds the states visible
+// to the caller, read when the first expression needs them. A failed evaluation is
+// reported as unavailable with an error attribute rather than failing the whole read.
+func (h *HAService) evaluateComputed(ctx context.Context, c *computedEntity, exposed func() ([]HAState, error)) HAState {
+	now := time.Now().Format(time.RFC3339)
+	state := HAState{
+		EntityID:    c.entityID,
+		Attributes:  map[string]interface{}{"friendly_name": c.Name},
+		LastChanged: now,
+		LastUpdated: now,
+	}
+	if c.Unit != "" {
+		state.Attributes["unit_of_measurement"] = c.Unit
+	}
+
+	var value string
+	var err error
+	if c.expression != nil {
+		state.Attributes["expression"] = c.Expression
+		var states []HAState
+		states, err = exposed()
+		if err == nil {
+			value, err = c.expression.evaluate(states)
+		}
+	} else {
+		state.Attributes["template"] = c.Template
+		value, err = h.renderTemplate(ctx, c.Template)
+	}
+
+	if err != nil {
+		h.logger.Printf("Failed to compute %s: %v", c.entityID, err)
+		state.State = "unavailable"
+		state.Attributes["error"] = err.Error()
+		return state
+	}
+	state.State = value
+	return state
+}
+
+// computedStates evaluates every computed entity; expressions only see the entities the
+// filters and the caller's profile expose
+func (h *HAService) computedStates(ctx context.Context, maxAge time.Duration) []HAState {
+	if len(h.computed) == 0 {
+		return nil
+	}
+
+	var exposed []HAState
+	var exposedErr error
+	loaded := false
+	load := func() ([]HAState, error) {
+		if !loaded {
+			loaded = true
+			exposed, exposedErr = h.getRawStates(ctx, maxAge)
+			if exposedErr == nil {
+				exposed = h.filterExposed(ctx, exposed)
+			}
+		}
+		return exposed, exposedErr
+	}
+
+	states := make([]HAState, 0, len(h.computed))
+	for i := range h.computed {
+		states = append(states, h.evaluateComputed(ctx, &h.computed[i], load))
+	}
+	return states
+}
+
+// computedState evaluates one computed entity
+func (h *HAService) computedState(ctx context.Context, c *computedEntity, maxAge time.Duration) HAState {
+	return h.evaluateComputed(ctx, c, func() ([]HAState, error) {
+		states, err := h.getRawStates(ctx, maxAge)
+		if err != nil {
+			return nil, err
+		}
+		return h.filterExposed(ctx, states), nil
+	})
+}
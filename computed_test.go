@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Template-based computed entities only read, so they keep working in read-only mode
+// while service calls are still rejected
+func TestComputedTemplateReadOnly(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/api/template" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("3\n"))
+	}))
+	defer ts.Close()
+
+	h := NewHAService()
+	h.config.HAURL = ts.URL
+	h.config.ReadOnly = true
+
+	computed, err := compileComputedEntities([]ComputedEntity{{Name: "Open windows", Template: "{{ 3 }}"}})
+	if err != nil {
+		t.Fatalf("compileComputedEntities failed: %v", err)
+	}
+	state := h.evaluateComputed(context.Background(), &computed[0], nil)
+	if state.State != "3" {
+		t.Errorf("computed.open_windows is %q (error %v), want 3", state.State, state.Attributes["error"])
+	}
+
+	if err := h.callService(context.Background(), "light", "turn_on", map[string]interface{}{"entity_id": "light.kitchen"}); !errors.Is(err, errReadOnly) {
+		t.Errorf("callService in read-only mode returned %v, want errReadOnly", err)
+	}
+}
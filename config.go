@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configFileNames are tried in order in the executable directory when CONFIG_FILE is unset
+var configFileNames = []string{"config.json", "config.yaml", "config.yml"}
+
+// envRefPattern matches ${VAR} and ${VAR:-default} references in config string values
+var envRefPattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// findConfigFile returns the first existing default config file, or config.json if none exists
+func (h *HAService) findConfigFile() string {
+	for _, name := range configFileNames {
+		path := filepath.Join(h.executableDir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(h.executableDir, configFileNames[0])
+}
+
+// parseConfig decodes a JSON or YAML config file, expands ${ENV_VAR} references in
+// string values and checks every key against the Config schema
+func parseConfig(path string, data []byte, config *Config) error {
+	var tree interface{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &tree); err != nil {
+			return err
+		}
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&tree); err != nil {
+			return err
+		}
+	}
+
+	if tree == nil {
+		return fmt.Errorf("config is empty")
+	}
+
+	tree, err := interpolateEnv(tree, "")
+	if err != nil {
+		return err
+	}
+
+	normalized, err := json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(normalized))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(config); err != nil {
+		return describeConfigError(err)
+	}
+	return nil
+}
+
+// interpolateEnv walks a decoded config tree replacing ${VAR} references in strings
+func interpolateEnv(value interface{}, key string) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		var missing string
+		expanded := envRefPattern.ReplaceAllStringFunc(v, func(ref string) string {
+			match := envRefPattern.FindStringSubmatch(ref)
+			if env, ok := os.LookupEnv(match[1]); ok {
+				return env
+			}
+			if strings.Contains(ref, ":-") {
+				return match[2]
+			}
+			if missing == "" {
+				missing = match[1]
+			}
+			return ""
+		})
+		if missing != "" {
+			return nil, fmt.Errorf("key %q: environment variable %s is not set", key, missing)
+		}
+		return expanded, nil
+
+	case map[string]interface{}:
+		for k, item := range v {
+			expanded, err := interpolateEnv(item, joinConfigKey(key, k))
+			if err != nil {
+				return nil, err
+			}
+			v[k] = expanded
+		}
+		return v, nil
+
+	case []interface{}:
+		for i, item := range v {
+			expanded, err := interpolateEnv(item, fmt.Sprintf("%s[%d]", key, i))
+			if err != nil {
+				return nil, err
+			}
+			v[i] = expanded
+		}
+		return v, nil
+	}
+	return value, nil
+}
+
+func joinConfigKey(parent, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+// describeConfigError rewrites JSON decoding errors in terms of config keys
+func describeConfigError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return fmt.Errorf("key %q: expected %s, got %s", typeErr.Field, typeErr.Type, typeErr.Value)
+	}
+
+	// encoding/json reports unknown keys only as a message
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		return fmt.Errorf("unknown key %s", field)
+	}
+	return err
+}
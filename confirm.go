@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// How long a confirmation token stays valid
+const confirmationWindow = 60 * time.Second
+
+// ConfirmationRequiredError is returned for the first call touching a confirm_entities
+// entity; repeating the same call with Token carries it out
+type ConfirmationRequiredError struct {
+	Token    string
+	EntityID string
+	Service  string // domain.service
+}
+
+func (e *ConfirmationRequiredError) Error() string {
+	return fmt.Sprintf("%s on %s needs confirmation: repeat the same call with confirmation_token %q within %d seconds",
+		e.Service, e.EntityID, e.Token, int(confirmationWindow.Seconds()))
+}
+
+// pendingConfirmation is an issued token, valid for one call fingerprint
+type pendingConfirmation struct {
+	fingerprint string
+	expires     time.Time
+}
+
+// confirmationStore holds the issued tokens until they are used or expire
+type confirmationStore struct {
+	mu      sync.Mutex
+	pending map[string]pendingConfirmation
+}
+
+var confirmations = &confirmationStore{pending: make(map[string]pendingConfirmation)}
+
+// issue returns a new token for fingerprint
+func (s *confirmationStore) issue(fingerprint string, now time.Time) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for token, pending := range s.pending {
+		if now.After(pending.expires) {
+			delete(s.pending, token)
+		}
+	}
+	token := newID()
+	s.pending[token] = pendingConfirmation{fingerprint: fingerprint, expires: now.Add(confirmationWindow)}
+	return token
+}
+
+// valid reports whether token was issued for fingerprint and hasn't expired
+func (s *confirmationStore) valid(token, fingerprint string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending, exists := s.pending[token]
+	return exists && pending.fingerprint == fingerprint && !now.After(pending.expires)
+}
+
+// consume invalidates a used token
+func (s *confirmationStore) consume(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, token)
+}
+
+// confirmationCall identifies the tool call a service call is made for
+type confirmationCall struct {
+	fingerprint string // session, tool and arguments
+	token       string // confirmation_token argument, if given
+}
+
+type confirmationCallKey struct{}
+
+// confirmationParam declares the confirmation_token argument of the control tools
+func confirmationParam() mcp.ToolOption {
+	return mcp.WithString("confirmation_token",
+		mcp.Description("Token returned by a previous call that needed confirmation; repeat that exact call with it within 60 seconds to carry it out"),
+	)
+}
+
+// confirmationMiddleware records which call the handler's service calls belong to, and
+// invalidates a presented token once the call has run
+func confirmationMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if len(haService.confirmEntities) == 0 {
+			return next(ctx, request)
+		}
+
+		fingerprint := request.Params.Name + "/" + callArguments(request)
+		if session := server.ClientSessionFromContext(ctx); session != nil {
+			fingerprint = session.SessionID() + "/" + fingerprint
+		}
+		call := &confirmationCall{fingerprint: fingerprint, token: request.GetString("confirmation_token", "")}
+
+		result, err := next(context.WithValue(ctx, confirmationCallKey{}, call), request)
+		if call.token != "" && result != nil && !result.IsError {
+			confirmations.consume(call.token)
+		}
+		return result, err
+	}
+}
+
+// checkConfirmation requires a valid confirmation token for service calls on
+// confirm_entities entities made by a tool call. Scheduled actions run outside a tool call
+// and pass; checkScheduledConfirmation asks for them when they are scheduled.
+func (h *HAService) checkConfirmation(ctx context.Context, domain, service string, entityIDs []string) error {
+	if len(h.confirmEntities) == 0 {
+		return nil
+	}
+	call, ok := ctx.Value(confirmationCallKey{}).(*confirmationCall)
+	if !ok {
+		return nil
+	}
+
+	for _, entityID := range entityIDs {
+		if !matchesAny(h.confirmEntities, entityID) {
+			continue
+		}
+		if call.token != "" && confirmations.valid(call.token, call.fingerprint, time.Now()) {
+			return nil
+		}
+		token := confirmations.issue(call.fingerprint, time.Now())
+		h.logger.Printf("%s.%s on %s needs confirmation, issued token %s", domain, service, entityID, token)
+		return &ConfirmationRequiredError{Token: token, EntityID: entityID, Service: domain + "." + service}
+	}
+	return nil
+}
+
+// checkScheduledConfirmation requires a valid confirmation token for scheduling an action,
+// or a macro, that touches confirm_entities entities, since its runs can't ask for one
+func (h *HAService) checkScheduledConfirmation(ctx context.Context, action *ScheduledAction) error {
+	if action.Macro == "" {
+		domain, _, _ := strings.Cut(action.EntityID, ".")
+		return h.checkConfirmation(ctx, domain, MacroStep{Action: action.Action}.service(), []string{action.EntityID})
+	}
+
+	_, macro, _ := h.findMacro(action.Macro)
+	for _, step := range macro.Steps {
+		if step.EntityID == "" {
+			continue
+		}
+		entityID, err := h.canonicalEntityID(step.EntityID)
+		if err != nil {
+			continue // reported when the macro runs
+		}
+		domain, _, _ := strings.Cut(entityID, ".")
+		if err := h.checkConfirmation(ctx, domain, step.service(), []string{entityID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
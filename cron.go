@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed five-field cron expression (minute hour day-of-month month
+// day-of-week), evaluated in local time
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64 // bit sets of allowed values
+	domAny, dowAny                bool   // the field was "*", for the day-of-month/day-of-week rule
+}
+
+var cronFields = []struct {
+	name     string
+	min, max int
+	names    []string // three-letter names, starting at min
+}{
+	{"minute", 0, 59, nil},
+	{"hour", 0, 23, nil},
+	{"day of month", 1, 31, nil},
+	{"month", 1, 12, []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	{"day of week", 0, 7, []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+var cronShorthands = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+	"@monthly":  "0 0 1 * *",
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+}
+
+// parseCron parses expressions such as "30 22 * * *" (every day at 22:30), "0 7 * * mon-fri"
+// or "*/15 * * * *", and the @daily style shorthands
+func parseCron(expression string) (*cronSchedule, error) {
+	expression = strings.ToLower(strings.TrimSpace(expression))
+	if shorthand, ok := cronShorthands[expression]; ok {
+		expression = shorthand
+	}
+
+	fields := strings.Fields(expression)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields: minute hour day-of-month month day-of-week", expression)
+	}
+
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseCronField(field, i)
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %v", expression, err)
+		}
+		sets[i] = set
+	}
+
+	// 7 is Sunday as well as 0
+	if sets[4]&(1<<7) != 0 {
+		sets[4] |= 1
+	}
+
+	schedule := &cronSchedule{
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    sets[4],
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}
+	if schedule.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("cron expression %q never matches", expression)
+	}
+	return schedule, nil
+}
+
+// parseCronField parses a comma-separated list of *, values, ranges and /steps
+func parseCronField(field string, index int) (uint64, error) {
+	spec := cronFields[index]
+	value := func(s string) (int, error) {
+		for i, name := range spec.names {
+			if s == name {
+				return spec.min + i, nil
+			}
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < spec.min || n > spec.max {
+			return 0, fmt.Errorf("invalid %s %q, expected %d-%d", spec.name, s, spec.min, spec.max)
+		}
+		return n, nil
+	}
+
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %s", stepPart, spec.name)
+			}
+		}
+
+		low, high := spec.min, spec.max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			from, to, _ := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = value(from); err != nil {
+				return 0, err
+			}
+			if high, err = value(to); err != nil {
+				return 0, err
+			}
+			if low > high {
+				return 0, fmt.Errorf("invalid %s range %q", spec.name, rangePart)
+			}
+		default:
+			n, err := value(rangePart)
+			if err != nil {
+				return 0, err
+			}
+			// "5/15" runs from 5 to the end of the range
+			low, high = n, n
+			if hasStep {
+				high = spec.max
+			}
+		}
+
+		for n := low; n <= high; n += step {
+			set |= 1 << n
+		}
+	}
+	return set, nil
+}
+
+// matchesDay applies the cron rule that, when both day fields are restricted, a day
+// matching either of them is enough
+func (c *cronSchedule) matchesDay(t time.Time) bool {
+	dom := c.dom&(1<<t.Day()) != 0
+	dow := c.dow&(1<<int(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next returns the first matching minute after t, or the zero time when there is none
+// within five years (e.g. "0 0 30 2 *"). The search steps through wall-clock time in t's
+// location: a time skipped by a DST change runs as much later as the clocks jumped, and a
+// time repeated by one runs once.
+func (c *cronSchedule) next(t time.Time) time.Time {
+	loc := t.Location()
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC).Add(time.Minute)
+	limit := wall.AddDate(5, 0, 0)
+
+	for wall.Before(limit) {
+		switch {
+		case c.month&(1<<int(wall.Month())) == 0:
+			wall = time.Date(wall.Year(), wall.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.matchesDay(wall):
+			wall = time.Date(wall.Year(), wall.Month(), wall.Day()+1, 0, 0, 0, 0, time.UTC)
+		case c.hour&(1<<wall.Hour()) == 0:
+			wall = time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour()+1, 0, 0, 0, time.UTC)
+		case c.minute&(1<<wall.Minute()) == 0:
+			wall = wall.Add(time.Minute)
+		default:
+			if next := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), 0, 0, loc); next.After(t) {
+				return next
+			}
+			wall = wall.Add(time.Minute)
+		}
+	}
+	return time.Time{}
+}
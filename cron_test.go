@@ -0,0 +1,155 @@
+package main
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expression := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"30-10 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"0 0 * foo *",
+		"0 0 30 feb *",
+		"@often",
+	} {
+		if _, err := parseCron(expression); err == nil {
+			t.Errorf("parseCron(%q) succeeded, want an error", expression)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(s string) time.Time {
+		parsed, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+		if err != nil {
+			t.Fatalf("bad test time %q: %v", s, err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		expression string
+		from       string
+		want       []string
+	}{
+		// 2026-10-16 is a Friday
+		{"30 22 * * *", "2026-10-16 12:00", []string{"2026-10-16 22:30", "2026-10-17 22:30"}},
+		{"30 22 * * *", "2026-10-16 22:30", []string{"2026-10-17 22:30"}},
+		{"*/15 * * * *", "2026-10-16 12:07", []string{"2026-10-16 12:15", "2026-10-16 12:30", "2026-10-16 12:45", "2026-10-16 13:00"}},
+		{"5/20 * * * *", "2026-10-16 12:00", []string{"2026-10-16 12:05", "2026-10-16 12:25", "2026-10-16 12:45", "2026-10-16 13:05"}},
+		{"0 9-17/4 * * *", "2026-10-16 10:00", []string{"2026-10-16 13:00", "2026-10-16 17:00", "2026-10-17 09:00"}},
+		{"0 8,12-13 * * *", "2026-10-16 09:00", []string{"2026-10-16 12:00", "2026-10-16 13:00", "2026-10-17 08:00"}},
+		{"0 7 * * mon-fri", "2026-10-16 08:00", []string{"2026-10-19 07:00", "2026-10-20 07:00"}},
+		{"0 7 * * SAT,sun", "2026-10-16 08:00", []string{"2026-10-17 07:00", "2026-10-18 07:00", "2026-10-24 07:00"}},
+		{"0 0 * * 7", "2026-10-16 08:00", []string{"2026-10-18 00:00"}},
+		{"0 0 1 jan,jul *", "2026-10-16 08:00", []string{"2027-01-01 00:00", "2027-07-01 00:00"}},
+		{"0 0 31 * *", "2026-10-16 08:00", []string{"2026-10-31 00:00", "2026-12-31 00:00"}},
+		{"0 0 29 2 *", "2026-10-16 08:00", []string{"2028-02-29 00:00"}},
+		// Both day fields restricted: the 13th or any Friday
+		{"0 12 13 * fri", "2026-10-16 13:00", []string{"2026-10-23 12:00", "2026-10-30 12:00", "2026-11-06 12:00", "2026-11-13 12:00"}},
+		// Only one restricted: Fridays, whatever the day of month
+		{"0 12 * * fri", "2026-10-16 13:00", []string{"2026-10-23 12:00"}},
+		{"@daily", "2026-10-16 08:00", []string{"2026-10-17 00:00"}},
+		{"@hourly", "2026-10-16 08:00", []string{"2026-10-16 09:00"}},
+		{"@weekly", "2026-10-16 08:00", []string{"2026-10-18 00:00"}},
+		{"@monthly", "2026-10-16 08:00", []string{"2026-11-01 00:00"}},
+		{"@yearly", "2026-10-16 08:00", []string{"2027-01-01 00:00"}},
+	}
+	for _, tt := range tests {
+		schedule, err := parseCron(tt.expression)
+		if err != nil {
+			t.Errorf("parseCron(%q) failed: %v", tt.expression, err)
+			continue
+		}
+		next := at(tt.from)
+		for _, want := range tt.want {
+			next = schedule.next(next)
+			if !next.Equal(at(want)) {
+				t.Errorf("%q: next run %s, want %s", tt.expression, next.Format("2006-01-02 15:04"), want)
+				break
+			}
+		}
+	}
+}
+
+// Around DST changes, a time the clocks skip runs as much later as they jumped, and a time
+// they repeat runs once
+func TestCronNextDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("loading Europe/Berlin: %v", err)
+	}
+	at := func(s string) time.Time {
+		parsed, err := time.Parse("2006-01-02 15:04 -0700", s)
+		if err != nil {
+			t.Fatalf("bad test time %q: %v", s, err)
+		}
+		return parsed.In(berlin)
+	}
+
+	tests := []struct {
+		expression string
+		from       string
+		want       []string
+	}{
+		// 2026-03-29: 02:00 CET jumps to 03:00 CEST
+		{"30 2 * * *", "2026-03-29 00:00 +0100", []string{"2026-03-29 03:30 +0200", "2026-03-30 02:30 +0200"}},
+		{"0 * * * *", "2026-03-29 00:30 +0100", []string{"2026-03-29 01:00 +0100", "2026-03-29 03:00 +0200", "2026-03-29 04:00 +0200"}},
+		{"*/30 * * * *", "2026-03-29 01:40 +0100", []string{"2026-03-29 03:00 +0200", "2026-03-29 03:30 +0200"}},
+		// 2026-10-25: 03:00 CEST goes back to 02:00 CET
+		{"30 2 * * *", "2026-10-25 00:00 +0200", []string{"2026-10-25 02:30 +0100", "2026-10-26 02:30 +0100"}},
+		{"30 2 * * *", "2026-10-25 02:40 +0200", []string{"2026-10-26 02:30 +0100"}},
+		{"0 * * * *", "2026-10-25 00:30 +0200", []string{"2026-10-25 01:00 +0200", "2026-10-25 02:00 +0100", "2026-10-25 03:00 +0100"}},
+		{"0 0 * * *", "2026-10-24 12:00 +0200", []string{"2026-10-25 00:00 +0200", "2026-10-26 00:00 +0100"}},
+	}
+	for _, tt := range tests {
+		schedule, err := parseCron(tt.expression)
+		if err != nil {
+			t.Errorf("parseCron(%q) failed: %v", tt.expression, err)
+			continue
+		}
+		next := at(tt.from)
+		for _, want := range tt.want {
+			next = schedule.next(next)
+			if !next.Equal(at(want)) {
+				t.Errorf("%q: next run %s, want %s", tt.expression, next.Format("2006-01-02 15:04 -0700"), want)
+				break
+			}
+		}
+	}
+}
+
+// A repeating action that was due while the bridge was down resumes at its next occurrence
+// instead of catching up on every missed one
+func TestScheduledActionNextRun(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		action ScheduledAction
+		want   time.Time
+	}{
+		{"once", ScheduledAction{RunAt: now.Add(-time.Hour)}, time.Time{}},
+		{"every due now", ScheduledAction{RunAt: now, Every: "1h"}, now.Add(time.Hour)},
+		{"every missed for days", ScheduledAction{RunAt: now.Add(-74 * time.Hour), Every: "24h"}, now.Add(22 * time.Hour)},
+		{"every keeps its phase", ScheduledAction{RunAt: now.Add(-50 * time.Minute), Every: "15m"}, now.Add(10 * time.Minute)},
+		{"cron missed for days", ScheduledAction{RunAt: now.Add(-72 * time.Hour), Cron: "30 22 * * *"}, time.Date(2026, 10, 16, 22, 30, 0, 0, time.UTC)},
+		{"invalid cron", ScheduledAction{RunAt: now.Add(-time.Hour), Cron: "bad"}, time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := tt.action.nextRun(now); !got.Equal(tt.want) {
+			t.Errorf("%s: nextRun = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
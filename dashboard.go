@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Strings in a dashboard config that look like entity IDs
+var entityIDPattern = regexp.MustCompile(`^[a-z_]+\.[a-z0-9_]+$`)
+
+// DashboardView is one view of a dashboard with the exposed entities shown on it
+type DashboardView struct {
+	Title    string   `json:"title,omitempty"`
+	Path     string   `json:"path,omitempty"`
+	Entities []string `json:"entities"`
+}
+
+// DashboardEntity counts how often an entity appears on the dashboard; frequently shown
+// entities are the ones the user cares about
+type DashboardEntity struct {
+	EntityID string `json:"entity_id"`
+	Count    int    `json:"count"`
+}
+
+// DashboardSummary is the get_dashboard_config response
+type DashboardSummary struct {
+	Dashboard  string            `json:"dashboard"`
+	Title      string            `json:"title,omitempty"`
+	Views      []DashboardView   `json:"views"`
+	Entities   []DashboardEntity `json:"entities"` // most shown first
+	Dashboards []string          `json:"available_dashboards,omitempty"`
+}
+
+// collectEntityIDs walks a card config and counts the entity IDs referenced by entity and
+// entities keys, including {"entity": ...} objects in entity lists
+func collectEntityIDs(node interface{}, counts map[string]int, order *[]string) {
+	add := func(value interface{}) {
+		id, ok := value.(string)
+		if !ok || !entityIDPattern.MatchString(id) {
+			return
+		}
+		if counts[id] == 0 {
+			*order = append(*order, id)
+		}
+		counts[id]++
+	}
+
+	switch v := node.(type) {
+	case map[string]interface{}:
+		// Sorted keys keep the entity order stable between calls
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			value := v[key]
+			switch key {
+			case "entity", "entity_id", "camera_image":
+				add(value)
+			case "entities":
+				if list, ok := value.([]interface{}); ok {
+					for _, item := range list {
+						add(item)
+					}
+				}
+			}
+			collectEntityIDs(value, counts, order)
+		}
+	case []interface{}:
+		for _, item := range v {
+			collectEntityIDs(item, counts, order)
+		}
+	}
+}
+
+// getDashboardSummary reads a dashboard's config and lists the exposed entities on each view
+func (h *HAService) getDashboardSummary(ctx context.Context, urlPath string) (*DashboardSummary, error) {
+	fields := map[string]interface{}{"force": false}
+	if urlPath != "" {
+		fields["url_path"] = urlPath
+	}
+
+	var config struct {
+		Title string                   `json:"title"`
+		Views []map[string]interface{} `json:"views"`
+	}
+	if err := h.ws.CommandInto(ctx, "lovelace/config", fields, &config); err != nil {
+		return nil, err
+	}
+
+	summary := &DashboardSummary{
+		Dashboard: urlPath,
+		Title:     config.Title,
+		Views:     []DashboardView{},
+		Entities:  []DashboardEntity{},
+	}
+	if summary.Dashboard == "" {
+		summary.Dashboard = "lovelace"
+	}
+
+	total := make(map[string]int)
+	for _, rawView := range config.Views {
+		counts := make(map[string]int)
+		var order []string
+		collectEntityIDs(rawView, counts, &order)
+
+		view := DashboardView{
+			Title:    formatValue(rawView["title"]),
+			Path:     formatValue(rawView["path"]),
+			Entities: []string{},
+		}
+		for _, id := range order {
+			if h.entityIDExposed(ctx, id) {
+				view.Entities = append(view.Entities, id)
+				total[id] += counts[id]
+			}
+		}
+		summary.Views = append(summary.Views, view)
+	}
+
+	for id, count := range total {
+		summary.Entities = append(summary.Entities, DashboardEntity{EntityID: id, Count: count})
+	}
+	sort.Slice(summary.Entities, func(i, j int) bool {
+		if summary.Entities[i].Count != summary.Entities[j].Count {
+			return summary.Entities[i].Count > summary.Entities[j].Count
+		}
+		return summary.Entities[i].EntityID < summary.Entities[j].EntityID
+	})
+
+	var dashboards []struct {
+		URLPath string `json:"url_path"`
+	}
+	if err := h.ws.CommandInto(ctx, "lovelace/dashboards/list", nil, &dashboards); err != nil {
+		h.logger.Printf("Could not list dashboards: %v", err)
+	}
+	for _, dashboard := range dashboards {
+		summary.Dashboards = append(summary.Dashboards, dashboard.URLPath)
+	}
+	return summary, nil
+}
+
+// get_dashboard_config handler
+func getDashboardConfigHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	summary, err := haService.getDashboardSummary(ctx, request.GetString("dashboard", ""))
+	if err != nil {
+		return toolError("Failed to get dashboard config", err), nil
+	}
+
+	summaryJSON, err := json.Marshal(summary)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize dashboard: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Dashboard %s shows %d entities on %d views:\n%s",
+		summary.Dashboard, len(summary.Entities), len(summary.Views), string(summaryJSON))), nil
+}
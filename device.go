@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// DeviceInfo is a device registry entry with its area, integrations and exposed entities
+type DeviceInfo struct {
+	ID               string          `json:"id"`
+	Name             string          `json:"name"`
+	NameByUser       string          `json:"name_by_user,omitempty"`
+	Manufacturer     string          `json:"manufacturer,omitempty"`
+	Model            string          `json:"model,omitempty"`
+	ModelID          string          `json:"model_id,omitempty"`
+	SWVersion        string          `json:"sw_version,omitempty"`
+	HWVersion        string          `json:"hw_version,omitempty"`
+	SerialNumber     string          `json:"serial_number,omitempty"`
+	Connections      [][]string      `json:"connections,omitempty"` // e.g. [["mac", "aa:bb:cc:dd:ee:ff"]]
+	Identifiers      [][]interface{} `json:"identifiers,omitempty"`
+	ConfigEntries    []string        `json:"config_entries,omitempty"`
+	AreaID           string          `json:"area_id,omitempty"`
+	ViaDeviceID      string          `json:"via_device_id,omitempty"`
+	EntryType        string          `json:"entry_type,omitempty"`
+	ConfigurationURL string          `json:"configuration_url,omitempty"`
+	DisabledBy       string          `json:"disabled_by,omitempty"`
+
+	Area         *HAArea             `json:"area,omitempty"`
+	Integrations []DeviceIntegration `json:"integrations,omitempty"`
+	Entities     []string            `json:"entities"`
+}
+
+// DeviceIntegration is a config entry a device belongs to
+type DeviceIntegration struct {
+	EntryID string `json:"entry_id"`
+	Domain  string `json:"domain"`
+	Title   string `json:"title"`
+}
+
+// displayName prefers the name the user gave the device
+func (d *DeviceInfo) displayName() string {
+	if d.NameByUser != "" {
+		return d.NameByUser
+	}
+	return d.Name
+}
+
+// findDevice picks a device by ID, by one of its entities, or by name; ambiguous names
+// list the matching devices
+func findDevice(devices []DeviceInfo, deviceID, entityID, name string) (*DeviceInfo, error) {
+	if entityID != "" {
+		areaCache.mu.RLock()
+		deviceID = areaCache.deviceOf[entityID]
+		areaCache.mu.RUnlock()
+		if deviceID == "" {
+			return nil, &InvalidRequestError{fmt.Sprintf("%s does not belong to a device", entityID)}
+		}
+	}
+
+	var matches []*DeviceInfo
+	for i := range devices {
+		device := &devices[i]
+		switch {
+		case deviceID != "":
+			if device.ID == deviceID {
+				return device, nil
+			}
+		case normalizeName(device.displayName()) == normalizeName(name) || normalizeName(device.Name) == normalizeName(name):
+			matches = append(matches, device)
+		}
+	}
+
+	switch {
+	case len(matches) == 1:
+		return matches[0], nil
+	case len(matches) > 1:
+		names := make([]string, len(matches))
+		for i, device := range matches {
+			names[i] = fmt.Sprintf("%s (%s)", device.displayName(), device.ID)
+		}
+		return nil, &InvalidRequestError{fmt.Sprintf("device name %q is ambiguous, candidates: %s", name, strings.Join(names, ", "))}
+	case deviceID != "":
+		return nil, &InvalidRequestError{fmt.Sprintf("device %s not found", deviceID)}
+	default:
+		return nil, &InvalidRequestError{fmt.Sprintf("no device named %q", name)}
+	}
+}
+
+// getDeviceInfo looks up a device and fills in its area, integrations and exposed entities.
+// Devices without any exposed entity are treated as hidden.
+func (h *HAService) getDeviceInfo(ctx context.Context, deviceID, entityID, name string) (*DeviceInfo, error) {
+	if err := h.updateAreaCache(ctx); err != nil {
+		return nil, err
+	}
+
+	var devices []DeviceInfo
+	if err := h.ws.CommandInto(ctx, "config/device_registry/list", nil, &devices); err != nil {
+		return nil, err
+	}
+
+	device, err := findDevice(devices, deviceID, entityID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	areaCache.mu.RLock()
+	device.Entities = []string{}
+	for id, owner := range areaCache.deviceOf {
+		if owner == device.ID && h.entityIDExposed(ctx, id) {
+			device.Entities = append(device.Entities, id)
+		}
+	}
+	device.Area = areaCache.areas[device.AreaID]
+	areaCache.mu.RUnlock()
+
+	if len(device.Entities) == 0 {
+		return nil, &AccessDeniedError{EntityID: device.ID}
+	}
+	sort.Strings(device.Entities)
+
+	// Integration names are a nicety; older HA versions lack config_entries/get
+	var entries []DeviceIntegration
+	if err := h.ws.CommandInto(ctx, "config_entries/get", nil, &entries); err != nil {
+		h.logger.Printf("Could not read config entries: %v", err)
+	}
+	for _, entry := range entries {
+		if containsString(device.ConfigEntries, entry.EntryID) {
+			device.Integrations = append(device.Integrations, entry)
+		}
+	}
+	return device, nil
+}
+
+// get_device_info handler
+func getDeviceInfoHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	deviceID := request.GetString("device_id", "")
+	entityID := request.GetString("entity_id", "")
+	name := request.GetString("name", "")
+	if deviceID == "" && entityID == "" && name == "" {
+		return mcp.NewToolResultError("device_id, entity_id or name parameter is required"), nil
+	}
+
+	if entityID != "" {
+		canonical, err := haService.canonicalEntityID(entityID)
+		if err != nil {
+			return toolError("Failed to get device info", err), nil
+		}
+		entityID = canonical
+		if err := haService.checkEntityAccess(ctx, entityID); err != nil {
+			return toolError("Failed to get device info", err), nil
+		}
+	}
+
+	device, err := haService.getDeviceInfo(ctx, deviceID, entityID, name)
+	if err != nil {
+		return toolError("Failed to get device info", err), nil
+	}
+
+	deviceJSON, err := json.Marshal(device)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize device: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Device %s:\n%s", device.displayName(), string(deviceJSON))), nil
+}
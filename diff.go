@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// StateChange is an entity whose state differs from the compared point
+type StateChange struct {
+	EntityID    string `json:"entity_id"`
+	Name        string `json:"name,omitempty"`
+	Area        string `json:"area,omitempty"`
+	Previous    string `json:"previous"`
+	Current     string `json:"current"`
+	LastChanged string `json:"last_changed"`
+}
+
+// StateDiff is the diff_states response
+type StateDiff struct {
+	Since    string        `json:"since"`
+	Source   string        `json:"source"` // "snapshot" or "history"
+	Compared int           `json:"compared"`
+	Changed  []StateChange `json:"changed"`
+}
+
+// statesAt reads the state every entity had at t from the recorder; the first point of
+// each history series is the state at the start of the period
+func (h *HAService) statesAt(ctx context.Context, t time.Time) (map[string]string, error) {
+	endpoint := fmt.Sprintf("/api/history/period/%s?end_time=%s&minimal_response&no_attributes",
+		url.PathEscape(t.UTC().Format(time.RFC3339)), url.QueryEscape(t.Add(time.Second).UTC().Format(time.RFC3339)))
+	resp, err := h.makeHARequest(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("HA API returned status %d for history", resp.StatusCode)
+	}
+
+	var history [][]struct {
+		EntityID string `json:"entity_id"`
+		State    string `json:"state"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		return nil, err
+	}
+
+	states := make(map[string]string, len(history))
+	for _, series := range history {
+		if len(series) > 0 && series[0].EntityID != "" {
+			states[series[0].EntityID] = series[0].State
+		}
+	}
+	return states, nil
+}
+
+// diffStates compares the exposed current states with previous, skipping entities that
+// have no previous state
+func diffStates(current []HAState, previous map[string]string) StateDiff {
+	diff := StateDiff{Changed: []StateChange{}}
+	for _, state := range current {
+		before, known := previous[state.EntityID]
+		if !known {
+			continue
+		}
+		diff.Compared++
+		if before == state.State {
+			continue
+		}
+
+		change := StateChange{
+			EntityID:    state.EntityID,
+			Previous:    before,
+			Current:     state.State,
+			LastChanged: state.LastChanged,
+		}
+		change.Name, _ = state.Attributes["friendly_name"].(string)
+		if state.Area != nil {
+			change.Area = state.Area.Name
+		}
+		diff.Changed = append(diff.Changed, change)
+	}
+
+	// Most recent changes first
+	sort.Slice(diff.Changed, func(i, j int) bool {
+		return diff.Changed[i].LastChanged > diff.Changed[j].LastChanged
+	})
+	return diff
+}
+
+// diff_states handler
+func diffStatesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	snapshotID := request.GetString("snapshot_id", "")
+	since := request.GetString("since", "")
+	hours := request.GetFloat("hours", 0)
+
+	var previous map[string]string
+	var at time.Time
+	var source string
+	switch {
+	case snapshotID != "":
+		snapshots.mu.Lock()
+		snapshot, exists := snapshots.byID[snapshotID]
+		snapshots.mu.Unlock()
+		if !exists {
+			return mcp.NewToolResultError(fmt.Sprintf("Snapshot %s not found", snapshotID)), nil
+		}
+		previous = make(map[string]string, len(snapshot.Entities))
+		for _, entity := range snapshot.Entities {
+			previous[entity.EntityID] = entity.State
+		}
+		at, source = snapshot.CreatedAt, "snapshot"
+	case since != "" || hours > 0:
+		at = time.Now().Add(-time.Duration(hours * float64(time.Hour)))
+		if since != "" {
+			parsed, err := time.Parse(time.RFC3339, since)
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("since must be an RFC 3339 timestamp such as 2024-05-01T08:00:00+02:00: %v", err)), nil
+			}
+			at = parsed
+		}
+		if !at.Before(time.Now()) {
+			return mcp.NewToolResultError("since must be in the past"), nil
+		}
+
+		var err error
+		previous, err = haService.statesAt(ctx, at)
+		if err != nil {
+			return toolError("Failed to read historical states", err), nil
+		}
+		source = "history"
+	default:
+		return mcp.NewToolResultError("snapshot_id, since or hours parameter is required"), nil
+	}
+
+	states, err := haService.getRawStates(ctx, 0)
+	if err != nil {
+		return toolError("Failed to get states", err), nil
+	}
+	states = haService.filterExposed(ctx, states)
+
+	diff := diffStates(states, previous)
+	diff.Since = at.Format(time.RFC3339)
+	diff.Source = source
+
+	diffJSON, err := json.Marshal(diff)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize diff: %v", err)), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("%d of %d entities changed since %s:\n%s", len(diff.Changed), diff.Compared, diff.Since, string(diffJSON))), nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Service type Home Assistant announces over zeroconf
+const haServiceType = "_home-assistant._tcp.local."
+
+// How long discovery waits for answers
+const discoveryTimeout = 3 * time.Second
+
+// mDNS multicast groups
+var mdnsGroups = []struct{ network, addr string }{
+	{"udp4", "224.0.0.251:5353"},
+	{"udp6", "[ff02::fb]:5353"},
+}
+
+// discoveredInstance collects the records announced for one HA instance
+type discoveredInstance struct {
+	name   string
+	target string // SRV host name
+	port   uint16
+	txt    map[string]string
+}
+
+// discoverHomeAssistant looks for a Home Assistant instance announcing _home-assistant._tcp
+// on the local network and returns its base URL. The query is sent from an ephemeral port,
+// which makes responders answer by unicast, so no multicast membership is needed.
+func (h *HAService) discoverHomeAssistant(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+
+	query, err := mdnsQuery()
+	if err != nil {
+		return "", err
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	instances := make(map[string]*discoveredInstance)
+	addresses := make(map[string][]net.IP) // host name -> A/AAAA records
+	var order []string
+	sent := 0
+
+	for _, group := range mdnsGroups {
+		conn, err := net.ListenPacket(group.network, ":0")
+		if err != nil {
+			h.logger.Printf("mDNS discovery: no %s socket: %v", group.network, err)
+			continue
+		}
+		dst, err := net.ResolveUDPAddr(group.network, group.addr)
+		if err == nil {
+			_, err = conn.WriteTo(query, dst)
+		}
+		if err != nil {
+			h.logger.Printf("mDNS discovery: query to %s failed: %v", group.addr, err)
+			conn.Close()
+			continue
+		}
+		sent++
+
+		// Collect answers until the timeout closes the socket
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, 9000)
+			for {
+				n, _, err := conn.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				parseMDNSResponse(buf[:n], instances, addresses, &order)
+				mu.Unlock()
+			}
+		}()
+		go func() {
+			<-ctx.Done()
+			conn.Close()
+		}()
+	}
+	if sent == 0 {
+		return "", errors.New("mDNS discovery: could not send a query on any interface")
+	}
+
+	// Wait for the full timeout, answers from several instances should all be seen
+	<-ctx.Done()
+	wg.Wait()
+
+	var urls []string
+	for _, name := range order {
+		if url := instances[name].baseURL(addresses); url != "" {
+			urls = append(urls, url)
+		}
+	}
+	if len(urls) == 0 {
+		return "", fmt.Errorf("no Home Assistant instance found via mDNS within %v, set ha_url", discoveryTimeout)
+	}
+	if len(urls) > 1 {
+		h.logger.Printf("mDNS discovery found %d instances, using the first: %v", len(urls), urls)
+	}
+	h.logger.Printf("Discovered Home Assistant at %s", urls[0])
+	return urls[0], nil
+}
+
+// mdnsQuery builds a PTR query for the Home Assistant service type
+func mdnsQuery() ([]byte, error) {
+	name, err := dnsmessage.NewName(haServiceType)
+	if err != nil {
+		return nil, err
+	}
+	message := dnsmessage.Message{
+		Questions: []dnsmessage.Question{{Name: name, Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET}},
+	}
+	return message.Pack()
+}
+
+// parseMDNSResponse records the PTR, SRV, TXT and address records of a response; answers and
+// additional records are treated alike, as responders put them in either section
+func parseMDNSResponse(packet []byte, instances map[string]*discoveredInstance, addresses map[string][]net.IP, order *[]string) {
+	var message dnsmessage.Message
+	if err := message.Unpack(packet); err != nil || !message.Response {
+		return
+	}
+
+	instance := func(name string) *discoveredInstance {
+		if _, ok := instances[name]; !ok {
+			instances[name] = &discoveredInstance{name: name, txt: make(map[string]string)}
+			*order = append(*order, name)
+		}
+		return instances[name]
+	}
+
+	records := append(message.Answers, message.Additionals...)
+	for _, record := range records {
+		name := strings.ToLower(record.Header.Name.String())
+		switch body := record.Body.(type) {
+		case *dnsmessage.PTRResource:
+			if name == haServiceType {
+				instance(strings.ToLower(body.PTR.String()))
+			}
+		case *dnsmessage.SRVResource:
+			if strings.HasSuffix(name, "."+haServiceType) {
+				i := instance(name)
+				i.target = strings.ToLower(body.Target.String())
+				i.port = body.Port
+			}
+		case *dnsmessage.TXTResource:
+			if strings.HasSuffix(name, "."+haServiceType) {
+				i := instance(name)
+				for _, entry := range body.TXT {
+					if key, value, ok := strings.Cut(entry, "="); ok {
+						i.txt[key] = value
+					}
+				}
+			}
+		case *dnsmessage.AResource:
+			addresses[name] = append(addresses[name], net.IP(body.A[:]))
+		case *dnsmessage.AAAAResource:
+			addresses[name] = append(addresses[name], net.IP(body.AAAA[:]))
+		}
+	}
+}
+
+// baseURL prefers the URLs HA announces in its TXT record and otherwise builds one from the
+// SRV port and an address of the target, IPv4 first
+func (i *discoveredInstance) baseURL(addresses map[string][]net.IP) string {
+	for _, key := range []string{"internal_url", "base_url"} {
+		if url := i.txt[key]; url != "" {
+			return url
+		}
+	}
+	if i.target == "" || i.port == 0 {
+		return ""
+	}
+
+	var chosen net.IP
+	for _, ip := range addresses[i.target] {
+		if ip.To4() != nil {
+			chosen = ip
+			break
+		}
+		if chosen == nil && !ip.IsLinkLocalUnicast() {
+			chosen = ip
+		}
+	}
+	host := strings.TrimSuffix(i.target, ".")
+	if chosen != nil {
+		host = chosen.String()
+	}
+	url := neturl.URL{Scheme: "http", Host: net.JoinHostPort(host, strconv.Itoa(int(i.port)))}
+	return url.String()
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Default number of state changes kept for get_recent_events
+const defaultEventBufferSize = 1000
+
+// Defaults of get_recent_events
+const (
+	defaultRecentEventsMinutes = 60
+	defaultRecentEventsLimit   = 50
+)
+
+// RecentEvent is a state change seen on the state_changed subscription
+type RecentEvent struct {
+	EntityID string    `json:"entity_id"`
+	Name     string    `json:"name,omitempty"`
+	Area     string    `json:"area,omitempty"`
+	OldState string    `json:"old_state,omitempty"` // empty when the entity was added
+	NewState string    `json:"new_state,omitempty"` // empty when the entity was removed
+	Time     time.Time `json:"time"`
+
+	deviceClass string
+	area        *HAArea
+}
+
+// eventBuffer keeps the most recent state changes in a ring
+type eventBuffer struct {
+	mu     sync.Mutex
+	events []RecentEvent
+	next   int
+	full   bool
+}
+
+func newEventBuffer(size int) *eventBuffer {
+	return &eventBuffer{events: make([]RecentEvent, size)}
+}
+
+func (b *eventBuffer) add(event RecentEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events[b.next] = event
+	b.next = (b.next + 1) % len(b.events)
+	if b.next == 0 {
+		b.full = true
+	}
+}
+
+// since returns the buffered events from t on, oldest first
+func (b *eventBuffer) since(t time.Time) []RecentEvent {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var ordered []RecentEvent
+	if b.full {
+		ordered = append(ordered, b.events[b.next:]...)
+	}
+	ordered = append(ordered, b.events[:b.next]...)
+
+	var result []RecentEvent
+	for _, event := range ordered {
+		if !event.Time.Before(t) {
+			result = append(result, event)
+		}
+	}
+	return result
+}
+
+// startEventBuffer subscribes to state_changed and keeps the last event_buffer_size state
+// changes; a negative size disables it
+func (h *HAService) startEventBuffer(ctx context.Context) {
+	size := h.config.EventBufferSize
+	if size < 0 {
+		return
+	}
+	if size == 0 {
+		size = defaultEventBufferSize
+	}
+	h.events = newEventBuffer(size)
+	go h.ws.Subscribe(ctx, "state_changed", h.recordEvent)
+	h.logger.Printf("Keeping the last %d state changes for get_recent_events", size)
+}
+
+// recordEvent runs on the WebSocket reader; attribute-only updates are skipped so sensors
+// refreshing their attributes don't push real changes out of the buffer
+func (h *HAService) recordEvent(raw json.RawMessage) {
+	var event struct {
+		TimeFired time.Time `json:"time_fired"`
+		Data      struct {
+			EntityID string   `json:"entity_id"`
+			OldState *HAState `json:"old_state"`
+			NewState *HAState `json:"new_state"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &event); err != nil {
+		h.logger.Printf("Failed to parse state_changed event: %v", err)
+		return
+	}
+
+	recent := RecentEvent{EntityID: event.Data.EntityID, Time: event.TimeFired}
+	for _, state := range []*HAState{event.Data.OldState, event.Data.NewState} {
+		if state == nil {
+			continue
+		}
+		recent.Name, _ = state.Attributes["friendly_name"].(string)
+		recent.deviceClass = deviceClassOf(*state)
+	}
+	if event.Data.OldState != nil {
+		recent.OldState = event.Data.OldState.State
+	}
+	if event.Data.NewState != nil {
+		recent.NewState = event.Data.NewState.State
+	}
+	if recent.OldState == recent.NewState {
+		return
+	}
+	if recent.Time.IsZero() {
+		recent.Time = time.Now()
+	}
+	h.events.add(recent)
+}
+
+// exposedEvents drops the events of entities the caller may not see and fills in areas
+func (h *HAService) exposedEvents(ctx context.Context, events []RecentEvent) []RecentEvent {
+	// One state per entity, so the filters and the area lookup run once each
+	seen := make(map[string]bool)
+	var states []HAState
+	for _, event := range events {
+		if seen[event.EntityID] {
+			continue
+		}
+		seen[event.EntityID] = true
+		state := HAState{
+			EntityID:   event.EntityID,
+			Attributes: map[string]interface{}{"friendly_name": event.Name},
+		}
+		if event.deviceClass != "" {
+			state.Attributes["device_class"] = event.deviceClass
+		}
+		states = append(states, state)
+	}
+
+	areas := make(map[string]*HAArea)
+	for _, state := range h.filterExposed(ctx, states) {
+		areas[state.EntityID] = state.Area
+	}
+
+	var result []RecentEvent
+	for _, event := range events {
+		area, exposed := areas[event.EntityID]
+		if !exposed {
+			continue
+		}
+		if event.area = area; area != nil {
+			event.Area = area.Name
+		}
+		result = append(result, event)
+	}
+	return result
+}
+
+// get_recent_events handler
+func getRecentEventsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if haService.events == nil {
+		return mcp.NewToolResultError("The event buffer is disabled (event_buffer_size is negative)"), nil
+	}
+
+	minutes := request.GetFloat("minutes", defaultRecentEventsMinutes)
+	limit := request.GetInt("limit", defaultRecentEventsLimit)
+	if minutes <= 0 || limit <= 0 {
+		return mcp.NewToolResultError("minutes and limit must be positive"), nil
+	}
+
+	var patterns []entityPattern
+	if entity := request.GetString("entity", ""); entity != "" {
+		var err error
+		patterns, err = compilePatterns("entity", []string{entity})
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+	}
+	domain := request.GetString("domain", "")
+	area := request.GetString("area", "")
+
+	var matched []RecentEvent
+	for _, event := range haService.exposedEvents(ctx, haService.events.since(time.Now().Add(-time.Duration(minutes*float64(time.Minute))))) {
+		if patterns != nil && !matchesAny(patterns, event.EntityID) {
+			continue
+		}
+		if domain != "" && !strings.HasPrefix(event.EntityID, domain+".") {
+			continue
+		}
+		if area != "" && !matchesArea(event.area, area) {
+			continue
+		}
+		matched = append(matched, event)
+	}
+
+	// Newest first, the most recent limit events
+	events := make([]RecentEvent, 0, min(limit, len(matched)))
+	for i := len(matched) - 1; i >= 0 && len(events) < limit; i-- {
+		events = append(events, matched[i])
+	}
+
+	eventsJSON, err := json.Marshal(events)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize events: %v", err)), nil
+	}
+	summary := fmt.Sprintf("%d state changes in the last %g minutes", len(matched), minutes)
+	if len(events) < len(matched) {
+		summary += fmt.Sprintf(", showing the latest %d", len(events))
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("%s:\n%s", summary, string(eventsJSON))), nil
+}
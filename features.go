@@ -0,0 +1,120 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// supported_features bits per domain, named after the HA EntityFeature flags
+var featureFlags = map[string][]struct {
+	bit  int
+	name string
+}{
+	"light": {
+		{4, "effect"}, {8, "flash"}, {32, "transition"},
+	},
+	"cover": {
+		{1, "open"}, {2, "close"}, {4, "set_position"}, {8, "stop"},
+		{16, "open_tilt"}, {32, "close_tilt"}, {64, "stop_tilt"}, {128, "set_tilt_position"},
+	},
+	"climate": {
+		{1, "target_temperature"}, {2, "target_temperature_range"}, {4, "target_humidity"},
+		{8, "fan_mode"}, {16, "preset_mode"}, {32, "swing_mode"}, {64, "aux_heat"},
+		{128, "turn_off"}, {256, "turn_on"}, {512, "swing_horizontal_mode"},
+	},
+	"fan": {
+		{1, "set_speed"}, {2, "oscillate"}, {4, "direction"}, {8, "preset_mode"},
+		{16, "turn_off"}, {32, "turn_on"},
+	},
+	"media_player": {
+		{1, "pause"}, {2, "seek"}, {4, "volume_set"}, {8, "volume_mute"},
+		{16, "previous_track"}, {32, "next_track"}, {128, "turn_on"}, {256, "turn_off"},
+		{512, "play_media"}, {1024, "volume_step"}, {2048, "select_source"}, {4096, "stop"},
+		{8192, "clear_playlist"}, {16384, "play"}, {32768, "shuffle_set"}, {65536, "select_sound_mode"},
+		{131072, "browse_media"}, {262144, "repeat_set"}, {524288, "grouping"},
+		{1048576, "media_announce"}, {2097152, "media_enqueue"},
+	},
+	"valve": {
+		{1, "open"}, {2, "close"}, {4, "set_position"}, {8, "stop"},
+	},
+	"vacuum": {
+		{1, "turn_on"}, {2, "turn_off"}, {4, "pause"}, {8, "stop"}, {16, "return_home"},
+		{32, "fan_speed"}, {64, "battery"}, {128, "status"}, {256, "send_command"},
+		{512, "locate"}, {1024, "clean_spot"}, {2048, "map"}, {4096, "state"}, {8192, "start"},
+	},
+	"lock": {
+		{1, "open"},
+	},
+	"water_heater": {
+		{1, "target_temperature"}, {2, "operation_mode"}, {4, "away_mode"}, {8, "on_off"},
+	},
+	"humidifier": {
+		{1, "modes"},
+	},
+	"siren": {
+		{1, "turn_on"}, {2, "turn_off"}, {4, "tones"}, {8, "volume_set"}, {16, "duration"},
+	},
+	"lawn_mower": {
+		{1, "start_mowing"}, {2, "pause"}, {4, "dock"},
+	},
+	"alarm_control_panel": {
+		{1, "arm_home"}, {2, "arm_away"}, {4, "arm_night"}, {8, "trigger"},
+		{16, "arm_custom_bypass"}, {32, "arm_vacation"},
+	},
+	"remote": {
+		{1, "learn_command"}, {2, "delete_command"}, {4, "activity"},
+	},
+}
+
+// Capabilities implied by a light's supported_color_modes
+var colorModeCapabilities = map[string][]string{
+	"brightness": {"brightness"},
+	"color_temp": {"brightness", "color_temp"},
+	"hs":         {"brightness", "color"},
+	"xy":         {"brightness", "color"},
+	"rgb":        {"brightness", "color"},
+	"rgbw":       {"brightness", "color"},
+	"rgbww":      {"brightness", "color"},
+	"white":      {"brightness", "white"},
+}
+
+// decodeCapabilities turns the supported_features bitmask and, for lights, the
+// supported_color_modes list into sorted capability names
+func decodeCapabilities(state HAState) []string {
+	domain, _, _ := strings.Cut(state.EntityID, ".")
+	found := make(map[string]bool)
+
+	if features, ok := state.Attributes["supported_features"].(float64); ok {
+		for _, flag := range featureFlags[domain] {
+			if int(features)&flag.bit != 0 {
+				found[flag.name] = true
+			}
+		}
+	}
+	if domain == "light" {
+		modes, _ := state.Attributes["supported_color_modes"].([]interface{})
+		for _, mode := range modes {
+			for _, capability := range colorModeCapabilities[formatValue(mode)] {
+				found[capability] = true
+			}
+		}
+	}
+
+	if len(found) == 0 {
+		return nil
+	}
+	capabilities := make([]string, 0, len(found))
+	for capability := range found {
+		capabilities = append(capabilities, capability)
+	}
+	sort.Strings(capabilities)
+	return capabilities
+}
+
+// addCapabilities fills in the decoded capabilities of each state. It runs before the
+// attribute policy, so the list survives even when the raw bitmasks are stripped.
+func addCapabilities(states []HAState) {
+	for i := range states {
+		states[i].Capabilities = decodeCapabilities(states[i])
+	}
+}
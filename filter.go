@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// accessCheckMaxAge is how stale a state may be when checking area and device_class filters
+// before a write
+const accessCheckMaxAge = time.Minute
+
+// AccessDeniedError is returned for entities hidden by the configured filters
+type AccessDeniedError struct {
+	EntityID string
+}
+
+func (e *AccessDeniedError) Error() string {
+	return fmt.Sprintf("entity %s is not available through this server", e.EntityID)
+}
+
+// entityPattern is a compiled entity_filter or entity_blacklist entry
+type entityPattern struct {
+	source string
+	re     *regexp.Regexp
+}
+
+// globPrefix marks a pattern as a glob like glob:light.kitchen_*; patterns without it are
+// regexes, so existing filters keep their meaning
+const globPrefix = "glob:"
+
+// globToRegexp translates a glob into an anchored regex: * matches any run of characters, ? one
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// compilePatterns compiles a filter list once at config load, naming the key of any invalid entry
+func compilePatterns(key string, patterns []string) ([]entityPattern, error) {
+	var compiled []entityPattern
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+
+		expr := pattern
+		if glob, ok := strings.CutPrefix(pattern, globPrefix); ok {
+			expr = globToRegexp(glob)
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern %q: %v", key, pattern, err)
+		}
+		compiled = append(compiled, entityPattern{source: pattern, re: re})
+	}
+	return compiled, nil
+}
+
+// compileDomainPatterns is compilePatterns where a bare domain such as "lock" stands for
+// all entities of that domain
+func compileDomainPatterns(key string, patterns []string) ([]entityPattern, error) {
+	expanded := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if domainPattern.MatchString(pattern) {
+			pattern = `^` + pattern + `\.`
+		}
+		expanded[i] = pattern
+	}
+	return compilePatterns(key, expanded)
+}
+
+var domainPattern = regexp.MustCompile(`^[a-z_]+$`)
+
+// matchesAny reports whether entityID equals or matches one of the patterns
+func matchesAny(patterns []entityPattern, entityID string) bool {
+	for _, pattern := range patterns {
+		if pattern.source == entityID || pattern.re.MatchString(entityID) {
+			return true
+		}
+	}
+	return false
+}
+
+// entityIDExposed applies entity_filter and entity_blacklist, and the caller's profile filters
+func (h *HAService) entityIDExposed(ctx context.Context, entityID string) bool {
+	if h.isEntityBlacklisted(entityID) {
+		return false
+	}
+	if len(h.entityFilter) > 0 && !h.isEntityWhitelisted(entityID) {
+		return false
+	}
+	if profile, enforced := profileFromContext(ctx); enforced {
+		return profile != nil && profile.allowsEntity(entityID)
+	}
+	return true
+}
+
+// hasStateFilters reports whether filters needing the entity's state and area are configured
+func (h *HAService) hasStateFilters() bool {
+	return len(h.config.AreaFilter) > 0 || len(h.config.AreaBlacklist) > 0 ||
+		len(h.config.DeviceClassFilter) > 0 || len(h.config.DeviceClassBlacklist) > 0
+}
+
+// checkEntityAccess returns an AccessDeniedError when the filters hide entityID, so tools can't
+// read or control entities that the listings don't show
+func (h *HAService) checkEntityAccess(ctx context.Context, entityID string) error {
+	if !h.entityIDExposed(ctx, entityID) {
+		h.logger.Printf("Access to %s denied by entity filters", entityID)
+		return &AccessDeniedError{EntityID: entityID}
+	}
+	if !h.hasStateFilters() {
+		return nil
+	}
+
+	_, err := h.getEntityState(ctx, entityID, accessCheckMaxAge)
+	return err
+}
+
+// deviceClassOf returns an entity's device_class attribute, or "" when it has none
+func deviceClassOf(state HAState) string {
+	deviceClass, _ := state.Attributes["device_class"].(string)
+	return deviceClass
+}
+
+// isDeviceClassAllowed applies device_class_filter and device_class_blacklist; entities without
+// a device class only pass when no device_class_filter is set
+func (h *HAService) isDeviceClassAllowed(state HAState) bool {
+	deviceClass := deviceClassOf(state)
+	if deviceClass != "" && containsFold(h.config.DeviceClassBlacklist, deviceClass) {
+		return false
+	}
+	if len(h.config.DeviceClassFilter) > 0 {
+		return deviceClass != "" && containsFold(h.config.DeviceClassFilter, deviceClass)
+	}
+	return true
+}
+
+// isAreaAllowed applies area_filter and area_blacklist; entities without an area only pass
+// when no area_filter is set
+func (h *HAService) isAreaAllowed(area *HAArea) bool {
+	for _, denied := range h.config.AreaBlacklist {
+		if matchesArea(area, denied) {
+			return false
+		}
+	}
+	if len(h.config.AreaFilter) == 0 {
+		return true
+	}
+	for _, allowed := range h.config.AreaFilter {
+		if matchesArea(area, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// cachedArea returns the area of an entity from the area cache, without refreshing it
+func cachedArea(entityID string) *HAArea {
+	areaCache.mu.RLock()
+	defer areaCache.mu.RUnlock()
+	return areaCache.areas[areaCache.entities[entityID]]
+}
+
+// stateEventExposed applies every filter to the entity of a state_changed event, with state
+// its new state (or its old one when it was removed). Events are handled on the WebSocket
+// reader, so areas come from the cache as it is.
+func (h *HAService) stateEventExposed(entityID string, state *HAState) bool {
+	if !h.entityIDExposed(context.Background(), entityID) {
+		return false
+	}
+	if state == nil {
+		if len(h.config.DeviceClassFilter) > 0 {
+			return false
+		}
+	} else if !h.isDeviceClassAllowed(*state) {
+		return false
+	}
+	if len(h.config.AreaFilter) > 0 || len(h.config.AreaBlacklist) > 0 {
+		return h.isAreaAllowed(cachedArea(entityID))
+	}
+	return true
+}
+
+// filterEntitiesByArea drops entities outside the allowed areas; states must be area-enriched
+func (h *HAService) filterEntitiesByArea(states []HAState) []HAState {
+	if len(h.config.AreaFilter) == 0 && len(h.config.AreaBlacklist) == 0 {
+		return states
+	}
+
+	var filtered []HAState
+	for _, state := range states {
+		if h.isAreaAllowed(state.Area) {
+			filtered = append(filtered, state)
+		}
+	}
+	return filtered
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(strings.TrimSpace(v), value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Output formats supported by the state tools
+const (
+	formatJSON     = "json"
+	formatMarkdown = "markdown"
+	formatCSV      = "csv"
+)
+
+// stateColumns returns the fixed columns followed by the union of attribute keys
+func stateColumns(states []HAState) []string {
+	keys := make(map[string]bool)
+	for _, state := range states {
+		for key := range state.Attributes {
+			if key != "friendly_name" {
+				keys[key] = true
+			}
+		}
+	}
+
+	attributes := make([]string, 0, len(keys))
+	for key := range keys {
+		attributes = append(attributes, key)
+	}
+	sort.Strings(attributes)
+
+	return append([]string{"entity_id", "name", "state", "area", "last_changed", "state_for", "capabilities"}, attributes...)
+}
+
+func stateRow(state HAState, columns []string) []string {
+	row := make([]string, len(columns))
+	for i, column := range columns {
+		switch column {
+		case "entity_id":
+			row[i] = state.EntityID
+		case "name":
+			row[i] = formatValue(state.Attributes["friendly_name"])
+		case "state":
+			row[i] = state.State
+		case "area":
+			if state.Area != nil {
+				row[i] = state.Area.Name
+			}
+		case "last_changed":
+			row[i] = state.LastChanged
+		case "state_for":
+			row[i] = state.StateFor
+		case "capabilities":
+			row[i] = strings.Join(state.Capabilities, " ")
+		default:
+			row[i] = formatValue(state.Attributes[column])
+		}
+	}
+	return row
+}
+
+// formatValue renders strings as-is and everything else as compact JSON
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
+
+func markdownTable(states []HAState) string {
+	if len(states) == 0 {
+		return "_No entities_\n"
+	}
+
+	escape := strings.NewReplacer("|", "\\|", "\n", " ")
+	columns := stateColumns(states)
+
+	var b strings.Builder
+	b.WriteString("| " + strings.Join(columns, " | ") + " |\n")
+	b.WriteString("|" + strings.Repeat(" --- |", len(columns)) + "\n")
+	for _, state := range states {
+		row := stateRow(state, columns)
+		for i := range row {
+			row[i] = escape.Replace(row[i])
+		}
+		b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+	}
+	return b.String()
+}
+
+func csvTable(states []HAState) (string, error) {
+	columns := stateColumns(states)
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(columns); err != nil {
+		return "", err
+	}
+	for _, state := range states {
+		if err := w.Write(stateRow(state, columns)); err != nil {
+			return "", err
+		}
+	}
+	w.Flush()
+	return buf.String(), w.Error()
+}
+
+// formatStates renders states as a markdown table or CSV
+func formatStates(states []HAState, format string) (string, error) {
+	switch format {
+	case formatMarkdown:
+		return markdownTable(states), nil
+	case formatCSV:
+		return csvTable(states)
+	default:
+		return "", fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// formatAreaGroups renders one markdown table per area, or a single CSV ordered by area
+func formatAreaGroups(groups []AreaGroup, format string) (string, error) {
+	switch format {
+	case formatMarkdown:
+		var b strings.Builder
+		for _, group := range groups {
+			fmt.Fprintf(&b, "### %s (%d on, %d off)\n\n", group.Name, group.On, group.Off)
+			area := &HAArea{AreaID: group.AreaID, Name: group.Name}
+			entities := make([]HAState, len(group.Entities))
+			for i, state := range group.Entities {
+				state.Area = area
+				entities[i] = state
+			}
+			b.WriteString(markdownTable(entities))
+			b.WriteString("\n")
+		}
+		return b.String(), nil
+	case formatCSV:
+		var states []HAState
+		for _, group := range groups {
+			area := &HAArea{AreaID: group.AreaID, Name: group.Name}
+			for _, state := range group.Entities {
+				state.Area = area
+				states = append(states, state)
+			}
+		}
+		return csvTable(states)
+	default:
+		return "", fmt.Errorf("unsupported format: %s", format)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// control_lawn_mower actions and the lawn_mower services they call
+var mowerServices = map[string]string{
+	"start_mowing": "start_mowing",
+	"pause":        "pause",
+	"dock":         "dock",
+}
+
+// addMowerDetails adds an activity attribute (the mower's state, e.g. mowing or docked) and,
+// when the mower doesn't report one itself, the battery_level of its device's battery sensor
+func (h *HAService) addMowerDetails(ctx context.Context, states []HAState) []HAState {
+	for i := range states {
+		if !strings.HasPrefix(states[i].EntityID, "lawn_mower.") {
+			continue
+		}
+
+		// States may be shared with the cache, so never write into their attributes
+		attrs := make(map[string]interface{}, len(states[i].Attributes)+2)
+		for key, value := range states[i].Attributes {
+			attrs[key] = value
+		}
+		attrs["activity"] = states[i].State
+		if _, ok := attrs["battery_level"]; !ok {
+			if level, ok := h.deviceBatteryLevel(ctx, states[i].EntityID); ok {
+				attrs["battery_level"] = level
+			}
+		}
+		states[i].Attributes = attrs
+	}
+	return states
+}
+
+// deviceBatteryLevel reads the exposed battery sensor on the same device as entityID
+func (h *HAService) deviceBatteryLevel(ctx context.Context, entityID string) (float64, bool) {
+	areaCache.mu.RLock()
+	deviceID := areaCache.deviceOf[entityID]
+	var candidates []string
+	if deviceID != "" {
+		for id, device := range areaCache.deviceOf {
+			if device == deviceID && strings.HasPrefix(id, "sensor.") && strings.Contains(id, "battery") {
+				candidates = append(candidates, id)
+			}
+		}
+	}
+	areaCache.mu.RUnlock()
+
+	sort.Strings(candidates)
+	for _, id := range candidates {
+		if !h.entityIDExposed(ctx, id) {
+			continue
+		}
+		state, err := h.fetchEntityState(ctx, id, accessCheckMaxAge)
+		if err != nil {
+			h.logger.Printf("Failed to read battery sensor %s: %v", id, err)
+			continue
+		}
+		if level, ok := batteryLevel(*state); ok {
+			return level, true
+		}
+	}
+	return 0, false
+}
+
+// control_lawn_mower handler
+func controlLawnMowerHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	entityID, err := haService.resolveDomainEntity(ctx, request, "lawn_mower")
+	if err != nil {
+		return toolError("Failed to control lawn mower", err), nil
+	}
+
+	action, err := request.RequireString("action")
+	if err != nil {
+		return mcp.NewToolResultError("action parameter is required"), nil
+	}
+	service, ok := mowerServices[action]
+	if !ok {
+		return mcp.NewToolResultError(fmt.Sprintf("Unsupported action: %s", action)), nil
+	}
+
+	return runServiceCalls(ctx, "lawn_mower", entityID, []serviceStep{{service: service}}, "Failed to control lawn mower"), nil
+}
+
+// irrigationZones returns the switches of an irrigation group: a configured
+// irrigation_groups entry, or else the switches carrying the label of that name
+func (h *HAService) irrigationZones(ctx context.Context, group string) ([]string, error) {
+	for name, zones := range h.config.IrrigationGroups {
+		if strings.EqualFold(name, group) {
+			for _, zone := range zones {
+				if !strings.HasPrefix(zone, "switch.") {
+					return nil, &InvalidRequestError{fmt.Sprintf("irrigation group %q: %s is not a switch", name, zone)}
+				}
+			}
+			return zones, nil
+		}
+	}
+
+	zones, err := h.expandTargets(ctx, "", "switch", group)
+	if err != nil {
+		return nil, fmt.Errorf("no irrigation group or labelled switches named %q", group)
+	}
+	return zones, nil
+}
+
+// control_irrigation handler
+func controlIrrigationHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	group, err := request.RequireString("group")
+	if err != nil {
+		return mcp.NewToolResultError("group parameter is required"), nil
+	}
+
+	var action string
+	switch request.GetString("action", "") {
+	case "start":
+		action = "on"
+	case "stop":
+		action = "off"
+	default:
+		return mcp.NewToolResultError("action parameter must be 'start' or 'stop'"), nil
+	}
+
+	zones, err := haService.irrigationZones(ctx, group)
+	if err != nil {
+		return toolError("Failed to find irrigation zones", err), nil
+	}
+	if err := haService.checkBatchSize(len(zones)); err != nil {
+		return toolError("Failed to control irrigation", err), nil
+	}
+
+	var errors []string
+	var started []string
+	for _, zone := range zones {
+		if _, err := haService.controlEntityWithRetry(ctx, zone, action, haService.config.BatchRetries); err != nil {
+			errors = append(errors, fmt.Sprintf("Zone %s: %v", zone, err))
+			continue
+		}
+		started = append(started, zone)
+	}
+
+	// Schedule the stop so the water is turned off even if the client goes away
+	minutes := request.GetFloat("duration_minutes", 0)
+	if action == "on" && minutes > 0 {
+		runAt := time.Now().Add(time.Duration(minutes * float64(time.Minute)))
+		for _, zone := range started {
+			if _, err := scheduler.Add(zone, "off", runAt, 0); err != nil {
+				errors = append(errors, fmt.Sprintf("Zone %s: failed to schedule stop: %v", zone, err))
+			}
+		}
+	}
+
+	if len(errors) > 0 {
+		return mcp.NewToolResultError(fmt.Sprintf("Irrigation group %s: %d of %d zones failed:\n%s",
+			group, len(errors), len(zones), strings.Join(errors, "\n"))), nil
+	}
+
+	message := fmt.Sprintf("Irrigation group %s: turned %s %s", group, action, strings.Join(zones, ", "))
+	if action == "on" && minutes > 0 {
+		message += fmt.Sprintf(" for %v minutes", minutes)
+	}
+	return mcp.NewToolResultText(message), nil
+}
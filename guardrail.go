@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GuardRail blocks service calls on matching entities while its conditions hold; a rule
+// without conditions always blocks
+type GuardRail struct {
+	Name           string   `json:"name"`
+	Entities       []string `json:"entities"`                   // domains, entity IDs, globs or regexes, e.g. ["siren"]
+	Services       []string `json:"services,omitempty"`         // blocked services, e.g. ["turn_on"] or ["lock.unlock"], all when empty
+	Between        string   `json:"between,omitempty"`          // local time window, e.g. "22:00-07:00"
+	WhenNobodyHome []string `json:"when_nobody_home,omitempty"` // presence entities (person, device_tracker, occupancy sensors) of which none may be home
+
+	entities   []entityPattern
+	start, end int // minutes after midnight of Between
+}
+
+// PolicyViolationError is returned for a service call a guard rail blocks
+type PolicyViolationError struct {
+	Rule     string
+	EntityID string
+	Service  string // domain.service
+	Reason   string
+}
+
+func (e *PolicyViolationError) Error() string {
+	return fmt.Sprintf("guard rail %q blocks %s on %s: %s", e.Rule, e.Service, e.EntityID, e.Reason)
+}
+
+// parseClockRange parses "HH:MM-HH:MM" into minutes after midnight
+func parseClockRange(value string) (int, int, error) {
+	from, to, ok := strings.Cut(value, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("expected HH:MM-HH:MM, got %q", value)
+	}
+	var minutes [2]int
+	for i, clock := range []string{from, to} {
+		t, err := time.Parse("15:04", strings.TrimSpace(clock))
+		if err != nil {
+			return 0, 0, fmt.Errorf("expected HH:MM-HH:MM, got %q", value)
+		}
+		minutes[i] = t.Hour()*60 + t.Minute()
+	}
+	return minutes[0], minutes[1], nil
+}
+
+func compileGuardRails(rails []GuardRail) ([]*GuardRail, error) {
+	var compiled []*GuardRail
+	for i := range rails {
+		rail := rails[i]
+		if rail.Name == "" {
+			rail.Name = fmt.Sprintf("guard rail %d", i+1)
+		}
+		if len(rail.Entities) == 0 {
+			return nil, fmt.Errorf("guard_rails[%d] (%s): entities is required", i, rail.Name)
+		}
+
+		var err error
+		rail.entities, err = compileDomainPatterns(fmt.Sprintf("guard_rails[%d].entities", i), rail.Entities)
+		if err != nil {
+			return nil, err
+		}
+		if rail.Between != "" {
+			rail.start, rail.end, err = parseClockRange(rail.Between)
+			if err != nil {
+				return nil, fmt.Errorf("guard_rails[%d] (%s): between: %v", i, rail.Name, err)
+			}
+		}
+		for _, presence := range rail.WhenNobodyHome {
+			if _, err := normalizeEntityID(presence); err != nil {
+				return nil, fmt.Errorf("guard_rails[%d] (%s): when_nobody_home: %v", i, rail.Name, err)
+			}
+		}
+		compiled = append(compiled, &rail)
+	}
+	return compiled, nil
+}
+
+// covers reports whether the rule applies to calling domain.service on entityID
+func (r *GuardRail) covers(entityID, domain, service string) bool {
+	if !matchesAny(r.entities, entityID) {
+		return false
+	}
+	if len(r.Services) == 0 {
+		return true
+	}
+	return containsString(r.Services, service) || containsString(r.Services, domain+"."+service)
+}
+
+// inWindow reports whether now falls in Between; windows may wrap past midnight
+func (r *GuardRail) inWindow(now time.Time) bool {
+	if r.Between == "" {
+		return true
+	}
+	minute := now.Hour()*60 + now.Minute()
+	if r.start <= r.end {
+		return minute >= r.start && minute < r.end
+	}
+	return minute >= r.start || minute < r.end
+}
+
+// nobodyHome reports whether none of the rule's presence entities is home. A presence
+// entity that can't be read counts as unknown, and the rule blocks rather than guess.
+func (h *HAService) nobodyHome(ctx context.Context, r *GuardRail) (bool, error) {
+	for _, presence := range r.WhenNobodyHome {
+		state, err := h.fetchEntityState(ctx, presence, accessCheckMaxAge)
+		if err != nil {
+			return false, fmt.Errorf("presence of %s is unknown: %w", presence, err)
+		}
+		if state.State == "home" || state.State == "on" {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// checkGuardRails runs before every service call and returns a PolicyViolationError for
+// the first rule that blocks it
+func (h *HAService) checkGuardRails(ctx context.Context, domain, service string, entityIDs []string) error {
+	if len(h.guardRails) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	for _, rail := range h.guardRails {
+		for _, entityID := range entityIDs {
+			if !rail.covers(entityID, domain, service) || !rail.inWindow(now) {
+				continue
+			}
+
+			var reasons []string
+			if rail.Between != "" {
+				reasons = append(reasons, "not allowed between "+strings.ReplaceAll(rail.Between, "-", " and "))
+			}
+			if len(rail.WhenNobodyHome) > 0 {
+				away, err := h.nobodyHome(ctx, rail)
+				switch {
+				case err != nil:
+					reasons = append(reasons, err.Error())
+				case !away:
+					continue
+				default:
+					reasons = append(reasons, "not allowed while nobody is home")
+				}
+			}
+			if len(reasons) == 0 {
+				reasons = append(reasons, "not allowed")
+			}
+
+			err := &PolicyViolationError{
+				Rule:     rail.Name,
+				EntityID: entityID,
+				Service:  domain + "." + service,
+				Reason:   strings.Join(reasons, ", "),
+			}
+			h.logger.Printf("Service call blocked: %v", err)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Health report returned by the health_check tool and /readyz
+type HealthReport struct {
+	Status          string `json:"status"` // "ok" or "unavailable"
+	Version         string `json:"version"`
+	HAURL           string `json:"ha_url,omitempty"`
+	HAReachable     bool   `json:"ha_reachable"`
+	HAError         string `json:"ha_error,omitempty"`
+	WebSocketOK     bool   `json:"websocket_ok"`
+	WebSocketError  string `json:"websocket_error,omitempty"`
+	AreaCacheUpdate string `json:"area_cache_updated,omitempty"`
+	AreaCacheAge    string `json:"area_cache_age,omitempty"`
+	StateCacheAge   string `json:"state_cache_age,omitempty"`
+	CheckedAt       string `json:"checked_at"`
+}
+
+// How long a REST check is reused, so that frequent probes don't each call HA
+const restCheckTTL = 5 * time.Second
+
+// restHealth is the last REST check; mu also makes concurrent probes share one check
+var restHealth struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+// cachedRESTCheck runs checkREST at most once per restCheckTTL
+func (h *HAService) cachedRESTCheck(ctx context.Context) error {
+	restHealth.mu.Lock()
+	defer restHealth.mu.Unlock()
+
+	if time.Since(restHealth.checkedAt) < restCheckTTL {
+		return restHealth.err
+	}
+	restHealth.err = h.checkREST(ctx)
+	restHealth.checkedAt = time.Now()
+	return restHealth.err
+}
+
+// healthReport checks REST, cached briefly, and reports the state of the shared WebSocket
+// connection rather than opening one per check
+func (h *HAService) healthReport(ctx context.Context) HealthReport {
+	report := HealthReport{
+		Status:    "ok",
+		Version:   serverVersion,
+		HAURL:     h.config.HAURL,
+		CheckedAt: time.Now().Format(time.RFC3339),
+	}
+
+	if err := h.cachedRESTCheck(ctx); err != nil {
+		report.HAError = err.Error()
+	} else {
+		report.HAReachable = true
+	}
+
+	if err := h.ws.status(); err != nil {
+		report.WebSocketError = fmt.Sprintf("Home Assistant WebSocket not connected: %v", err)
+	} else {
+		report.WebSocketOK = true
+	}
+
+	areaCache.mu.RLock()
+	lastUpdate := areaCache.lastUpdate
+	areaCache.mu.RUnlock()
+	if !lastUpdate.IsZero() {
+		report.AreaCacheUpdate = lastUpdate.Format(time.RFC3339)
+		report.AreaCacheAge = time.Since(lastUpdate).Round(time.Second).String()
+	}
+
+	if age, ok := h.stateCache.age(); ok {
+		report.StateCacheAge = age.Round(time.Second).String()
+	}
+
+	if !report.HAReachable || !report.WebSocketOK {
+		report.Status = "unavailable"
+	}
+	return report
+}
+
+// health_check handler
+func healthCheckHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	report := haService.healthReport(ctx)
+
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize health report: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Bridge status: %s\n%s", report.Status, string(reportJSON))), nil
+}
+
+// startHealthServer serves /healthz (process liveness) and /readyz (HA reachable) in the
+// background. The endpoints are unauthenticated, so /readyz leaves out the HA URL and the
+// error details, which health_check reports.
+func startHealthServer(addr string) {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeHealthJSON(w, http.StatusOK, map[string]string{
+			"status":  "ok",
+			"version": serverVersion,
+		})
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		report := haService.healthReport(r.Context())
+		status := http.StatusOK
+		if report.Status != "ok" {
+			status = http.StatusServiceUnavailable
+		}
+		report.HAURL = ""
+		if report.HAError != "" {
+			report.HAError = "unreachable"
+		}
+		if report.WebSocketError != "" {
+			report.WebSocketError = "not connected"
+		}
+		writeHealthJSON(w, status, report)
+	})
+
+	go func() {
+		haService.logger.Printf("Health endpoints listening on %s", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			haService.logger.Printf("Health server failed: %v", err)
+		}
+	}()
+}
+
+func writeHealthJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Limits of get_entity_history
+const (
+	defaultHistoryHours = 24
+	maxHistoryHours     = 24 * 31
+	maxHistoryPoints    = 500 // raw points returned without aggregation
+)
+
+// History aggregation intervals
+const (
+	intervalHour = "hour"
+	intervalDay  = "day"
+)
+
+// HistoryPoint is one recorded state change
+type HistoryPoint struct {
+	State       string `json:"state"`
+	LastChanged string `json:"last_changed"`
+}
+
+// HistoryBucket summarizes an hour or day. Numeric entities get time-weighted mean, min
+// and max; the others the state they spent most of the bucket in.
+type HistoryBucket struct {
+	Start   string   `json:"start"`
+	Mean    *float64 `json:"mean,omitempty"`
+	Min     *float64 `json:"min,omitempty"`
+	Max     *float64 `json:"max,omitempty"`
+	State   string   `json:"state,omitempty"`
+	Changes int      `json:"changes"` // state changes recorded in the bucket
+}
+
+// EntityHistory is the get_entity_history response
+type EntityHistory struct {
+	EntityID  string          `json:"entity_id"`
+	Start     string          `json:"start"`
+	End       string          `json:"end"`
+	Unit      string          `json:"unit,omitempty"`
+	Interval  string          `json:"interval,omitempty"`
+	Buckets   []HistoryBucket `json:"buckets,omitempty"`
+	Points    []HistoryPoint  `json:"points,omitempty"`
+	Truncated bool            `json:"truncated,omitempty"` // only the last maxHistoryPoints points are returned
+}
+
+// historySegment is a state held from start until end
+type historySegment struct {
+	state      string
+	start, end time.Time
+}
+
+// fetchHistory reads the state changes of entityID between start and end; the first point
+// is the state at start
+func (h *HAService) fetchHistory(ctx context.Context, entityID string, start, end time.Time) ([]HistoryPoint, string, error) {
+	endpoint := fmt.Sprintf("/api/history/period/%s?filter_entity_id=%s&end_time=%s&minimal_response&significant_changes_only=0",
+		url.PathEscape(start.UTC().Format(time.RFC3339)), url.QueryEscape(entityID), url.QueryEscape(end.UTC().Format(time.RFC3339)))
+	resp, err := h.makeHARequest(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, "", fmt.Errorf("HA API returned status %d for history", resp.StatusCode)
+	}
+
+	// With minimal_response only the first point carries attributes
+	var history [][]struct {
+		State       string                 `json:"state"`
+		LastChanged string                 `json:"last_changed"`
+		Attributes  map[string]interface{} `json:"attributes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		return nil, "", err
+	}
+
+	var points []HistoryPoint
+	var unit string
+	for _, series := range history {
+		for i, point := range series {
+			if i == 0 {
+				unit, _ = point.Attributes["unit_of_measurement"].(string)
+			}
+			points = append(points, HistoryPoint{State: point.State, LastChanged: point.LastChanged})
+		}
+	}
+	return points, unit, nil
+}
+
+// historySegments turns points into the periods each state was held, clipped to end
+func historySegments(points []HistoryPoint, end time.Time) []historySegment {
+	var segments []historySegment
+	for i, point := range points {
+		start, err := time.Parse(time.RFC3339Nano, point.LastChanged)
+		if err != nil {
+			continue
+		}
+		segmentEnd := end
+		if i+1 < len(points) {
+			if next, err := time.Parse(time.RFC3339Nano, points[i+1].LastChanged); err == nil {
+				segmentEnd = next
+			}
+		}
+		if segmentEnd.After(start) {
+			segments = append(segments, historySegment{state: point.State, start: start, end: segmentEnd})
+		}
+	}
+	return segments
+}
+
+// truncateInterval returns the start of the hour or local day t falls in
+func truncateInterval(t time.Time, interval string) time.Time {
+	t = t.Local()
+	if interval == intervalDay {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+	return t.Truncate(time.Hour)
+}
+
+// nextInterval returns the start of the following hour or day
+func nextInterval(t time.Time, interval string) time.Time {
+	if interval == intervalDay {
+		return t.AddDate(0, 0, 1)
+	}
+	return t.Add(time.Hour)
+}
+
+// aggregateHistory summarizes segments per hour or day between start and end
+func aggregateHistory(segments []historySegment, start, end time.Time, interval string) []HistoryBucket {
+	var buckets []HistoryBucket
+	for bucketStart := truncateInterval(start, interval); bucketStart.Before(end); bucketStart = nextInterval(bucketStart, interval) {
+		bucketEnd := nextInterval(bucketStart, interval)
+		bucket := HistoryBucket{Start: bucketStart.Format(time.RFC3339)}
+
+		var weighted, seconds float64
+		var low, high float64
+		numeric := false
+		durations := make(map[string]time.Duration)
+		for i, segment := range segments {
+			// The first segment is the state at the start of the range, not a change
+			if i > 0 && !segment.start.Before(bucketStart) && segment.start.Before(bucketEnd) {
+				bucket.Changes++
+			}
+			from, to := maxTime(segment.start, bucketStart), minTime(segment.end, bucketEnd)
+			if !to.After(from) {
+				continue
+			}
+			duration := to.Sub(from)
+			durations[segment.state] += duration
+
+			value, err := strconv.ParseFloat(segment.state, 64)
+			if err != nil {
+				continue
+			}
+			weighted += value * duration.Seconds()
+			seconds += duration.Seconds()
+			if !numeric || value < low {
+				low = value
+			}
+			if !numeric || value > high {
+				high = value
+			}
+			numeric = true
+		}
+		if len(durations) == 0 {
+			continue
+		}
+
+		if numeric {
+			mean := weighted / seconds
+			bucket.Mean, bucket.Min, bucket.Max = &mean, &low, &high
+		} else {
+			states := make([]string, 0, len(durations))
+			for state := range durations {
+				states = append(states, state)
+			}
+			sort.Slice(states, func(i, j int) bool {
+				if durations[states[i]] != durations[states[j]] {
+					return durations[states[i]] > durations[states[j]]
+				}
+				return states[i] < states[j]
+			})
+			bucket.State = states[0]
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// get_entity_history handler
+func getEntityHistoryHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	entityID, err := haService.resolveEntityRef(ctx, request.GetString("entity_id", ""), request.GetString("name", ""))
+	if err != nil {
+		return toolError("Failed to resolve entity", err), nil
+	}
+	if err := haService.checkEntityAccess(ctx, entityID); err != nil {
+		return toolError("Failed to get history", err), nil
+	}
+
+	hours := request.GetFloat("hours", defaultHistoryHours)
+	if hours <= 0 || hours > maxHistoryHours {
+		return mcp.NewToolResultError(fmt.Sprintf("hours must be between 0 and %d", maxHistoryHours)), nil
+	}
+	interval := request.GetString("interval", "")
+	if interval != "" && interval != intervalHour && interval != intervalDay {
+		return mcp.NewToolResultError(fmt.Sprintf("Unsupported interval: %s", interval)), nil
+	}
+
+	history, summary, err := haService.entityHistory(ctx, entityID, hours, interval)
+	if err != nil {
+		return toolError("Failed to get history", err), nil
+	}
+
+	historyJSON, err := json.Marshal(history)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize history: %v", err)), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("%s:\n%s", summary, string(historyJSON))), nil
+}
+
+// entityHistory reads the last hours of entityID, aggregated when interval is set, and
+// returns it with a summary
+func (h *HAService) entityHistory(ctx context.Context, entityID string, hours float64, interval string) (*EntityHistory, string, error) {
+	end := time.Now()
+	start := end.Add(-time.Duration(hours * float64(time.Hour)))
+	points, unit, err := h.fetchHistory(ctx, entityID, start, end)
+	if err != nil {
+		return nil, "", err
+	}
+
+	history := &EntityHistory{
+		EntityID: entityID,
+		Start:    start.Format(time.RFC3339),
+		End:      end.Format(time.RFC3339),
+		Unit:     unit,
+		Interval: interval,
+	}
+	var summary string
+	if interval != "" {
+		history.Buckets = aggregateHistory(historySegments(points, end), start, end, interval)
+		summary = fmt.Sprintf("%d history points of %s aggregated into %d %s buckets", len(points), entityID, len(history.Buckets), interval)
+	} else {
+		if len(points) > maxHistoryPoints {
+			points = points[len(points)-maxHistoryPoints:]
+			history.Truncated = true
+		}
+		history.Points = points
+		summary = fmt.Sprintf("%d history points of %s", len(points), entityID)
+		if history.Truncated {
+			summary += fmt.Sprintf(" (the last %d, use interval to aggregate)", maxHistoryPoints)
+		}
+	}
+	return history, summary, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// How long a successful result is replayed for a repeated idempotency_key
+const idempotencyWindow = 10 * time.Minute
+
+// idempotentCall is a call seen with an idempotency key; done is closed once result is set
+type idempotentCall struct {
+	arguments string
+	done      chan struct{}
+	result    *mcp.CallToolResult
+	finished  time.Time
+}
+
+// idempotencyStore remembers control calls by tool and key, so an agent retrying a call
+// (e.g. after a timeout on its side) gets the first result instead of toggling twice
+type idempotencyStore struct {
+	mu    sync.Mutex
+	calls map[string]*idempotentCall
+}
+
+var idempotentCalls = &idempotencyStore{calls: make(map[string]*idempotentCall)}
+
+// idempotencyParam declares the idempotency_key argument of the control tools
+func idempotencyParam() mcp.ToolOption {
+	return mcp.WithString("idempotency_key",
+		mcp.Description("Unique key for this command; repeating a call with the same key within 10 minutes returns the first result instead of executing it again"),
+	)
+}
+
+// callArguments fingerprints the arguments of a call, without the ones that don't change
+// what it does
+func callArguments(request mcp.CallToolRequest) string {
+	arguments := make(map[string]interface{})
+	for key, value := range request.GetArguments() {
+		if key != "idempotency_key" && key != "timeout_ms" && key != "confirmation_token" {
+			arguments[key] = value
+		}
+	}
+	data, _ := json.Marshal(arguments) // map keys are sorted
+	return string(data)
+}
+
+// start registers a call, or returns the earlier call with the same key
+func (s *idempotencyStore) start(key, arguments string, now time.Time) (*idempotentCall, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for k, call := range s.calls {
+		if !call.finished.IsZero() && now.Sub(call.finished) > idempotencyWindow {
+			delete(s.calls, k)
+		}
+	}
+
+	if call, ok := s.calls[key]; ok {
+		return call, true
+	}
+	call := &idempotentCall{arguments: arguments, done: make(chan struct{})}
+	s.calls[key] = call
+	return call, false
+}
+
+// finish records the result of a call; failed calls are forgotten so a retry runs again
+func (s *idempotencyStore) finish(key string, call *idempotentCall, result *mcp.CallToolResult, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	call.result = result
+	call.finished = now
+	if result == nil || result.IsError {
+		delete(s.calls, key)
+	}
+	close(call.done)
+}
+
+// idempotencyMiddleware replays the result of an earlier call with the same tool and
+// idempotency_key; a concurrent duplicate waits for the first call to finish
+func idempotencyMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		key := request.GetString("idempotency_key", "")
+		if key == "" {
+			return next(ctx, request)
+		}
+		if profile, enforced := profileFromContext(ctx); enforced && profile != nil {
+			key = profile.Name + "/" + key
+		}
+		key = request.Params.Name + "/" + key
+		arguments := callArguments(request)
+
+		for {
+			call, seen := idempotentCalls.start(key, arguments, time.Now())
+			if !seen {
+				result, err := next(ctx, request)
+				idempotentCalls.finish(key, call, result, time.Now())
+				return result, err
+			}
+
+			if call.arguments != arguments {
+				return mcp.NewToolResultError(fmt.Sprintf("idempotency_key %q was already used with different arguments", request.GetString("idempotency_key", ""))), nil
+			}
+			select {
+			case <-call.done:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if call.result != nil && !call.result.IsError {
+				haService.logger.Printf("Replaying %s result for idempotency key %q", request.Params.Name, request.GetString("idempotency_key", ""))
+				return call.result, nil
+			}
+			// The first call failed and was forgotten, run this one
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sort"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Build information, set at build time with
+// -ldflags "-X main.serverVersion=... -X main.buildCommit=... -X main.buildDate=..."
+var (
+	serverVersion = "2.0.0"
+	buildCommit   = ""
+	buildDate     = ""
+)
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Version      string `json:"version"`
+	Commit       string `json:"commit,omitempty"`
+	BuildDate    string `json:"build_date,omitempty"`
+	GoVersion    string `json:"go_version"`
+	MCPGoVersion string `json:"mcp_go_version,omitempty"`
+}
+
+// ServerInfo is the get_server_info response
+type ServerInfo struct {
+	BuildInfo
+	Transport string        `json:"transport"`
+	HAURL     string        `json:"ha_url"`
+	Tools     int           `json:"tools"`
+	Features  []string      `json:"features"` // enabled optional features, sorted
+	Update    *UpdateStatus `json:"update,omitempty"`
+}
+
+// readBuildInfo combines the ldflags values with what the Go toolchain embedded; a plain
+// go build from a git checkout still records the commit and its time
+func readBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   serverVersion,
+		Commit:    buildCommit,
+		BuildDate: buildDate,
+		GoVersion: runtime.Version(),
+	}
+
+	embedded, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	for _, dep := range embedded.Deps {
+		if dep.Path == "github.com/mark3labs/mcp-go" {
+			info.MCPGoVersion = dep.Version
+		}
+	}
+	for _, setting := range embedded.Settings {
+		switch {
+		case setting.Key == "vcs.revision" && info.Commit == "":
+			info.Commit = setting.Value
+		case setting.Key == "vcs.time" && info.BuildDate == "":
+			info.BuildDate = setting.Value
+		case setting.Key == "vcs.modified" && setting.Value == "true" && buildCommit == "" && info.Commit != "":
+			info.Commit += "-dirty"
+		}
+	}
+	return info
+}
+
+// String renders the build info for --version
+func (b BuildInfo) String() string {
+	s := "ha-mcp-server " + b.Version
+	if b.Commit != "" {
+		s += " (" + b.Commit
+		if b.BuildDate != "" {
+			s += ", " + b.BuildDate
+		}
+		s += ")"
+	}
+	s += "\n" + b.GoVersion
+	if b.MCPGoVersion != "" {
+		s += ", mcp-go " + b.MCPGoVersion
+	}
+	return s
+}
+
+// enabledFeatures lists the optional features turned on in the configuration
+func (h *HAService) enabledFeatures() []string {
+	c := h.config
+	flags := map[string]bool{
+		"read_only":         c.ReadOnly,
+		"admin_tools":       c.AdminTools && !c.ReadOnly,
+		"degraded_mode":     c.DegradedMode,
+		"verify_writes":     c.VerifyWrites,
+		"compact_responses": c.CompactResponses,
+		"dynamic_tools":     c.DynamicTools,
+		"heuristic_areas":   c.HeuristicAreas,
+		"discover":          c.Discover,
+		"rate_limit":        h.rateLimiter != nil,
+		"state_poll":        h.statePollInterval > 0,
+		"health_endpoints":  c.HealthAddr != "",
+		"webhooks":          len(c.Webhooks) > 0,
+		"mqtt":              c.MQTT != nil,
+		"profiles":          len(h.profiles) > 0,
+		"unit_conversion":   c.UnitSystem != "",
+		"attribute_policy":  !c.Attributes.isEmpty(),
+		"aliases":           len(c.Aliases) > 0,
+		"irrigation_groups": len(c.IrrigationGroups) > 0,
+		"token_refresh":     c.TokenRefreshCommand != "",
+		"api_key":           c.Server.APIKey != "",
+		"tls":               c.Server.TLSCert != "",
+		"event_buffer":      h.events != nil,
+		"pprof":             c.PprofAddr != "",
+		"macros":            len(c.Macros) > 0,
+		"guard_rails":       len(h.guardRails) > 0,
+		"confirm_entities":  len(h.confirmEntities) > 0,
+		"approval":          len(h.approvalEntities) > 0,
+	}
+
+	features := []string{}
+	for name, enabled := range flags {
+		if enabled {
+			features = append(features, name)
+		}
+	}
+	sort.Strings(features)
+	return features
+}
+
+// get_server_info handler
+func getServerInfoHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	info := ServerInfo{
+		BuildInfo: readBuildInfo(),
+		Transport: haService.transport,
+		HAURL:     haService.config.HAURL,
+		Tools:     haService.toolCount - dynamicTools.hiddenCount(),
+		Features:  haService.enabledFeatures(),
+		Update:    currentUpdateStatus(),
+	}
+
+	infoJSON, err := json.Marshal(info)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize server info: %v", err)), nil
+	}
+
+	summary := fmt.Sprintf("ha-mcp-server %s on %s transport", info.Version, info.Transport)
+	if info.Update != nil && info.Update.UpdateAvailable {
+		summary += fmt.Sprintf(", version %s is available", info.Update.LatestVersion)
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("%s:\n%s", summary, string(infoJSON))), nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ConfigEntry is a configured integration instance as returned by config_entries/get
+type ConfigEntry struct {
+	EntryID    string `json:"entry_id"`
+	Domain     string `json:"domain"`
+	Title      string `json:"title"`
+	State      string `json:"state"` // loaded, setup_error, setup_retry, not_loaded, ...
+	Source     string `json:"source,omitempty"`
+	DisabledBy string `json:"disabled_by,omitempty"`
+	Reason     string `json:"reason,omitempty"` // why setup failed, when it did
+}
+
+// getConfigEntries lists config entries, optionally limited to a domain and a state
+func (h *HAService) getConfigEntries(ctx context.Context, domain, state string) ([]ConfigEntry, error) {
+	var entries []ConfigEntry
+	if err := h.ws.CommandInto(ctx, "config_entries/get", nil, &entries); err != nil {
+		return nil, err
+	}
+
+	result := []ConfigEntry{}
+	for _, entry := range entries {
+		if (domain == "" || entry.Domain == domain) && (state == "" || entry.State == state) {
+			result = append(result, entry)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Domain != result[j].Domain {
+			return result[i].Domain < result[j].Domain
+		}
+		return result[i].Title < result[j].Title
+	})
+	return result, nil
+}
+
+// reloadConfigEntry reloads one config entry and reports whether HA needs a restart for it
+func (h *HAService) reloadConfigEntry(ctx context.Context, entryID string) (bool, error) {
+	resp, err := h.makeHARequest(ctx, "POST", "/api/config/config_entries/entry/"+entryID+"/reload", nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		return false, &InvalidRequestError{fmt.Sprintf("config entry %s not found", entryID)}
+	}
+	if resp.StatusCode != 200 {
+		return false, fmt.Errorf("HA API returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		RequireRestart bool `json:"require_restart"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return result.RequireRestart, nil
+}
+
+// list_integrations handler
+func listIntegrationsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	entries, err := haService.getConfigEntries(ctx, request.GetString("domain", ""), request.GetString("state", ""))
+	if err != nil {
+		return toolError("Failed to list integrations", err), nil
+	}
+
+	failed := 0
+	for _, entry := range entries {
+		if entry.State != "loaded" && entry.State != "not_loaded" {
+			failed++
+		}
+	}
+
+	entriesJSON, err := json.Marshal(entries)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize integrations: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Found %d integrations (%d not loaded correctly):\n%s", len(entries), failed, string(entriesJSON))), nil
+}
+
+// reload_integration handler
+func reloadIntegrationHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	entryID := request.GetString("entry_id", "")
+	domain := request.GetString("domain", "")
+
+	var entryIDs []string
+	switch {
+	case entryID != "":
+		entryIDs = []string{entryID}
+	case domain != "":
+		entries, err := haService.getConfigEntries(ctx, domain, "")
+		if err != nil {
+			return toolError("Failed to list integrations", err), nil
+		}
+		for _, entry := range entries {
+			entryIDs = append(entryIDs, entry.EntryID)
+		}
+		if len(entryIDs) == 0 {
+			return mcp.NewToolResultError(fmt.Sprintf("No config entries for integration %s", domain)), nil
+		}
+	default:
+		return mcp.NewToolResultError("entry_id or domain parameter is required"), nil
+	}
+
+	var restart, errors []string
+	for _, id := range entryIDs {
+		haService.logger.Printf("Reloading config entry %s", id)
+		requireRestart, err := haService.reloadConfigEntry(ctx, id)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("Entry %s: %v", id, err))
+			continue
+		}
+		if requireRestart {
+			restart = append(restart, id)
+		}
+	}
+
+	if len(errors) > 0 {
+		return mcp.NewToolResultError(fmt.Sprintf("Reloaded %d of %d config entries:\n%s",
+			len(entryIDs)-len(errors), len(entryIDs), strings.Join(errors, "\n"))), nil
+	}
+	message := fmt.Sprintf("Reloaded %d config entries", len(entryIDs))
+	if len(restart) > 0 {
+		message += fmt.Sprintf("; Home Assistant must be restarted to apply %s", strings.Join(restart, ", "))
+	}
+	return mcp.NewToolResultText(message), nil
+}
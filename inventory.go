@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// EntityInventory is the get_entity_inventory response: counts of the exposed entities
+type EntityInventory struct {
+	Total         int            `json:"total"`
+	ByDomain      map[string]int `json:"by_domain"`
+	ByArea        map[string]int `json:"by_area"`         // area names; "Unassigned" for entities without one
+	ByDeviceClass map[string]int `json:"by_device_class"` // "domain.device_class", e.g. "binary_sensor.motion"
+	Unavailable   int            `json:"unavailable"`
+}
+
+// countInventory tallies states per domain, area and device class
+func countInventory(states []HAState) EntityInventory {
+	inventory := EntityInventory{
+		ByDomain:      make(map[string]int),
+		ByArea:        make(map[string]int),
+		ByDeviceClass: make(map[string]int),
+	}
+	for _, state := range states {
+		inventory.Total++
+		domain, _, _ := strings.Cut(state.EntityID, ".")
+		inventory.ByDomain[domain]++
+
+		area := "Unassigned"
+		if state.Area != nil {
+			area = state.Area.Name
+		}
+		inventory.ByArea[area]++
+
+		if deviceClass := deviceClassOf(state); deviceClass != "" {
+			inventory.ByDeviceClass[domain+"."+deviceClass]++
+		}
+		if state.State == "unavailable" {
+			inventory.Unavailable++
+		}
+	}
+	return inventory
+}
+
+// get_entity_inventory handler
+func getEntityInventoryHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	maxAge := time.Duration(request.GetFloat("max_age", 0) * float64(time.Second))
+
+	states, err := haService.getRawStates(ctx, maxAge)
+	if err != nil {
+		return toolError("Failed to get states", err), nil
+	}
+
+	// Device classes are read before the attribute policy would drop them
+	inventory := countInventory(haService.filterExposed(ctx, states))
+
+	inventoryJSON, err := json.Marshal(inventory)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize inventory: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("%d entities in %d domains and %d areas:\n%s",
+		inventory.Total, len(inventory.ByDomain), len(inventory.ByArea), string(inventoryJSON))), nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Languages the human-readable parts of tool results can be written in
+var languages = []string{"en", "cs", "de"}
+
+// Translations of result summaries, keyed by the English format; messages without a
+// translation stay in English. Formats may reorder their arguments with %[n]s.
+var translations = map[string]map[string]string{
+	"cs": {
+		"Successfully turned %s on":                                 "%s úspěšně zapnuto",
+		"Successfully turned %s off":                                "%s úspěšně vypnuto",
+		"Turned %s on, but it still reports %s after %v":            "%[1]s zapnuto, ale po %[3]v stále hlásí %[2]s",
+		"Turned %s off, but it still reports %s after %v":           "%[1]s vypnuto, ale po %[3]v stále hlásí %[2]s",
+		"Successfully updated %s: %s":                               "%s úspěšně aktualizováno: %s",
+		"Successfully pressed %s":                                   "%s úspěšně stisknuto",
+		"Successfully set %s to %s":                                 "%s úspěšně nastaveno na %s",
+		"Sent %s to %s":                                             "Do %[2]s odesláno: %[1]s",
+		"Processed %d entities: %d successful, %d failed":           "Zpracováno entit: %d, úspěšně: %d, neúspěšně: %d",
+		"Entity %s is %s":                                           "Entita %s je %s",
+		"Read %d of %d entities":                                    "Načteno %d z %d entit",
+		"Found %d controllable entities":                            "Nalezeno ovladatelných entit: %d",
+		"Found %d controllable entities, showing %d from offset %d": "Nalezeno ovladatelných entit: %d, zobrazeno %d od pozice %d",
+		"Macro %s ran %d steps: %s":                                 "Makro %[1]s dokončeno (kroky: %[2]d): %[3]s",
+		"Restored %d entities from snapshot %s":                     "Ze snímku %[2]s obnoveno entit: %[1]d",
+		"Cancelled scheduled action %s":                             "Naplánovaná akce %s zrušena",
+	},
+	"de": {
+		"Successfully turned %s on":                                 "%s erfolgreich eingeschaltet",
+		"Successfully turned %s off":                                "%s erfolgreich ausgeschaltet",
+		"Turned %s on, but it still reports %s after %v":            "%[1]s eingeschaltet, meldet nach %[3]v aber noch %[2]s",
+		"Turned %s off, but it still reports %s after %v":           "%[1]s ausgeschaltet, meldet nach %[3]v aber noch %[2]s",
+		"Successfully updated %s: %s":                               "%s erfolgreich aktualisiert: %s",
+		"Successfully pressed %s":                                   "%s erfolgreich gedrückt",
+		"Successfully set %s to %s":                                 "%s erfolgreich auf %s gesetzt",
+		"Sent %s to %s":                                             "%s an %s gesendet",
+		"Processed %d entities: %d successful, %d failed":           "%d Entitäten verarbeitet: %d erfolgreich, %d fehlgeschlagen",
+		"Entity %s is %s":                                           "Entität %s ist %s",
+		"Read %d of %d entities":                                    "%d von %d Entitäten gelesen",
+		"Found %d controllable entities":                            "%d steuerbare Entitäten gefunden",
+		"Found %d controllable entities, showing %d from offset %d": "%d steuerbare Entitäten gefunden, %d ab Offset %d angezeigt",
+		"Macro %s ran %d steps: %s":                                 "Makro %s hat %d Schritte ausgeführt: %s",
+		"Restored %d entities from snapshot %s":                     "%d Entitäten aus Snapshot %s wiederhergestellt",
+		"Cancelled scheduled action %s":                             "Geplante Aktion %s abgebrochen",
+	},
+}
+
+// Duration units by language: the form for 1, for 2-4 (Czech) and for other counts
+var durationUnits = map[string]map[string][3]string{
+	"en": {
+		"day":    {"day", "days", "days"},
+		"hour":   {"hour", "hours", "hours"},
+		"minute": {"minute", "minutes", "minutes"},
+		"second": {"second", "seconds", "seconds"},
+	},
+	"cs": {
+		"day":    {"den", "dny", "dní"},
+		"hour":   {"hodina", "hodiny", "hodin"},
+		"minute": {"minuta", "minuty", "minut"},
+		"second": {"sekunda", "sekundy", "sekund"},
+	},
+	"de": {
+		"day":    {"Tag", "Tage", "Tage"},
+		"hour":   {"Stunde", "Stunden", "Stunden"},
+		"minute": {"Minute", "Minuten", "Minuten"},
+		"second": {"Sekunde", "Sekunden", "Sekunden"},
+	},
+}
+
+// validateLanguage normalizes a language code, English when empty
+func validateLanguage(language string) (string, error) {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if language == "" {
+		return "en", nil
+	}
+	if !containsString(languages, language) {
+		return "", fmt.Errorf("invalid language %q: must be one of %s", language, strings.Join(languages, ", "))
+	}
+	return language, nil
+}
+
+type languageKey struct{}
+
+// languageParam declares the language argument of tools with human-readable results
+func languageParam() mcp.ToolOption {
+	return mcp.WithString("language",
+		mcp.Description("Language of the human-readable parts of the result, such as summaries and durations (default: the server's language)"),
+		mcp.Enum(languages...),
+	)
+}
+
+// languageMiddleware applies a call's language argument to the results of its handler
+func languageMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if _, ok := request.GetArguments()["language"]; !ok {
+			return next(ctx, request)
+		}
+		language, err := validateLanguage(request.GetString("language", ""))
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return next(context.WithValue(ctx, languageKey{}, language), request)
+	}
+}
+
+// languageFromContext returns the language of the call in ctx, or the configured one
+func languageFromContext(ctx context.Context) string {
+	if language, ok := ctx.Value(languageKey{}).(string); ok {
+		return language
+	}
+	if haService != nil && haService.config.Language != "" {
+		return haService.config.Language
+	}
+	return "en"
+}
+
+// localize formats a result message in the language of ctx
+func localize(ctx context.Context, format string, args ...interface{}) string {
+	if translated, ok := translations[languageFromContext(ctx)][format]; ok {
+		format = translated
+	}
+	return fmt.Sprintf(format, args...)
+}
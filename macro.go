@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Longest a macro may wait in total; longer routines belong in schedule_action
+const maxMacroDelay = 5 * time.Minute
+
+// Macro is a named routine of service calls run by run_macro
+type Macro struct {
+	Description string      `json:"description,omitempty"`
+	Steps       []MacroStep `json:"steps"`
+}
+
+// MacroStep calls a service on an entity, after waiting Delay; a step with only a delay
+// just waits
+type MacroStep struct {
+	EntityID string                 `json:"entity_id,omitempty"` // entity ID or alias
+	Action   string                 `json:"action,omitempty"`    // service of the entity's domain, e.g. "turn_on", "open_valve"; "on" and "off" are short for turn_on and turn_off
+	Data     map[string]interface{} `json:"data,omitempty"`      // service data, e.g. {"brightness_pct": 30}
+	Delay    string                 `json:"delay,omitempty"`     // wait before the step, e.g. "30s"
+}
+
+var servicePattern = regexp.MustCompile(`^[a-z_]+$`)
+
+// service returns the HA service the step's action names
+func (s MacroStep) service() string {
+	switch s.Action {
+	case "on":
+		return "turn_on"
+	case "off":
+		return "turn_off"
+	}
+	return s.Action
+}
+
+// validateMacros checks macros at config load; entity IDs are resolved when the macro runs,
+// since they may be aliases
+func validateMacros(macros map[string]Macro) error {
+	for name, macro := range macros {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("macros: name is required")
+		}
+		if len(macro.Steps) == 0 {
+			return fmt.Errorf("macros: %s has no steps", name)
+		}
+
+		var total time.Duration
+		for i, step := range macro.Steps {
+			if step.Delay != "" {
+				delay, err := time.ParseDuration(step.Delay)
+				if err != nil || delay < 0 {
+					return fmt.Errorf("macros: %s step %d: invalid delay %q", name, i+1, step.Delay)
+				}
+				total += delay
+			}
+			switch {
+			case step.EntityID == "" && (step.Action != "" || step.Data != nil):
+				return fmt.Errorf("macros: %s step %d: entity_id is required with an action", name, i+1)
+			case step.EntityID == "" && step.Delay == "":
+				return fmt.Errorf("macros: %s step %d: needs an entity_id and action or a delay", name, i+1)
+			case step.EntityID != "" && !servicePattern.MatchString(step.service()):
+				return fmt.Errorf("macros: %s step %d: invalid action %q", name, i+1, step.Action)
+			}
+		}
+		if total > maxMacroDelay {
+			return fmt.Errorf("macros: %s waits %v in total, at most %v is allowed (use schedule_action for longer routines)", name, total, maxMacroDelay)
+		}
+	}
+	return nil
+}
+
+// findMacro looks a macro up by name, ignoring case
+func (h *HAService) findMacro(name string) (string, Macro, bool) {
+	for macroName, macro := range h.config.Macros {
+		if strings.EqualFold(macroName, name) {
+			return macroName, macro, true
+		}
+	}
+	return "", Macro{}, false
+}
+
+// runMacroStep waits for the step's delay and calls its service
+func (h *HAService) runMacroStep(ctx context.Context, step MacroStep) (string, error) {
+	if step.Delay != "" {
+		delay, _ := time.ParseDuration(step.Delay)
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+	if step.EntityID == "" {
+		return "wait " + step.Delay, nil
+	}
+
+	entityID, err := h.canonicalEntityID(step.EntityID)
+	if err != nil {
+		return "", err
+	}
+	if err := h.checkEntityAccess(ctx, entityID); err != nil {
+		return "", err
+	}
+
+	domain, _, _ := strings.Cut(entityID, ".")
+	data := map[string]interface{}{"entity_id": entityID}
+	for key, value := range step.Data {
+		data[key] = value
+	}
+	if err := h.callService(ctx, domain, step.service(), data); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s.%s %s", domain, step.service(), entityID), nil
+}
+
+// runMacro runs the steps in order and stops at the first failure, since the later steps
+// usually build on the earlier ones; it returns the steps that ran
+func (h *HAService) runMacro(ctx context.Context, macro Macro) ([]string, error) {
+	var done []string
+	for i, step := range macro.Steps {
+		description, err := h.runMacroStep(ctx, step)
+		if err != nil {
+			if len(done) > 0 {
+				return done, fmt.Errorf("step %d failed after %s: %w", i+1, strings.Join(done, ", "), err)
+			}
+			return done, fmt.Errorf("step %d failed: %w", i+1, err)
+		}
+		done = append(done, description)
+	}
+	return done, nil
+}
+
+// run_macro handler
+func runMacroHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	name, err := request.RequireString("name")
+	if err != nil {
+		return mcp.NewToolResultError("name parameter is required"), nil
+	}
+	name, macro, exists := haService.findMacro(name)
+	if !exists {
+		return mcp.NewToolResultError(fmt.Sprintf("Macro %s not found, see list_macros", request.GetString("name", ""))), nil
+	}
+
+	haService.logger.Printf("Running macro %s (%d steps)", name, len(macro.Steps))
+
+	done, err := haService.runMacro(ctx, macro)
+	if err != nil {
+		return toolError(fmt.Sprintf("Failed to run macro %s", name), err), nil
+	}
+	return mcp.NewToolResultText(localize(ctx, "Macro %s ran %d steps: %s", name, len(done), strings.Join(done, ", "))), nil
+}
+
+// list_macros handler
+func listMacrosHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	type macroInfo struct {
+		Name string `json:"name"`
+		Macro
+	}
+	macros := make([]macroInfo, 0, len(haService.config.Macros))
+	for name, macro := range haService.config.Macros {
+		macros = append(macros, macroInfo{Name: name, Macro: macro})
+	}
+	sort.Slice(macros, func(i, j int) bool {
+		return macros[i].Name < macros[j].Name
+	})
+
+	macrosJSON, err := json.Marshal(macros)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize macros: %v", err)), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("%d macros:\n%s", len(macros), string(macrosJSON))), nil
+}
@@ -2,280 +2,279 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 
 	"log"
+	"net"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"path/filepath"
-	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Configuration structures
 type Config struct {
 	HAToken         string   `json:"ha_token"`
 	HAURL           string   `json:"ha_url"`
+	HAWSURL         string   `json:"ha_ws_url,omitempty"` // derived from ha_url when empty
+	Discover        bool     `json:"discover,omitempty"`  // find HA via mDNS when ha_url is empty
 	EntityFilter    []string `json:"entity_filter,omitempty"`
 	EntityBlacklist []string `json:"entity_blacklist,omitempty"`
+
+	// Area (ID or name) and device_class allow/deny lists, applied on top of the entity patterns
+	AreaFilter           []string `json:"area_filter,omitempty"`
+	AreaBlacklist        []string `json:"area_blacklist,omitempty"`
+	DeviceClassFilter    []string `json:"device_class_filter,omitempty"`
+	DeviceClassBlacklist []string `json:"device_class_blacklist,omitempty"`
+
+	// Timeouts as Go duration strings (e.g. "8s", "1m30s")
+	RequestTimeout string `json:"request_timeout,omitempty"` // whole HTTP request / WebSocket exchange
+	DialTimeout    string `json:"dial_timeout,omitempty"`    // TCP connect and WebSocket handshake
+	ReadTimeout    string `json:"read_timeout,omitempty"`    // WebSocket read deadline
+
+	// TLS options for self-signed certificates and private CAs
+	CAFile             string `json:"ca_file,omitempty"`
+	ClientCert         string `json:"client_cert,omitempty"`
+	ClientKey          string `json:"client_key,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+
+	// Explicit proxy (http, https or socks5); HTTP_PROXY/HTTPS_PROXY/NO_PROXY apply otherwise
+	ProxyURL string `json:"proxy_url,omitempty"`
+
+	// Alternatives to an inline ha_token, tried in this order; /run/secrets/ha_token is the fallback
+	TokenFile    string `json:"token_file,omitempty"`
+	TokenCommand string `json:"token_command,omitempty"` // e.g. "pass show ha/token"
+
+	// Command printing a fresh token on stdout, run when HA rejects the current one
+	TokenRefreshCommand string `json:"token_refresh_command,omitempty"`
+
+	// API key and TLS for the sse and http transports
+	Server ServerConfig `json:"server,omitempty"`
+
+	// Forward HA events to HTTP endpoints such as n8n webhooks
+	Webhooks []WebhookConfig `json:"webhooks,omitempty"`
+
+	// Publish filtered state changes to an MQTT broker, disabled when unset
+	MQTT *MQTTConfig `json:"mqtt,omitempty"`
+
+	// Per-client tool and entity restrictions for the sse and http transports, selected by API key
+	Profiles []Profile `json:"profiles,omitempty"`
+
+	// Reject every write to HA and hide the control tools
+	ReadOnly bool `json:"read_only,omitempty"`
+
+	// Offer administrative tools such as reload_integration
+	AdminTools bool `json:"admin_tools,omitempty"`
+
+	// Keep running when the startup connectivity check fails instead of exiting
+	DegradedMode bool `json:"degraded_mode,omitempty"`
+
+	// Listen address for /healthz and /readyz (e.g. ":8081"), disabled when empty
+	HealthAddr string `json:"health_addr,omitempty"`
+
+	// Localhost address for the net/http/pprof endpoints (e.g. "localhost:6060"), disabled when empty
+	PprofAddr string `json:"pprof_addr,omitempty"`
+
+	// Outbound request limits toward HA, disabled when unset
+	RateLimit RateLimitConfig `json:"rate_limit,omitempty"`
+
+	// Poll /api/states in the background to keep the state cache warm (e.g. "30s"), disabled when empty
+	StatePollInterval string `json:"state_poll_interval,omitempty"`
+
+	// Attributes stripped or whitelisted before states are returned
+	Attributes AttributePolicy `json:"attributes,omitempty"`
+
+	// Convert temperature, pressure and speed values to "metric" or "imperial", empty keeps HA units
+	UnitSystem string `json:"unit_system,omitempty"`
+
+	// Colloquial names mapped to entity IDs, e.g. "couch lamp" -> "light.livingroom_sofa"
+	Aliases map[string]string `json:"aliases,omitempty"`
+
+	// Irrigation zones (switches) run together, e.g. "front lawn" -> ["switch.zone_1", "switch.zone_2"]
+	IrrigationGroups map[string][]string `json:"irrigation_groups,omitempty"`
+
+	// File persisting scheduled actions, relative to the executable directory
+	ScheduleFile string `json:"schedule_file,omitempty"`
+
+	// Default number of retries per entity in control_multiple_entities
+	BatchRetries int `json:"batch_retries,omitempty"`
+
+	// Re-read the state after control_entity and report whether it reached the requested state
+	VerifyWrites bool `json:"verify_writes,omitempty"`
+
+	// Shrink the JSON in tool results for small-context models: shorter keys, no nulls and
+	// no last_changed/last_updated unless a call asks for them
+	CompactResponses bool `json:"compact_responses,omitempty"`
+
+	// Only offer the tools for domains Home Assistant has entities of, updating the tool
+	// list as the entity registry changes
+	DynamicTools bool `json:"dynamic_tools,omitempty"`
+
+	// Guess areas from English friendly names ("Kitchen Light") when the registries are
+	// unavailable; off by default since it produces wrong areas on other languages
+	HeuristicAreas bool `json:"heuristic_areas,omitempty"`
+
+	// Language of the human-readable parts of tool results (en, cs, de), English when empty
+	Language string `json:"language,omitempty"`
+
+	// Languages of the built-in heuristic_areas word lists (en, de, cs, fr, es), English when
+	// empty, and extra words added to them
+	HeuristicAreaLanguages []string  `json:"heuristic_area_languages,omitempty"`
+	HeuristicAreaWords     AreaWords `json:"heuristic_area_words,omitempty"`
+
+	// Skip the startup check for a newer release on GitHub, the only call not made to HA
+	DisableUpdateCheck bool `json:"disable_update_check,omitempty"`
+
+	// Export OpenTelemetry spans for tool calls and the HA requests they make
+	Tracing *TracingConfig `json:"tracing,omitempty"`
+
+	// Virtual entities derived from other entities, listed as computed.<name>
+	ComputedEntities []ComputedEntity `json:"computed_entities,omitempty"`
+
+	// State changes kept in memory for get_recent_events, 1000 when 0, disabled when negative
+	EventBufferSize int `json:"event_buffer_size,omitempty"`
+
+	// Named routines of service calls run by run_macro
+	Macros map[string]Macro `json:"macros,omitempty"`
+
+	// Rules checked before every service call, e.g. no sirens at night
+	GuardRails []GuardRail `json:"guard_rails,omitempty"`
+
+	// Caps on the entities one call may change and the writes a client session may make
+	WriteLimits WriteLimitConfig `json:"write_limits,omitempty"`
+
+	// Entities whose service calls must be confirmed by repeating the call with a token,
+	// e.g. ["lock", "alarm_control_panel", "glob:cover.garage_*"]
+	ConfirmEntities []string `json:"confirm_entities,omitempty"`
+
+	// Hold service calls on dangerous entities until a human approves them via a webhook
+	Approval *ApprovalConfig `json:"approval,omitempty"`
+
+	// Bounds of the state cache: entities kept (10000 when 0) and the JSON size an attribute
+	// value is truncated to (16384 when 0); negative removes the bound
+	StateCacheMaxEntities       int `json:"state_cache_max_entities,omitempty"`
+	StateCacheMaxAttributeBytes int `json:"state_cache_max_attribute_bytes,omitempty"`
 }
 
+// Default timeouts used when the configuration doesn't override them
+const (
+	defaultRequestTimeout = 8 * time.Second
+	defaultDialTimeout    = 5 * time.Second
+	defaultReadTimeout    = 10 * time.Second
+)
+
 // WebSocket message structures for Home Assistant
 type WSMessage struct {
 	ID          int                    `json:"id,omitempty"`
 	Type        string                 `json:"type"`
 	AccessToken string                 `json:"access_token,omitempty"`
+	Message     string                 `json:"message,omitempty"`
 	Success     bool                   `json:"success,omitempty"`
 	Result      interface{}           `json:"result,omitempty"`
 	Error       map[string]interface{} `json:"error,omitempty"`
 }
 
-// WebSocket client for Home Assistant
-func (h *HAService) getAreasViaWebSocket() ([]HAArea, error) {
+// WebSocket method to get area registry
+func (h *HAService) getAreasViaWebSocket(ctx context.Context) ([]HAArea, error) {
 	h.logger.Println("Attempting to get areas via WebSocket")
-	
-	// Parse WebSocket URL
-	wsURL := strings.Replace(h.config.HAURL, "http", "ws", 1) + "/api/websocket"
-	h.logger.Printf("Connecting to WebSocket: %s", wsURL)
-	
-	// Connect to WebSocket
-	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
-	if err != nil {
-		h.logger.Printf("WebSocket connection failed: %v", err)
-		return nil, err
-	}
-	defer conn.Close()
-	
-	// Read initial auth required message
-	_, message, err := conn.ReadMessage()
-	if err != nil {
-		h.logger.Printf("Failed to read initial message: %v", err)
-		return nil, err
-	}
-	
-	var authRequired WSMessage
-	if err := json.Unmarshal(message, &authRequired); err != nil {
-		h.logger.Printf("Failed to parse initial message: %v", err)
-		return nil, err
-	}
-	
-	h.logger.Printf("Received auth required message: %s", authRequired.Type)
-	
-	// Send authentication
-	authMsg := WSMessage{
-		Type:        "auth",
-		AccessToken: h.config.HAToken,
-	}
-	
-	if err := conn.WriteJSON(authMsg); err != nil {
-		h.logger.Printf("Failed to send auth: %v", err)
-		return nil, err
-	}
-	
-	// Read auth response
-	_, message, err = conn.ReadMessage()
-	if err != nil {
-		h.logger.Printf("Failed to read auth response: %v", err)
-		return nil, err
-	}
-	
-	var authResponse WSMessage
-	if err := json.Unmarshal(message, &authResponse); err != nil {
-		h.logger.Printf("Failed to parse auth response: %v", err)
-		return nil, err
-	}
-	
-	if authResponse.Type != "auth_ok" {
-		h.logger.Printf("Authentication failed: %+v", authResponse)
-		return nil, fmt.Errorf("authentication failed")
-	}
-	
-	h.logger.Println("WebSocket authentication successful")
-	
-	// Request area registry
-	areaRequest := WSMessage{
-		ID:   1,
-		Type: "config/area_registry/list",
-	}
-	
-	if err := conn.WriteJSON(areaRequest); err != nil {
-		h.logger.Printf("Failed to send area request: %v", err)
-		return nil, err
-	}
-	
-	// Read area registry response
-	_, message, err = conn.ReadMessage()
-	if err != nil {
-		h.logger.Printf("Failed to read area response: %v", err)
-		return nil, err
-	}
-	
-	var areaResponse WSMessage
-	if err := json.Unmarshal(message, &areaResponse); err != nil {
-		h.logger.Printf("Failed to parse area response: %v", err)
-		return nil, err
-	}
-	
-	if !areaResponse.Success {
-		h.logger.Printf("Area request failed: %+v", areaResponse.Error)
-		return nil, fmt.Errorf("area request failed")
-	}
-	
-	// Parse areas from result
-	resultBytes, err := json.Marshal(areaResponse.Result)
-	if err != nil {
-		h.logger.Printf("Failed to marshal area result: %v", err)
-		return nil, err
-	}
-	
+
 	var areas []HAArea
-	if err := json.Unmarshal(resultBytes, &areas); err != nil {
-		h.logger.Printf("Failed to parse areas: %v", err)
+	if err := h.ws.CommandInto(ctx, "config/area_registry/list", nil, &areas); err != nil {
+		h.logger.Printf("Area request failed: %v", err)
 		return nil, err
 	}
-	
+
 	h.logger.Printf("Successfully retrieved %d areas via WebSocket", len(areas))
 	return areas, nil
 }
 
 // WebSocket method to get device registry
-func (h *HAService) getDevicesViaWebSocket() ([]HADevice, error) {
+func (h *HAService) getDevicesViaWebSocket(ctx context.Context) ([]HADevice, error) {
 	h.logger.Println("Attempting to get devices via WebSocket")
-	
-	// Parse WebSocket URL
-	wsURL := strings.Replace(h.config.HAURL, "http", "ws", 1) + "/api/websocket"
-	
-	// Connect to WebSocket
-	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
-	if err != nil {
-		h.logger.Printf("WebSocket connection failed: %v", err)
-		return nil, err
-	}
-	defer conn.Close()
-	
-	// Read initial message and authenticate
-	if err := h.authenticateWebSocket(conn); err != nil {
-		return nil, err
-	}
-	
-	// Request device registry
-	deviceRequest := WSMessage{
-		ID:   2,
-		Type: "config/device_registry/list",
-	}
-	
-	if err := conn.WriteJSON(deviceRequest); err != nil {
-		h.logger.Printf("Failed to send device request: %v", err)
-		return nil, err
-	}
-	
-	// Read device registry response
-	_, message, err := conn.ReadMessage()
-	if err != nil {
-		h.logger.Printf("Failed to read device response: %v", err)
-		return nil, err
-	}
-	
-	var deviceResponse WSMessage
-	if err := json.Unmarshal(message, &deviceResponse); err != nil {
-		h.logger.Printf("Failed to parse device response: %v", err)
-		return nil, err
-	}
-	
-	if !deviceResponse.Success {
-		h.logger.Printf("Device request failed: %+v", deviceResponse.Error)
-		return nil, fmt.Errorf("device request failed")
-	}
-	
-	// Parse devices from result
-	resultBytes, err := json.Marshal(deviceResponse.Result)
-	if err != nil {
-		h.logger.Printf("Failed to marshal device result: %v", err)
-		return nil, err
-	}
-	
+
 	var devices []HADevice
-	if err := json.Unmarshal(resultBytes, &devices); err != nil {
-		h.logger.Printf("Failed to parse devices: %v", err)
+	if err := h.ws.CommandInto(ctx, "config/device_registry/list", nil, &devices); err != nil {
+		h.logger.Printf("Device request failed: %v", err)
 		return nil, err
 	}
-	
+
 	h.logger.Printf("Successfully retrieved %d devices via WebSocket", len(devices))
 	return devices, nil
 }
 
 // WebSocket method to get entity registry
-func (h *HAService) getEntityRegistryViaWebSocket() ([]HAEntity, error) {
+func (h *HAService) getEntityRegistryViaWebSocket(ctx context.Context) ([]HAEntity, error) {
 	h.logger.Println("Attempting to get entity registry via WebSocket")
-	
-	// Parse WebSocket URL
-	wsURL := strings.Replace(h.config.HAURL, "http", "ws", 1) + "/api/websocket"
-	
-	// Connect to WebSocket
-	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
-	if err != nil {
-		h.logger.Printf("WebSocket connection failed: %v", err)
-		return nil, err
-	}
-	defer conn.Close()
-	
-	// Read initial message and authenticate
-	if err := h.authenticateWebSocket(conn); err != nil {
-		return nil, err
-	}
-	
-	// Request entity registry
-	entityRequest := WSMessage{
-		ID:   3,
-		Type: "config/entity_registry/list",
-	}
-	
-	if err := conn.WriteJSON(entityRequest); err != nil {
-		h.logger.Printf("Failed to send entity request: %v", err)
+
+	var entities []HAEntity
+	if err := h.ws.CommandInto(ctx, "config/entity_registry/list", nil, &entities); err != nil {
+		h.logger.Printf("Entity request failed: %v", err)
 		return nil, err
 	}
-	
-	// Read entity registry response
-	_, message, err := conn.ReadMessage()
+
+	h.logger.Printf("Successfully retrieved %d entities via WebSocket", len(entities))
+	return entities, nil
+}
+
+// Helper function to open a WebSocket connection
+func (h *HAService) openWebSocket(ctx context.Context) (*websocket.Conn, error) {
+	h.logger.Printf("Connecting to WebSocket: %s", h.wsURL)
+
+	conn, _, err := h.wsDialer.DialContext(ctx, h.wsURL, nil)
 	if err != nil {
-		h.logger.Printf("Failed to read entity response: %v", err)
+		h.logger.Printf("WebSocket connection failed: %v", err)
 		return nil, err
 	}
-	
-	var entityResponse WSMessage
-	if err := json.Unmarshal(message, &entityResponse); err != nil {
-		h.logger.Printf("Failed to parse entity response: %v", err)
+	return conn, nil
+}
+
+// Helper function to open a one-off WebSocket connection bound to ctx.
+// Reads are limited by the configured read timeout and the context deadline,
+// whichever comes first. The connection
+// is closed as soon as the context is cancelled, aborting any pending read.
+func (h *HAService) dialWebSocket(ctx context.Context) (*websocket.Conn, error) {
+	if err := h.rateLimiter.allow(""); err != nil {
+		h.logger.Printf("WebSocket connection rejected: %v", err)
 		return nil, err
 	}
-	
-	if !entityResponse.Success {
-		h.logger.Printf("Entity request failed: %+v", entityResponse.Error)
-		return nil, fmt.Errorf("entity request failed")
-	}
-	
-	// Parse entities from result
-	resultBytes, err := json.Marshal(entityResponse.Result)
+
+	conn, err := h.openWebSocket(ctx)
 	if err != nil {
-		h.logger.Printf("Failed to marshal entity result: %v", err)
 		return nil, err
 	}
-	
-	var entities []HAEntity
-	if err := json.Unmarshal(resultBytes, &entities); err != nil {
-		h.logger.Printf("Failed to parse entities: %v", err)
-		return nil, err
+
+	readDeadline := time.Now().Add(h.readTimeout)
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetWriteDeadline(deadline)
+		if deadline.Before(readDeadline) {
+			readDeadline = deadline
+		}
 	}
-	
-	h.logger.Printf("Successfully retrieved %d entities via WebSocket", len(entities))
-	return entities, nil
+	conn.SetReadDeadline(readDeadline)
+
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	return conn, nil
 }
 
 // Helper function to handle WebSocket authentication
@@ -296,7 +295,7 @@ func (h *HAService) authenticateWebSocket(conn *websocket.Conn) error {
 	// Send authentication
 	authMsg := WSMessage{
 		Type:        "auth",
-		AccessToken: h.config.HAToken,
+		AccessToken: h.token(),
 	}
 	
 	if err := conn.WriteJSON(authMsg); err != nil {
@@ -317,48 +316,20 @@ func (h *HAService) authenticateWebSocket(conn *websocket.Conn) error {
 		return err
 	}
 	
-	if authResponse.Type != "auth_ok" {
+	if authResponse.Type == "auth_invalid" {
 		h.logger.Printf("Authentication failed: %+v", authResponse)
-		return fmt.Errorf("authentication failed")
+		return &UnauthorizedError{Message: "authentication failed: " + authResponse.Message}
 	}
-	
-	return nil
-}
 
-// Helper functions for better area detection
-func isCommonAreaWord(word string) bool {
-	lowerWord := strings.ToLower(word)
-	commonAreaWords := []string{
-		"room", "bedroom", "bathroom", "kitchen", "office",
-		"living", "dining", "family", "master", "guest",
-		"hall", "hallway", "entrance", "foyer", "lobby",
-		"garage", "basement", "attic", "closet", "storage",
-		"porch", "patio", "deck", "balcony", "terrace",
-	}
-	
-	for _, commonWord := range commonAreaWords {
-		if lowerWord == commonWord {
-			return true
+	if authResponse.Type != "auth_ok" {
+		h.logger.Printf("Authentication failed: %+v", authResponse)
+		if authResponse.Message != "" {
+			return fmt.Errorf("authentication failed: %s", authResponse.Message)
 		}
-	}
-	return false
-}
-
-func isDeviceName(name string) bool {
-	lowerName := strings.ToLower(name)
-	deviceNames := []string{
-		"lolin", "nodemcu", "esp", "arduino", "sonoff", 
-		"shelly", "zigbee", "zwave", "wifi", "bluetooth",
-		"sensor", "switch", "light", "lamp", "bulb",
-		"device", "module", "controller", "hub",
+		return fmt.Errorf("authentication failed")
 	}
 	
-	for _, deviceName := range deviceNames {
-		if strings.Contains(lowerName, deviceName) {
-			return true
-		}
-	}
-	return false
+	return nil
 }
 
 // Home Assistant structures
@@ -369,6 +340,13 @@ type HAState struct {
 	LastChanged string                 `json:"last_changed"`
 	LastUpdated string                 `json:"last_updated"`
 	Area        *HAArea                `json:"area,omitempty"`
+
+	// Decoded from supported_features and supported_color_modes, e.g. ["brightness", "color_temp"]
+	Capabilities []string `json:"capabilities,omitempty"`
+
+	// Computed from last_changed when a response is built, e.g. 754 and "12 minutes"
+	SecondsSinceChange int64  `json:"seconds_since_change,omitempty"`
+	StateFor           string `json:"state_for,omitempty"`
 }
 
 type HAArea struct {
@@ -385,18 +363,49 @@ type HADevice struct {
 }
 
 type HAEntity struct {
-	EntityID string `json:"entity_id"`
-	DeviceID string `json:"device_id,omitempty"`
-	AreaID   string `json:"area_id,omitempty"`
+	EntityID string   `json:"entity_id"`
+	DeviceID string   `json:"device_id,omitempty"`
+	AreaID   string   `json:"area_id,omitempty"`
+	Labels   []string `json:"labels,omitempty"`
 }
 
 // Home Assistant Service
 type HAService struct {
-	config       Config
-	httpClient   *http.Client
-	logger       *log.Logger
-	mu           sync.Mutex
-	executableDir string
+	config            Config
+	httpClient        *http.Client
+	wsDialer          *websocket.Dialer
+	wsURL             string
+	ws                *WSClient
+	rateLimiter       *RateLimiter
+	entityFilter      []entityPattern // compiled config.EntityFilter
+	entityBlacklist   []entityPattern // compiled config.EntityBlacklist
+	profiles          []*Profile      // compiled config.Profiles
+	areaWords         *areaWordSet    // compiled heuristic_areas word lists
+	computed          []computedEntity // compiled config.ComputedEntities
+	guardRails        []*GuardRail    // compiled config.GuardRails
+	confirmEntities   []entityPattern // compiled config.ConfirmEntities
+	approvalEntities  []entityPattern // compiled config.Approval.Entities
+	approvalTimeout   time.Duration
+	events            *eventBuffer    // recent state changes, nil when disabled
+	statesMu          sync.Mutex
+	statesCall        *statesCall
+	stateCache        StateCache
+	writes            entityQueue // serializes service calls per entity
+	statePollInterval time.Duration
+	requestTimeout    time.Duration
+	dialTimeout       time.Duration
+	readTimeout       time.Duration
+	logger            *log.Logger
+	debug             bool // --log-level debug
+	mu                sync.Mutex
+	executableDir     string
+	configFile        string // --config, takes precedence over environment configuration
+	unitSystem        map[string]string // HA's configured units, read lazily from /api/config
+	tokenMu           sync.RWMutex      // guards config.HAToken, which the refresh hook replaces
+	refreshMu         sync.Mutex        // serializes token refreshes
+	transport         string            // --transport, reported by get_server_info
+	toolCount         int               // tools offered after read-only and admin filtering
+	mcpServer         *server.MCPServer // notified of tool list changes with dynamic_tools
 }
 
 func NewHAService() *HAService {
@@ -420,753 +429,1840 @@ func NewHAService() *HAService {
 		logger = log.New(logFile, "[HA-MCP] ", log.LstdFlags|log.Lshortfile)
 	}
 
-	// HTTP client with connection pooling
-	transport := &http.Transport{
-		MaxIdleConns:        10,
-		MaxIdleConnsPerHost: 5,
-		IdleConnTimeout:     30 * time.Second,
-		DisableKeepAlives:   false,
-	}
-
 	service := &HAService{
-		httpClient: &http.Client{
-			Timeout:   8 * time.Second,
-			Transport: transport,
-		},
 		logger:        logger,
 		executableDir: executableDir,
 	}
+	service.ws = &WSClient{service: service}
+	service.configureClients(clientSettings{
+		requestTimeout: defaultRequestTimeout,
+		dialTimeout:    defaultDialTimeout,
+		readTimeout:    defaultReadTimeout,
+		proxy:          http.ProxyFromEnvironment,
+	})
 
 	service.logger.Printf("HA Service initialized, executable directory: %s", executableDir)
 	service.logger.Printf("Log file: %s", logFilePath)
 	return service
 }
 
-func (h *HAService) LoadConfig() error {
-	h.logger.Println("Loading configuration...")
-	
-	// Try environment variables first
-	token := os.Getenv("HA_TOKEN")
-	url := os.Getenv("HA_URL")
+// debugf logs only when started with --log-level debug
+func (h *HAService) debugf(format string, args ...interface{}) {
+	if h.debug {
+		h.logger.Output(2, fmt.Sprintf(format, args...))
+	}
+}
 
-	if token != "" && url != "" {
-		h.config.HAToken = token
-		h.config.HAURL = strings.TrimSuffix(url, "/")
+// Connection settings shared by the HTTP client and the WebSocket dialer
+type clientSettings struct {
+	requestTimeout time.Duration
+	dialTimeout    time.Duration
+	readTimeout    time.Duration
+	tlsConfig      *tls.Config
+	proxy          func(*http.Request) (*neturl.URL, error)
+}
 
-		// Load entity filter from environment if available
-		filterStr := os.Getenv("HA_ENTITY_FILTER")
-		if filterStr != "" {
-			h.config.EntityFilter = strings.Split(filterStr, ",")
-		}
+// configureClients (re)builds the HTTP client and WebSocket dialer from settings
+func (h *HAService) configureClients(settings clientSettings) {
+	h.requestTimeout = settings.requestTimeout
+	h.dialTimeout = settings.dialTimeout
+	h.readTimeout = settings.readTimeout
 
-		// Load entity blacklist from environment if available
-		blacklistStr := os.Getenv("HA_ENTITY_BLACKLIST")
-		if blacklistStr != "" {
-			h.config.EntityBlacklist = strings.Split(blacklistStr, ",")
-		}
-		
-		h.logger.Printf("Configuration loaded from environment variables")
-		return nil
+	// HTTP client with connection pooling
+	transport := &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: settings.dialTimeout,
+		}).DialContext,
+		TLSClientConfig:     settings.tlsConfig,
+		Proxy:               settings.proxy,
+		MaxIdleConns:        10,
+		MaxIdleConnsPerHost: 5,
+		IdleConnTimeout:     30 * time.Second,
+		DisableKeepAlives:   false,
 	}
 
-	// Fallback to config file in executable directory
-	configFile := os.Getenv("CONFIG_FILE")
-	if configFile == "" {
-		configFile = filepath.Join(h.executableDir, "config.json")
-	} else {
-		// If CONFIG_FILE is relative path, make it relative to executable directory
-		if !filepath.IsAbs(configFile) {
-			configFile = filepath.Join(h.executableDir, configFile)
-		}
+	h.httpClient = &http.Client{
+		Timeout:   settings.requestTimeout,
+		Transport: transport,
 	}
 
-	h.logger.Printf("Looking for config file: %s", configFile)
-
-	data, err := os.ReadFile(configFile)
-	if err != nil {
-		return fmt.Errorf("failed to read config file %s: %v", configFile, err)
+	h.wsDialer = &websocket.Dialer{
+		NetDialContext: (&net.Dialer{
+			Timeout: settings.dialTimeout,
+		}).DialContext,
+		HandshakeTimeout: settings.dialTimeout,
+		TLSClientConfig:  settings.tlsConfig,
+		Proxy:            settings.proxy,
 	}
+}
 
-	if err := json.Unmarshal(data, &h.config); err != nil {
-		return fmt.Errorf("failed to parse config file %s: %v", configFile, err)
-	}
+// applyClientConfig parses the configured timeouts and TLS options and rebuilds the clients
+func (h *HAService) applyClientConfig() error {
+	var settings clientSettings
+	var err error
 
-	h.config.HAURL = strings.TrimSuffix(h.config.HAURL, "/")
-	h.logger.Printf("Configuration loaded from file: %s", configFile)
-	return nil
-}
+	settings.requestTimeout, err = parseTimeout("request_timeout", h.config.RequestTimeout, defaultRequestTimeout)
+	if err != nil {
+		return err
+	}
+	settings.dialTimeout, err = parseTimeout("dial_timeout", h.config.DialTimeout, defaultDialTimeout)
+	if err != nil {
+		return err
+	}
+	settings.readTimeout, err = parseTimeout("read_timeout", h.config.ReadTimeout, defaultReadTimeout)
+	if err != nil {
+		return err
+	}
 
-func (h *HAService) makeHARequest(method, endpoint string, body interface{}) (*http.Response, error) {
-	url := h.config.HAURL + endpoint
-	
-	// Debug logging
-	h.logger.Printf("Making %s request to: %s", method, url)
+	settings.tlsConfig, err = h.buildTLSConfig()
+	if err != nil {
+		return err
+	}
 
-	var req *http.Request
-	var err error
+	settings.proxy, err = h.buildProxy()
+	if err != nil {
+		return err
+	}
 
-	if body != nil {
-		jsonBody, err := json.Marshal(body)
-		if err != nil {
-			return nil, err
-		}
-		req, err = http.NewRequest(method, url, strings.NewReader(string(jsonBody)))
-		if err != nil {
-			return nil, err
-		}
-		req.Header.Set("Content-Type", "application/json")
-	} else {
-		req, err = http.NewRequest(method, url, nil)
+	if h.config.HAURL == "" && h.config.Discover {
+		h.config.HAURL, err = h.discoverHomeAssistant(context.Background())
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
-
-	req.Header.Set("Authorization", "Bearer "+h.config.HAToken)
-	
-	// Debug logging
-	h.logger.Printf("Request headers: %+v", req.Header)
-	
-	resp, err := h.httpClient.Do(req)
+	if h.config.HAURL == "" {
+		return fmt.Errorf("ha_url is required (or set discover to find Home Assistant via mDNS)")
+	}
+	h.config.HAURL, err = normalizeBaseURL(h.config.HAURL)
 	if err != nil {
-		h.logger.Printf("HTTP request failed: %v", err)
-		return nil, err
+		return err
 	}
-	
-	// Debug logging
-	h.logger.Printf("Response status: %d %s", resp.StatusCode, resp.Status)
-	
-	return resp, nil
-}
-
-func (h *HAService) isEntityBlacklisted(entityID string) bool {
-	for _, pattern := range h.config.EntityBlacklist {
-		// Try exact match first
-		if pattern == entityID {
-			return true
-		}
+	h.wsURL, err = buildWebSocketURL(h.config.HAURL, h.config.HAWSURL)
+	if err != nil {
+		return err
+	}
+	h.logger.Printf("WebSocket URL: %s", h.wsURL)
 
-		// Try regex match
-		matched, err := regexp.MatchString(pattern, entityID)
-		if err == nil && matched {
-			return true
+	if h.config.StatePollInterval != "" {
+		h.statePollInterval, err = parseTimeout("state_poll_interval", h.config.StatePollInterval, 0)
+		if err != nil {
+			return err
 		}
 	}
-	return false
-}
+	h.stateCache.setLimits(h.config.StateCacheMaxEntities, h.config.StateCacheMaxAttributeBytes)
 
-func (h *HAService) isEntityWhitelisted(entityID string) bool {
-	for _, pattern := range h.config.EntityFilter {
-		matched, err := regexp.MatchString(pattern, entityID)
-		if err == nil && matched {
-			return true
+	if h.config.UnitSystem != "" {
+		if _, exists := targetUnits[h.config.UnitSystem]; !exists {
+			return fmt.Errorf("invalid unit_system %q: must be metric or imperial", h.config.UnitSystem)
 		}
 	}
-	return false
-}
 
-func (h *HAService) filterEntities(entities []HAState) []HAState {
-	var filtered []HAState
+	h.areaWords, err = compileAreaWords(h.config.HeuristicAreaLanguages, h.config.HeuristicAreaWords)
+	if err != nil {
+		return err
+	}
+	h.config.Language, err = validateLanguage(h.config.Language)
+	if err != nil {
+		return err
+	}
 
-	for _, entity := range entities {
-		// Check if entity is blacklisted
-		if h.isEntityBlacklisted(entity.EntityID) {
-			continue
-		}
+	h.entityFilter, err = compilePatterns("entity_filter", h.config.EntityFilter)
+	if err != nil {
+		return err
+	}
+	h.entityBlacklist, err = compilePatterns("entity_blacklist", h.config.EntityBlacklist)
+	if err != nil {
+		return err
+	}
 
-		// If no whitelist filter is defined, include entity
-		if len(h.config.EntityFilter) == 0 {
-			filtered = append(filtered, entity)
-			continue
-		}
+	h.profiles, err = compileProfiles(h.config.Profiles)
+	if err != nil {
+		return err
+	}
 
-		// Check against whitelist filter
-		if h.isEntityWhitelisted(entity.EntityID) {
-			filtered = append(filtered, entity)
-		}
+	h.computed, err = compileComputedEntities(h.config.ComputedEntities)
+	if err != nil {
+		return err
 	}
 
-	return filtered
-}
+	if err := validateMacros(h.config.Macros); err != nil {
+		return err
+	}
 
-// Internal functions for area enrichment
-func (h *HAService) getAreas() ([]HAArea, error) {
-	h.logger.Println("Fetching areas from HA")
-	
-	// First try WebSocket API (most reliable)
-	areas, err := h.getAreasViaWebSocket()
-	if err == nil && len(areas) > 0 {
-		h.logger.Printf("Successfully got %d areas via WebSocket", len(areas))
-		return areas, nil
+	h.guardRails, err = compileGuardRails(h.config.GuardRails)
+	if err != nil {
+		return err
 	}
-	
-	h.logger.Printf("WebSocket failed (%v), trying REST endpoints", err)
-	
-	// Fallback to REST endpoints
-	endpoints := []string{
-		"/api/config/area_registry",
-		"/api/areas",
+	h.confirmEntities, err = compileDomainPatterns("confirm_entities", h.config.ConfirmEntities)
+	if err != nil {
+		return err
 	}
-	
-	for _, endpoint := range endpoints {
-		h.logger.Printf("Trying endpoint: %s", endpoint)
-		resp, err := h.makeHARequest("GET", endpoint, nil)
+	h.approvalEntities, h.approvalTimeout, err = compileApproval(h.config.Approval)
+	if err != nil {
+		return err
+	}
+
+	if h.config.PprofAddr != "" {
+		h.config.PprofAddr, err = pprofListenAddr(h.config.PprofAddr)
 		if err != nil {
-			h.logger.Printf("Failed to get areas from %s: %v", endpoint, err)
-			continue
-		}
-		defer resp.Body.Close()
-		
-		if resp.StatusCode == 200 {
-			h.logger.Printf("Success! Endpoint %s returned 200", endpoint)
-			
-			// Try to decode as JSON
-			bodyBytes, err := io.ReadAll(resp.Body)
-			if err != nil {
-				h.logger.Printf("Failed to read response body from %s: %v", endpoint, err)
-				continue
-			}
-			
-			var areas []HAArea
-			if err := json.Unmarshal(bodyBytes, &areas); err != nil {
-				h.logger.Printf("Failed to decode areas from %s: %v", endpoint, err)
-				continue
-			}
-			h.logger.Printf("Found %d areas from %s", len(areas), endpoint)
-			return areas, nil
-		} else {
-			h.logger.Printf("Endpoint %s returned status %d", endpoint, resp.StatusCode)
+			return err
 		}
 	}
-	
-	h.logger.Printf("All REST endpoints failed, falling back to states extraction")
-	// As last resort, try to extract area info from states attributes
-	return h.extractAreasFromStates()
+
+	h.rateLimiter = newRateLimiter(h.config.RateLimit)
+	if h.rateLimiter != nil {
+		h.logger.Printf("Rate limit: %+v", h.config.RateLimit)
+	}
+
+	h.configureClients(settings)
+	h.logger.Printf("Timeouts: request %v, dial %v, read %v", settings.requestTimeout, settings.dialTimeout, settings.readTimeout)
+	return nil
 }
 
-// Fallback method to extract areas from entity states attributes
-func (h *HAService) extractAreasFromStates() ([]HAArea, error) {
-	h.logger.Println("Extracting areas from entity states")
-	
-	resp, err := h.makeHARequest("GET", "/api/states", nil)
-	if err != nil {
-		return nil, err
+// buildTLSConfig returns nil when no TLS option is set so Go's defaults apply
+func (h *HAService) buildTLSConfig() (*tls.Config, error) {
+	if h.config.CAFile == "" && h.config.ClientCert == "" && h.config.ClientKey == "" && !h.config.InsecureSkipVerify {
+		return nil, nil
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("HA API returned status %d for states", resp.StatusCode)
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: h.config.InsecureSkipVerify,
 	}
 
-	var states []HAState
-	if err := json.NewDecoder(resp.Body).Decode(&states); err != nil {
-		return nil, err
+	if h.config.InsecureSkipVerify {
+		h.logger.Println("Warning: TLS certificate verification is disabled (insecure_skip_verify)")
 	}
 
-	// Extract unique areas from entity attributes
-	areasMap := make(map[string]*HAArea)
-	for _, state := range states {
-		// Skip non-light/switch entities for area extraction
-		if !strings.HasPrefix(state.EntityID, "light.") && !strings.HasPrefix(state.EntityID, "switch.") {
-			continue
+	if h.config.CAFile != "" {
+		caFile := h.resolvePath(h.config.CAFile)
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file %s: %v", caFile, err)
 		}
-		
-		// Check for explicit area attribute first
-		if areaName, hasArea := state.Attributes["area"]; hasArea {
-			if areaStr, ok := areaName.(string); ok && areaStr != "" {
-				areaID := strings.ReplaceAll(strings.ToLower(areaStr), " ", "_")
-				if _, exists := areasMap[areaID]; !exists {
-					areasMap[areaID] = &HAArea{
-						AreaID: areaID,
-						Name:   areaStr,
-					}
-				}
-			}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
 		}
-		
-		// Try to extract area from friendly name patterns
-		if friendlyName, hasFriendly := state.Attributes["friendly_name"]; hasFriendly {
-			if nameStr, ok := friendlyName.(string); ok {
-				// Look for common area patterns in friendly names
-				// Examples: "Workshop Light", "Kitchen Switch", "Living Room Lamp"
-				parts := strings.Split(nameStr, " ")
-				if len(parts) >= 2 {
-					var possibleArea string
-					
-					// Check for two-word areas like "Living Room", "Master Bedroom"
-					if len(parts) >= 3 && isCommonAreaWord(parts[1]) {
-						possibleArea = parts[0] + " " + parts[1]
-					} else {
-						// Single word area
-						possibleArea = parts[0]
-					}
-					
-					// Only consider meaningful area names (avoid device names)
-					if len(possibleArea) > 3 && !isDeviceName(possibleArea) {
-						areaID := strings.ReplaceAll(strings.ToLower(possibleArea), " ", "_")
-						if _, exists := areasMap[areaID]; !exists {
-							areasMap[areaID] = &HAArea{
-								AreaID: areaID,
-								Name:   possibleArea,
-							}
-						}
-					}
-				}
-			}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificates found in CA file %s", caFile)
 		}
+		tlsConfig.RootCAs = pool
+		h.logger.Printf("Using CA bundle: %s", caFile)
 	}
 
-	// Convert map to slice
-	var areas []HAArea
-	for _, area := range areasMap {
-		areas = append(areas, *area)
+	if h.config.ClientCert != "" || h.config.ClientKey != "" {
+		if h.config.ClientCert == "" || h.config.ClientKey == "" {
+			return nil, fmt.Errorf("client_cert and client_key must be set together")
+		}
+		certFile := h.resolvePath(h.config.ClientCert)
+		keyFile := h.resolvePath(h.config.ClientKey)
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate %s: %v", certFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		h.logger.Printf("Using client certificate: %s", certFile)
 	}
 
-	h.logger.Printf("Extracted %d areas from entity states", len(areas))
-	return areas, nil
+	return tlsConfig, nil
 }
 
-func (h *HAService) getDevices() ([]HADevice, error) {
-	h.logger.Println("Fetching devices from HA")
-	
-	// First try WebSocket API
-	devicesWS, err := h.getDevicesViaWebSocket()
-	if err == nil && len(devicesWS) >= 0 { // Accept empty result as valid
-		h.logger.Printf("Successfully got %d devices via WebSocket", len(devicesWS))
-		return devicesWS, nil
+// buildProxy uses the explicit proxy_url when set, otherwise HTTP_PROXY/HTTPS_PROXY/NO_PROXY.
+// Supported schemes are http, https and socks5.
+func (h *HAService) buildProxy() (func(*http.Request) (*neturl.URL, error), error) {
+	if h.config.ProxyURL == "" {
+		return http.ProxyFromEnvironment, nil
 	}
-	
-	h.logger.Printf("WebSocket failed (%v), trying REST endpoint", err)
-	
-	resp, err := h.makeHARequest("GET", "/api/config/device_registry", nil)
+
+	proxyURL, err := neturl.Parse(h.config.ProxyURL)
 	if err != nil {
-		h.logger.Printf("Failed to get devices: %v", err)
-		return nil, err
+		return nil, fmt.Errorf("invalid proxy_url %q: %v", h.config.ProxyURL, err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		h.logger.Printf("HA API returned status %d for devices, skipping device registry", resp.StatusCode)
-		return []HADevice{}, nil // Return empty slice instead of error
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy_url %q: unsupported scheme %q", h.config.ProxyURL, proxyURL.Scheme)
 	}
 
-	var devices []HADevice
-	if err := json.NewDecoder(resp.Body).Decode(&devices); err != nil {
-		return nil, err
+	h.logger.Printf("Using proxy: %s://%s", proxyURL.Scheme, proxyURL.Host)
+	return http.ProxyURL(proxyURL), nil
+}
+
+// normalizeBaseURL cleans up ha_url so REST paths can be appended to it: a reverse proxy path
+// prefix (https://example.com/homeassistant) is kept, while trailing slashes, a trailing /api
+// copied from an API URL, query and fragment are dropped
+func normalizeBaseURL(haURL string) (string, error) {
+	parsed, err := neturl.Parse(strings.TrimSpace(haURL))
+	if err != nil {
+		return "", fmt.Errorf("invalid ha_url %q: %v", haURL, err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", fmt.Errorf("invalid ha_url %q: scheme must be http or https", haURL)
+	}
+	if parsed.Host == "" {
+		return "", fmt.Errorf("invalid ha_url %q: missing host", haURL)
+	}
+	if strings.Count(parsed.Host, ":") > 1 && !strings.HasPrefix(parsed.Host, "[") {
+		return "", fmt.Errorf("invalid ha_url %q: IPv6 addresses must be in brackets, e.g. http://[fd00::10]:8123", haURL)
 	}
 
-	h.logger.Printf("Found %d devices", len(devices))
-	return devices, nil
+	parsed.Path = strings.TrimRight(parsed.Path, "/")
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/api")
+	parsed.RawPath = ""
+	parsed.RawQuery = ""
+	parsed.Fragment = ""
+	return parsed.String(), nil
 }
 
-func (h *HAService) getEntityRegistry() ([]HAEntity, error) {
-	h.logger.Println("Fetching entity registry from HA")
-	
-	// First try WebSocket API
-	entitiesWS, err := h.getEntityRegistryViaWebSocket()
-	if err == nil && len(entitiesWS) >= 0 { // Accept empty result as valid
-		h.logger.Printf("Successfully got %d entities via WebSocket", len(entitiesWS))
-		return entitiesWS, nil
+// buildWebSocketURL returns wsURL when set, otherwise derives it from the HA base URL
+// (http -> ws, https -> wss) keeping any path prefix of a reverse proxy.
+func buildWebSocketURL(haURL, wsURL string) (string, error) {
+	if wsURL != "" {
+		parsed, err := neturl.Parse(wsURL)
+		if err != nil {
+			return "", fmt.Errorf("invalid ha_ws_url %q: %v", wsURL, err)
+		}
+		if parsed.Scheme != "ws" && parsed.Scheme != "wss" {
+			return "", fmt.Errorf("invalid ha_ws_url %q: scheme must be ws or wss", wsURL)
+		}
+		return parsed.String(), nil
 	}
-	
-	h.logger.Printf("WebSocket failed (%v), trying REST endpoint", err)
-	
-	resp, err := h.makeHARequest("GET", "/api/config/entity_registry", nil)
+
+	parsed, err := neturl.Parse(haURL)
 	if err != nil {
-		h.logger.Printf("Failed to get entity registry: %v", err)
-		return nil, err
+		return "", fmt.Errorf("invalid ha_url %q: %v", haURL, err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		h.logger.Printf("HA API returned status %d for entity registry, falling back to states-based area matching", resp.StatusCode)
-		return h.extractEntityAreaFromStates()
+	switch parsed.Scheme {
+	case "http":
+		parsed.Scheme = "ws"
+	case "https":
+		parsed.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("invalid ha_url %q: scheme must be http or https", haURL)
+	}
+	if parsed.Host == "" {
+		return "", fmt.Errorf("invalid ha_url %q: missing host", haURL)
 	}
 
-	var entities []HAEntity
-	if err := json.NewDecoder(resp.Body).Decode(&entities); err != nil {
-		return nil, err
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/") + "/api/websocket"
+	parsed.RawQuery = ""
+	parsed.Fragment = ""
+	return parsed.String(), nil
+}
+
+// resolvePath makes relative paths relative to the executable directory, like CONFIG_FILE
+func (h *HAService) resolvePath(path string) string {
+	if filepath.IsAbs(path) {
+		return path
 	}
+	return filepath.Join(h.executableDir, path)
+}
 
-	h.logger.Printf("Found %d entities in registry", len(entities))
-	return entities, nil
+// envBool reports whether an environment variable is set to a true value ("1", "true", ...)
+func envBool(name string) bool {
+	value, err := strconv.ParseBool(os.Getenv(name))
+	return err == nil && value
 }
 
-// Fallback method to create entity-area mappings from states
-func (h *HAService) extractEntityAreaFromStates() ([]HAEntity, error) {
-	h.logger.Println("Extracting entity-area mappings from states")
-	
-	resp, err := h.makeHARequest("GET", "/api/states", nil)
+func parseTimeout(name, value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
 	if err != nil {
-		return nil, err
+		return 0, fmt.Errorf("invalid %s %q: %v", name, value, err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("HA API returned status %d for states", resp.StatusCode)
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be positive", name, value)
 	}
+	return d, nil
+}
 
-	var states []HAState
-	if err := json.NewDecoder(resp.Body).Decode(&states); err != nil {
-		return nil, err
-	}
+func (h *HAService) LoadConfig() error {
+	h.logger.Println("Loading configuration...")
+	
+	// Try environment variables first
+	token := os.Getenv("HA_TOKEN")
+	url := os.Getenv("HA_URL")
+	tokenFile := os.Getenv("HA_TOKEN_FILE")
+	tokenCommand := os.Getenv("HA_TOKEN_COMMAND")
 
-	// Create entity mappings based on friendly names and patterns
-	var entities []HAEntity
-	for _, state := range states {
-		// Skip non-light/switch entities
-		if !strings.HasPrefix(state.EntityID, "light.") && !strings.HasPrefix(state.EntityID, "switch.") {
-			continue
-		}
-		
-		entity := HAEntity{
-			EntityID: state.EntityID,
+	discover := envBool("HA_DISCOVER")
+
+	if h.configFile == "" && (url != "" || discover) && (token != "" || tokenFile != "" || tokenCommand != "" || dockerSecretExists()) {
+		h.config.Discover = discover
+		h.config.HAToken = token
+		h.config.TokenFile = tokenFile
+		h.config.TokenCommand = tokenCommand
+		h.config.HAURL = strings.TrimSuffix(url, "/")
+		h.config.HAWSURL = os.Getenv("HA_WS_URL")
+		h.config.TokenRefreshCommand = os.Getenv("HA_TOKEN_REFRESH_COMMAND")
+
+		// Load entity filter from environment if available
+		filterStr := os.Getenv("HA_ENTITY_FILTER")
+		if filterStr != "" {
+			h.config.EntityFilter = strings.Split(filterStr, ",")
 		}
-		
-		// Try to extract area from friendly name patterns
-		if friendlyName, hasFriendly := state.Attributes["friendly_name"]; hasFriendly {
-			if nameStr, ok := friendlyName.(string); ok {
-				parts := strings.Split(nameStr, " ")
-				if len(parts) >= 2 {
-					var possibleArea string
-					
-					// Check for two-word areas like "Living Room", "Master Bedroom"
-					if len(parts) >= 3 && isCommonAreaWord(parts[1]) {
-						possibleArea = parts[0] + " " + parts[1]
-					} else {
-						// Single word area
-						possibleArea = parts[0]
-					}
-					
-					// Only consider meaningful area names (avoid device names)
-					if len(possibleArea) > 3 && !isDeviceName(possibleArea) {
-						entity.AreaID = strings.ReplaceAll(strings.ToLower(possibleArea), " ", "_")
-					}
-				}
-			}
+
+		// Load entity blacklist from environment if available
+		blacklistStr := os.Getenv("HA_ENTITY_BLACKLIST")
+		if blacklistStr != "" {
+			h.config.EntityBlacklist = strings.Split(blacklistStr, ",")
 		}
-		
-		entities = append(entities, entity)
-	}
 
-	h.logger.Printf("Extracted %d entity-area mappings from states", len(entities))
-	return entities, nil
-}
+		// Load area and device_class filters from environment if available
+		if areaStr := os.Getenv("HA_AREA_FILTER"); areaStr != "" {
+			h.config.AreaFilter = strings.Split(areaStr, ",")
+		}
+		if areaStr := os.Getenv("HA_AREA_BLACKLIST"); areaStr != "" {
+			h.config.AreaBlacklist = strings.Split(areaStr, ",")
+		}
+		if classStr := os.Getenv("HA_DEVICE_CLASS_FILTER"); classStr != "" {
+			h.config.DeviceClassFilter = strings.Split(classStr, ",")
+		}
+		if classStr := os.Getenv("HA_DEVICE_CLASS_BLACKLIST"); classStr != "" {
+			h.config.DeviceClassBlacklist = strings.Split(classStr, ",")
+		}
 
-// Cache for area enrichment data
-type AreaEnrichmentCache struct {
-	areas      map[string]*HAArea
-	devices    map[string]string // device_id -> area_id
-	entities   map[string]string // entity_id -> area_id
-	lastUpdate time.Time
-	mu         sync.RWMutex
-}
+		// Load timeouts from environment if available
+		h.config.RequestTimeout = os.Getenv("HA_REQUEST_TIMEOUT")
+		h.config.DialTimeout = os.Getenv("HA_DIAL_TIMEOUT")
+		h.config.ReadTimeout = os.Getenv("HA_READ_TIMEOUT")
+
+		// Load TLS options from environment if available
+		h.config.CAFile = os.Getenv("HA_CA_FILE")
+		h.config.ClientCert = os.Getenv("HA_CLIENT_CERT")
+		h.config.ClientKey = os.Getenv("HA_CLIENT_KEY")
+		h.config.InsecureSkipVerify = envBool("HA_INSECURE_SKIP_VERIFY")
+
+		// Load proxy from environment if available
+		h.config.ProxyURL = os.Getenv("HA_PROXY_URL")
+
+		h.config.DegradedMode = envBool("HA_DEGRADED_MODE")
+		h.config.ReadOnly = envBool("HA_READ_ONLY")
+		h.config.AdminTools = envBool("HA_ADMIN_TOOLS")
+		h.config.VerifyWrites = envBool("HA_VERIFY_WRITES")
+		h.config.CompactResponses = envBool("HA_COMPACT_RESPONSES")
+		h.config.DynamicTools = envBool("HA_DYNAMIC_TOOLS")
+		h.config.HeuristicAreas = envBool("HA_HEURISTIC_AREAS")
+		h.config.DisableUpdateCheck = envBool("HA_DISABLE_UPDATE_CHECK")
+		if endpoint := os.Getenv("HA_OTLP_ENDPOINT"); endpoint != "" {
+			h.config.Tracing = &TracingConfig{Endpoint: endpoint}
+		}
+		h.config.Language = os.Getenv("HA_LANGUAGE")
+		if languagesStr := os.Getenv("HA_HEURISTIC_AREA_LANGUAGES"); languagesStr != "" {
+			h.config.HeuristicAreaLanguages = strings.Split(languagesStr, ",")
+		}
 
-var areaCache = &AreaEnrichmentCache{
-	areas:    make(map[string]*HAArea),
-	devices:  make(map[string]string),
-	entities: make(map[string]string),
-}
+		// Load MQTT publishing from environment if available
+		if broker := os.Getenv("HA_MQTT_BROKER"); broker != "" {
+			h.config.MQTT = &MQTTConfig{
+				BrokerURL:   broker,
+				Username:    os.Getenv("HA_MQTT_USERNAME"),
+				Password:    os.Getenv("HA_MQTT_PASSWORD"),
+				TopicPrefix: os.Getenv("HA_MQTT_TOPIC_PREFIX"),
+				Retain:      envBool("HA_MQTT_RETAIN"),
+			}
+			if qosStr := os.Getenv("HA_MQTT_QOS"); qosStr != "" {
+				qos, err := strconv.ParseUint(qosStr, 10, 8)
+				if err != nil {
+					return fmt.Errorf("invalid HA_MQTT_QOS %q", qosStr)
+				}
+				h.config.MQTT.QoS = byte(qos)
+			}
+		}
 
-func (h *HAService) updateAreaCache() error {
-	areaCache.mu.Lock()
-	defer areaCache.mu.Unlock()
+		// Load HTTP transport security from environment if available
+		h.config.Server.APIKey = os.Getenv("HA_SERVER_API_KEY")
+		h.config.Server.TLSCert = os.Getenv("HA_SERVER_TLS_CERT")
+		h.config.Server.TLSKey = os.Getenv("HA_SERVER_TLS_KEY")
+		h.config.Server.ClientCAFile = os.Getenv("HA_SERVER_CLIENT_CA_FILE")
+		h.config.HealthAddr = os.Getenv("HA_HEALTH_ADDR")
+		h.config.PprofAddr = os.Getenv("HA_PPROF_ADDR")
+		h.config.StatePollInterval = os.Getenv("HA_STATE_POLL_INTERVAL")
+		h.config.UnitSystem = os.Getenv("HA_UNIT_SYSTEM")
+		h.config.ScheduleFile = os.Getenv("HA_SCHEDULE_FILE")
+
+		if retriesStr := os.Getenv("HA_BATCH_RETRIES"); retriesStr != "" {
+			retries, err := strconv.Atoi(retriesStr)
+			if err != nil || retries < 0 {
+				return fmt.Errorf("invalid HA_BATCH_RETRIES %q", retriesStr)
+			}
+			h.config.BatchRetries = retries
+		}
 
-	// Update cache every 5 minutes
-	if time.Since(areaCache.lastUpdate) < 5*time.Minute {
-		return nil
-	}
+		// Load global attribute allow/deny lists from environment if available
+		if allowStr := os.Getenv("HA_ATTRIBUTE_ALLOWLIST"); allowStr != "" {
+			h.config.Attributes.Allow = strings.Split(allowStr, ",")
+		}
+		if denyStr := os.Getenv("HA_ATTRIBUTE_DENYLIST"); denyStr != "" {
+			h.config.Attributes.Deny = strings.Split(denyStr, ",")
+		}
 
-	h.logger.Println("Updating area cache")
+		// Load global rate limit from environment if available
+		if rpsStr := os.Getenv("HA_RATE_LIMIT"); rpsStr != "" {
+			rps, err := strconv.ParseFloat(rpsStr, 64)
+			if err != nil {
+				return fmt.Errorf("invalid HA_RATE_LIMIT %q: %v", rpsStr, err)
+			}
+			h.config.RateLimit.RequestsPerSecond = rps
+			if burstStr := os.Getenv("HA_RATE_BURST"); burstStr != "" {
+				burst, err := strconv.Atoi(burstStr)
+				if err != nil {
+					return fmt.Errorf("invalid HA_RATE_BURST %q: %v", burstStr, err)
+				}
+				h.config.RateLimit.Burst = burst
+			}
+		}
+		
+		if err := h.loadToken(); err != nil {
+			return err
+		}
 
-	// Get areas (with fallbacks)
-	areas, err := h.getAreas()
-	if err != nil {
-		h.logger.Printf("Warning: Could not update areas cache: %v", err)
-		// Don't return error, continue with empty areas
-		areas = []HAArea{}
+		h.logger.Printf("Configuration loaded from environment variables")
+		return h.applyClientConfig()
 	}
 
-	// Clear and rebuild areas map
-	areaCache.areas = make(map[string]*HAArea)
-	for i := range areas {
-		areaCache.areas[areas[i].AreaID] = &areas[i]
+	// Fallback to config file (JSON or YAML) in executable directory
+	configFile := h.configFile
+	if configFile == "" {
+		configFile = os.Getenv("CONFIG_FILE")
 	}
-
-	// Get devices (with fallbacks)
-	devices, err := h.getDevices()
-	if err != nil {
-		h.logger.Printf("Warning: Could not update devices cache: %v", err)
-		// Don't return error, continue with empty devices
-		devices = []HADevice{}
+	if configFile == "" {
+		configFile = h.findConfigFile()
+	} else {
+		// If CONFIG_FILE is relative path, make it relative to executable directory
+		configFile = h.resolvePath(configFile)
 	}
 
-	// Clear and rebuild devices map
-	areaCache.devices = make(map[string]string)
-	for _, device := range devices {
-		if device.AreaID != "" {
-			areaCache.devices[device.ID] = device.AreaID
-		}
-	}
+	h.logger.Printf("Looking for config file: %s", configFile)
 
-	// Get entity registry (with fallbacks)
-	entities, err := h.getEntityRegistry()
+	data, err := os.ReadFile(configFile)
 	if err != nil {
-		h.logger.Printf("Warning: Could not update entity registry cache: %v", err)
-		// Don't return error, continue with empty entities
-		entities = []HAEntity{}
+		return fmt.Errorf("failed to read config file %s: %v", configFile, err)
 	}
 
-	// Clear and rebuild entities map
-	areaCache.entities = make(map[string]string)
-	for _, entity := range entities {
-		// Direct area assignment
-		if entity.AreaID != "" {
-			areaCache.entities[entity.EntityID] = entity.AreaID
-		} else if entity.DeviceID != "" {
-			// Area through device
-			if deviceAreaID, exists := areaCache.devices[entity.DeviceID]; exists {
-				areaCache.entities[entity.EntityID] = deviceAreaID
-			}
-		}
+	if err := parseConfig(configFile, data, &h.config); err != nil {
+		return fmt.Errorf("invalid config file %s: %v", configFile, err)
 	}
 
-	areaCache.lastUpdate = time.Now()
-	h.logger.Printf("Area cache updated: %d areas, %d devices, %d entities", len(areaCache.areas), len(areaCache.devices), len(areaCache.entities))
-	return nil
-}
-
-func (h *HAService) enrichWithArea(states []HAState) []HAState {
-	// Update cache if needed - never fail, just log warnings
-	h.updateAreaCache()
-
-	areaCache.mu.RLock()
-	defer areaCache.mu.RUnlock()
-
-	// If we have no area information, just return original states
-	if len(areaCache.areas) == 0 && len(areaCache.entities) == 0 {
-		h.logger.Println("No area information available, returning states without area info")
-		return states
+	h.config.HAURL = strings.TrimSuffix(h.config.HAURL, "/")
+	if err := h.loadToken(); err != nil {
+		return err
 	}
 
-	// Enrich states with area information
-	enrichedCount := 0
-	for i := range states {
-		if areaID, exists := areaCache.entities[states[i].EntityID]; exists {
-			if area, areaExists := areaCache.areas[areaID]; areaExists {
-				states[i].Area = area
-				enrichedCount++
-			}
-		}
-	}
+	h.logger.Printf("Configuration loaded from file: %s", configFile)
+	return h.applyClientConfig()
+}
 
-	h.logger.Printf("Enriched %d out of %d entities with area information", enrichedCount, len(states))
-	return states
+// readOnlyPOSTEndpoints only read Home Assistant although they take a POST body, so they
+// stay available in read-only mode
+var readOnlyPOSTEndpoints = map[string]bool{
+	"/api/template": true,
 }
 
-func (h *HAService) getAllStates() ([]HAState, error) {
-	h.logger.Println("Fetching all states from HA")
+func (h *HAService) makeHARequest(ctx context.Context, method, endpoint string, body interface{}) (*http.Response, error) {
+	url := h.config.HAURL + endpoint
 	
-	resp, err := h.makeHARequest("GET", "/api/states", nil)
-	if err != nil {
-		h.logger.Printf("Failed to get states: %v", err)
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		h.logger.Printf("HA API returned status %d", resp.StatusCode)
-		return nil, fmt.Errorf("HA API returned status %d", resp.StatusCode)
+	if h.config.ReadOnly && method != "GET" && !(method == "POST" && readOnlyPOSTEndpoints[endpoint]) {
+		h.logger.Printf("%s request to %s rejected in read-only mode", method, url)
+		return nil, errReadOnly
 	}
 
-	var states []HAState
-	if err := json.NewDecoder(resp.Body).Decode(&states); err != nil {
+	if err := h.rateLimiter.allow(endpointDomain(endpoint)); err != nil {
+		h.logger.Printf("Request to %s rejected: %v", url, err)
 		return nil, err
 	}
 
-	// Filter for lights and switches only
-	var filtered []HAState
-	for _, state := range states {
-		if strings.HasPrefix(state.EntityID, "light.") || strings.HasPrefix(state.EntityID, "switch.") {
-			filtered = append(filtered, state)
+	h.debugf("Making %s request to: %s", method, url)
+
+	var jsonBody []byte
+	if body != nil {
+		var err error
+		jsonBody, err = json.Marshal(body)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	result := h.filterEntities(filtered)
-	
-	// Enrich with area information
-	result = h.enrichWithArea(result)
-	
-	h.logger.Printf("Returning %d filtered entities with area info", len(result))
-	return result, nil
-}
-
-func (h *HAService) getEntityState(entityID string) (*HAState, error) {
-	h.logger.Printf("Getting state for entity: %s", entityID)
-	
-	resp, err := h.makeHARequest("GET", "/api/states/"+entityID, nil)
+	token := h.token()
+	resp, err := h.doHARequest(ctx, method, url, jsonBody, token)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == 404 {
-		return nil, fmt.Errorf("entity %s not found", entityID)
-	}
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("HA API returned status %d", resp.StatusCode)
-	}
+	// A rotated token may be picked up by the refresh hook, retry once with the new one
+	if resp.StatusCode == 401 {
+		resp.Body.Close()
+		if !h.refreshToken(ctx, token) {
+			return nil, &UnauthorizedError{Message: "Home Assistant rejected the access token (401)"}
+		}
 
-	var state HAState
-	if err := json.NewDecoder(resp.Body).Decode(&state); err != nil {
-		return nil, err
+		resp, err = h.doHARequest(ctx, method, url, jsonBody, h.token())
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == 401 {
+			resp.Body.Close()
+			return nil, &UnauthorizedError{Message: "Home Assistant rejected the refreshed access token (401)"}
+		}
 	}
 
-	// Enrich with area information
-	states := []HAState{state}
-	states = h.enrichWithArea(states)
-	
-	return &states[0], nil
+	return resp, nil
 }
 
-func (h *HAService) controlEntity(entityID, action string) error {
-	h.logger.Printf("Controlling entity %s: %s", entityID, action)
+func (h *HAService) doHARequest(ctx context.Context, method, url string, jsonBody []byte, token string) (resp *http.Response, err error) {
+	ctx, span := tracer.Start(ctx, "HA "+method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("http.request.method", method),
+		attribute.String("url.full", url),
+	))
+	start := time.Now()
+	defer func() {
+		endSpan(span, err)
+		failed := err != nil || resp.StatusCode >= 400
+		stats.recordEndpoint(statsEndpoint(method, strings.TrimPrefix(url, h.config.HAURL)), time.Since(start), failed)
+	}()
 
-	var domain, service string
+	var req *http.Request
 
-	if strings.HasPrefix(entityID, "light.") {
-		domain = "light"
-	} else if strings.HasPrefix(entityID, "switch.") {
-		domain = "switch"
+	if jsonBody != nil {
+		req, err = http.NewRequestWithContext(ctx, method, url, strings.NewReader(string(jsonBody)))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
 	} else {
-		return fmt.Errorf("unsupported entity type for %s", entityID)
+		req, err = http.NewRequestWithContext(ctx, method, url, nil)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	switch action {
-	case "on", "turn_on":
-		service = "turn_on"
-	case "off", "turn_off":
-		service = "turn_off"
-	default:
-		return fmt.Errorf("unsupported action: %s", action)
+	req.Header.Set("Authorization", "Bearer "+token)
+	
+	if h.debug {
+		headers := req.Header.Clone()
+		headers.Set("Authorization", "Bearer <redacted>")
+		h.debugf("Request headers: %+v", headers)
 	}
-
-	serviceCall := map[string]interface{}{
-		"entity_id": entityID,
+	
+	client := h.httpClient
+	if timeout, ok := callTimeout(ctx); ok {
+		override := *client
+		override.Timeout = timeout
+		client = &override
+	}
+	resp, err = client.Do(req)
+	if err != nil {
+		h.logger.Printf("HTTP request failed: %v", err)
+		return nil, err
 	}
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	
+	h.debugf("Response status: %d %s", resp.StatusCode, resp.Status)
+	
+	return resp, nil
+}
 
-	startTime := time.Now()
-	resp, err := h.makeHARequest("POST", fmt.Sprintf("/api/services/%s/%s", domain, service), serviceCall)
-	duration := time.Since(startTime)
+// checkConnectivity verifies that HA is reachable and accepts the token over REST and WebSocket
+func (h *HAService) checkConnectivity(ctx context.Context) error {
+	h.logger.Println("Checking Home Assistant connectivity")
 
-	if err != nil {
-		h.logger.Printf("HA API request failed for %s after %v: %v", entityID, duration, err)
+	if err := h.checkREST(ctx); err != nil {
 		return err
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		h.logger.Printf("HA API returned status %d for %s after %v", resp.StatusCode, entityID, duration)
-		return fmt.Errorf("HA API returned status %d", resp.StatusCode)
+	if err := h.checkWebSocket(ctx); err != nil {
+		return err
 	}
 
-	h.logger.Printf("Successfully controlled %s (%s) in %v", entityID, action, duration)
+	h.logger.Println("Home Assistant connectivity check passed")
 	return nil
 }
 
-// Global HA service instance
-var haService *HAService
-
-// MCP Tool Handlers using mark3labs/mcp-go
-
-// get_all_states handler
-func getAllStatesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	states, err := haService.getAllStates()
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to get states: %v", err)), nil
+// checkREST calls /api/ and translates common failures into actionable errors
+func (h *HAService) checkREST(ctx context.Context) error {
+	resp, err := h.makeHARequest(ctx, "GET", "/api/", nil)
+	var unauthorizedErr *UnauthorizedError
+	if errors.As(err, &unauthorizedErr) {
+		return fmt.Errorf("Home Assistant rejected the access token (401 Unauthorized), check HA_TOKEN")
 	}
-
-	// Convert states to JSON for the response
-	statesJSON, err := json.Marshal(states)
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize states: %v", err)), nil
+		return fmt.Errorf("Home Assistant unreachable at %s: %v", h.config.HAURL, err)
 	}
+	resp.Body.Close()
 
-	return mcp.NewToolResultText(fmt.Sprintf("Found %d lights and switches:\n%s", len(states), string(statesJSON))), nil
+	switch {
+	case resp.StatusCode == 401:
+		return fmt.Errorf("Home Assistant rejected the access token (401 Unauthorized), check HA_TOKEN")
+	case resp.StatusCode == 404:
+		return fmt.Errorf("Home Assistant API not found at %s/api/ (404), check HA_URL", h.config.HAURL)
+	case resp.StatusCode != 200:
+		return fmt.Errorf("Home Assistant API at %s returned status %d", h.config.HAURL, resp.StatusCode)
+	}
+	return nil
 }
 
-// get_entity_state handler
-func getEntityStateHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	entityID, err := request.RequireString("entity_id")
-	if err != nil {
-		return mcp.NewToolResultError("entity_id parameter is required"), nil
-	}
+// checkWebSocket performs the WebSocket authentication handshake
+func (h *HAService) checkWebSocket(ctx context.Context) error {
+	wsCtx, cancel := context.WithTimeout(ctx, h.requestTimeout)
+	defer cancel()
 
-	state, err := haService.getEntityState(entityID)
+	conn, err := h.dialWebSocket(wsCtx)
 	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to get entity state: %v", err)), nil
+		return fmt.Errorf("Home Assistant WebSocket unreachable at %s: %v", h.wsURL, err)
 	}
+	defer conn.Close()
 
-	stateJSON, err := json.Marshal(state)
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize state: %v", err)), nil
+	if err := h.authenticateWebSocket(conn); err != nil {
+		return fmt.Errorf("Home Assistant WebSocket %v", err)
 	}
+	return nil
+}
 
-	return mcp.NewToolResultText(fmt.Sprintf("Entity %s is %s:\n%s", entityID, state.State, string(stateJSON))), nil
+func (h *HAService) isEntityBlacklisted(entityID string) bool {
+	return matchesAny(h.entityBlacklist, entityID)
 }
 
-// control_entity handler
-func controlEntityHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	entityID, err := request.RequireString("entity_id")
-	if err != nil {
-		return mcp.NewToolResultError("entity_id parameter is required"), nil
-	}
+func (h *HAService) isEntityWhitelisted(entityID string) bool {
+	return matchesAny(h.entityFilter, entityID)
+}
 
-	action, err := request.RequireString("action")
-	if err != nil {
-		return mcp.NewToolResultError("action parameter is required"), nil
-	}
+func (h *HAService) filterEntities(ctx context.Context, entities []HAState) []HAState {
+	var filtered []HAState
 
-	err = haService.controlEntity(entityID, action)
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to control entity: %v", err)), nil
+	for _, entity := range entities {
+		if h.entityIDExposed(ctx, entity.EntityID) && h.isDeviceClassAllowed(entity) {
+			filtered = append(filtered, entity)
+		}
 	}
 
-	return mcp.NewToolResultText(fmt.Sprintf("Successfully turned %s %s", entityID, action)), nil
+	return filtered
 }
 
-// control_multiple_entities handler (simplified version)
-func controlMultipleEntitiesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	arguments := request.GetArguments()
+// Internal functions for area enrichment
+func (h *HAService) getAreas(ctx context.Context) ([]HAArea, error) {
+	h.logger.Println("Fetching areas from HA")
 	
-	// Get entities from parameter
-	entitiesInterface, ok := arguments["entities"]
-	if !ok {
-		return mcp.NewToolResultError("entities parameter is required"), nil
+	// First try WebSocket API (most reliable)
+	areas, err := h.getAreasViaWebSocket(ctx)
+	if err == nil && len(areas) > 0 {
+		h.logger.Printf("Successfully got %d areas via WebSocket", len(areas))
+		return areas, nil
 	}
 	
-	entitiesSlice, entitiesOk := entitiesInterface.([]interface{})
-	if !entitiesOk {
-		return mcp.NewToolResultError("entities must be an array"), nil
+	h.logger.Printf("WebSocket failed (%v), trying REST endpoints", err)
+	
+	// Fallback to REST endpoints
+	endpoints := []string{
+		"/api/config/area_registry",
+		"/api/areas",
 	}
-
-	haService.logger.Printf("Processing %d entities in batch", len(entitiesSlice))
 	
-	results := make([]map[string]interface{}, 0, len(entitiesSlice))
+	for _, endpoint := range endpoints {
+		h.logger.Printf("Trying endpoint: %s", endpoint)
+		resp, err := h.makeHARequest(ctx, "GET", endpoint, nil)
+		if err != nil {
+			h.logger.Printf("Failed to get areas from %s: %v", endpoint, err)
+			continue
+		}
+		defer resp.Body.Close()
+		
+		if resp.StatusCode == 200 {
+			h.logger.Printf("Success! Endpoint %s returned 200", endpoint)
+			
+			// Try to decode as JSON
+			bodyBytes, err := io.ReadAll(resp.Body)
+			if err != nil {
+				h.logger.Printf("Failed to read response body from %s: %v", endpoint, err)
+				continue
+			}
+			
+			var areas []HAArea
+			if err := json.Unmarshal(bodyBytes, &areas); err != nil {
+				h.logger.Printf("Failed to decode areas from %s: %v", endpoint, err)
+				continue
+			}
+			h.logger.Printf("Found %d areas from %s", len(areas), endpoint)
+			return areas, nil
+		} else {
+			h.logger.Printf("Endpoint %s returned status %d", endpoint, resp.StatusCode)
+		}
+	}
+	
+	h.logger.Printf("All REST endpoints failed, falling back to states extraction")
+	// As last resort, try to extract area info from states attributes
+	return h.extractAreasFromStates(ctx)
+}
+
+// Fallback method to extract areas from entity states attributes
+func (h *HAService) extractAreasFromStates(ctx context.Context) ([]HAArea, error) {
+	h.logger.Println("Extracting areas from entity states")
+	
+	states, err := h.fetchStates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Extract unique areas from entity attributes
+	areasMap := make(map[string]*HAArea)
+	guessed := 0
+	for _, state := range states {
+		// Skip non-light/switch entities for area extraction
+		if !strings.HasPrefix(state.EntityID, "light.") && !strings.HasPrefix(state.EntityID, "switch.") {
+			continue
+		}
+		
+		// Check for explicit area attribute first
+		if areaName, hasArea := state.Attributes["area"]; hasArea {
+			if areaStr, ok := areaName.(string); ok && areaStr != "" {
+				areaID := strings.ReplaceAll(strings.ToLower(areaStr), " ", "_")
+				if _, exists := areasMap[areaID]; !exists {
+					areasMap[areaID] = &HAArea{
+						AreaID: areaID,
+						Name:   areaStr,
+					}
+				}
+			}
+		}
+		
+		// Guessing areas from friendly names is opt-in (heuristic_areas)
+		if !h.config.HeuristicAreas {
+			continue
+		}
+		if possibleArea := h.areaWords.guessAreaFromName(formatValue(state.Attributes["friendly_name"])); possibleArea != "" {
+			areaID := strings.ReplaceAll(strings.ToLower(possibleArea), " ", "_")
+			if _, exists := areasMap[areaID]; !exists {
+				areasMap[areaID] = &HAArea{
+					AreaID: areaID,
+					Name:   possibleArea,
+				}
+				guessed++
+			}
+		}
+	}
+
+	// Convert map to slice
+	var areas []HAArea
+	for _, area := range areasMap {
+		areas = append(areas, *area)
+	}
+
+	h.logger.Printf("Extracted %d areas from entity states", len(areas))
+	if guessed > 0 {
+		h.logger.Printf("%d of them guessed from friendly names (heuristic_areas)", guessed)
+	}
+	return areas, nil
+}
+
+func (h *HAService) getDevices(ctx context.Context) ([]HADevice, error) {
+	h.logger.Println("Fetching devices from HA")
+	
+	// First try WebSocket API
+	devicesWS, err := h.getDevicesViaWebSocket(ctx)
+	if err == nil && len(devicesWS) >= 0 { // Accept empty result as valid
+		h.logger.Printf("Successfully got %d devices via WebSocket", len(devicesWS))
+		return devicesWS, nil
+	}
+	
+	h.logger.Printf("WebSocket failed (%v), trying REST endpoint", err)
+	
+	resp, err := h.makeHARequest(ctx, "GET", "/api/config/device_registry", nil)
+	if err != nil {
+		h.logger.Printf("Failed to get devices: %v", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		h.logger.Printf("HA API returned status %d for devices, skipping device registry", resp.StatusCode)
+		return []HADevice{}, nil // Return empty slice instead of error
+	}
+
+	var devices []HADevice
+	if err := json.NewDecoder(resp.Body).Decode(&devices); err != nil {
+		return nil, err
+	}
+
+	h.logger.Printf("Found %d devices", len(devices))
+	return devices, nil
+}
+
+func (h *HAService) getEntityRegistry(ctx context.Context) ([]HAEntity, error) {
+	h.logger.Println("Fetching entity registry from HA")
+	
+	// First try WebSocket API
+	entitiesWS, err := h.getEntityRegistryViaWebSocket(ctx)
+	if err == nil && len(entitiesWS) >= 0 { // Accept empty result as valid
+		h.logger.Printf("Successfully got %d entities via WebSocket", len(entitiesWS))
+		return entitiesWS, nil
+	}
+	
+	h.logger.Printf("WebSocket failed (%v), trying REST endpoint", err)
+	
+	resp, err := h.makeHARequest(ctx, "GET", "/api/config/entity_registry", nil)
+	if err != nil {
+		h.logger.Printf("Failed to get entity registry: %v", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		h.logger.Printf("HA API returned status %d for entity registry, falling back to states-based area matching", resp.StatusCode)
+		return h.extractEntityAreaFromStates(ctx)
+	}
+
+	var entities []HAEntity
+	if err := json.NewDecoder(resp.Body).Decode(&entities); err != nil {
+		return nil, err
+	}
+
+	h.logger.Printf("Found %d entities in registry", len(entities))
+	return entities, nil
+}
+
+// Fallback method to create entity-area mappings from states. Without heuristic_areas
+// there is nothing reliable to map, so entities stay without an area.
+func (h *HAService) extractEntityAreaFromStates(ctx context.Context) ([]HAEntity, error) {
+	if !h.config.HeuristicAreas {
+		h.logger.Println("Entity registry unavailable and heuristic_areas disabled, entities get no area")
+		return []HAEntity{}, nil
+	}
+	h.logger.Println("Extracting entity-area mappings from states (heuristic_areas)")
+	
+	states, err := h.fetchStates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create entity mappings based on friendly names and patterns
+	var entities []HAEntity
+	for _, state := range states {
+		// Skip non-light/switch entities
+		if !strings.HasPrefix(state.EntityID, "light.") && !strings.HasPrefix(state.EntityID, "switch.") {
+			continue
+		}
+		
+		entity := HAEntity{
+			EntityID: state.EntityID,
+		}
+		if possibleArea := h.areaWords.guessAreaFromName(formatValue(state.Attributes["friendly_name"])); possibleArea != "" {
+			entity.AreaID = strings.ReplaceAll(strings.ToLower(possibleArea), " ", "_")
+		}
+		
+		entities = append(entities, entity)
+	}
+
+	h.logger.Printf("Extracted %d entity-area mappings from states", len(entities))
+	return entities, nil
+}
+
+// Cache for area enrichment data
+type AreaEnrichmentCache struct {
+	areas      map[string]*HAArea
+	devices    map[string]string   // device_id -> area_id
+	entities   map[string]string   // entity_id -> area_id
+	labels     map[string][]string // entity_id -> label_ids
+	deviceOf   map[string]string   // entity_id -> device_id
+	registry   []HAEntity          // last entity registry, to re-derive areas when devices move
+	lastUpdate time.Time
+	mu         sync.RWMutex // guards the fields above, held only to read or swap them
+	writeMu    sync.Mutex   // serializes replace
+	loadMu     sync.Mutex   // serializes the first, blocking load
+	refreshing atomic.Bool  // a background refresh is running
+}
+
+// How long the area cache is served before it is refreshed in the background
+const areaCacheTTL = 5 * time.Minute
+
+var areaCache = &AreaEnrichmentCache{
+	areas:    make(map[string]*HAArea),
+	devices:  make(map[string]string),
+	entities: make(map[string]string),
+	labels:   make(map[string][]string),
+	deviceOf: make(map[string]string),
+}
+
+// updateAreaCache makes sure the area cache is loaded. Only the first load blocks; once
+// something is cached, an expired cache is served as is while a background refresh
+// replaces it (stale-while-revalidate).
+func (h *HAService) updateAreaCache(ctx context.Context) error {
+	areaCache.mu.RLock()
+	lastUpdate := areaCache.lastUpdate
+	areaCache.mu.RUnlock()
+
+	if time.Since(lastUpdate) < areaCacheTTL {
+		return nil
+	}
+	if !lastUpdate.IsZero() {
+		if areaCache.refreshing.CompareAndSwap(false, true) {
+			go func() {
+				defer areaCache.refreshing.Store(false)
+				ctx, cancel := context.WithTimeout(context.Background(), 2*h.requestTimeout)
+				defer cancel()
+				if err := h.refreshAreaCache(ctx); err != nil {
+					h.logger.Printf("Background area cache refresh failed, keeping the previous data: %v", err)
+				}
+			}()
+		}
+		return nil
+	}
+
+	// Nothing cached yet: concurrent first callers wait for a single load
+	areaCache.loadMu.Lock()
+	defer areaCache.loadMu.Unlock()
+	areaCache.mu.RLock()
+	loaded := !areaCache.lastUpdate.IsZero()
+	areaCache.mu.RUnlock()
+	if loaded {
+		return nil
+	}
+	return h.refreshAreaCache(ctx)
+}
+
+// refreshAreaCache reads the area, device and entity registries and replaces the cached
+// ones. The reads happen before taking the lock, so enrichment keeps using the previous
+// data meanwhile.
+func (h *HAService) refreshAreaCache(ctx context.Context) error {
+	h.logger.Println("Updating area cache")
+
+	// The three registries are independent requests, fetch them at once over the shared
+	// connection. A failed one leaves its part empty rather than failing the others, so
+	// this waits for all of them instead of cancelling on the first error.
+	var areas []HAArea
+	var devices []HADevice
+	var entities []HAEntity
+	var areasErr, devicesErr, entitiesErr error
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		areas, areasErr = h.getAreas(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		devices, devicesErr = h.getDevices(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		entities, entitiesErr = h.getEntityRegistry(ctx)
+	}()
+	wg.Wait()
+
+	// A cancelled request leaves partial data behind, keep the previous data instead
+	if err := ctx.Err(); err != nil {
+		h.logger.Printf("Area cache update aborted: %v", err)
+		return err
+	}
+
+	// A registry that couldn't be read keeps its previous data, empty on the first load
+	var areasUpdate *[]HAArea
+	var devicesUpdate *[]HADevice
+	var entitiesUpdate *[]HAEntity
+	if areasErr != nil {
+		h.logger.Printf("Warning: Could not update areas cache: %v", areasErr)
+	} else {
+		areasUpdate = &areas
+	}
+	if devicesErr != nil {
+		h.logger.Printf("Warning: Could not update devices cache: %v", devicesErr)
+	} else {
+		devicesUpdate = &devices
+	}
+	if entitiesErr != nil {
+		h.logger.Printf("Warning: Could not update entity registry cache: %v", entitiesErr)
+	} else {
+		entitiesUpdate = &entities
+	}
+	areaCache.replace(areasUpdate, devicesUpdate, entitiesUpdate, true)
+
+	h.logger.Printf("Area cache updated: %d areas, %d devices, %d entities", len(areas), len(devices), len(entities))
+	return nil
+}
+
+func (h *HAService) enrichWithArea(ctx context.Context, states []HAState) []HAState {
+	// Update cache if needed - never fail, just log warnings
+	h.updateAreaCache(ctx)
+
+	areaCache.mu.RLock()
+	defer areaCache.mu.RUnlock()
+
+	// If we have no area information, just return original states
+	if len(areaCache.areas) == 0 && len(areaCache.entities) == 0 {
+		h.logger.Println("No area information available, returning states without area info")
+		return states
+	}
+
+	// Enrich states with area information
+	enrichedCount := 0
+	for i := range states {
+		if areaID, exists := areaCache.entities[states[i].EntityID]; exists {
+			if area, areaExists := areaCache.areas[areaID]; areaExists {
+				states[i].Area = area
+				enrichedCount++
+			}
+		}
+	}
+
+	h.logger.Printf("Enriched %d out of %d entities with area information", enrichedCount, len(states))
+	return states
+}
+
+// In-flight /api/states request shared by concurrent callers
+type statesCall struct {
+	done   chan struct{}
+	states []HAState
+	err    error
+}
+
+// fetchStates reads /api/states, coalescing concurrent callers into one upstream request.
+// The shared request is detached from the first caller's cancellation (the HTTP client
+// timeout still bounds it); every caller stops waiting when its own context is done.
+func (h *HAService) fetchStates(ctx context.Context) ([]HAState, error) {
+	h.statesMu.Lock()
+	call := h.statesCall
+	if call == nil {
+		call = &statesCall{done: make(chan struct{})}
+		h.statesCall = call
+		go h.runStatesCall(context.WithoutCancel(ctx), call)
+	} else {
+		h.logger.Println("Joining in-flight states request")
+	}
+	h.statesMu.Unlock()
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if call.err != nil {
+		return nil, call.err
+	}
+	// Each caller gets its own slice since results are enriched in place
+	return append([]HAState(nil), call.states...), nil
+}
+
+func (h *HAService) runStatesCall(ctx context.Context, call *statesCall) {
+	defer func() {
+		h.statesMu.Lock()
+		h.statesCall = nil
+		h.statesMu.Unlock()
+		close(call.done)
+	}()
+
+	resp, err := h.makeHARequest(ctx, "GET", "/api/states", nil)
+	if err != nil {
+		call.err = err
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		h.logger.Printf("HA API returned status %d for states", resp.StatusCode)
+		call.err = fmt.Errorf("HA API returned status %d for states", resp.StatusCode)
+		return
+	}
+
+	call.err = json.NewDecoder(resp.Body).Decode(&call.states)
+	if call.err == nil {
+		if evicted, truncated := h.stateCache.store(call.states); evicted > 0 || truncated > 0 {
+			h.logger.Printf("State cache bounded: %d entities evicted, %d attributes truncated", evicted, truncated)
+		}
+	}
+}
+
+// Domains returned by get_all_states and searched by name resolution
+var listedDomains = []string{"light", "switch", "water_heater", "valve", "lawn_mower"}
+
+func isListedEntity(entityID string) bool {
+	domain, _, _ := strings.Cut(entityID, ".")
+	return containsString(listedDomains, domain)
+}
+
+// isSwitchable reports whether control_entity can turn entityID on and off
+func isSwitchable(entityID string) bool {
+	return strings.HasPrefix(entityID, "light.") || strings.HasPrefix(entityID, "switch.")
+}
+
+// getAllStates returns filtered entities of the listed domains; maxAge > 0 allows serving
+// cached states
+func (h *HAService) getAllStates(ctx context.Context, maxAge time.Duration) ([]HAState, error) {
+	states, err := h.getRawStates(ctx, maxAge)
+	if err != nil {
+		return nil, err
+	}
+
+	// Filter for the listed domains only
+	var filtered []HAState
+	for _, state := range states {
+		if isListedEntity(state.EntityID) {
+			filtered = append(filtered, state)
+		}
+	}
+
+	result := h.exposeStates(ctx, filtered)
+	h.logger.Printf("Returning %d filtered entities with area info", len(result))
+	return result, nil
+}
+
+// getRawStates returns every HA state, unfiltered, from the cache when it is fresh enough
+func (h *HAService) getRawStates(ctx context.Context, maxAge time.Duration) ([]HAState, error) {
+	states, cached := h.stateCache.all(maxAge)
+	if cached {
+		h.logger.Printf("Serving %d states from cache (max age %v)", len(states), maxAge)
+		return states, nil
+	}
+
+	h.logger.Println("Fetching all states from HA")
+	states, err := h.fetchStates(ctx)
+	if err != nil {
+		h.logger.Printf("Failed to get states: %v", err)
+		return nil, err
+	}
+	return states, nil
+}
+
+// exposeStates filters states for output, then applies the attribute policy and adds
+// the change age
+func (h *HAService) exposeStates(ctx context.Context, states []HAState) []HAState {
+	result := h.filterExposed(ctx, states)
+	result = h.addMowerDetails(ctx, result)
+	addCapabilities(result)
+	result = h.applyAttributePolicy(result)
+	addChangeAge(result, time.Now(), languageFromContext(ctx))
+	return result
+}
+
+// filterExposed applies the entity, device class and area filters and enriches the
+// remaining states with their area; attributes are left untouched
+func (h *HAService) filterExposed(ctx context.Context, states []HAState) []HAState {
+	result := h.filterEntities(ctx, states)
+	
+	// Enrich with area information
+	result = h.enrichWithArea(ctx, result)
+	return h.filterEntitiesByArea(result)
+}
+
+// getEntityState reads one entity; maxAge > 0 allows serving it from the state cache
+func (h *HAService) getEntityState(ctx context.Context, entityID string, maxAge time.Duration) (*HAState, error) {
+	h.logger.Printf("Getting state for entity: %s", entityID)
+
+	if c := h.findComputed(entityID); c != nil {
+		state := h.computedState(ctx, c, maxAge)
+		return &state, nil
+	}
+
+	if !h.entityIDExposed(ctx, entityID) {
+		return nil, &AccessDeniedError{EntityID: entityID}
+	}
+
+	state, err := h.fetchEntityState(ctx, entityID, maxAge)
+	if err != nil {
+		return nil, h.withSuggestions(ctx, err)
+	}
+
+	// Enrich with area information
+	states := h.enrichWithArea(ctx, []HAState{*state})
+	if !h.isDeviceClassAllowed(states[0]) || !h.isAreaAllowed(states[0].Area) {
+		return nil, &AccessDeniedError{EntityID: entityID}
+	}
+	states = h.addMowerDetails(ctx, states)
+	addCapabilities(states)
+	states = h.applyAttributePolicy(states)
+	addChangeAge(states, time.Now(), languageFromContext(ctx))
+	
+	return &states[0], nil
+}
+
+// fetchEntityState reads one raw, unfiltered entity state
+func (h *HAService) fetchEntityState(ctx context.Context, entityID string, maxAge time.Duration) (*HAState, error) {
+	if state, cached := h.stateCache.get(entityID, maxAge); cached {
+		h.logger.Printf("Serving %s from state cache (max age %v)", entityID, maxAge)
+		return &state, nil
+	}
+	
+	resp, err := h.makeHARequest(ctx, "GET", "/api/states/"+entityID, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		return nil, &EntityNotFoundError{EntityID: entityID}
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("HA API returned status %d", resp.StatusCode)
+	}
+
+	var state HAState
+	if err := json.NewDecoder(resp.Body).Decode(&state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// controlService maps an on/off action on a light or switch to the HA service to call
+func controlService(entityID, action string) (domain, service string, err error) {
+	if strings.HasPrefix(entityID, "light.") {
+		domain = "light"
+	} else if strings.HasPrefix(entityID, "switch.") {
+		domain = "switch"
+	} else {
+		return "", "", &InvalidRequestError{fmt.Sprintf("unsupported entity type for %s", entityID)}
+	}
+
+	switch action {
+	case "on", "turn_on":
+		service = "turn_on"
+	case "off", "turn_off":
+		service = "turn_off"
+	default:
+		return "", "", &InvalidRequestError{fmt.Sprintf("unsupported action: %s", action)}
+	}
+	return domain, service, nil
+}
+
+func (h *HAService) controlEntity(ctx context.Context, entityID, action string) error {
+	h.logger.Printf("Controlling entity %s: %s", entityID, action)
+
+	domain, service, err := controlService(entityID, action)
+	if err != nil {
+		return err
+	}
+
+	if err := h.checkEntityAccess(ctx, entityID); err != nil {
+		return err
+	}
+
+	serviceCall := map[string]interface{}{
+		"entity_id": entityID,
+	}
+
+	if err := h.callService(ctx, domain, service, serviceCall); err != nil {
+		return err
+	}
+
+	h.logger.Printf("Successfully controlled %s (%s)", entityID, action)
+	return nil
+}
+
+// errReadOnly is returned for writes to HA when read_only is set
+var errReadOnly = errors.New("server is in read-only mode")
+
+// InvalidRequestError reports a request that can never succeed, so it is not retried
+type InvalidRequestError struct {
+	Message string
+}
+
+func (e *InvalidRequestError) Error() string {
+	return e.Message
+}
+
+// isRetryable reports whether a failed HA call may succeed when repeated
+func isRetryable(err error) bool {
+	var invalidErr *InvalidRequestError
+	var rateLimitErr *RateLimitError
+	var unauthorizedErr *UnauthorizedError
+	var accessErr *AccessDeniedError
+	var policyErr *PolicyViolationError
+	var confirmErr *ConfirmationRequiredError
+	var approvalErr *ApprovalError
+	return !errors.As(err, &invalidErr) &&
+		!errors.As(err, &accessErr) &&
+		!errors.As(err, &policyErr) &&
+		!errors.As(err, &confirmErr) &&
+		!errors.As(err, &approvalErr) &&
+		!errors.As(err, &rateLimitErr) &&
+		!errors.As(err, &unauthorizedErr) &&
+		!errors.Is(err, errReadOnly) &&
+		!errors.Is(err, context.Canceled) &&
+		!errors.Is(err, context.DeadlineExceeded)
+}
+
+// controlEntityWithRetry retries transient failures up to retries times with a growing pause
+// and returns the number of attempts made
+func (h *HAService) controlEntityWithRetry(ctx context.Context, entityID, action string, retries int) (int, error) {
+	attempt := 1
+	for {
+		err := h.controlEntity(ctx, entityID, action)
+		if err == nil || attempt > retries || !isRetryable(err) {
+			return attempt, err
+		}
+
+		h.logger.Printf("Attempt %d for %s failed, retrying: %v", attempt, entityID, err)
+		select {
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+		case <-time.After(time.Duration(attempt) * 200 * time.Millisecond):
+		}
+		attempt++
+	}
+}
+
+type rollbackKey struct{}
+
+// withRollback marks ctx as undoing changes whose calls already passed the guard rails,
+// confirmation, approval and write limits, so putting them back can't be refused or stall
+func withRollback(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rollbackKey{}, true)
+}
+
+func isRollback(ctx context.Context) bool {
+	rollback, _ := ctx.Value(rollbackKey{}).(bool)
+	return rollback
+}
+
+// callService invokes a Home Assistant service with the given service data
+func (h *HAService) callService(ctx context.Context, domain, service string, data map[string]interface{}) error {
+	if !isRollback(ctx) {
+		if err := h.checkGuardRails(ctx, domain, service, serviceEntityIDs(data)); err != nil {
+			return err
+		}
+		if err := h.checkConfirmation(ctx, domain, service, serviceEntityIDs(data)); err != nil {
+			return err
+		}
+		if err := h.checkApproval(ctx, domain, service, data); err != nil {
+			return err
+		}
+		if err := h.checkWriteRate(ctx); err != nil {
+			return err
+		}
+	}
+
+	ctx, release, err := h.writes.acquire(ctx, serviceEntityIDs(data))
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	startTime := time.Now()
+	resp, err := h.makeHARequest(ctx, "POST", fmt.Sprintf("/api/services/%s/%s", domain, service), data)
+	duration := time.Since(startTime)
+
+	if err != nil {
+		h.logger.Printf("HA API request %s.%s failed for %v after %v: %v", domain, service, data["entity_id"], duration, err)
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		h.logger.Printf("HA API returned status %d for %s.%s on %v after %v", resp.StatusCode, domain, service, data["entity_id"], duration)
+		return fmt.Errorf("HA API returned status %d", resp.StatusCode)
+	}
+
+	h.logger.Printf("Called %s.%s on %v in %v", domain, service, data["entity_id"], duration)
+	recordControlled(ctx, serviceEntityIDs(data))
+	return nil
+}
+
+// serviceStep is one service call of a multi-step change to an entity
+type serviceStep struct {
+	service string
+	data    map[string]interface{}
+}
+
+// runServiceCalls calls the services on entityID in order, stopping at the first failure
+func runServiceCalls(ctx context.Context, domain, entityID string, calls []serviceStep, failure string) *mcp.CallToolResult {
+	// Hold the entity for the whole sequence so another command can't interleave
+	ctx, release, err := haService.writes.acquire(ctx, []string{entityID})
+	if err != nil {
+		return toolError(failure, err)
+	}
+	defer release()
+
+	var done []string
+	for _, call := range calls {
+		data := map[string]interface{}{"entity_id": entityID}
+		for key, value := range call.data {
+			data[key] = value
+		}
+		if err := haService.callService(ctx, domain, call.service, data); err != nil {
+			if len(done) > 0 {
+				err = fmt.Errorf("%s.%s failed after %s succeeded: %w", domain, call.service, strings.Join(done, ", "), err)
+			}
+			return toolError(failure, err)
+		}
+		done = append(done, call.service)
+	}
+	return mcp.NewToolResultText(localize(ctx, "Successfully updated %s: %s", entityID, strings.Join(done, ", ")))
+}
+
+// Global HA service instance
+var haService *HAService
+
+// MCP Tool Handlers using mark3labs/mcp-go
+
+// get_all_states handler
+func getAllStatesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	maxAge := time.Duration(request.GetFloat("max_age", 0) * float64(time.Second))
+
+	states, err := haService.getAllStates(ctx, maxAge)
+	if err != nil {
+		return toolError("Failed to get states", err), nil
+	}
+	states = append(states, haService.computedStates(ctx, maxAge)...)
+
+	states = filterStatesBy(states,
+		request.GetString("area", ""),
+		request.GetString("domain", ""),
+		request.GetString("state", ""),
+	)
+
+	total := len(states)
+	offset := request.GetInt("offset", 0)
+	page, nextOffset := paginateStates(states, offset, request.GetInt("limit", 0))
+	page = selectAttributes(page, request.GetStringSlice("fields", nil), request.GetBool("compact", true))
+
+	if units := request.GetString("units", haService.config.UnitSystem); units != "" {
+		page, err = haService.convertUnits(ctx, page, units)
+		if err != nil {
+			return toolError("Failed to convert units", err), nil
+		}
+	}
+
+	format := request.GetString("format", formatJSON)
+
+	var payload interface{} = page
+	var body string
+	switch groupBy := request.GetString("group_by", ""); groupBy {
+	case "":
+		if format != formatJSON {
+			body, err = formatStates(page, format)
+		}
+	case "area":
+		groups := groupStatesByArea(page)
+		payload = groups
+		if format != formatJSON {
+			body, err = formatAreaGroups(groups, format)
+		}
+	default:
+		return mcp.NewToolResultError(fmt.Sprintf("Unsupported group_by: %s", groupBy)), nil
+	}
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to format states: %v", err)), nil
+	}
+
+	if format == formatJSON {
+		// Convert states to JSON for the response
+		statesJSON, err := json.Marshal(payload)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize states: %v", err)), nil
+		}
+		body = string(statesJSON)
+	}
+
+	// CSV is returned as-is so it can be fed straight into spreadsheet nodes
+	if format == formatCSV {
+		return mcp.NewToolResultText(body), nil
+	}
+
+	if len(page) == total {
+		return mcp.NewToolResultText(fmt.Sprintf("%s:\n%s", localize(ctx, "Found %d controllable entities", total), body)), nil
+	}
+
+	header := localize(ctx, "Found %d controllable entities, showing %d from offset %d", total, len(page), offset)
+	if nextOffset > 0 {
+		header += fmt.Sprintf(" (next_offset: %d)", nextOffset)
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("%s:\n%s", header, body)), nil
+}
+
+// get_entity_state handler
+func getEntityStateHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	entityID, err := haService.resolveEntityRef(ctx, request.GetString("entity_id", ""), request.GetString("name", ""))
+	if err != nil {
+		return toolError("Failed to resolve entity", err), nil
+	}
+
+	maxAge := time.Duration(request.GetFloat("max_age", 0) * float64(time.Second))
+
+	state, err := haService.getEntityState(ctx, entityID, maxAge)
+	if err != nil {
+		return toolError("Failed to get entity state", err), nil
+	}
+
+	if units := request.GetString("units", haService.config.UnitSystem); units != "" {
+		converted, err := haService.convertUnits(ctx, []HAState{*state}, units)
+		if err != nil {
+			return toolError("Failed to convert units", err), nil
+		}
+		state = &converted[0]
+	}
+
+	format := request.GetString("format", formatJSON)
+	if format != formatJSON {
+		body, err := formatStates([]HAState{*state}, format)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to format state: %v", err)), nil
+		}
+		if format == formatCSV {
+			return mcp.NewToolResultText(body), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("%s:\n%s", localize(ctx, "Entity %s is %s", entityID, state.State), body)), nil
+	}
+
+	stateJSON, err := json.Marshal(state)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize state: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("%s:\n%s", localize(ctx, "Entity %s is %s", entityID, state.State), string(stateJSON))), nil
+}
+
+// maxBatchEntities bounds get_entities_state; batchConcurrency bounds its parallel reads
+const (
+	maxBatchEntities = 50
+	batchConcurrency = 8
+)
+
+// get_entities_state handler
+func getEntitiesStateHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	refs, err := request.RequireStringSlice("entity_ids")
+	if err != nil || len(refs) == 0 {
+		return mcp.NewToolResultError("entity_ids must be a non-empty array of entity IDs"), nil
+	}
+	if len(refs) > maxBatchEntities {
+		return mcp.NewToolResultError(fmt.Sprintf("At most %d entities can be read in one call", maxBatchEntities)), nil
+	}
+
+	maxAge := time.Duration(request.GetFloat("max_age", 0) * float64(time.Second))
+
+	// Read concurrently, keeping the requested order
+	results := make([]*HAState, len(refs))
+	failures := make([]error, len(refs))
+	sem := make(chan struct{}, batchConcurrency)
+	var wg sync.WaitGroup
+	for i, ref := range refs {
+		wg.Add(1)
+		go func(i int, ref string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			entityID, err := haService.resolveEntityRef(ctx, ref, "")
+			if err == nil {
+				results[i], err = haService.getEntityState(ctx, entityID, maxAge)
+			}
+			failures[i] = err
+		}(i, ref)
+	}
+	wg.Wait()
+
+	var states []HAState
+	errors := make(map[string]string)
+	for i, ref := range refs {
+		if failures[i] != nil {
+			errors[ref] = failures[i].Error()
+			continue
+		}
+		states = append(states, *results[i])
+	}
+	if len(states) == 0 {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to get any entity state: %v", errors)), nil
+	}
+
+	if units := request.GetString("units", haService.config.UnitSystem); units != "" {
+		states, err = haService.convertUnits(ctx, states, units)
+		if err != nil {
+			return toolError("Failed to convert units", err), nil
+		}
+	}
+
+	format := request.GetString("format", formatJSON)
+	if format != formatJSON {
+		body, err := formatStates(states, format)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to format states: %v", err)), nil
+		}
+		if format == formatCSV {
+			return mcp.NewToolResultText(body), nil
+		}
+		for i, ref := range refs {
+			if failures[i] != nil {
+				body += fmt.Sprintf("\n%s: %v", ref, failures[i])
+			}
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("%s:\n%s", localize(ctx, "Read %d of %d entities", len(states), len(refs)), body)), nil
+	}
+
+	response := map[string]interface{}{"states": states}
+	if len(errors) > 0 {
+		response["errors"] = errors
+	}
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize states: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("%s:\n%s", localize(ctx, "Read %d of %d entities", len(states), len(refs)), string(responseJSON))), nil
+}
+
+// control_entity handler
+func controlEntityHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	entityID, err := haService.resolveEntityRef(ctx, request.GetString("entity_id", ""), request.GetString("name", ""))
+	if err != nil {
+		return toolError("Failed to resolve entity", err), nil
+	}
+
+	action, err := request.RequireString("action")
+	if err != nil {
+		return mcp.NewToolResultError("action parameter is required"), nil
+	}
+
+	// Access is checked first, so an entity the filters hide can't be told apart from one
+	// that doesn't exist
+	if err := haService.checkEntityAccess(ctx, entityID); err != nil {
+		return toolError("Failed to control entity", haService.withSuggestions(ctx, err)), nil
+	}
+
+	// The pre-call state comes from the cache when it is fresh enough
+	transition := StateTransition{EntityID: entityID, Action: action}
+	previous, previousErr := haService.fetchEntityState(ctx, entityID, accessCheckMaxAge)
+	var notFound *EntityNotFoundError
+	if errors.As(previousErr, &notFound) {
+		return toolError("Failed to control entity", haService.withSuggestions(ctx, previousErr)), nil
+	}
+
+	err = haService.controlEntity(ctx, entityID, action)
+	if err != nil {
+		return toolError("Failed to control entity", err), nil
+	}
+	if previousErr == nil {
+		transition.Previous = snapshotOf(previous)
+	}
+
+	want := strings.TrimPrefix(action, "turn_")
+	summary := localize(ctx, "Successfully turned %s "+want, entityID)
+	if request.GetBool("verify", haService.config.VerifyWrites) {
+		current, verified, err := haService.waitForState(ctx, entityID, want)
+		if err != nil {
+			haService.logger.Printf("Could not verify %s: %v", entityID, err)
+		} else {
+			transition.Current = snapshotOf(current)
+			transition.Verified = &verified
+			if !verified {
+				summary = localize(ctx, "Turned %s "+want+", but it still reports %s after %v", entityID, current.State, verifyTimeout)
+			}
+		}
+	}
+
+	transitionJSON, err := json.Marshal(transition)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize result: %v", err)), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("%s:\n%s", summary, string(transitionJSON))), nil
+}
+
+// control_multiple_entities handler (simplified version)
+func controlMultipleEntitiesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	arguments := request.GetArguments()
+	defaultAction, _ := arguments["action"].(string)
+	
+	// Get entities from parameter
+	var entitiesSlice []interface{}
+	if entitiesInterface, ok := arguments["entities"]; ok {
+		slice, entitiesOk := entitiesInterface.([]interface{})
+		if !entitiesOk {
+			return mcp.NewToolResultError("entities must be an array"), nil
+		}
+		entitiesSlice = append(entitiesSlice, slice...)
+	}
+
+	// Plain entity IDs use the top-level action: {"entities": ["light.a", "light.b"], "action": "off"}
+	explicit := make(map[string]bool)
+	for i, entityInterface := range entitiesSlice {
+		if entityID, isString := entityInterface.(string); isString && defaultAction != "" {
+			entitiesSlice[i] = map[string]interface{}{"entity_id": entityID, "action": defaultAction}
+			explicit[entityID] = true
+		} else if entityMap, isMap := entityInterface.(map[string]interface{}); isMap {
+			if entityID, ok := entityMap["entity_id"].(string); ok {
+				explicit[entityID] = true
+			}
+		}
+	}
+
+	// Expand target selectors server-side: {"area": "kitchen", "domain": "light", "action": "off"}
+	area := request.GetString("area", "")
+	domain := request.GetString("domain", "")
+	label := request.GetString("label", "")
+	if area != "" || domain != "" || label != "" {
+		if defaultAction == "" {
+			return mcp.NewToolResultError("action parameter is required when targeting by area, domain or label"), nil
+		}
+
+		targets, err := haService.expandTargets(ctx, area, domain, label)
+		if err != nil {
+			return toolError("Failed to expand targets", err), nil
+		}
+		for _, entityID := range targets {
+			if !explicit[entityID] {
+				entitiesSlice = append(entitiesSlice, map[string]interface{}{"entity_id": entityID, "action": defaultAction})
+			}
+		}
+	}
+
+	if len(entitiesSlice) == 0 {
+		return mcp.NewToolResultError("entities parameter or a target selector (area, domain, label) is required"), nil
+	}
+	if err := haService.checkBatchSize(len(entitiesSlice)); err != nil {
+		return toolError("Batch rejected", err), nil
+	}
+
+	haService.logger.Printf("Processing %d entities in batch", len(entitiesSlice))
+	
+	results := make([]map[string]interface{}, len(entitiesSlice))
 	var errors []string
 
-	// Sequential processing for STDIO stability
+	retries := request.GetInt("retries", haService.config.BatchRetries)
+	stopOnError := request.GetBool("stop_on_error", false)
+	// All-or-nothing: stop at the first failure and roll back what was already changed
+	atomic := request.GetBool("atomic", false)
+	if atomic {
+		stopOnError = true
+	}
+
+	skip := func(i int) {
+		skipped := map[string]interface{}{
+			"index":   i,
+			"success": false,
+			"skipped": true,
+		}
+		if entityMap, ok := entitiesSlice[i].(map[string]interface{}); ok {
+			skipped["entity_id"] = entityMap["entity_id"]
+			skipped["action"] = entityMap["action"]
+		}
+		results[i] = skipped
+	}
+
+	// Validate every entity first, grouping the valid ones by domain and service so each
+	// group is a single HA call with a list of entity IDs
+	type serviceGroup struct {
+		domain, service string
+		indexes         []int
+		entityIDs       []string
+	}
+	var groups []*serviceGroup
+	groupOf := make(map[string]*serviceGroup)
 	for i, entityInterface := range entitiesSlice {
+		// After the first failure with stop_on_error, the rest is reported as skipped
+		if stopOnError && len(errors) > 0 {
+			skip(i)
+			continue
+		}
+
 		// Handle object format: [{"entity_id": "light.entity1", "action": "on"}, ...]
 		entityMap, ok := entityInterface.(map[string]interface{})
 		if !ok {
 			errorMsg := fmt.Sprintf("Entity %d: must be an object with entity_id and action", i)
-			results = append(results, map[string]interface{}{
+			results[i] = map[string]interface{}{
 				"index":   i,
 				"success": false,
 				"error":   errorMsg,
-			})
+			}
 			errors = append(errors, errorMsg)
 			continue
 		}
@@ -1174,153 +2270,1295 @@ func controlMultipleEntitiesHandler(ctx context.Context, request mcp.CallToolReq
 		entityID, entityOk := entityMap["entity_id"].(string)
 		if !entityOk {
 			errorMsg := fmt.Sprintf("Entity %d: entity_id is required and must be a string", i)
-			results = append(results, map[string]interface{}{
+			results[i] = map[string]interface{}{
 				"index":     i,
 				"entity_id": "",
 				"success":   false,
 				"error":     errorMsg,
-			})
+			}
 			errors = append(errors, errorMsg)
 			continue
 		}
 
-		action, actionOk := entityMap["action"].(string)
-		if !actionOk {
-			errorMsg := fmt.Sprintf("Entity %s: action is required and must be a string", entityID)
-			results = append(results, map[string]interface{}{
-				"index":     i,
-				"entity_id": entityID,
-				"success":   false,
-				"error":     errorMsg,
-			})
-			errors = append(errors, errorMsg)
-			continue
-		}
+		action, actionOk := entityMap["action"].(string)
+		if !actionOk {
+			errorMsg := fmt.Sprintf("Entity %s: action is required and must be a string", entityID)
+			results[i] = map[string]interface{}{
+				"index":     i,
+				"entity_id": entityID,
+				"success":   false,
+				"error":     errorMsg,
+			}
+			errors = append(errors, errorMsg)
+			continue
+		}
+
+		result := map[string]interface{}{
+			"index":     i,
+			"entity_id": entityID,
+			"action":    action,
+		}
+		results[i] = result
+
+		var domain, service string
+		canonical, err := haService.canonicalEntityID(entityID)
+		if err == nil {
+			entityID = canonical
+			result["entity_id"] = entityID
+			domain, service, err = controlService(entityID, action)
+		}
+		if err == nil {
+			err = haService.checkEntityAccess(ctx, entityID)
+		}
+		if err != nil {
+			result["success"] = false
+			result["error"] = err.Error()
+			errors = append(errors, fmt.Sprintf("Entity %s: %v", entityID, err))
+			continue
+		}
+
+		key := domain + "." + service
+		group, exists := groupOf[key]
+		if !exists {
+			group = &serviceGroup{domain: domain, service: service}
+			groupOf[key] = group
+			groups = append(groups, group)
+		}
+		group.indexes = append(group.indexes, i)
+		group.entityIDs = append(group.entityIDs, entityID)
+	}
+
+	// An atomic batch with an invalid entity changes nothing; otherwise the targeted
+	// entities are captured before the first call so they can be put back
+	callFailed := atomic && len(errors) > 0
+	var before map[string]EntitySnapshot
+	if atomic && !callFailed && len(groups) > 0 {
+		var targeted []string
+		for _, group := range groups {
+			targeted = append(targeted, group.entityIDs...)
+		}
+		var err error
+		before, err = haService.captureEntities(ctx, targeted)
+		if err != nil {
+			return toolError("Failed to capture entities for the atomic batch, nothing was changed", err), nil
+		}
+	}
+
+	// Sequential processing for STDIO stability
+	processed := 0
+	for _, group := range groups {
+		// Stop early if the MCP request was cancelled; an atomic batch still rolls back
+		if ctx.Err() != nil {
+			haService.logger.Printf("Batch cancelled after %d of %d entities: %v", processed, len(entitiesSlice), ctx.Err())
+			if !atomic {
+				return mcp.NewToolResultError(fmt.Sprintf("Batch cancelled after %d of %d entities: %v", processed, len(entitiesSlice), ctx.Err())), nil
+			}
+			if !callFailed {
+				errors = append(errors, fmt.Sprintf("Batch cancelled after %d of %d entities: %v", processed, len(entitiesSlice), ctx.Err()))
+				callFailed = true
+			}
+		}
+
+		if stopOnError && callFailed {
+			for _, i := range group.indexes {
+				skip(i)
+			}
+			continue
+		}
+		processed += len(group.indexes)
+
+		haService.logger.Printf("Calling %s.%s on %d entities", group.domain, group.service, len(group.entityIDs))
+		err := haService.callService(ctx, group.domain, group.service, map[string]interface{}{"entity_id": group.entityIDs})
+		if err == nil {
+			for _, i := range group.indexes {
+				results[i]["success"] = true
+			}
+			continue
+		}
+
+		// A rejection by the server's own checks (policy, confirmation, approval, write
+		// limits, ...) applies to every entity alike; calling them one by one would only
+		// repeat it
+		if !isRetryable(err) {
+			haService.logger.Printf("%s.%s on %d entities rejected: %v", group.domain, group.service, len(group.entityIDs), err)
+			for n, i := range group.indexes {
+				results[i]["success"] = false
+				results[i]["error"] = err.Error()
+				errors = append(errors, fmt.Sprintf("Entity %s: %v", group.entityIDs[n], err))
+			}
+			callFailed = true
+			continue
+		}
+
+		// A failed group call doesn't say which entity broke it, so each entity is retried
+		// on its own to attribute the failure
+		haService.logger.Printf("%s.%s on %d entities failed, calling them one by one: %v", group.domain, group.service, len(group.entityIDs), err)
+		for n, i := range group.indexes {
+			if stopOnError && callFailed {
+				skip(i)
+				continue
+			}
+			entityID := group.entityIDs[n]
+			attempts, err := haService.controlEntityWithRetry(ctx, entityID, results[i]["action"].(string), retries)
+			results[i]["success"] = err == nil
+			if attempts > 1 {
+				results[i]["attempts"] = attempts
+			}
+			if err != nil {
+				results[i]["error"] = err.Error()
+				errors = append(errors, fmt.Sprintf("Entity %s: %v", entityID, err))
+				callFailed = true
+			}
+		}
+	}
+
+	// Put the entities already changed back; the request may be cancelled by now, so the
+	// rollback doesn't depend on it
+	if atomic && callFailed {
+		rollbackCtx := withRollback(context.WithoutCancel(ctx))
+		for _, result := range results {
+			if result["success"] != true {
+				continue
+			}
+			entityID := result["entity_id"].(string)
+			result["success"] = false
+			result["rolled_back"] = true
+			if err := haService.restoreEntity(rollbackCtx, before[entityID]); err != nil {
+				result["rolled_back"] = false
+				result["rollback_error"] = err.Error()
+				errors = append(errors, fmt.Sprintf("Entity %s: rollback failed: %v", entityID, err))
+			}
+		}
+	}
+
+	// Outcome lists let n8n branch on partial failures without parsing text
+	succeeded := []interface{}{}
+	failed := []map[string]interface{}{}
+	skipped := []interface{}{}
+	rolledBack := []interface{}{}
+	for _, result := range results {
+		switch {
+		case result["success"].(bool):
+			succeeded = append(succeeded, result["entity_id"])
+		case result["skipped"] == true:
+			skipped = append(skipped, result["entity_id"])
+		case result["rolled_back"] == true:
+			rolledBack = append(rolledBack, result["entity_id"])
+		default:
+			failed = append(failed, map[string]interface{}{
+				"index":     result["index"],
+				"entity_id": result["entity_id"],
+				"error":     result["error"],
+			})
+		}
+	}
+	successCount := len(succeeded)
+
+	haService.logger.Printf("Batch completed: %d successful, %d failed, %d skipped", successCount, len(failed), len(skipped))
+
+	// Create response
+	response := map[string]interface{}{
+		"results": results,
+	}
+
+	if len(errors) > 0 {
+		response["errors"] = errors
+	}
+
+	responseJSON, err := json.Marshal(response)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize response: %v", err)), nil
+	}
+
+	summary := localize(ctx, "Processed %d entities: %d successful, %d failed", len(entitiesSlice), successCount, len(failed))
+	if len(skipped) > 0 {
+		summary += fmt.Sprintf(", %d skipped", len(skipped))
+	}
+	if len(rolledBack) > 0 {
+		summary += fmt.Sprintf(", %d rolled back", len(rolledBack))
+	}
+
+	result := mcp.NewToolResultText(fmt.Sprintf("%s\n%s", summary, string(responseJSON)))
+	outcome := map[string]interface{}{
+		"succeeded": succeeded,
+		"failed":    failed,
+		"skipped":   skipped,
+	}
+	if atomic {
+		outcome["rolled_back"] = rolledBack
+	}
+	result.StructuredContent = outcome
+	return result, nil
+}
+
+func main() {
+	opts, err := parseCLI(os.Args[1:], os.Stderr)
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
+	if opts.version {
+		fmt.Println(readBuildInfo())
+		return
+	}
+
+	// Initialize HA Service
+	haService = NewHAService()
+	haService.configFile = opts.configFile
+	haService.debug = opts.logLevel == "debug"
+
+	if opts.command == "setup" {
+		os.Exit(runSetup(haService, opts.configFile, os.Stdin, os.Stdout))
+	}
+
+	haService.logger.Println("Starting Home Assistant MCP Server")
+
+	if err := haService.LoadConfig(); err != nil {
+		haService.logger.Printf("Error loading configuration: %v", err)
+		fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Please set HA_TOKEN and HA_URL environment variables or create a config.json or config.yaml file\n")
+		os.Exit(1)
+	}
+
+	if opts.readOnly {
+		haService.config.ReadOnly = true
+	}
+	if opts.admin {
+		haService.config.AdminTools = true
+	}
+
+	if opts.command == "validate" {
+		os.Exit(runValidate(haService))
+	}
+
+	haService.logger.Printf("Configuration loaded - HA URL: %s", haService.config.HAURL)
+	haService.logger.Printf("Entity filters: %v", haService.config.EntityFilter)
+	haService.logger.Printf("Entity blacklist: %v", haService.config.EntityBlacklist)
+	if len(haService.config.AreaFilter) > 0 || len(haService.config.AreaBlacklist) > 0 {
+		haService.logger.Printf("Area filter: %v, area blacklist: %v", haService.config.AreaFilter, haService.config.AreaBlacklist)
+	}
+	if len(haService.config.DeviceClassFilter) > 0 || len(haService.config.DeviceClassBlacklist) > 0 {
+		haService.logger.Printf("Device class filter: %v, device class blacklist: %v", haService.config.DeviceClassFilter, haService.config.DeviceClassBlacklist)
+	}
+
+	// Fail fast on a bad token or unreachable HA instead of on the first tool call
+	if err := haService.checkConnectivity(context.Background()); err != nil {
+		haService.logger.Printf("Startup check failed: %v", err)
+		if !haService.config.DegradedMode {
+			fmt.Fprintf(os.Stderr, "Startup check failed: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Set HA_DEGRADED_MODE=true to start anyway\n")
+			os.Exit(1)
+		}
+		haService.logger.Println("Continuing in degraded mode")
+	}
+
+	// Create MCP server with mark3labs/mcp-go
+	s := &toolServer{tools: make(map[string]bool)}
+	s.MCPServer = server.NewMCPServer(
+		"home-assistant-mcp",
+		serverVersion,
+		server.WithToolCapabilities(haService.config.DynamicTools),
+		server.WithToolFilter(filterToolsForProfile),
+		server.WithToolFilter(filterToolsForDomains),
+		server.WithToolHandlerMiddleware(tracingMiddleware),
+		server.WithToolHandlerMiddleware(statsMiddleware),
+		server.WithToolHandlerMiddleware(profileMiddleware),
+		server.WithToolHandlerMiddleware(dynamicToolsMiddleware),
+		server.WithToolHandlerMiddleware(compactMiddleware),
+		server.WithToolHandlerMiddleware(timeoutMiddleware),
+		server.WithToolHandlerMiddleware(languageMiddleware),
+		server.WithToolHandlerMiddleware(idempotencyMiddleware),
+		server.WithToolHandlerMiddleware(sessionContextMiddleware),
+		server.WithToolHandlerMiddleware(confirmationMiddleware),
+	)
+
+	// Register tools:
+
+	// 1. get_all_states
+	getAllStatesTool := mcp.NewTool("get_all_states",
+		mcp.WithDescription("Get the state of all lights, switches, water heaters, valves and lawn mowers"),
+		queryAnnotations(),
+		mcp.WithNumber("max_age",
+			mcp.Description("Accept cached states up to this many seconds old (0 = always read live from Home Assistant)"),
+		),
+		mcp.WithString("area",
+			mcp.Description("Only entities in this area, by area ID or name (e.g. kitchen, Living Room)"),
+		),
+		mcp.WithString("domain",
+			mcp.Description("Only entities of this domain"),
+			mcp.Enum(listedDomains...),
+		),
+		mcp.WithString("state",
+			mcp.Description("Only entities in this state (e.g. on, off, unavailable)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("Maximum number of entities to return (0 = all)"),
+			mcp.Min(0),
+		),
+		mcp.WithNumber("offset",
+			mcp.Description("Number of entities to skip, use next_offset from the previous page"),
+			mcp.Min(0),
+		),
+		mcp.WithArray("fields",
+			mcp.Description("Attribute names to return (e.g. ['friendly_name', 'brightness']); all others are dropped"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithBoolean("compact",
+			mcp.Description("Drop verbose attributes such as supported_color_modes, effect_list and entity_picture (default true)"),
+			mcp.DefaultBool(true),
+		),
+		mcp.WithString("group_by",
+			mcp.Description("Nest entities under their area with per-area on/off counts"),
+			mcp.Enum("area"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Response format: json (default), markdown table (compact, for chat) or csv (for spreadsheets)"),
+			mcp.Enum(formatJSON, formatMarkdown, formatCSV),
+		),
+		mcp.WithString("units",
+			mcp.Description("Convert temperature, pressure and speed values to this unit system (defaults to the server setting)"),
+			mcp.Enum(unitsMetric, unitsImperial),
+		),
+		languageParam(),
+		includeTimestampsParam(),
+	)
+	s.AddTool(getAllStatesTool, getAllStatesHandler)
+
+	// 2. get_entity_state
+	getEntityStateTool := mcp.NewTool("get_entity_state",
+		mcp.WithDescription("Get the state of a specific light or switch, identified by entity_id or by name"),
+		queryAnnotations(),
+		mcp.WithString("entity_id",
+			mcp.Description("The entity ID (e.g., light.living_room, switch.kitchen) or a configured alias"),
+		),
+		mcp.WithString("name",
+			mcp.Description("Friendly name or alias to resolve when entity_id is not given; ambiguous names return the candidates"),
+		),
+		mcp.WithNumber("max_age",
+			mcp.Description("Accept a cached state up to this many seconds old (0 = always read live from Home Assistant)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Response format: json (default), markdown table (compact, for chat) or csv (for spreadsheets)"),
+			mcp.Enum(formatJSON, formatMarkdown, formatCSV),
+		),
+		mcp.WithString("units",
+			mcp.Description("Convert temperature, pressure and speed values to this unit system (defaults to the server setting)"),
+			mcp.Enum(unitsMetric, unitsImperial),
+		),
+		languageParam(),
+		includeTimestampsParam(),
+	)
+	s.AddTool(getEntityStateTool, getEntityStateHandler)
+
+	// 3. control_entity
+	controlEntityTool := mcp.NewTool("control_entity",
+		mcp.WithDescription("Turn a light or switch on or off, identified by entity_id or by name"),
+		controlAnnotations(true),
+		mcp.WithString("entity_id",
+			mcp.Description("The entity ID (e.g., light.living_room, switch.kitchen) or a configured alias"),
+		),
+		mcp.WithString("name",
+			mcp.Description("Friendly name or alias to resolve when entity_id is not given (e.g., 'Living Room Lamp'); ambiguous names return the candidates"),
+		),
+		mcp.WithString("action",
+			mcp.Required(),
+			mcp.Description("Action to perform: 'on', 'off', 'turn_on', or 'turn_off'"),
+			mcp.Enum("on", "off", "turn_on", "turn_off"),
+		),
+		mcp.WithBoolean("verify",
+			mcp.Description("Re-read the state after the call and report whether it reached the requested state (default: the server's verify_writes setting)"),
+		),
+		timeoutParam(),
+		idempotencyParam(),
+		confirmationParam(),
+		languageParam(),
+	)
+	s.AddTool(controlEntityTool, controlEntityHandler)
+
+	// 4. control_multiple_entities
+	controlMultipleEntitiesTool := mcp.NewTool("control_multiple_entities",
+		mcp.WithDescription("Control multiple lights or switches at once, given as a list of entities and/or target selectors (area, domain, label) that are expanded server-side"),
+		controlAnnotations(true),
+		mcp.WithArray("entities",
+			mcp.Description("Array of entities to control. Format: [{'entity_id': 'light.entity1', 'action': 'on'}, {'entity_id': 'switch.entity2', 'action': 'off'}], or plain entity IDs combined with the top-level action"),
+		),
+		mcp.WithString("action",
+			mcp.Description("Action for plain entity IDs and target selectors: 'on', 'off', 'turn_on', or 'turn_off'"),
+			mcp.Enum("on", "off", "turn_on", "turn_off"),
+		),
+		mcp.WithString("area",
+			mcp.Description("Target all lights and switches in this area (ID or name)"),
+		),
+		mcp.WithString("domain",
+			mcp.Description("Target all entities of this domain, combined with area and label if given"),
+			mcp.Enum("light", "switch"),
+		),
+		mcp.WithString("label",
+			mcp.Description("Target all entities with this Home Assistant label (ID or name, e.g. holiday)"),
+		),
+		mcp.WithNumber("retries",
+			mcp.Description("Retry each failed entity up to this many times (defaults to the server setting)"),
+			mcp.Min(0),
+			mcp.Max(5),
+		),
+		mcp.WithBoolean("stop_on_error",
+			mcp.Description("Stop at the first failure and report the remaining entities as skipped"),
+		),
+		mcp.WithBoolean("atomic",
+			mcp.Description("All or nothing: capture the entities first and, if any call fails, stop and roll back the entities already changed"),
+		),
+		timeoutParam(),
+		idempotencyParam(),
+		confirmationParam(),
+		languageParam(),
+	)
+	s.AddTool(controlMultipleEntitiesTool, controlMultipleEntitiesHandler)
+
+	// 5. health_check
+	healthCheckTool := mcp.NewTool("health_check",
+		mcp.WithDescription("Report bridge health: Home Assistant reachability, WebSocket status, area cache age and version"),
+		queryAnnotations(),
+	)
+	s.AddTool(healthCheckTool, healthCheckHandler)
+
+	// 6. schedule_action
+	scheduleActionTool := mcp.NewTool("schedule_action",
+		mcp.WithDescription("Turn a light or switch on or off, or run a configured macro, later: at a given time or after a delay, optionally repeating, or on a cron schedule"),
+		controlAnnotations(false),
+		mcp.WithString("entity_id",
+			mcp.Description("The entity ID (e.g., light.living_room, switch.kitchen) or a configured alias"),
+		),
+		mcp.WithString("name",
+			mcp.Description("Friendly name or alias to resolve when entity_id is not given"),
+		),
+		mcp.WithString("action",
+			mcp.Description("Action to perform: 'on', 'off', 'turn_on', or 'turn_off' (required unless macro is given)"),
+			mcp.Enum("on", "off", "turn_on", "turn_off"),
+		),
+		mcp.WithString("macro",
+			mcp.Description("Run this configured macro (see list_macros) instead of turning an entity on or off"),
+		),
+		mcp.WithString("run_at",
+			mcp.Description("When to run, RFC3339 timestamp (e.g., 2025-01-31T18:30:00+01:00)"),
+		),
+		mcp.WithString("delay",
+			mcp.Description("Run after this duration instead of at run_at (e.g., 90s, 15m, 2h)"),
+		),
+		mcp.WithString("every",
+			mcp.Description("Repeat at this interval after the first run (e.g., 24h), at least 1m"),
+		),
+		mcp.WithString("cron",
+			mcp.Description("Run on this cron schedule in the server's local time instead of run_at/delay, e.g. '30 22 * * *' for every day at 22:30 or '0 7 * * mon-fri'"),
+		),
+		idempotencyParam(),
+		confirmationParam(),
+	)
+	s.AddTool(scheduleActionTool, scheduleActionHandler)
+
+	// 7. list_scheduled_actions
+	listScheduledActionsTool := mcp.NewTool("list_scheduled_actions",
+		mcp.WithDescription("List pending scheduled actions and routines ordered by next run, including disabled ones"),
+		queryAnnotations(),
+	)
+	s.AddTool(listScheduledActionsTool, listScheduledActionsHandler)
+
+	// 8. cancel_scheduled_action
+	cancelScheduledActionTool := mcp.NewTool("cancel_scheduled_action",
+		mcp.WithDescription("Cancel a scheduled action by its ID"),
+		bookkeepingAnnotations(true),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("ID returned by schedule_action or list_scheduled_actions"),
+		),
+		languageParam(),
+	)
+	s.AddTool(cancelScheduledActionTool, cancelScheduledActionHandler)
+
+	// 9. snapshot_states
+	snapshotStatesTool := mcp.NewTool("snapshot_states",
+		mcp.WithDescription("Capture the current on/off state, brightness and color of entities or an area so it can be restored later"),
+		bookkeepingAnnotations(false),
+		mcp.WithArray("entity_ids",
+			mcp.Description("Entity IDs or aliases to capture"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithString("area",
+			mcp.Description("Capture all lights and switches in this area (ID or name)"),
+		),
+		mcp.WithString("name",
+			mcp.Description("Optional label for the snapshot"),
+		),
+	)
+	s.AddTool(snapshotStatesTool, snapshotStatesHandler)
+
+	// 10. restore_snapshot
+	restoreSnapshotTool := mcp.NewTool("restore_snapshot",
+		mcp.WithDescription("Put entities back into the state captured by snapshot_states"),
+		controlAnnotations(true),
+		mcp.WithString("id",
+			mcp.Required(),
+			mcp.Description("Snapshot ID returned by snapshot_states"),
+		),
+		timeoutParam(),
+		idempotencyParam(),
+		confirmationParam(),
+		languageParam(),
+	)
+	s.AddTool(restoreSnapshotTool, restoreSnapshotHandler)
+
+	// 11. create_scene_from_area
+	createSceneFromAreaTool := mcp.NewTool("create_scene_from_area",
+		mcp.WithDescription("Save the current lighting of an area as a Home Assistant scene (e.g. save the living room as 'Reading')"),
+		controlAnnotations(true),
+		mcp.WithString("area",
+			mcp.Required(),
+			mcp.Description("Area ID or name whose lights and switches are captured"),
+		),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("Scene name; the scene ID is derived from it (e.g. 'Reading' -> scene.reading)"),
+		),
+		timeoutParam(),
+		idempotencyParam(),
+		confirmationParam(),
+		languageParam(),
+	)
+	s.AddTool(createSceneFromAreaTool, createSceneFromAreaHandler)
+
+	// 12. get_entities_state
+	getEntitiesStateTool := mcp.NewTool("get_entities_state",
+		mcp.WithDescription("Get the state of several specific entities in one call, instead of calling get_entity_state repeatedly"),
+		queryAnnotations(),
+		mcp.WithArray("entity_ids",
+			mcp.Required(),
+			mcp.Description("Entity IDs or configured aliases, e.g. ['light.kitchen', 'switch.porch'] (at most 50)"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithNumber("max_age",
+			mcp.Description("Accept cached states up to this many seconds old (0 = always read live from Home Assistant)"),
+		),
+		mcp.WithString("format",
+			mcp.Description("Response format: json (default), markdown table (compact, for chat) or csv (for spreadsheets)"),
+			mcp.Enum(formatJSON, formatMarkdown, formatCSV),
+		),
+		mcp.WithString("units",
+			mcp.Description("Convert temperature, pressure and speed values to this unit system (defaults to the server setting)"),
+			mcp.Enum(unitsMetric, unitsImperial),
+		),
+		languageParam(),
+		includeTimestampsParam(),
+	)
+	s.AddTool(getEntitiesStateTool, getEntitiesStateHandler)
+
+	// 13. get_problems
+	getProblemsTool := mcp.NewTool("get_problems",
+		mcp.WithDescription("House health report: unavailable and unknown entities, low batteries and flapping devices, grouped by area"),
+		queryAnnotations(),
+		mcp.WithNumber("battery_threshold",
+			mcp.Description("Report batteries below this percentage (default 20)"),
+			mcp.Min(0),
+			mcp.Max(100),
+		),
+		mcp.WithNumber("flap_changes",
+			mcp.Description(fmt.Sprintf("Report entities changing state more than this many times within flap_minutes (default %d)", defaultFlapChanges)),
+			mcp.Min(1),
+		),
+		mcp.WithNumber("flap_minutes",
+			mcp.Description(fmt.Sprintf("Window for flapping detection in minutes (default %d)", defaultFlapMinutes)),
+			mcp.Min(1),
+		),
+		mcp.WithNumber("max_age",
+			mcp.Description("Accept cached states up to this many seconds old (0 = always read live from Home Assistant)"),
+		),
+		languageParam(),
+	)
+	s.AddTool(getProblemsTool, getProblemsHandler)
+
+	// 14. get_occupancy
+	getOccupancyTool := mcp.NewTool("get_occupancy",
+		mcp.WithDescription("Motion and occupancy per area with last activity times, plus who is home. Use it for questions like \"is anyone in the office?\""),
+		queryAnnotations(),
+		mcp.WithString("area",
+			mcp.Description("Only report this area (area ID or name)"),
+		),
+		mcp.WithNumber("max_age",
+			mcp.Description("Accept cached states up to this many seconds old (0 = always read live from Home Assistant)"),
+		),
+		languageParam(),
+	)
+	s.AddTool(getOccupancyTool, getOccupancyHandler)
+
+	// 15. get_climate
+	getClimateTool := mcp.NewTool("get_climate",
+		mcp.WithDescription("List climate and humidifier entities with their current temperature, humidity and mode, and the HVAC, preset, fan and swing modes each one supports"),
+		queryAnnotations(),
+		mcp.WithString("area",
+			mcp.Description("Only list entities in this area (area ID or name)"),
+		),
+		mcp.WithNumber("max_age",
+			mcp.Description("Accept cached states up to this many seconds old (0 = always read live from Home Assistant)"),
+		),
+	)
+	s.AddTool(getClimateTool, getClimateHandler)
+
+	// 16. control_climate
+	controlClimateTool := mcp.NewTool("control_climate",
+		mcp.WithDescription("Change a climate or humidifier entity: power, HVAC mode, target temperature, preset, fan and swing modes, target humidity, or humidifier mode. Modes are checked against the ones get_climate lists."),
+		controlAnnotations(true),
+		mcp.WithString("entity_id",
+			mcp.Required(),
+			mcp.Description("The climate or humidifier entity ID (e.g., climate.living_room, humidifier.bedroom) or a configured alias"),
+		),
+		mcp.WithString("action",
+			mcp.Description("Turn the entity 'on' or 'off'"),
+			mcp.Enum("on", "off", "turn_on", "turn_off"),
+		),
+		mcp.WithString("hvac_mode",
+			mcp.Description("Climate HVAC mode, e.g. heat, cool, heat_cool, auto, dry, fan_only or off"),
+		),
+		mcp.WithNumber("temperature",
+			mcp.Description("Climate target temperature, in the entity's unit"),
+		),
+		mcp.WithNumber("target_temp_low",
+			mcp.Description("Climate lower target temperature for heat_cool mode"),
+		),
+		mcp.WithNumber("target_temp_high",
+			mcp.Description("Climate upper target temperature for heat_cool mode"),
+		),
+		mcp.WithString("preset_mode",
+			mcp.Description("Climate preset, e.g. eco, away, comfort"),
+		),
+		mcp.WithString("fan_mode",
+			mcp.Description("Climate fan mode, e.g. auto, low, high"),
+		),
+		mcp.WithString("swing_mode",
+			mcp.Description("Climate swing mode, e.g. off, vertical, both"),
+		),
+		mcp.WithNumber("humidity",
+			mcp.Description("Target humidity in percent, for climate entities with humidity control and humidifiers"),
+			mcp.Min(0),
+			mcp.Max(100),
+		),
+		mcp.WithString("mode",
+			mcp.Description("Humidifier mode, e.g. normal, eco, sleep"),
+		),
+		timeoutParam(),
+		idempotencyParam(),
+		confirmationParam(),
+		languageParam(),
+	)
+	s.AddTool(controlClimateTool, controlClimateHandler)
 
-		err := haService.controlEntity(entityID, action)
-		if err != nil {
-			errorMsg := fmt.Sprintf("Entity %s: %v", entityID, err)
-			results = append(results, map[string]interface{}{
-				"index":     i,
-				"entity_id": entityID,
-				"action":    action,
-				"success":   false,
-				"error":     err.Error(),
-			})
-			errors = append(errors, errorMsg)
-		} else {
-			results = append(results, map[string]interface{}{
-				"index":     i,
-				"entity_id": entityID,
-				"action":    action,
-				"success":   true,
-			})
-		}
+	// 17. control_water_heater
+	controlWaterHeaterTool := mcp.NewTool("control_water_heater",
+		mcp.WithDescription("Change a water heater: power, operation mode, away mode or target temperature"),
+		controlAnnotations(true),
+		mcp.WithString("entity_id",
+			mcp.Required(),
+			mcp.Description("The water_heater entity ID or a configured alias"),
+		),
+		mcp.WithString("action",
+			mcp.Description("Turn the water heater 'on' or 'off'"),
+			mcp.Enum("on", "off", "turn_on", "turn_off"),
+		),
+		mcp.WithString("operation_mode",
+			mcp.Description("Operation mode from the entity's operation_list, e.g. eco, electric, heat_pump, performance"),
+		),
+		mcp.WithBoolean("away_mode",
+			mcp.Description("Turn away mode on or off"),
+		),
+		mcp.WithNumber("temperature",
+			mcp.Description("Target temperature, in the entity's unit"),
+		),
+		timeoutParam(),
+		idempotencyParam(),
+		confirmationParam(),
+		languageParam(),
+	)
+	s.AddTool(controlWaterHeaterTool, controlWaterHeaterHandler)
 
-		// Small pause between requests
-		if i < len(entitiesSlice)-1 {
-			time.Sleep(50 * time.Millisecond)
-		}
-	}
+	// 18. control_valve
+	controlValveTool := mcp.NewTool("control_valve",
+		mcp.WithDescription("Open, close or stop a valve, or set it to a position"),
+		controlAnnotations(true),
+		mcp.WithString("entity_id",
+			mcp.Required(),
+			mcp.Description("The valve entity ID or a configured alias"),
+		),
+		mcp.WithString("action",
+			mcp.Required(),
+			mcp.Description("open, close, stop, or set_position (with position)"),
+			mcp.Enum("open", "close", "stop", "set_position"),
+		),
+		mcp.WithNumber("position",
+			mcp.Description("Position for set_position, 0 (closed) to 100 (open)"),
+			mcp.Min(0),
+			mcp.Max(100),
+		),
+		timeoutParam(),
+		idempotencyParam(),
+		confirmationParam(),
+		languageParam(),
+	)
+	s.AddTool(controlValveTool, controlValveHandler)
 
-	successCount := 0
-	for _, result := range results {
-		if result["success"].(bool) {
-			successCount++
-		}
-	}
+	// 19. press_button
+	pressButtonTool := mcp.NewTool("press_button",
+		mcp.WithDescription("Press a button or input_button entity, e.g. a doorbell chime or a device restart button"),
+		controlAnnotations(false),
+		mcp.WithString("entity_id",
+			mcp.Required(),
+			mcp.Description("The button or input_button entity ID or a configured alias"),
+		),
+		timeoutParam(),
+		idempotencyParam(),
+		confirmationParam(),
+		languageParam(),
+	)
+	s.AddTool(pressButtonTool, pressButtonHandler)
 
-	haService.logger.Printf("Batch completed: %d successful, %d failed", successCount, len(entitiesSlice)-successCount)
+	// 20. control_siren
+	controlSirenTool := mcp.NewTool("control_siren",
+		mcp.WithDescription("Turn a siren on (optionally with a tone, duration and volume) or off"),
+		controlAnnotations(true),
+		mcp.WithString("entity_id",
+			mcp.Required(),
+			mcp.Description("The siren entity ID or a configured alias"),
+		),
+		mcp.WithString("action",
+			mcp.Required(),
+			mcp.Description("Action to perform: 'on' or 'off'"),
+			mcp.Enum("on", "off", "turn_on", "turn_off"),
+		),
+		mcp.WithString("tone",
+			mcp.Description("Tone to play, from the siren's available_tones"),
+		),
+		mcp.WithNumber("duration",
+			mcp.Description("Seconds to sound before turning off automatically"),
+			mcp.Min(1),
+		),
+		mcp.WithNumber("volume_level",
+			mcp.Description("Volume from 0 to 1"),
+			mcp.Min(0),
+			mcp.Max(1),
+		),
+		timeoutParam(),
+		idempotencyParam(),
+		confirmationParam(),
+		languageParam(),
+	)
+	s.AddTool(controlSirenTool, controlSirenHandler)
 
-	// Create response
-	response := map[string]interface{}{
-		"results": results,
-	}
+	// 21. send_remote_command
+	sendRemoteCommandTool := mcp.NewTool("send_remote_command",
+		mcp.WithDescription("Send commands through a remote entity, such as a universal remote or IR blaster (remote.send_command)"),
+		controlAnnotations(false),
+		mcp.WithString("entity_id",
+			mcp.Required(),
+			mcp.Description("The remote entity ID or a configured alias"),
+		),
+		mcp.WithArray("command",
+			mcp.Required(),
+			mcp.Description("Commands to send in order, e.g. ['power'] or ['volume_up', 'volume_up']; learned commands need the device they were learned for"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithString("device",
+			mcp.Description("Device the commands belong to, for remotes with learned commands (e.g. 'television')"),
+		),
+		mcp.WithNumber("num_repeats",
+			mcp.Description("Times to repeat each command (default 1)"),
+			mcp.Min(1),
+		),
+		mcp.WithNumber("delay_secs",
+			mcp.Description("Seconds to wait between commands (default 0.4)"),
+			mcp.Min(0),
+		),
+		mcp.WithNumber("hold_secs",
+			mcp.Description("Seconds to hold each command, for remotes that support it"),
+			mcp.Min(0),
+		),
+		timeoutParam(),
+		idempotencyParam(),
+		confirmationParam(),
+		languageParam(),
+	)
+	s.AddTool(sendRemoteCommandTool, sendRemoteCommandHandler)
 
-	if len(errors) > 0 {
-		response["errors"] = errors
-	}
+	// 22. set_entity_value
+	setEntityValueTool := mcp.NewTool("set_entity_value",
+		mcp.WithDescription("Set the value of a number, select or text entity. The value is checked against the entity's min, max, step, options or pattern before Home Assistant is called."),
+		controlAnnotations(true),
+		mcp.WithString("entity_id",
+			mcp.Required(),
+			mcp.Description("The number, select or text entity ID or a configured alias"),
+		),
+		mcp.WithString("value",
+			mcp.Required(),
+			mcp.Description("New value: a number (e.g. '30' or '2.5') for number entities, one of the options for select entities, or text"),
+		),
+		timeoutParam(),
+		idempotencyParam(),
+		confirmationParam(),
+		languageParam(),
+	)
+	s.AddTool(setEntityValueTool, setEntityValueHandler)
 
-	responseJSON, err := json.Marshal(response)
-	if err != nil {
-		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize response: %v", err)), nil
-	}
+	// 23. control_lawn_mower
+	controlLawnMowerTool := mcp.NewTool("control_lawn_mower",
+		mcp.WithDescription("Start, pause or dock a lawn mower"),
+		controlAnnotations(true),
+		mcp.WithString("entity_id",
+			mcp.Required(),
+			mcp.Description("The lawn_mower entity ID or a configured alias"),
+		),
+		mcp.WithString("action",
+			mcp.Required(),
+			mcp.Description("Action to perform: 'start_mowing', 'pause' or 'dock'"),
+			mcp.Enum("start_mowing", "pause", "dock"),
+		),
+		timeoutParam(),
+		idempotencyParam(),
+		confirmationParam(),
+		languageParam(),
+	)
+	s.AddTool(controlLawnMowerTool, controlLawnMowerHandler)
 
-	return mcp.NewToolResultText(fmt.Sprintf("Processed %d entities: %d successful, %d failed\n%s",
-		len(entitiesSlice), successCount, len(entitiesSlice)-successCount, string(responseJSON))), nil
-}
+	// 24. control_irrigation
+	controlIrrigationTool := mcp.NewTool("control_irrigation",
+		mcp.WithDescription("Start or stop an irrigation group: the zone switches of a configured irrigation_groups entry, or the switches with a label of that name"),
+		controlAnnotations(false),
+		mcp.WithString("group",
+			mcp.Required(),
+			mcp.Description("Irrigation group name or label (e.g. 'front lawn')"),
+		),
+		mcp.WithString("action",
+			mcp.Required(),
+			mcp.Description("Action to perform: 'start' or 'stop'"),
+			mcp.Enum("start", "stop"),
+		),
+		mcp.WithNumber("duration_minutes",
+			mcp.Description("With start, schedule the zones to turn off after this many minutes"),
+			mcp.Min(0),
+		),
+		timeoutParam(),
+		idempotencyParam(),
+		confirmationParam(),
+		languageParam(),
+	)
+	s.AddTool(controlIrrigationTool, controlIrrigationHandler)
+
+	// 25. get_device_info
+	getDeviceInfoTool := mcp.NewTool("get_device_info",
+		mcp.WithDescription("Describe a device from the device registry: manufacturer, model, firmware, connections, integrations, area and its entities. Identify it by device_id, by one of its entities, or by device name."),
+		queryAnnotations(),
+		mcp.WithString("device_id",
+			mcp.Description("Device registry ID"),
+		),
+		mcp.WithString("entity_id",
+			mcp.Description("Any entity of the device (e.g., sensor.washer_power) or a configured alias"),
+		),
+		mcp.WithString("name",
+			mcp.Description("Device name as shown in Home Assistant (e.g., 'Washing Machine')"),
+		),
+	)
+	s.AddTool(getDeviceInfoTool, getDeviceInfoHandler)
+
+	// 26. get_repair_issues
+	getRepairIssuesTool := mcp.NewTool("get_repair_issues",
+		mcp.WithDescription("List open issues from Home Assistant's repairs dashboard, such as broken integrations or deprecated configuration, most severe first"),
+		queryAnnotations(),
+		mcp.WithString("severity",
+			mcp.Description("Only issues of this severity"),
+			mcp.Enum("critical", "error", "warning"),
+		),
+		mcp.WithString("domain",
+			mcp.Description("Only issues raised by or about this integration (e.g. zha, mqtt)"),
+		),
+		mcp.WithBoolean("include_ignored",
+			mcp.Description("Also list issues the user has ignored (default false)"),
+		),
+	)
+	s.AddTool(getRepairIssuesTool, getRepairIssuesHandler)
+
+	// 27. list_integrations
+	listIntegrationsTool := mcp.NewTool("list_integrations",
+		mcp.WithDescription("List the configured integrations (config entries) and their state, e.g. loaded, setup_error or setup_retry"),
+		queryAnnotations(),
+		mcp.WithString("domain",
+			mcp.Description("Only entries of this integration (e.g. hue, mqtt)"),
+		),
+		mcp.WithString("state",
+			mcp.Description("Only entries in this state"),
+			mcp.Enum("loaded", "setup_error", "setup_retry", "not_loaded", "failed_unload", "migration_error"),
+		),
+	)
+	s.AddTool(listIntegrationsTool, listIntegrationsHandler)
+
+	// 28. reload_integration (admin)
+	reloadIntegrationTool := mcp.NewTool("reload_integration",
+		mcp.WithDescription("Reload a config entry, or all entries of an integration, e.g. to recover one stuck in setup_retry"),
+		controlAnnotations(true),
+		mcp.WithString("entry_id",
+			mcp.Description("Config entry ID from list_integrations"),
+		),
+		mcp.WithString("domain",
+			mcp.Description("Reload every config entry of this integration"),
+		),
+	)
+	s.AddTool(reloadIntegrationTool, reloadIntegrationHandler)
 
-func main() {
-	// Initialize HA Service
-	haService = NewHAService()
+	// 29. get_automation_trace
+	getAutomationTraceTool := mcp.NewTool("get_automation_trace",
+		mcp.WithDescription("Get the execution trace of an automation or script run (the latest by default): trigger, each executed step with its result and errors, and the recent runs. Use it to explain why an automation misbehaved."),
+		queryAnnotations(),
+		mcp.WithString("entity_id",
+			mcp.Required(),
+			mcp.Description("The automation or script entity ID (e.g., automation.hallway_motion_light) or a configured alias"),
+		),
+		mcp.WithString("run_id",
+			mcp.Description("Run to return, from recent_runs (default: the latest)"),
+		),
+		mcp.WithBoolean("include_config",
+			mcp.Description("Also return the automation or script configuration the run used (default false)"),
+		),
+	)
+	s.AddTool(getAutomationTraceTool, getAutomationTraceHandler)
 
-	haService.logger.Println("Starting Home Assistant MCP Server")
+	// 30. get_person_summary
+	getPersonSummaryTool := mcp.NewTool("get_person_summary",
+		mcp.WithDescription("Where is someone and is their phone charged? Combines a person's presence and zone, their device trackers with battery levels, and the last zone they were in when away"),
+		queryAnnotations(),
+		mcp.WithString("person",
+			mcp.Required(),
+			mcp.Description("Person entity ID (e.g., person.alice), name or configured alias"),
+		),
+		mcp.WithNumber("max_age",
+			mcp.Description("Accept cached states up to this many seconds old (0 = always read live from Home Assistant)"),
+		),
+		languageParam(),
+	)
+	s.AddTool(getPersonSummaryTool, getPersonSummaryHandler)
+
+	// 31. get_sun_info
+	getSunInfoTool := mcp.NewTool("get_sun_info",
+		mcp.WithDescription("Sun position and the next dawn, sunrise, noon, sunset, dusk and midnight with the time remaining until each, for scheduling relative to solar events"),
+		queryAnnotations(),
+		mcp.WithNumber("max_age",
+			mcp.Description("Accept cached states up to this many seconds old (0 = always read live from Home Assistant)"),
+		),
+		languageParam(),
+	)
+	s.AddTool(getSunInfoTool, getSunInfoHandler)
+
+	// 32. get_dashboard_config
+	getDashboardConfigTool := mcp.NewTool("get_dashboard_config",
+		mcp.WithDescription("List the entities on a Lovelace dashboard, per view and ranked by how often they appear. These are the entities the user cares about, useful for prioritizing summaries."),
+		queryAnnotations(),
+		mcp.WithString("dashboard",
+			mcp.Description("Dashboard URL path (e.g. 'dashboard-energy'); the default dashboard when omitted"),
+		),
+	)
+	s.AddTool(getDashboardConfigTool, getDashboardConfigHandler)
 
-	if err := haService.LoadConfig(); err != nil {
-		haService.logger.Printf("Error loading configuration: %v", err)
-		fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
-		fmt.Fprintf(os.Stderr, "Please set HA_TOKEN and HA_URL environment variables or create a config.json file\n")
-		os.Exit(1)
-	}
+	// 33. list_blueprints
+	listBlueprintsTool := mcp.NewTool("list_blueprints",
+		mcp.WithDescription("List the automation blueprints installed in Home Assistant with their inputs, marking the required ones"),
+		queryAnnotations(),
+	)
+	s.AddTool(listBlueprintsTool, listBlueprintsHandler)
 
-	haService.logger.Printf("Configuration loaded - HA URL: %s", haService.config.HAURL)
-	haService.logger.Printf("Entity filters: %v", haService.config.EntityFilter)
-	haService.logger.Printf("Entity blacklist: %v", haService.config.EntityBlacklist)
+	// 34. create_automation_from_blueprint (admin)
+	createAutomationFromBlueprintTool := mcp.NewTool("create_automation_from_blueprint",
+		mcp.WithDescription("Create and enable a new automation from a blueprint, e.g. a motion-activated light for the hallway. Use list_blueprints for the blueprint paths and inputs."),
+		controlAnnotations(false),
+		mcp.WithString("blueprint",
+			mcp.Required(),
+			mcp.Description("Blueprint path from list_blueprints (e.g., homeassistant/motion_light.yaml)"),
+		),
+		mcp.WithString("alias",
+			mcp.Required(),
+			mcp.Description("Name of the new automation (e.g., 'Hallway motion light')"),
+		),
+		mcp.WithString("description",
+			mcp.Description("Description of the new automation"),
+		),
+		mcp.WithObject("inputs",
+			mcp.Description("Blueprint input values by input key, e.g. {'motion_entity': 'binary_sensor.hallway_motion', 'light_target': {'entity_id': 'light.hallway'}}"),
+		),
+	)
+	s.AddTool(createAutomationFromBlueprintTool, createAutomationFromBlueprintHandler)
 
-	// Create MCP server with mark3labs/mcp-go
-	s := server.NewMCPServer(
-		"home-assistant-mcp",
-		"2.0.0",
-		server.WithToolCapabilities(false),
+	// 35. ha_ws_command (admin)
+	haWSCommandTool := mcp.NewTool("ha_ws_command",
+		mcp.WithDescription("Send a raw Home Assistant WebSocket command and return its result, for commands no other tool wraps (e.g. 'config/label_registry/list'). Bypasses the entity filters."),
+		controlAnnotations(false),
+		mcp.WithString("type",
+			mcp.Required(),
+			mcp.Description("WebSocket command type, e.g. 'config/floor_registry/list'"),
+		),
+		mcp.WithObject("payload",
+			mcp.Description("Command fields other than id and type, e.g. {'entity_id': 'light.kitchen'}"),
+		),
+	)
+	s.AddTool(haWSCommandTool, haWSCommandHandler)
+
+	// 36. purge_recorder (admin)
+	purgeRecorderTool := mcp.NewTool("purge_recorder",
+		mcp.WithDescription("Purge old history from the Home Assistant database (recorder.purge), optionally repacking it to reclaim disk space"),
+		controlAnnotations(true),
+		mcp.WithNumber("keep_days",
+			mcp.Description("Days of history to keep (default: the recorder's purge_keep_days setting)"),
+			mcp.Min(0),
+		),
+		mcp.WithBoolean("repack",
+			mcp.Description("Rewrite the database afterwards to free disk space; slow and locks the database while it runs (default false)"),
+		),
+		mcp.WithBoolean("apply_filter",
+			mcp.Description("Also remove entities and events excluded by the recorder's include/exclude filters (default false)"),
+		),
+	)
+	s.AddTool(purgeRecorderTool, purgeRecorderHandler)
+
+	// 37. get_entity_inventory
+	getEntityInventoryTool := mcp.NewTool("get_entity_inventory",
+		mcp.WithDescription("Cheap overview of the installation: counts of entities per domain, area and device class. Call it first to decide which detailed queries to make."),
+		queryAnnotations(),
+		mcp.WithNumber("max_age",
+			mcp.Description("Accept cached states up to this many seconds old (0 = always read live from Home Assistant)"),
+		),
 	)
+	s.AddTool(getEntityInventoryTool, getEntityInventoryHandler)
 
-	// Register only the requested 4 tools:
+	// 38. get_server_info
+	getServerInfoTool := mcp.NewTool("get_server_info",
+		mcp.WithDescription("Report the bridge version, commit, build date, mcp-go version, transport and enabled features, for support requests"),
+		queryAnnotations(),
+	)
+	s.AddTool(getServerInfoTool, getServerInfoHandler)
 
-	// 1. get_all_states
-	getAllStatesTool := mcp.NewTool("get_all_states",
-		mcp.WithDescription("Get the state of all lights and switches"),
+	// 39. get_bridge_stats
+	getBridgeStatsTool := mcp.NewTool("get_bridge_stats",
+		mcp.WithDescription("Report call counts, p50/p95 latency and error rate per tool and per Home Assistant endpoint since the server started, to find slow or failing calls"),
+		queryAnnotations(),
 	)
-	s.AddTool(getAllStatesTool, getAllStatesHandler)
+	s.AddTool(getBridgeStatsTool, getBridgeStatsHandler)
 
-	// 2. get_entity_state
-	getEntityStateTool := mcp.NewTool("get_entity_state",
-		mcp.WithDescription("Get the state of a specific light or switch"),
+	// 40. get_entity_history
+	getEntityHistoryTool := mcp.NewTool("get_entity_history",
+		mcp.WithDescription("Get the recorded states of an entity over the past hours, optionally aggregated per hour or day (time-weighted mean/min/max for numeric sensors, the prevailing state otherwise) to keep long ranges small"),
+		queryAnnotations(),
 		mcp.WithString("entity_id",
-			mcp.Required(),
-			mcp.Description("The entity ID (e.g., light.living_room, switch.kitchen)"),
+			mcp.Description("The entity ID (e.g., sensor.living_room_temperature) or a configured alias"),
+		),
+		mcp.WithString("name",
+			mcp.Description("Friendly name or alias to resolve when entity_id is not given"),
+		),
+		mcp.WithNumber("hours",
+			mcp.Description(fmt.Sprintf("How far back to read, in hours (default %d, at most %d)", defaultHistoryHours, maxHistoryHours)),
+		),
+		mcp.WithString("interval",
+			mcp.Description("Aggregate per hour or per day instead of returning every state change"),
+			mcp.Enum(intervalHour, intervalDay),
 		),
 	)
-	s.AddTool(getEntityStateTool, getEntityStateHandler)
+	s.AddTool(getEntityHistoryTool, getEntityHistoryHandler)
+
+	// 41. diff_states
+	diffStatesTool := mcp.NewTool("diff_states",
+		mcp.WithDescription("List the entities whose state changed since a snapshot or a past point in time, e.g. for \"what changed while I was away\" summaries"),
+		queryAnnotations(),
+		mcp.WithString("snapshot_id",
+			mcp.Description("Compare with a snapshot taken by snapshot_states"),
+		),
+		mcp.WithString("since",
+			mcp.Description("Compare with the recorded states at this RFC 3339 time, e.g. 2024-05-01T08:00:00+02:00"),
+		),
+		mcp.WithNumber("hours",
+			mcp.Description("Compare with the recorded states this many hours ago, when since is not given"),
+		),
+	)
+	s.AddTool(diffStatesTool, diffStatesHandler)
+
+	// 42. get_recent_events
+	getRecentEventsTool := mcp.NewTool("get_recent_events",
+		mcp.WithDescription("List the state changes the server saw recently, newest first, to answer \"what just happened?\" without querying the recorder"),
+		queryAnnotations(),
+		mcp.WithNumber("minutes",
+			mcp.Description(fmt.Sprintf("How far back to look (default %d)", defaultRecentEventsMinutes)),
+		),
+		mcp.WithString("entity",
+			mcp.Description("Only this entity, or entities matching a pattern as in entity_filter, such as glob:binary_sensor.*door*"),
+		),
+		mcp.WithString("domain",
+			mcp.Description("Only entities of this domain, e.g. light"),
+		),
+		mcp.WithString("area",
+			mcp.Description("Only entities in this area (ID or name)"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description(fmt.Sprintf("Maximum number of events returned (default %d)", defaultRecentEventsLimit)),
+		),
+	)
+	s.AddTool(getRecentEventsTool, getRecentEventsHandler)
 
-	// 3. control_entity
-	controlEntityTool := mcp.NewTool("control_entity",
-		mcp.WithDescription("Turn a light or switch on or off"),
-		mcp.WithString("entity_id",
+	// 43. run_macro
+	runMacroTool := mcp.NewTool("run_macro",
+		mcp.WithDescription("Run a macro defined in the server configuration: a named, fixed sequence of service calls with optional delays (see list_macros)"),
+		controlAnnotations(false),
+		mcp.WithString("name",
 			mcp.Required(),
-			mcp.Description("The entity ID (e.g., light.living_room, switch.kitchen)"),
+			mcp.Description("Name of the macro, e.g. movie_night"),
 		),
-		mcp.WithString("action",
+		timeoutParam(),
+		idempotencyParam(),
+		confirmationParam(),
+		languageParam(),
+	)
+	s.AddTool(runMacroTool, runMacroHandler)
+
+	// 44. list_macros
+	listMacrosTool := mcp.NewTool("list_macros",
+		mcp.WithDescription("List the macros defined in the server configuration with their descriptions and steps"),
+		queryAnnotations(),
+	)
+	s.AddTool(listMacrosTool, listMacrosHandler)
+
+	// 45. enable_scheduled_action
+	enableScheduledActionTool := mcp.NewTool("enable_scheduled_action",
+		mcp.WithDescription("Resume a disabled scheduled action; a repeating one continues at its next occurrence"),
+		controlAnnotations(true),
+		mcp.WithString("id",
 			mcp.Required(),
-			mcp.Description("Action to perform: 'on', 'off', 'turn_on', or 'turn_off'"),
-			mcp.Enum("on", "off", "turn_on", "turn_off"),
+			mcp.Description("ID returned by schedule_action or list_scheduled_actions"),
 		),
 	)
-	s.AddTool(controlEntityTool, controlEntityHandler)
+	s.AddTool(enableScheduledActionTool, setScheduledActionEnabledHandler(true))
 
-	// 4. control_multiple_entities
-	controlMultipleEntitiesTool := mcp.NewTool("control_multiple_entities",
-		mcp.WithDescription("Control multiple lights or switches at once. Requires an array of objects with entity_id and action properties."),
-		mcp.WithArray("entities",
+	// 46. disable_scheduled_action
+	disableScheduledActionTool := mcp.NewTool("disable_scheduled_action",
+		mcp.WithDescription("Pause a scheduled action without deleting it"),
+		bookkeepingAnnotations(true),
+		mcp.WithString("id",
 			mcp.Required(),
-			mcp.Description("Array of entities to control. Format: [{'entity_id': 'light.entity1', 'action': 'on'}, {'entity_id': 'switch.entity2', 'action': 'off'}]"),
+			mcp.Description("ID returned by schedule_action or list_scheduled_actions"),
 		),
 	)
-	s.AddTool(controlMultipleEntitiesTool, controlMultipleEntitiesHandler)
+	s.AddTool(disableScheduledActionTool, setScheduledActionEnabledHandler(false))
+
+	// 47. get_session_context
+	getSessionContextTool := mcp.NewTool("get_session_context",
+		mcp.WithDescription("Entities this session recently queried or controlled, most recent first. Instead of repeating entity IDs, later calls can pass \"@last\" (the entities of the previous call) or \"@last:light\" (the lights of the latest call that touched lights) as entity_id, in entity_ids or in entities, e.g. to turn \"them\" off"),
+		queryAnnotations(),
+	)
+	s.AddTool(getSessionContextTool, getSessionContextHandler)
+
+	// Resource templates for history and logbook
+	s.AddResourceTemplate(mcp.NewResourceTemplate(historyTemplate, "Entity history",
+		mcp.WithTemplateDescription("State changes of an entity over the last hours (default 24), aggregated into hour or day buckets with interval, as get_entity_history returns them"),
+		mcp.WithTemplateMIMEType("application/json"),
+	), historyResourceHandler)
+	s.AddResourceTemplate(mcp.NewResourceTemplate(logbookTemplate, "Area logbook",
+		mcp.WithTemplateDescription("Logbook entries of the entities in an area (ID or name) over the last hours (default 24)"),
+		mcp.WithTemplateMIMEType("application/json"),
+	), logbookResourceHandler)
+
+	if !haService.config.AdminTools || haService.config.ReadOnly {
+		s.DeleteTools(adminTools...)
+	}
+	if haService.config.ReadOnly {
+		s.DeleteTools(writeTools...)
+		haService.logger.Printf("Read-only mode, control tools disabled: %v", writeTools)
+	}
+	if haService.config.DynamicTools {
+		haService.mcpServer = s.MCPServer
+		ctx, cancel := context.WithTimeout(context.Background(), haService.requestTimeout)
+		if err := haService.refreshToolDomains(ctx); err != nil {
+			haService.logger.Printf("Reading domains for dynamic tools failed, offering all tools: %v", err)
+		}
+		cancel()
+	}
+
+	scheduler, err = NewScheduler(haService, haService.scheduleFilePath())
+	if err != nil {
+		haService.logger.Printf("Error starting scheduler: %v", err)
+		fmt.Fprintf(os.Stderr, "Error starting scheduler: %v\n", err)
+		os.Exit(1)
+	}
+
+	if haService.config.Tracing != nil {
+		shutdown, err := startTracing(context.Background(), *haService.config.Tracing)
+		if err != nil {
+			haService.logger.Printf("Error configuring tracing: %v", err)
+			fmt.Fprintf(os.Stderr, "Error configuring tracing: %v\n", err)
+			os.Exit(1)
+		}
+		haService.logger.Printf("Exporting traces to %s", haService.config.Tracing.Endpoint)
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdown(ctx); err != nil {
+				haService.logger.Printf("Error flushing traces: %v", err)
+			}
+		}()
+	}
+
+	haService.warmCaches()
+	haService.startUpdateCheck()
+	haService.watchRegistries(context.Background())
+	haService.startEventBuffer(context.Background())
+	if haService.statePollInterval > 0 {
+		haService.startStatePoller(haService.statePollInterval)
+	}
+
+	if haService.config.HealthAddr != "" {
+		startHealthServer(haService.config.HealthAddr)
+	}
+
+	if haService.config.PprofAddr != "" {
+		startPprofServer(haService.config.PprofAddr)
+	}
+
+	if haService.config.Approval != nil {
+		startApprovalServer(haService.config.Approval.CallbackAddr)
+	}
+
+	if len(haService.config.Webhooks) > 0 {
+		webhooks, err := newWebhooks(haService, haService.config.Webhooks)
+		if err != nil {
+			haService.logger.Printf("Error configuring webhooks: %v", err)
+			fmt.Fprintf(os.Stderr, "Error configuring webhooks: %v\n", err)
+			os.Exit(1)
+		}
+		webhooks.Start(context.Background())
+	}
+
+	if haService.config.MQTT != nil {
+		publisher, err := newMQTTPublisher(haService, *haService.config.MQTT)
+		if err != nil {
+			haService.logger.Printf("Error configuring MQTT: %v", err)
+			fmt.Fprintf(os.Stderr, "Error configuring MQTT: %v\n", err)
+			os.Exit(1)
+		}
+		publisher.Start(context.Background())
+	}
+
+	if len(haService.profiles) > 0 {
+		if opts.transport == transportStdio {
+			haService.logger.Printf("Ignoring %d profiles, they only apply to the sse and http transports", len(haService.profiles))
+		} else {
+			haService.logger.Printf("Serving %d client profiles", len(haService.profiles))
+		}
+	}
 
-	haService.logger.Println("MCP Server configured with 4 tools, starting STDIO transport...")
+	haService.transport = opts.transport
+	haService.toolCount = s.toolCount()
+	haService.logger.Printf("MCP Server configured with %d tools, starting %s transport...", haService.toolCount, opts.transport)
 
-	// Start the STDIO server
-	if err := server.ServeStdio(s); err != nil {
+	if err := serve(s.MCPServer, opts.transport, opts.listenAddr); err != nil {
 		haService.logger.Printf("Server failed: %v", err)
 		log.Fatalf("Server failed: %v", err)
 	}
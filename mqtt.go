@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	defaultMQTTTopicPrefix = "ha-mcp"
+	defaultMQTTClientID    = "ha-mcp-server"
+	mqttPublishTimeout     = 10 * time.Second
+	mqttQueueSize          = 256
+)
+
+// MQTTConfig publishes filtered state changes to an MQTT broker, one topic per entity
+type MQTTConfig struct {
+	BrokerURL   string `json:"broker_url"` // tcp://host:1883, ssl://host:8883 or ws://host/mqtt
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
+	ClientID    string `json:"client_id,omitempty"`
+	QoS         byte   `json:"qos,omitempty"`          // 0, 1 or 2
+	Retain      bool   `json:"retain,omitempty"`       // keep the last state on the broker for new subscribers
+	TopicPrefix string `json:"topic_prefix,omitempty"` // topics are <prefix>/<domain>/<object_id>
+}
+
+// State change as carried by a state_changed event
+type stateChangedData struct {
+	EntityID string   `json:"entity_id"`
+	NewState *HAState `json:"new_state"`
+}
+
+// MQTTPublisher forwards state_changed events to the broker
+type MQTTPublisher struct {
+	service *HAService
+	config  MQTTConfig
+	client  mqtt.Client
+	queue   chan *HAState
+}
+
+// validateMQTTConfig rejects a broker URL the client can't connect to and an invalid QoS
+func validateMQTTConfig(config MQTTConfig) error {
+	if config.BrokerURL == "" {
+		return fmt.Errorf("mqtt.broker_url is required")
+	}
+	u, err := url.Parse(config.BrokerURL)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("invalid mqtt.broker_url %q: expected e.g. tcp://host:1883", config.BrokerURL)
+	}
+	switch u.Scheme {
+	case "tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss":
+	default:
+		return fmt.Errorf("invalid mqtt.broker_url %q: scheme must be tcp, mqtt, ssl, tls, mqtts, ws or wss", config.BrokerURL)
+	}
+	if config.QoS > 2 {
+		return fmt.Errorf("invalid mqtt.qos %d: must be 0, 1 or 2", config.QoS)
+	}
+	return nil
+}
+
+func newMQTTPublisher(h *HAService, config MQTTConfig) (*MQTTPublisher, error) {
+	if err := validateMQTTConfig(config); err != nil {
+		return nil, err
+	}
+	if config.ClientID == "" {
+		config.ClientID = defaultMQTTClientID
+	}
+	config.TopicPrefix = strings.TrimSuffix(config.TopicPrefix, "/")
+	if config.TopicPrefix == "" {
+		config.TopicPrefix = defaultMQTTTopicPrefix
+	}
+
+	opts := mqtt.NewClientOptions().
+		AddBroker(config.BrokerURL).
+		SetClientID(config.ClientID).
+		SetUsername(config.Username).
+		SetPassword(config.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			h.logger.Printf("MQTT connection lost: %v", err)
+		}).
+		SetOnConnectHandler(func(mqtt.Client) {
+			h.logger.Printf("Connected to MQTT broker %s", config.BrokerURL)
+		})
+
+	return &MQTTPublisher{
+		service: h,
+		config:  config,
+		client:  mqtt.NewClient(opts),
+		queue:   make(chan *HAState, mqttQueueSize),
+	}, nil
+}
+
+// Start connects in the background (retrying until the broker is reachable) and
+// subscribes to state_changed
+func (p *MQTTPublisher) Start(ctx context.Context) {
+	p.client.Connect()
+	go p.publishLoop(ctx)
+	go p.service.ws.Subscribe(ctx, "state_changed", p.dispatch)
+	p.service.logger.Printf("Publishing state changes to %s under %s/", p.config.BrokerURL, p.config.TopicPrefix)
+}
+
+// dispatch runs on the WebSocket reader, so it only filters and queues
+func (p *MQTTPublisher) dispatch(raw json.RawMessage) {
+	var event struct {
+		Data stateChangedData `json:"data"`
+	}
+	if err := json.Unmarshal(raw, &event); err != nil {
+		p.service.logger.Printf("Failed to parse state_changed event: %v", err)
+		return
+	}
+
+	state := event.Data.NewState
+	if state == nil || !p.service.entityIDExposed(context.Background(), state.EntityID) || !p.service.isDeviceClassAllowed(*state) {
+		return
+	}
+
+	select {
+	case p.queue <- state:
+	default:
+		p.service.logger.Printf("MQTT queue is full, dropping state change for %s", state.EntityID)
+	}
+}
+
+func (p *MQTTPublisher) publishLoop(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			p.client.Disconnect(250)
+			return
+		case state := <-p.queue:
+			states := p.service.enrichWithArea(ctx, []HAState{*state})
+			states = p.service.filterEntitiesByArea(states)
+			if len(states) == 0 {
+				continue
+			}
+			states = p.service.applyAttributePolicy(states)
+
+			payload, err := json.Marshal(states[0])
+			if err != nil {
+				p.service.logger.Printf("Failed to serialize state of %s: %v", state.EntityID, err)
+				continue
+			}
+
+			token := p.client.Publish(p.topic(state.EntityID), p.config.QoS, p.config.Retain, payload)
+			if !token.WaitTimeout(mqttPublishTimeout) {
+				p.service.logger.Printf("Timed out publishing state of %s", state.EntityID)
+			} else if err := token.Error(); err != nil {
+				p.service.logger.Printf("Failed to publish state of %s: %v", state.EntityID, err)
+			}
+		}
+	}
+}
+
+// topic maps light.kitchen to <prefix>/light/kitchen
+func (p *MQTTPublisher) topic(entityID string) string {
+	domain, objectID, _ := strings.Cut(entityID, ".")
+	return p.config.TopicPrefix + "/" + domain + "/" + objectID
+}
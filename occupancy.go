@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Binary sensor device classes that report someone being in a room
+var occupancyDeviceClasses = []string{"motion", "occupancy", "presence"}
+
+// OccupancySensor is one motion/occupancy sensor; last_changed is when it was last
+// triggered while on, or when it cleared while off
+type OccupancySensor struct {
+	EntityID    string `json:"entity_id"`
+	Name        string `json:"name,omitempty"`
+	DeviceClass string `json:"device_class"`
+	State       string `json:"state"`
+	LastChanged string `json:"last_changed"`
+	StateFor    string `json:"state_for,omitempty"`
+}
+
+// AreaOccupancy summarizes the occupancy sensors of one area
+type AreaOccupancy struct {
+	AreaID       string            `json:"area_id"`
+	Name         string            `json:"name"`
+	Occupied     bool              `json:"occupied"`
+	LastActivity string            `json:"last_activity,omitempty"` // latest change of any sensor in the area
+	Sensors      []OccupancySensor `json:"sensors"`
+}
+
+// PersonPresence is a person or device_tracker entity, e.g. home or not_home
+type PersonPresence struct {
+	EntityID    string `json:"entity_id"`
+	Name        string `json:"name,omitempty"`
+	State       string `json:"state"`
+	LastChanged string `json:"last_changed"`
+	StateFor    string `json:"state_for,omitempty"`
+}
+
+// OccupancyReport is the get_occupancy response
+type OccupancyReport struct {
+	OccupiedAreas []string         `json:"occupied_areas"`
+	PeopleHome    int              `json:"people_home"`
+	Areas         []AreaOccupancy  `json:"areas"`
+	People        []PersonPresence `json:"people,omitempty"`
+}
+
+func isOccupancySensor(state HAState) bool {
+	return strings.HasPrefix(state.EntityID, "binary_sensor.") && containsString(occupancyDeviceClasses, deviceClassOf(state))
+}
+
+func isPresenceEntity(state HAState) bool {
+	return strings.HasPrefix(state.EntityID, "person.") || strings.HasPrefix(state.EntityID, "device_tracker.")
+}
+
+// summarizeOccupancy groups occupancy sensors by area, optionally limited to one area
+func summarizeOccupancy(states []HAState, area string) OccupancyReport {
+	report := OccupancyReport{OccupiedAreas: []string{}, Areas: []AreaOccupancy{}}
+	groups := make(map[string]*AreaOccupancy)
+
+	for _, state := range states {
+		if isPresenceEntity(state) {
+			if area != "" {
+				continue
+			}
+			report.People = append(report.People, PersonPresence{
+				EntityID:    state.EntityID,
+				Name:        formatValue(state.Attributes["friendly_name"]),
+				State:       state.State,
+				LastChanged: state.LastChanged,
+				StateFor:    state.StateFor,
+			})
+			if state.State == "home" && strings.HasPrefix(state.EntityID, "person.") {
+				report.PeopleHome++
+			}
+			continue
+		}
+
+		if !isOccupancySensor(state) || (area != "" && !matchesArea(state.Area, area)) {
+			continue
+		}
+
+		areaID, name := "", "Unassigned"
+		if state.Area != nil {
+			areaID, name = state.Area.AreaID, state.Area.Name
+		}
+		g := groups[areaID]
+		if g == nil {
+			g = &AreaOccupancy{AreaID: areaID, Name: name}
+			groups[areaID] = g
+		}
+
+		g.Sensors = append(g.Sensors, OccupancySensor{
+			EntityID:    state.EntityID,
+			Name:        formatValue(state.Attributes["friendly_name"]),
+			DeviceClass: deviceClassOf(state),
+			State:       state.State,
+			LastChanged: state.LastChanged,
+			StateFor:    state.StateFor,
+		})
+		if state.State == "on" {
+			g.Occupied = true
+		}
+		if laterTimestamp(state.LastChanged, g.LastActivity) {
+			g.LastActivity = state.LastChanged
+		}
+	}
+
+	for _, g := range groups {
+		report.Areas = append(report.Areas, *g)
+	}
+	sort.Slice(report.Areas, func(i, j int) bool {
+		if report.Areas[i].AreaID == "" || report.Areas[j].AreaID == "" {
+			return report.Areas[j].AreaID == ""
+		}
+		return report.Areas[i].Name < report.Areas[j].Name
+	})
+	for _, g := range report.Areas {
+		if g.Occupied {
+			report.OccupiedAreas = append(report.OccupiedAreas, g.Name)
+		}
+	}
+	return report
+}
+
+// laterTimestamp reports whether RFC 3339 timestamp a is after b; an empty b is earliest
+func laterTimestamp(a, b string) bool {
+	if b == "" {
+		return a != ""
+	}
+	ta, errA := time.Parse(time.RFC3339Nano, a)
+	tb, errB := time.Parse(time.RFC3339Nano, b)
+	return errA == nil && (errB != nil || ta.After(tb))
+}
+
+// get_occupancy handler
+func getOccupancyHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	area := request.GetString("area", "")
+	maxAge := time.Duration(request.GetFloat("max_age", 0) * float64(time.Second))
+
+	states, err := haService.getRawStates(ctx, maxAge)
+	if err != nil {
+		return toolError("Failed to get states", err), nil
+	}
+
+	// Device classes are read before the attribute policy would drop them
+	exposed := haService.filterExposed(ctx, states)
+	addChangeAge(exposed, time.Now(), languageFromContext(ctx))
+	report := summarizeOccupancy(exposed, area)
+
+	if area != "" && len(report.Areas) == 0 {
+		return mcp.NewToolResultError(fmt.Sprintf("No motion or occupancy sensors found in area %q", area)), nil
+	}
+
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize occupancy: %v", err)), nil
+	}
+
+	summary := "No occupied areas"
+	if len(report.OccupiedAreas) > 0 {
+		summary = "Occupied: " + strings.Join(report.OccupiedAreas, ", ")
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("%s:\n%s", summary, string(reportJSON))), nil
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// How far back get_person_summary looks for the last zone of someone who is away
+const lastZoneLookback = 7 * 24 * time.Hour
+
+// PersonTracker is one of a person's device trackers with the battery of its device
+type PersonTracker struct {
+	EntityID     string   `json:"entity_id"`
+	Name         string   `json:"name,omitempty"`
+	State        string   `json:"state"`
+	SourceType   string   `json:"source_type,omitempty"` // gps, router, bluetooth, ...
+	LastChanged  string   `json:"last_changed"`
+	BatteryLevel *float64 `json:"battery_level,omitempty"`
+	Charging     *bool    `json:"charging,omitempty"`
+}
+
+// PersonSummary is the get_person_summary response
+type PersonSummary struct {
+	EntityID  string          `json:"entity_id"`
+	Name      string          `json:"name"`
+	State     string          `json:"state"` // home, not_home or a zone name
+	Zone      string          `json:"zone,omitempty"`
+	Since     string          `json:"since"`
+	StateFor  string          `json:"state_for,omitempty"`
+	LastSeen  string          `json:"last_seen_zone,omitempty"` // last zone before leaving, when away
+	Latitude  interface{}     `json:"latitude,omitempty"`
+	Longitude interface{}     `json:"longitude,omitempty"`
+	Trackers  []PersonTracker `json:"device_trackers"`
+}
+
+// findPerson resolves a person entity ID, alias or name among person states
+func findPerson(states []HAState, ref string) (*HAState, error) {
+	if !strings.Contains(ref, ".") {
+		wanted := normalizeName(ref)
+		var matches []*HAState
+		for i := range states {
+			if !strings.HasPrefix(states[i].EntityID, "person.") {
+				continue
+			}
+			_, objectID, _ := strings.Cut(states[i].EntityID, ".")
+			if normalizeName(formatValue(states[i].Attributes["friendly_name"])) == wanted || normalizeName(objectID) == wanted {
+				matches = append(matches, &states[i])
+			}
+		}
+		if len(matches) == 1 {
+			return matches[0], nil
+		}
+		if len(matches) > 1 {
+			return nil, &InvalidRequestError{fmt.Sprintf("person %q is ambiguous", ref)}
+		}
+		ref = "person." + strings.ReplaceAll(wanted, " ", "_")
+	}
+
+	for i := range states {
+		if states[i].EntityID == ref {
+			return &states[i], nil
+		}
+	}
+	return nil, &InvalidRequestError{fmt.Sprintf("person %s not found", ref)}
+}
+
+// zoneName maps a tracker state to the friendly name of its zone, if it is one
+func zoneName(states []HAState, state string) string {
+	for _, s := range states {
+		if s.EntityID == "zone."+state || (strings.HasPrefix(s.EntityID, "zone.") && formatValue(s.Attributes["friendly_name"]) == state) {
+			return formatValue(s.Attributes["friendly_name"])
+		}
+	}
+	if state == "home" {
+		return "Home"
+	}
+	return ""
+}
+
+// trackerBattery reads the battery of a tracker's phone: its own battery_level attribute, or
+// the companion app's battery level and state sensors on the same device
+func (h *HAService) trackerBattery(ctx context.Context, states []HAState, tracker HAState) (*float64, *bool) {
+	if level, ok := batteryLevel(tracker); ok {
+		return &level, nil
+	}
+
+	areaCache.mu.RLock()
+	defer areaCache.mu.RUnlock()
+
+	deviceID := areaCache.deviceOf[tracker.EntityID]
+	if deviceID == "" {
+		return nil, nil
+	}
+
+	var level *float64
+	var charging *bool
+	for _, state := range states {
+		if areaCache.deviceOf[state.EntityID] != deviceID || !h.entityIDExposed(ctx, state.EntityID) {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(state.EntityID, "sensor.") && deviceClassOf(state) == "battery" && level == nil:
+			if value, ok := batteryLevel(state); ok {
+				level = &value
+			}
+		case strings.HasPrefix(state.EntityID, "binary_sensor.") && deviceClassOf(state) == "battery_charging":
+			value := state.State == "on"
+			charging = &value
+		case strings.HasPrefix(state.EntityID, "sensor.") && strings.HasSuffix(state.EntityID, "_battery_state"):
+			value := state.State == "charging" || state.State == "full"
+			charging = &value
+		}
+	}
+	return level, charging
+}
+
+// getPersonSummary combines a person's presence with their device trackers and phone batteries
+func (h *HAService) getPersonSummary(ctx context.Context, ref string, maxAge time.Duration) (*PersonSummary, error) {
+	if target, ok := h.lookupAlias(ref); ok {
+		ref = target
+	}
+
+	if err := h.updateAreaCache(ctx); err != nil {
+		return nil, err
+	}
+	states, err := h.getRawStates(ctx, maxAge)
+	if err != nil {
+		return nil, err
+	}
+
+	person, err := findPerson(states, ref)
+	if err != nil {
+		return nil, err
+	}
+	exposed := h.exposeStates(ctx, []HAState{*person})
+	if len(exposed) == 0 {
+		return nil, &AccessDeniedError{EntityID: person.EntityID}
+	}
+
+	summary := &PersonSummary{
+		EntityID: person.EntityID,
+		Name:     formatValue(person.Attributes["friendly_name"]),
+		State:    person.State,
+		Zone:     zoneName(states, person.State),
+		Since:    person.LastChanged,
+		StateFor: exposed[0].StateFor,
+		// Taken after the attribute policy, which may hide the location
+		Latitude:  exposed[0].Attributes["latitude"],
+		Longitude: exposed[0].Attributes["longitude"],
+		Trackers:  []PersonTracker{},
+	}
+
+	trackerIDs, _ := person.Attributes["device_trackers"].([]interface{})
+	for _, id := range trackerIDs {
+		trackerID := formatValue(id)
+		if !h.entityIDExposed(ctx, trackerID) {
+			continue
+		}
+		for _, state := range states {
+			if state.EntityID != trackerID {
+				continue
+			}
+			tracker := PersonTracker{
+				EntityID:    state.EntityID,
+				Name:        formatValue(state.Attributes["friendly_name"]),
+				State:       state.State,
+				SourceType:  formatValue(state.Attributes["source_type"]),
+				LastChanged: state.LastChanged,
+			}
+			tracker.BatteryLevel, tracker.Charging = h.trackerBattery(ctx, states, state)
+			summary.Trackers = append(summary.Trackers, tracker)
+		}
+	}
+	sort.Slice(summary.Trackers, func(i, j int) bool {
+		return summary.Trackers[i].EntityID < summary.Trackers[j].EntityID
+	})
+
+	if summary.State == "not_home" {
+		lastZone, err := h.lastZone(ctx, person.EntityID)
+		if err != nil {
+			h.logger.Printf("Could not read location history of %s: %v", person.EntityID, err)
+		} else if lastZone != "" {
+			summary.LastSeen = zoneName(states, lastZone)
+			if summary.LastSeen == "" {
+				summary.LastSeen = lastZone
+			}
+		}
+	}
+	return summary, nil
+}
+
+// lastZone returns the last zone entityID was in during the past lastZoneLookback, from the
+// recorder history
+func (h *HAService) lastZone(ctx context.Context, entityID string) (string, error) {
+	start := time.Now().Add(-lastZoneLookback).UTC().Format(time.RFC3339)
+	endpoint := fmt.Sprintf("/api/history/period/%s?filter_entity_id=%s&minimal_response&no_attributes",
+		url.PathEscape(start), url.QueryEscape(entityID))
+	resp, err := h.makeHARequest(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("HA API returned status %d for history", resp.StatusCode)
+	}
+
+	var history [][]struct {
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		return "", err
+	}
+	for _, series := range history {
+		for i := len(series) - 1; i >= 0; i-- {
+			switch series[i].State {
+			case "not_home", "unknown", "unavailable":
+			default:
+				return series[i].State, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// get_person_summary handler
+func getPersonSummaryHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	ref, err := request.RequireString("person")
+	if err != nil {
+		return mcp.NewToolResultError("person parameter is required"), nil
+	}
+	maxAge := time.Duration(request.GetFloat("max_age", 0) * float64(time.Second))
+
+	summary, err := haService.getPersonSummary(ctx, ref, maxAge)
+	if err != nil {
+		return toolError("Failed to get person summary", err), nil
+	}
+
+	summaryJSON, err := json.Marshal(summary)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize person summary: %v", err)), nil
+	}
+
+	where := summary.Zone
+	if where == "" {
+		where = summary.State
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("%s is %s:\n%s", summary.Name, where, string(summaryJSON))), nil
+}
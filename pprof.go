@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+)
+
+// pprofListenAddr checks that pprof_addr stays on the loopback interface: profiles expose
+// memory contents and the endpoints have no authentication. A bare port or ":port" binds
+// to 127.0.0.1.
+func pprofListenAddr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		// A bare port such as "6060"
+		host, port = "", addr
+	}
+	if _, err := net.LookupPort("tcp", port); err != nil || port == "" {
+		return "", fmt.Errorf("invalid pprof_addr %q: expected a port or localhost:port", addr)
+	}
+
+	switch host {
+	case "":
+		host = "127.0.0.1"
+	case "localhost":
+	default:
+		if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+			return "", fmt.Errorf("invalid pprof_addr %q: the profiling endpoint only listens on localhost", addr)
+		}
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// startPprofServer serves the net/http/pprof handlers under /debug/pprof/ on their own mux,
+// so they never show up on the MCP or health listeners
+func startPprofServer(addr string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	go func() {
+		haService.logger.Printf("pprof listening on http://%s/debug/pprof/", addr)
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			haService.logger.Printf("pprof server failed: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const defaultBatteryThreshold = 20
+
+// Entities changing state more than defaultFlapChanges times within defaultFlapMinutes are
+// reported as flapping
+const (
+	defaultFlapChanges = 5
+	defaultFlapMinutes = 10
+)
+
+// ProblemEntity is one entity needing attention
+type ProblemEntity struct {
+	EntityID     string   `json:"entity_id"`
+	Name         string   `json:"name,omitempty"`
+	State        string   `json:"state"`
+	BatteryLevel *float64 `json:"battery_level,omitempty"`
+	StateFor     string   `json:"state_for,omitempty"`
+	Changes      int      `json:"changes,omitempty"` // state changes in the flapping window
+}
+
+// AreaProblems collects the problems found in one area
+type AreaProblems struct {
+	AreaID      string          `json:"area_id"`
+	Name        string          `json:"name"`
+	Unavailable []ProblemEntity `json:"unavailable,omitempty"`
+	Unknown     []ProblemEntity `json:"unknown,omitempty"`
+	LowBattery  []ProblemEntity `json:"low_battery,omitempty"`
+	Flapping    []ProblemEntity `json:"flapping,omitempty"`
+}
+
+// ProblemReport is the get_problems response
+type ProblemReport struct {
+	Unavailable      int            `json:"unavailable"`
+	Unknown          int            `json:"unknown"`
+	LowBattery       int            `json:"low_battery"`
+	Flapping         int            `json:"flapping"`
+	BatteryThreshold float64        `json:"battery_threshold"`
+	FlapWindow       string         `json:"flap_window,omitempty"` // e.g. "more than 5 changes in 10 minutes", empty without the event buffer
+	Areas            []AreaProblems `json:"areas"`
+}
+
+// batteryLevel returns an entity's battery percentage, from a battery sensor's state or a
+// battery_level attribute
+func batteryLevel(state HAState) (float64, bool) {
+	if strings.HasPrefix(state.EntityID, "sensor.") && deviceClassOf(state) == "battery" {
+		level, err := strconv.ParseFloat(state.State, 64)
+		return level, err == nil
+	}
+	switch level := state.Attributes["battery_level"].(type) {
+	case float64:
+		return level, true
+	case string:
+		value, err := strconv.ParseFloat(level, 64)
+		return value, err == nil
+	}
+	return 0, false
+}
+
+// isLowBattery reports battery sensors and levels below threshold, and battery
+// binary_sensors that are on (which means low)
+func isLowBattery(state HAState, threshold float64) (*float64, bool) {
+	if strings.HasPrefix(state.EntityID, "binary_sensor.") && deviceClassOf(state) == "battery" {
+		return nil, state.State == "on"
+	}
+	level, ok := batteryLevel(state)
+	if !ok || level >= threshold {
+		return nil, false
+	}
+	return &level, true
+}
+
+// isNumericChange reports a change between two numbers, a sensor reading rather than a
+// device switching
+func isNumericChange(event RecentEvent) bool {
+	_, oldErr := strconv.ParseFloat(event.OldState, 64)
+	_, newErr := strconv.ParseFloat(event.NewState, 64)
+	return oldErr == nil && newErr == nil
+}
+
+// flappingEntities counts the state changes per entity in events and keeps the entities
+// with more than maxChanges; numeric readings don't count
+func flappingEntities(events []RecentEvent, maxChanges int) map[string]int {
+	counts := make(map[string]int)
+	for _, event := range events {
+		if !isNumericChange(event) {
+			counts[event.EntityID]++
+		}
+	}
+	for entityID, count := range counts {
+		if count <= maxChanges {
+			delete(counts, entityID)
+		}
+	}
+	return counts
+}
+
+// findProblems groups unavailable, unknown, low-battery and flapping entities by area
+func findProblems(states []HAState, threshold float64, flapping map[string]int) ProblemReport {
+	report := ProblemReport{BatteryThreshold: threshold, Areas: []AreaProblems{}}
+	groups := make(map[string]*AreaProblems)
+
+	group := func(state HAState) *AreaProblems {
+		areaID, name := "", "Unassigned"
+		if state.Area != nil {
+			areaID, name = state.Area.AreaID, state.Area.Name
+		}
+		if groups[areaID] == nil {
+			groups[areaID] = &AreaProblems{AreaID: areaID, Name: name}
+		}
+		return groups[areaID]
+	}
+
+	for _, state := range states {
+		problem := ProblemEntity{
+			EntityID: state.EntityID,
+			Name:     formatValue(state.Attributes["friendly_name"]),
+			State:    state.State,
+			StateFor: state.StateFor,
+		}
+
+		if changes := flapping[state.EntityID]; changes > 0 {
+			flapper := problem
+			flapper.Changes = changes
+			g := group(state)
+			g.Flapping = append(g.Flapping, flapper)
+			report.Flapping++
+		}
+
+		switch state.State {
+		case "unavailable":
+			g := group(state)
+			g.Unavailable = append(g.Unavailable, problem)
+			report.Unavailable++
+			continue
+		case "unknown":
+			g := group(state)
+			g.Unknown = append(g.Unknown, problem)
+			report.Unknown++
+			continue
+		}
+
+		if level, low := isLowBattery(state, threshold); low {
+			problem.BatteryLevel = level
+			g := group(state)
+			g.LowBattery = append(g.LowBattery, problem)
+			report.LowBattery++
+		}
+	}
+
+	for _, g := range groups {
+		report.Areas = append(report.Areas, *g)
+	}
+	sort.Slice(report.Areas, func(i, j int) bool {
+		if report.Areas[i].AreaID == "" || report.Areas[j].AreaID == "" {
+			return report.Areas[j].AreaID == ""
+		}
+		return report.Areas[i].Name < report.Areas[j].Name
+	})
+	return report
+}
+
+// get_problems handler
+func getProblemsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	threshold := request.GetFloat("battery_threshold", defaultBatteryThreshold)
+	maxAge := time.Duration(request.GetFloat("max_age", 0) * float64(time.Second))
+
+	states, err := haService.getRawStates(ctx, maxAge)
+	if err != nil {
+		return toolError("Failed to get states", err), nil
+	}
+
+	// Battery attributes are read before the attribute policy would drop them
+	exposed := haService.filterExposed(ctx, states)
+	addChangeAge(exposed, time.Now(), languageFromContext(ctx))
+
+	var flapping map[string]int
+	var flapWindow string
+	if haService.events != nil {
+		changes := request.GetInt("flap_changes", defaultFlapChanges)
+		minutes := request.GetInt("flap_minutes", defaultFlapMinutes)
+		flapping = flappingEntities(haService.events.since(time.Now().Add(-time.Duration(minutes)*time.Minute)), changes)
+		flapWindow = fmt.Sprintf("more than %d changes in %d minutes", changes, minutes)
+	}
+
+	report := findProblems(exposed, threshold, flapping)
+	report.FlapWindow = flapWindow
+
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize report: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Found %d unavailable, %d unknown, %d low-battery and %d flapping entities:\n%s",
+		report.Unavailable, report.Unknown, report.LowBattery, report.Flapping, string(reportJSON))), nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Profile limits the tools and entities a client of the sse/http transports sees. Its
+// entity filters apply on top of the global ones, so a profile can only narrow access.
+type Profile struct {
+	Name            string   `json:"name"`
+	APIKey          string   `json:"api_key"`
+	Tools           []string `json:"tools,omitempty"` // allowed tool names, all when empty
+	EntityFilter    []string `json:"entity_filter,omitempty"`
+	EntityBlacklist []string `json:"entity_blacklist,omitempty"`
+
+	entityFilter    []entityPattern
+	entityBlacklist []entityPattern
+}
+
+// clientIdentity is stored in the request context when profiles are configured;
+// profile is nil for a missing or unknown API key
+type clientIdentity struct {
+	profile *Profile
+}
+
+type clientIdentityKey struct{}
+
+// compileProfiles validates the configured profiles and compiles their entity filters
+func compileProfiles(profiles []Profile) ([]*Profile, error) {
+	var compiled []*Profile
+	seen := make(map[string]string)
+	for i := range profiles {
+		profile := profiles[i]
+		if profile.Name == "" {
+			profile.Name = fmt.Sprintf("profile %d", i+1)
+		}
+		if profile.APIKey == "" {
+			return nil, fmt.Errorf("profiles[%d] (%s): api_key is required", i, profile.Name)
+		}
+		if other, exists := seen[profile.APIKey]; exists {
+			return nil, fmt.Errorf("profiles[%d] (%s): api_key is already used by %s", i, profile.Name, other)
+		}
+		seen[profile.APIKey] = profile.Name
+
+		var err error
+		profile.entityFilter, err = compilePatterns(fmt.Sprintf("profiles[%d].entity_filter", i), profile.EntityFilter)
+		if err != nil {
+			return nil, err
+		}
+		profile.entityBlacklist, err = compilePatterns(fmt.Sprintf("profiles[%d].entity_blacklist", i), profile.EntityBlacklist)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, &profile)
+	}
+	return compiled, nil
+}
+
+// apiKeyFromRequest reads the client's key from "Authorization: Bearer" or X-API-Key
+func apiKeyFromRequest(r *http.Request) string {
+	if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(key)
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// profileForKey returns the profile with the given API key, or nil
+func (h *HAService) profileForKey(key string) *Profile {
+	if key == "" {
+		return nil
+	}
+	for _, profile := range h.profiles {
+		if subtle.ConstantTimeCompare([]byte(profile.APIKey), []byte(key)) == 1 {
+			return profile
+		}
+	}
+	return nil
+}
+
+// profileContextFunc attaches the caller's profile to each HTTP request's context; the static
+// server.api_key bypasses profiles
+func (h *HAService) profileContextFunc(ctx context.Context, r *http.Request) context.Context {
+	key := apiKeyFromRequest(r)
+	if len(h.profiles) == 0 || h.isStaticAPIKey(key) {
+		return ctx
+	}
+	return context.WithValue(ctx, clientIdentityKey{}, clientIdentity{profile: h.profileForKey(key)})
+}
+
+// profileFromContext returns the caller's profile and whether profiles apply to this call
+// (they don't for stdio, or when none are configured)
+func profileFromContext(ctx context.Context) (*Profile, bool) {
+	identity, ok := ctx.Value(clientIdentityKey{}).(clientIdentity)
+	return identity.profile, ok
+}
+
+// withProfileName restores the named profile in a context without a client, such as a
+// scheduled action's run; an empty name means profiles didn't apply when it was created
+func (h *HAService) withProfileName(ctx context.Context, name string) (context.Context, error) {
+	if name == "" {
+		return ctx, nil
+	}
+	for _, profile := range h.profiles {
+		if profile.Name == name {
+			return context.WithValue(ctx, clientIdentityKey{}, clientIdentity{profile: profile}), nil
+		}
+	}
+	return nil, fmt.Errorf("profile %s is no longer configured", name)
+}
+
+func (p *Profile) allowsTool(name string) bool {
+	return len(p.Tools) == 0 || containsString(p.Tools, name)
+}
+
+// allowsEntity applies the profile's entity filters
+func (p *Profile) allowsEntity(entityID string) bool {
+	if matchesAny(p.entityBlacklist, entityID) {
+		return false
+	}
+	return len(p.entityFilter) == 0 || matchesAny(p.entityFilter, entityID)
+}
+
+// filterToolsForProfile hides tools the caller's profile doesn't allow from tools/list
+func filterToolsForProfile(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+	profile, enforced := profileFromContext(ctx)
+	if !enforced {
+		return tools
+	}
+	if profile == nil {
+		return nil
+	}
+
+	var allowed []mcp.Tool
+	for _, tool := range tools {
+		if profile.allowsTool(tool.Name) {
+			allowed = append(allowed, tool)
+		}
+	}
+	return allowed
+}
+
+// profileMiddleware rejects calls to tools outside the caller's profile
+func profileMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		profile, enforced := profileFromContext(ctx)
+		if enforced {
+			if profile == nil {
+				return mcp.NewToolResultError("Missing or unknown API key"), nil
+			}
+			if !profile.allowsTool(request.Params.Name) {
+				haService.logger.Printf("Profile %s denied tool %s", profile.Name, request.Params.Name)
+				return mcp.NewToolResultError(fmt.Sprintf("Tool %s is not available to profile %s", request.Params.Name, profile.Name)), nil
+			}
+		}
+		return next(ctx, request)
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Rate limit rule: sustained requests per second plus a burst allowance
+type RateLimitRule struct {
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	Burst             int     `json:"burst,omitempty"` // defaults to ceil(requests_per_second)
+}
+
+// Rate limits for outbound HA requests, global and per entity domain
+type RateLimitConfig struct {
+	RateLimitRule
+	PerDomain map[string]RateLimitRule `json:"per_domain,omitempty"`
+}
+
+// RateLimitError is returned when an outbound HA request is rejected by the limiter
+type RateLimitError struct {
+	Scope      string // "global" or the entity domain
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limited (%s), retry after %.1fs", e.Scope, e.RetryAfter.Seconds())
+}
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rule RateLimitRule) *tokenBucket {
+	burst := float64(rule.Burst)
+	if burst <= 0 {
+		burst = math.Max(1, math.Ceil(rule.RequestsPerSecond))
+	}
+	return &tokenBucket{
+		rate:   rule.RequestsPerSecond,
+		burst:  burst,
+		tokens: burst,
+		last:   time.Now(),
+	}
+}
+
+// refill adds the tokens accumulated since the last call and returns the wait for one token
+func (b *tokenBucket) refill(now time.Time) time.Duration {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// Token bucket limiter toward Home Assistant, non-blocking
+type RateLimiter struct {
+	mu      sync.Mutex
+	global  *tokenBucket
+	domains map[string]*tokenBucket
+}
+
+// newRateLimiter returns nil when no limit is configured
+func newRateLimiter(config RateLimitConfig) *RateLimiter {
+	limiter := &RateLimiter{
+		domains: make(map[string]*tokenBucket),
+	}
+	if config.RequestsPerSecond > 0 {
+		limiter.global = newTokenBucket(config.RateLimitRule)
+	}
+	for domain, rule := range config.PerDomain {
+		if rule.RequestsPerSecond > 0 {
+			limiter.domains[domain] = newTokenBucket(rule)
+		}
+	}
+	if limiter.global == nil && len(limiter.domains) == 0 {
+		return nil
+	}
+	return limiter
+}
+
+// allow consumes a token from the global and domain buckets, or from neither
+func (l *RateLimiter) allow(domain string) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	domainBucket := l.domains[domain]
+
+	if domainBucket != nil {
+		if wait := domainBucket.refill(now); wait > 0 {
+			return &RateLimitError{Scope: domain, RetryAfter: wait}
+		}
+	}
+	if l.global != nil {
+		if wait := l.global.refill(now); wait > 0 {
+			return &RateLimitError{Scope: "global", RetryAfter: wait}
+		}
+		l.global.tokens--
+	}
+	if domainBucket != nil {
+		domainBucket.tokens--
+	}
+	return nil
+}
+
+// endpointDomain extracts the entity domain from service and state endpoints
+func endpointDomain(endpoint string) string {
+	if rest, ok := strings.CutPrefix(endpoint, "/api/services/"); ok {
+		domain, _, _ := strings.Cut(rest, "/")
+		return domain
+	}
+	if rest, ok := strings.CutPrefix(endpoint, "/api/states/"); ok {
+		domain, _, _ := strings.Cut(rest, ".")
+		return domain
+	}
+	return ""
+}
+
+// toolError builds an MCP error result, adding structured details for rate limits and ambiguous names
+func toolError(message string, err error) *mcp.CallToolResult {
+	result := mcp.NewToolResultError(fmt.Sprintf("%s: %v", message, err))
+
+	var rateLimitErr *RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		result.StructuredContent = map[string]interface{}{
+			"error":               "rate_limited",
+			"scope":               rateLimitErr.Scope,
+			"retry_after_seconds": math.Ceil(rateLimitErr.RetryAfter.Seconds()*10) / 10,
+		}
+	}
+
+	var notFoundErr *EntityNotFoundError
+	if errors.As(err, &notFoundErr) {
+		result.StructuredContent = map[string]interface{}{
+			"error":       "entity_not_found",
+			"entity_id":   notFoundErr.EntityID,
+			"suggestions": notFoundErr.Suggestions,
+		}
+	}
+
+	var policyErr *PolicyViolationError
+	if errors.As(err, &policyErr) {
+		result.StructuredContent = map[string]interface{}{
+			"error":     "policy_violation",
+			"rule":      policyErr.Rule,
+			"entity_id": policyErr.EntityID,
+			"service":   policyErr.Service,
+			"reason":    policyErr.Reason,
+		}
+	}
+
+	var confirmErr *ConfirmationRequiredError
+	if errors.As(err, &confirmErr) {
+		result.StructuredContent = map[string]interface{}{
+			"error":              "confirmation_required",
+			"confirmation_token": confirmErr.Token,
+			"entity_id":          confirmErr.EntityID,
+			"service":            confirmErr.Service,
+			"expires_in_seconds": int(confirmationWindow.Seconds()),
+		}
+	}
+
+	var approvalErr *ApprovalError
+	if errors.As(err, &approvalErr) {
+		result.StructuredContent = map[string]interface{}{
+			"error":       "approval_" + approvalErr.Outcome,
+			"approval_id": approvalErr.ID,
+			"entity_ids":  approvalErr.EntityIDs,
+			"service":     approvalErr.Service,
+		}
+	}
+
+	var ambiguousErr *AmbiguousNameError
+	if errors.As(err, &ambiguousErr) {
+		result.StructuredContent = map[string]interface{}{
+			"error":      "ambiguous_name",
+			"name":       ambiguousErr.Name,
+			"candidates": ambiguousErr.Candidates,
+		}
+	}
+	return result
+}
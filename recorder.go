@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// purge_recorder handler
+func purgeRecorderHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+	data := map[string]interface{}{
+		"repack":       request.GetBool("repack", false),
+		"apply_filter": request.GetBool("apply_filter", false),
+	}
+	if _, ok := args["keep_days"]; ok {
+		keepDays := request.GetInt("keep_days", 0)
+		if keepDays < 0 {
+			return mcp.NewToolResultError("keep_days must not be negative"), nil
+		}
+		data["keep_days"] = keepDays
+	}
+
+	haService.logger.Printf("Purging recorder: %v", data)
+	if err := haService.callService(ctx, "recorder", "purge", data); err != nil {
+		return toolError("Failed to purge recorder", err), nil
+	}
+
+	keep := "the recorder's purge_keep_days setting"
+	if keepDays, ok := data["keep_days"]; ok {
+		keep = fmt.Sprintf("%d days", keepDays)
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Recorder purge started, keeping %s of history (repack: %v). The purge runs in the background in Home Assistant.", keep, data["repack"])), nil
+}
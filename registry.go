@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Registry events and the area cache section each one invalidates
+var registryEvents = map[string]string{
+	"area_registry_updated":   "areas",
+	"device_registry_updated": "devices",
+	"entity_registry_updated": "entities",
+}
+
+// Registry events usually come in bursts (e.g. renaming a device renames its entities), so
+// refreshes wait this long for the burst to end
+const registryRefreshDelay = time.Second
+
+// areaMaps builds the area lookup
+func areaMaps(areas []HAArea) map[string]*HAArea {
+	result := make(map[string]*HAArea, len(areas))
+	for i := range areas {
+		result[areas[i].AreaID] = &areas[i]
+	}
+	return result
+}
+
+// deviceAreaMaps builds device_id -> area_id
+func deviceAreaMaps(devices []HADevice) map[string]string {
+	result := make(map[string]string)
+	for _, device := range devices {
+		if device.AreaID != "" {
+			result[device.ID] = device.AreaID
+		}
+	}
+	return result
+}
+
+// entityMaps derives the entity areas, labels and devices from the entity registry; an
+// entity without its own area inherits the one of its device
+func entityMaps(entities []HAEntity, deviceAreas map[string]string) (areas map[string]string, labels map[string][]string, deviceOf map[string]string) {
+	areas = make(map[string]string)
+	labels = make(map[string][]string)
+	deviceOf = make(map[string]string)
+	for _, entity := range entities {
+		if len(entity.Labels) > 0 {
+			labels[entity.EntityID] = entity.Labels
+		}
+		if entity.DeviceID != "" {
+			deviceOf[entity.EntityID] = entity.DeviceID
+		}
+
+		// Direct area assignment
+		if entity.AreaID != "" {
+			areas[entity.EntityID] = entity.AreaID
+		} else if entity.DeviceID != "" {
+			// Area through device
+			if deviceAreaID, exists := deviceAreas[entity.DeviceID]; exists {
+				areas[entity.EntityID] = deviceAreaID
+			}
+		}
+	}
+	return areas, labels, deviceOf
+}
+
+// replace swaps in new registries; a nil section keeps its current data, and loaded marks
+// the cache as fresh. The maps are built before taking c.mu, so readers only wait for the
+// swap; writers are serialized by c.writeMu, which also makes reading the current sections
+// without c.mu safe.
+func (c *AreaEnrichmentCache) replace(areas *[]HAArea, devices *[]HADevice, entities *[]HAEntity, loaded bool) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	newAreas, deviceAreas, registry := c.areas, c.devices, c.registry
+	if areas != nil {
+		newAreas = areaMaps(*areas)
+	}
+	if devices != nil {
+		deviceAreas = deviceAreaMaps(*devices)
+	}
+	if entities != nil {
+		registry = *entities
+	}
+
+	// Moving a device moves the entities inheriting its area, so both rebuild the entity maps
+	entityAreas, labels, deviceOf := c.entities, c.labels, c.deviceOf
+	if devices != nil || entities != nil {
+		entityAreas, labels, deviceOf = entityMaps(registry, deviceAreas)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.areas, c.devices, c.registry = newAreas, deviceAreas, registry
+	c.entities, c.labels, c.deviceOf = entityAreas, labels, deviceOf
+	if loaded {
+		c.lastUpdate = time.Now()
+	}
+}
+
+// refreshRegistry reloads one section of the area cache; a failed read keeps the previous data
+func (h *HAService) refreshRegistry(ctx context.Context, section string) error {
+	switch section {
+	case "areas":
+		areas, err := h.getAreas(ctx)
+		if err != nil {
+			return err
+		}
+		areaCache.replace(&areas, nil, nil, false)
+	case "devices":
+		devices, err := h.getDevices(ctx)
+		if err != nil {
+			return err
+		}
+		areaCache.replace(nil, &devices, nil, false)
+	case "entities":
+		entities, err := h.getEntityRegistry(ctx)
+		if err != nil {
+			return err
+		}
+		areaCache.replace(nil, nil, &entities, false)
+	}
+	return nil
+}
+
+// watchRegistries subscribes to the registry events and refreshes the affected area cache
+// section right away, instead of serving renamed or moved devices until the cache expires
+func (h *HAService) watchRegistries(ctx context.Context) {
+	var mu sync.Mutex
+	pending := make(map[string]bool)
+	signal := make(chan struct{}, 1)
+
+	for eventType, section := range registryEvents {
+		go h.ws.Subscribe(ctx, eventType, func(json.RawMessage) {
+			// Runs on the WebSocket reader, so only mark the section and wake the refresher
+			mu.Lock()
+			pending[section] = true
+			mu.Unlock()
+			select {
+			case signal <- struct{}{}:
+			default:
+			}
+		})
+	}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-signal:
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(registryRefreshDelay):
+			}
+
+			mu.Lock()
+			sections := pending
+			pending = make(map[string]bool)
+			mu.Unlock()
+
+			// Devices before entities: entity areas are derived from both
+			for _, section := range []string{"areas", "devices", "entities"} {
+				if !sections[section] {
+					continue
+				}
+				refreshCtx, cancel := context.WithTimeout(ctx, h.requestTimeout)
+				if err := h.refreshRegistry(refreshCtx, section); err != nil {
+					h.logger.Printf("Refreshing %s after registry update failed: %v", section, err)
+				} else {
+					h.logger.Printf("Refreshed %s after registry update", section)
+				}
+				cancel()
+			}
+
+			// New or removed entities may change which tools apply
+			if sections["entities"] && h.config.DynamicTools {
+				refreshCtx, cancel := context.WithTimeout(ctx, h.requestTimeout)
+				if err := h.refreshToolDomains(refreshCtx); err != nil {
+					h.logger.Printf("Refreshing dynamic tools failed: %v", err)
+				}
+				cancel()
+			}
+		}
+	}()
+}
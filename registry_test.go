@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// replace rebuilds the maps outside mu and only swaps them in under it; run with -race
+func TestAreaCacheReplaceConcurrentReaders(t *testing.T) {
+	cache := &AreaEnrichmentCache{
+		areas:    make(map[string]*HAArea),
+		devices:  make(map[string]string),
+		entities: make(map[string]string),
+		labels:   make(map[string][]string),
+		deviceOf: make(map[string]string),
+	}
+
+	areas := []HAArea{{AreaID: "kitchen", Name: "Kitchen"}, {AreaID: "office", Name: "Office"}}
+	entities := []HAEntity{
+		{EntityID: "light.kitchen", DeviceID: "dev1", Labels: []string{"holiday"}},
+		{EntityID: "switch.fan", AreaID: "office"},
+	}
+
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				cache.mu.RLock()
+				for id, area := range cache.areas {
+					_ = id + area.Name
+				}
+				for entityID, areaID := range cache.entities {
+					_ = entityID + areaID
+				}
+				for _, labels := range cache.labels {
+					_ = len(labels)
+				}
+				_ = cache.deviceOf["light.kitchen"]
+				cache.mu.RUnlock()
+			}
+		}()
+	}
+
+	var writers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		writers.Add(1)
+		go func(i int) {
+			defer writers.Done()
+			for j := 0; j < 100; j++ {
+				area := []string{"kitchen", "office"}[(i+j)%2]
+				devices := []HADevice{{ID: "dev1", AreaID: area, Name: fmt.Sprintf("Device %d", j)}}
+				switch j % 3 {
+				case 0:
+					cache.replace(&areas, nil, nil, false)
+				case 1:
+					cache.replace(nil, &devices, nil, false)
+				default:
+					cache.replace(&areas, &devices, &entities, true)
+				}
+			}
+		}(i)
+	}
+	writers.Wait()
+	close(stop)
+	readers.Wait()
+
+	// The last write wins as a whole: entities follow the device they inherit their area from
+	devices := []HADevice{{ID: "dev1", AreaID: "office"}}
+	cache.replace(nil, &devices, nil, false)
+	if got := cache.entities["light.kitchen"]; got != "office" {
+		t.Errorf("light.kitchen is in area %q, want office", got)
+	}
+	if got := cache.entities["switch.fan"]; got != "office" {
+		t.Errorf("switch.fan is in area %q, want office", got)
+	}
+	if got := cache.labels["light.kitchen"]; len(got) != 1 || got[0] != "holiday" {
+		t.Errorf("light.kitchen has labels %v, want [holiday]", got)
+	}
+	if cache.lastUpdate.IsZero() {
+		t.Error("lastUpdate not set by a full load")
+	}
+}
+
+// fakeHomeAssistant serves the REST states and services and the WebSocket registries the
+// tools read, with two lights and a switch in two areas
+func fakeHomeAssistant(t *testing.T) *httptest.Server {
+	states := map[string]HAState{
+		"light.kitchen": {EntityID: "light.kitchen", State: "off", Attributes: map[string]interface{}{"friendly_name": "Kitchen"}},
+		"light.office":  {EntityID: "light.office", State: "on", Attributes: map[string]interface{}{"friendly_name": "Office"}},
+		"switch.kettle": {EntityID: "switch.kettle", State: "off", Attributes: map[string]interface{}{"friendly_name": "Kettle"}},
+	}
+	registries := map[string]interface{}{
+		"config/area_registry/list":   []HAArea{{AreaID: "kitchen", Name: "Kitchen"}, {AreaID: "office", Name: "Office"}},
+		"config/device_registry/list": []HADevice{{ID: "dev1", AreaID: "kitchen", Name: "Kettle plug"}},
+		"config/entity_registry/list": []HAEntity{
+			{EntityID: "light.kitchen", AreaID: "kitchen"},
+			{EntityID: "light.office", AreaID: "office"},
+			{EntityID: "switch.kettle", DeviceID: "dev1"},
+		},
+	}
+	upgrader := websocket.Upgrader{}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/websocket":
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			conn.WriteJSON(map[string]string{"type": "auth_required"})
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+			conn.WriteJSON(map[string]string{"type": "auth_ok"})
+			for {
+				var command struct {
+					ID   int    `json:"id"`
+					Type string `json:"type"`
+				}
+				if err := conn.ReadJSON(&command); err != nil {
+					return
+				}
+				conn.WriteJSON(map[string]interface{}{"id": command.ID, "type": "result", "success": true, "result": registries[command.Type]})
+			}
+		case r.Method == "GET" && r.URL.Path == "/api/states":
+			list := make([]HAState, 0, len(states))
+			for _, state := range states {
+				list = append(list, state)
+			}
+			json.NewEncoder(w).Encode(list)
+		case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/api/states/"):
+			state, exists := states[strings.TrimPrefix(r.URL.Path, "/api/states/")]
+			if !exists {
+				http.NotFound(w, r)
+				return
+			}
+			json.NewEncoder(w).Encode(state)
+		case r.Method == "POST" && strings.HasPrefix(r.URL.Path, "/api/services/"):
+			w.Write([]byte("[]"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+// Tool calls read the states and the area cache while it is refreshed; run with -race
+func TestConcurrentToolCalls(t *testing.T) {
+	ha := fakeHomeAssistant(t)
+	defer ha.Close()
+
+	previous := haService
+	defer func() { haService = previous }()
+	haService = NewHAService()
+	haService.config.HAURL = ha.URL
+	haService.config.HAToken = "test-token"
+	if err := haService.applyClientConfig(); err != nil {
+		t.Fatalf("applyClientConfig failed: %v", err)
+	}
+
+	ctx := context.Background()
+	if err := haService.updateAreaCache(ctx); err != nil {
+		t.Fatalf("loading the area cache failed: %v", err)
+	}
+
+	call := func(handler server.ToolHandlerFunc, arguments map[string]interface{}) {
+		var request mcp.CallToolRequest
+		request.Params.Arguments = arguments
+		result, err := handler(ctx, request)
+		if err != nil {
+			t.Errorf("tool call failed: %v", err)
+			return
+		}
+		if result.IsError {
+			t.Errorf("tool returned an error: %+v", result.Content)
+		}
+	}
+
+	stop := make(chan struct{})
+	refreshed := make(chan struct{})
+	go func() {
+		defer close(refreshed)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := haService.refreshAreaCache(ctx); err != nil {
+				t.Errorf("refreshing the area cache failed: %v", err)
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				switch (i + j) % 4 {
+				case 0:
+					call(getAllStatesHandler, map[string]interface{}{})
+				case 1:
+					call(getAllStatesHandler, map[string]interface{}{"area": "kitchen"})
+				case 2:
+					call(controlEntityHandler, map[string]interface{}{"entity_id": "light.kitchen", "action": "turn_on", "verify": false})
+				default:
+					call(controlMultipleEntitiesHandler, map[string]interface{}{"entities": []interface{}{"light.office", "switch.kettle"}, "action": "turn_off"})
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(stop)
+	<-refreshed
+
+	areaCache.mu.RLock()
+	defer areaCache.mu.RUnlock()
+	if got := areaCache.entities["switch.kettle"]; got != "kitchen" {
+		t.Errorf("switch.kettle is in area %q, want kitchen from its device", got)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// send_remote_command handler
+func sendRemoteCommandHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	entityID, err := haService.resolveDomainEntity(ctx, request, "remote")
+	if err != nil {
+		return toolError("Failed to send remote command", err), nil
+	}
+
+	commands, err := request.RequireStringSlice("command")
+	if err != nil || len(commands) == 0 {
+		return mcp.NewToolResultError("command parameter is required: one or more command names"), nil
+	}
+
+	data := map[string]interface{}{"command": commands}
+	if device := request.GetString("device", ""); device != "" {
+		data["device"] = device
+	}
+	args := request.GetArguments()
+	if _, ok := args["num_repeats"]; ok {
+		data["num_repeats"] = request.GetInt("num_repeats", 1)
+	}
+	if _, ok := args["delay_secs"]; ok {
+		data["delay_secs"] = request.GetFloat("delay_secs", 0)
+	}
+	if _, ok := args["hold_secs"]; ok {
+		data["hold_secs"] = request.GetFloat("hold_secs", 0)
+	}
+
+	result := runServiceCalls(ctx, "remote", entityID, []serviceStep{{service: "send_command", data: data}}, "Failed to send remote command")
+	if result.IsError {
+		return result, nil
+	}
+	return mcp.NewToolResultText(localize(ctx, "Sent %s to %s", strings.Join(commands, ", "), entityID)), nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// RepairIssue is an entry of Home Assistant's repairs dashboard
+type RepairIssue struct {
+	IssueID                 string            `json:"issue_id"`
+	Domain                  string            `json:"domain"`
+	IssueDomain             string            `json:"issue_domain,omitempty"`
+	Severity                string            `json:"severity"` // critical, error or warning
+	TranslationKey          string            `json:"translation_key,omitempty"`
+	TranslationPlaceholders map[string]string `json:"translation_placeholders,omitempty"`
+	BreaksInHAVersion       string            `json:"breaks_in_ha_version,omitempty"`
+	LearnMoreURL            string            `json:"learn_more_url,omitempty"`
+	IsFixable               bool              `json:"is_fixable"`
+	Ignored                 bool              `json:"ignored"`
+	DismissedVersion        string            `json:"dismissed_version,omitempty"`
+	Created                 string            `json:"created,omitempty"`
+}
+
+// Most severe first
+var repairSeverityRank = map[string]int{"critical": 0, "error": 1, "warning": 2}
+
+// getRepairIssues lists the repair issues, without ignored ones unless includeIgnored is set
+func (h *HAService) getRepairIssues(ctx context.Context, includeIgnored bool, severity, domain string) ([]RepairIssue, error) {
+	var result struct {
+		Issues []RepairIssue `json:"issues"`
+	}
+	if err := h.ws.CommandInto(ctx, "repairs/list_issues", nil, &result); err != nil {
+		return nil, err
+	}
+
+	issues := []RepairIssue{}
+	for _, issue := range result.Issues {
+		if (issue.Ignored && !includeIgnored) ||
+			(severity != "" && issue.Severity != severity) ||
+			(domain != "" && issue.Domain != domain && issue.IssueDomain != domain) {
+			continue
+		}
+		issues = append(issues, issue)
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		return repairSeverityRank[issues[i].Severity] < repairSeverityRank[issues[j].Severity]
+	})
+	return issues, nil
+}
+
+// get_repair_issues handler
+func getRepairIssuesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	issues, err := haService.getRepairIssues(ctx,
+		request.GetBool("include_ignored", false),
+		request.GetString("severity", ""),
+		request.GetString("domain", ""),
+	)
+	if err != nil {
+		return toolError("Failed to get repair issues", err), nil
+	}
+
+	issuesJSON, err := json.Marshal(issues)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize repair issues: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Found %d repair issues:\n%s", len(issues), string(issuesJSON))), nil
+}
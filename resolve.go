@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// How old the state cache may be when resolving names, avoids a full read per control call
+const nameIndexMaxAge = 30 * time.Second
+
+// Entity matching a name lookup
+type NameCandidate struct {
+	EntityID string `json:"entity_id"`
+	Name     string `json:"name"`
+	Area     string `json:"area,omitempty"`
+}
+
+// AmbiguousNameError is returned when a name matches more than one entity
+type AmbiguousNameError struct {
+	Name       string
+	Candidates []NameCandidate
+}
+
+func (e *AmbiguousNameError) Error() string {
+	ids := make([]string, len(e.Candidates))
+	for i, candidate := range e.Candidates {
+		ids[i] = candidate.EntityID
+	}
+	return fmt.Sprintf("name %q is ambiguous, candidates: %s", e.Name, strings.Join(ids, ", "))
+}
+
+// normalizeName lowercases and collapses separators so "Living Room Lamp" matches "living_room_lamp"
+func normalizeName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.NewReplacer("_", " ", "-", " ").Replace(name)
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// lookupAlias returns the entity ID configured for a colloquial name
+func (h *HAService) lookupAlias(name string) (string, bool) {
+	wanted := normalizeName(name)
+	for alias, entityID := range h.config.Aliases {
+		if normalizeName(alias) == wanted {
+			return entityID, true
+		}
+	}
+	return "", false
+}
+
+// normalizeEntityID trims and lowercases an entity ID, so "Light.Kitchen " becomes
+// "light.kitchen", and rejects anything that isn't domain.object_id
+func normalizeEntityID(entityID string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(entityID))
+	if !entityIDPattern.MatchString(normalized) {
+		return "", &InvalidRequestError{fmt.Sprintf("invalid entity ID %q, expected domain.object_id with lowercase letters, digits and underscores, e.g. light.kitchen", entityID)}
+	}
+	return normalized, nil
+}
+
+// canonicalEntityID returns the entity an entity_id argument refers to: the target of a
+// configured alias, or the normalized ID
+func (h *HAService) canonicalEntityID(ref string) (string, error) {
+	if target, ok := h.lookupAlias(ref); ok {
+		h.logger.Printf("Alias %q -> %s", ref, target)
+		return target, nil
+	}
+	return normalizeEntityID(ref)
+}
+
+// resolveEntityRef returns the entity to act on: entityID when given (or the entity its
+// alias points to), otherwise the entity resolved from name
+func (h *HAService) resolveEntityRef(ctx context.Context, entityID, name string) (string, error) {
+	if entityID != "" {
+		return h.canonicalEntityID(entityID)
+	}
+	if name == "" {
+		return "", fmt.Errorf("entity_id or name parameter is required")
+	}
+	return h.resolveEntityName(ctx, name)
+}
+
+// resolveEntityName maps a name to an entity ID. Configured aliases win, then exact
+// matches on the friendly name or object ID, then partial matches; more than one
+// match is ambiguous.
+func (h *HAService) resolveEntityName(ctx context.Context, name string) (string, error) {
+	if target, ok := h.lookupAlias(name); ok {
+		h.logger.Printf("Alias %q -> %s", name, target)
+		return target, nil
+	}
+
+	states, err := h.getAllStates(ctx, nameIndexMaxAge)
+	if err != nil {
+		return "", err
+	}
+
+	wanted := normalizeName(name)
+	var exact, partial []NameCandidate
+	for _, state := range states {
+		friendlyName, _ := state.Attributes["friendly_name"].(string)
+		_, objectID, _ := strings.Cut(state.EntityID, ".")
+
+		candidate := NameCandidate{EntityID: state.EntityID, Name: friendlyName}
+		if state.Area != nil {
+			candidate.Area = state.Area.Name
+		}
+
+		normalized := normalizeName(friendlyName)
+		switch {
+		case normalized == wanted || normalizeName(objectID) == wanted:
+			exact = append(exact, candidate)
+		case wanted != "" && (strings.Contains(normalized, wanted) || strings.Contains(normalizeName(objectID), wanted)):
+			partial = append(partial, candidate)
+		}
+	}
+
+	matches := exact
+	if len(matches) == 0 {
+		matches = partial
+	}
+
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no light or switch named %q", name)
+	case 1:
+		h.logger.Printf("Resolved name %q to %s", name, matches[0].EntityID)
+		return matches[0].EntityID, nil
+	default:
+		return "", &AmbiguousNameError{Name: name, Candidates: matches}
+	}
+}
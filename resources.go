@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Logbook entries a ha://logbook resource returns, the most recent ones
+const maxLogbookEntries = 500
+
+// Resource templates for clients that pull data as resources rather than calling tools
+const (
+	historyTemplate = "ha://history/{entity_id}{?hours,interval}"
+	logbookTemplate = "ha://logbook/{area}{?hours}"
+)
+
+// LogbookEntry is one line of the Home Assistant logbook
+type LogbookEntry struct {
+	When     string `json:"when"`
+	EntityID string `json:"entity_id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	State    string `json:"state,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+// AreaLogbook is the ha://logbook response
+type AreaLogbook struct {
+	Area      string         `json:"area"`
+	Start     string         `json:"start"`
+	End       string         `json:"end"`
+	Entries   []LogbookEntry `json:"entries"`
+	Truncated bool           `json:"truncated,omitempty"` // only the last maxLogbookEntries entries are returned
+}
+
+// fetchLogbook reads the logbook between start and end, oldest first
+func (h *HAService) fetchLogbook(ctx context.Context, start, end time.Time) ([]LogbookEntry, error) {
+	endpoint := fmt.Sprintf("/api/logbook/%s?end_time=%s",
+		url.PathEscape(start.UTC().Format(time.RFC3339)), url.QueryEscape(end.UTC().Format(time.RFC3339)))
+	resp, err := h.makeHARequest(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("HA API returned status %d for logbook", resp.StatusCode)
+	}
+
+	var entries []LogbookEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to decode logbook: %w", err)
+	}
+	return entries, nil
+}
+
+// resourceArgument returns a variable matched from a resource URI
+func resourceArgument(request mcp.ReadResourceRequest, name string) string {
+	switch v := request.Params.Arguments[name].(type) {
+	case string:
+		return v
+	case []string:
+		if len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+// resourceHours parses the hours variable of a resource URI
+func resourceHours(request mcp.ReadResourceRequest) (float64, error) {
+	value := resourceArgument(request, "hours")
+	if value == "" {
+		return defaultHistoryHours, nil
+	}
+	hours, err := strconv.ParseFloat(value, 64)
+	if err != nil || hours <= 0 || hours > maxHistoryHours {
+		return 0, &InvalidRequestError{fmt.Sprintf("hours must be between 0 and %d", maxHistoryHours)}
+	}
+	return hours, nil
+}
+
+// checkResourceAccess applies the caller's profile to resource reads, which don't pass the
+// tool middlewares; resources are allowed with the tool serving the same data
+func checkResourceAccess(ctx context.Context, tool string) error {
+	profile, enforced := profileFromContext(ctx)
+	if !enforced {
+		return nil
+	}
+	if profile == nil {
+		return fmt.Errorf("missing or unknown API key")
+	}
+	if !profile.allowsTool(tool) {
+		return fmt.Errorf("profile %s may not use %s", profile.Name, tool)
+	}
+	return nil
+}
+
+func jsonResource(uri string, value interface{}) ([]mcp.ResourceContents, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return []mcp.ResourceContents{
+		mcp.TextResourceContents{URI: uri, MIMEType: "application/json", Text: string(data)},
+	}, nil
+}
+
+// ha://history/{entity_id} resource handler
+func historyResourceHandler(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	if err := checkResourceAccess(ctx, "get_entity_history"); err != nil {
+		return nil, err
+	}
+
+	entityID, err := haService.canonicalEntityID(resourceArgument(request, "entity_id"))
+	if err != nil {
+		return nil, err
+	}
+	if err := haService.checkEntityAccess(ctx, entityID); err != nil {
+		return nil, err
+	}
+	hours, err := resourceHours(request)
+	if err != nil {
+		return nil, err
+	}
+	interval := resourceArgument(request, "interval")
+	if interval != "" && interval != intervalHour && interval != intervalDay {
+		return nil, &InvalidRequestError{fmt.Sprintf("unsupported interval: %s", interval)}
+	}
+
+	history, _, err := haService.entityHistory(ctx, entityID, hours, interval)
+	if err != nil {
+		return nil, err
+	}
+	return jsonResource(request.Params.URI, history)
+}
+
+// ha://logbook/{area} resource handler
+func logbookResourceHandler(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	if err := checkResourceAccess(ctx, "get_entity_history"); err != nil {
+		return nil, err
+	}
+
+	area := resourceArgument(request, "area")
+	hours, err := resourceHours(request)
+	if err != nil {
+		return nil, err
+	}
+
+	// The logbook can't be filtered by area, so select the area's entities first
+	states, err := haService.getRawStates(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+	inArea := make(map[string]bool)
+	for _, state := range haService.exposeStates(ctx, states) {
+		if matchesArea(state.Area, area) {
+			inArea[state.EntityID] = true
+		}
+	}
+	if len(inArea) == 0 {
+		return nil, &InvalidRequestError{fmt.Sprintf("no entities found in area %s", area)}
+	}
+
+	end := time.Now()
+	start := end.Add(-time.Duration(hours * float64(time.Hour)))
+	entries, err := haService.fetchLogbook(ctx, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	logbook := AreaLogbook{
+		Area:    area,
+		Start:   start.Format(time.RFC3339),
+		End:     end.Format(time.RFC3339),
+		Entries: []LogbookEntry{},
+	}
+	for _, entry := range entries {
+		if inArea[entry.EntityID] {
+			logbook.Entries = append(logbook.Entries, entry)
+		}
+	}
+	if len(logbook.Entries) > maxLogbookEntries {
+		logbook.Entries = logbook.Entries[len(logbook.Entries)-maxLogbookEntries:]
+		logbook.Truncated = true
+	}
+	return jsonResource(request.Params.URI, logbook)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify turns a display name into an HA object ID ("Reading Light" -> "reading_light")
+func slugify(name string) string {
+	return strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(name), "_"), "_")
+}
+
+// sceneEntityConfig converts a captured entity into scene config (state plus attributes)
+func sceneEntityConfig(snapshot EntitySnapshot) map[string]interface{} {
+	config := map[string]interface{}{"state": snapshot.State}
+	if snapshot.Brightness != nil {
+		config["brightness"] = snapshot.Brightness
+	}
+	if snapshot.ColorTempKelvin != nil {
+		config["color_temp_kelvin"] = snapshot.ColorTempKelvin
+	}
+	if snapshot.RGBColor != nil {
+		config["rgb_color"] = snapshot.RGBColor
+	}
+	return config
+}
+
+// saveScene stores a scene in HA's scenes.yaml through the config API and reloads scenes
+func (h *HAService) saveScene(ctx context.Context, sceneID, name string, entities map[string]interface{}) error {
+	sceneConfig := map[string]interface{}{
+		"id":       sceneID,
+		"name":     name,
+		"entities": entities,
+	}
+
+	resp, err := h.makeHARequest(ctx, "POST", "/api/config/scene/config/"+sceneID, sceneConfig)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("HA API returned status %d for scene config", resp.StatusCode)
+	}
+
+	return h.callService(ctx, "scene", "reload", map[string]interface{}{})
+}
+
+// create_scene_from_area handler
+func createSceneFromAreaHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	area, err := request.RequireString("area")
+	if err != nil {
+		return mcp.NewToolResultError("area parameter is required"), nil
+	}
+
+	name, err := request.RequireString("name")
+	if err != nil {
+		return mcp.NewToolResultError("name parameter is required"), nil
+	}
+
+	sceneID := slugify(name)
+	if sceneID == "" {
+		return mcp.NewToolResultError(fmt.Sprintf("Invalid scene name %q", name)), nil
+	}
+
+	states, err := haService.selectStates(ctx, nil, area)
+	if err != nil {
+		return toolError("Failed to select entities", err), nil
+	}
+
+	entities := make(map[string]interface{}, len(states))
+	entityIDs := make([]string, 0, len(states))
+	for _, state := range states {
+		entities[state.EntityID] = sceneEntityConfig(captureEntity(state))
+		entityIDs = append(entityIDs, state.EntityID)
+	}
+
+	// Prefer a persistent scene; scene.create only lives until HA restarts
+	err = haService.saveScene(ctx, sceneID, name, entities)
+	if err == nil {
+		haService.logger.Printf("Saved scene %s with %d entities", sceneID, len(entities))
+		return mcp.NewToolResultText(fmt.Sprintf("Saved scene scene.%s (%s) with %d entities from %s", sceneID, name, len(entities), area)), nil
+	}
+	haService.logger.Printf("Saving scene %s via config API failed (%v), falling back to scene.create", sceneID, err)
+
+	err = haService.callService(ctx, "scene", "create", map[string]interface{}{
+		"scene_id":          sceneID,
+		"snapshot_entities": entityIDs,
+	})
+	if err != nil {
+		return toolError("Failed to create scene", err), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Created scene scene.%s with %d entities from %s. Note: it could not be saved to scenes.yaml and will be lost when Home Assistant restarts", sceneID, len(entities), area)), nil
+}
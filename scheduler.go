@@ -0,0 +1,486 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Action scheduled for later execution, optionally repeating: an entity turned on or off,
+// or a configured macro
+type ScheduledAction struct {
+	ID        string    `json:"id"`
+	EntityID  string    `json:"entity_id,omitempty"`
+	Action    string    `json:"action,omitempty"`
+	Macro     string    `json:"macro,omitempty"`
+	RunAt     time.Time `json:"run_at"`
+	Every     string    `json:"every,omitempty"` // recurrence interval as Go duration, e.g. "24h"
+	Cron      string    `json:"cron,omitempty"`  // recurrence as cron expression in local time, e.g. "30 22 * * *"
+	Disabled  bool      `json:"disabled,omitempty"`
+	Session   string    `json:"session,omitempty"` // writes_per_minute bucket of the session that scheduled it
+	Profile   string    `json:"profile,omitempty"` // profile of the client that scheduled it, applied when it runs
+	CreatedAt time.Time `json:"created_at"`
+	LastRun   time.Time `json:"last_run,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// target describes what the action does, for logs
+func (a *ScheduledAction) target() string {
+	if a.Macro != "" {
+		return "macro " + a.Macro
+	}
+	return a.EntityID + " " + a.Action
+}
+
+// nextRun returns the first occurrence of a repeating action after now, skipping the ones
+// missed while the bridge was down; the zero time means it doesn't repeat
+func (a *ScheduledAction) nextRun(now time.Time) time.Time {
+	if a.Cron != "" {
+		schedule, err := parseCron(a.Cron)
+		if err != nil {
+			return time.Time{}
+		}
+		return schedule.next(now)
+	}
+
+	every, _ := time.ParseDuration(a.Every)
+	if every <= 0 {
+		return time.Time{}
+	}
+	next := a.RunAt
+	for !next.After(now) {
+		next = next.Add(every)
+	}
+	return next
+}
+
+// In-process scheduler persisting its actions to a JSON file so they survive restarts
+type Scheduler struct {
+	mu      sync.Mutex
+	actions map[string]*ScheduledAction
+	timers  map[string]*time.Timer
+	path    string
+	service *HAService
+}
+
+// Global scheduler instance
+var scheduler *Scheduler
+
+func newID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// NewScheduler loads persisted actions from path and arms their timers
+func NewScheduler(service *HAService, path string) (*Scheduler, error) {
+	sc := &Scheduler{
+		actions: make(map[string]*ScheduledAction),
+		timers:  make(map[string]*time.Timer),
+		path:    path,
+		service: service,
+	}
+
+	actions, err := loadScheduledActions(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, action := range actions {
+		sc.actions[action.ID] = action
+		if !action.Disabled {
+			sc.arm(action)
+		}
+	}
+
+	service.logger.Printf("Scheduler started with %d actions from %s", len(sc.actions), path)
+	return sc, nil
+}
+
+// loadScheduledActions reads the persisted actions; a missing file has none
+func loadScheduledActions(path string) ([]*ScheduledAction, error) {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read schedule file %s: %v", path, err)
+	}
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var actions []*ScheduledAction
+	if err := json.Unmarshal(data, &actions); err != nil {
+		return nil, fmt.Errorf("failed to parse schedule file %s: %v", path, err)
+	}
+	return actions, nil
+}
+
+// scheduleFilePath is the schedule file, relative paths resolved like CONFIG_FILE
+func (h *HAService) scheduleFilePath() string {
+	if h.config.ScheduleFile == "" {
+		return h.resolvePath("scheduled_actions.json")
+	}
+	return h.resolvePath(h.config.ScheduleFile)
+}
+
+// arm starts the timer for action; overdue actions run immediately. Caller holds mu
+// or has exclusive access.
+func (sc *Scheduler) arm(action *ScheduledAction) {
+	delay := time.Until(action.RunAt)
+	if delay < 0 {
+		delay = 0
+	}
+	id := action.ID
+	sc.timers[id] = time.AfterFunc(delay, func() {
+		sc.run(id)
+	})
+}
+
+// save writes all actions to the schedule file. Caller holds mu.
+func (sc *Scheduler) save() error {
+	actions := sc.listLocked()
+	data, err := json.MarshalIndent(actions, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file first so a crash never leaves a truncated schedule behind
+	tmp := sc.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, sc.path)
+}
+
+func (sc *Scheduler) listLocked() []ScheduledAction {
+	actions := make([]ScheduledAction, 0, len(sc.actions))
+	for _, action := range sc.actions {
+		actions = append(actions, *action)
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].RunAt.Before(actions[j].RunAt)
+	})
+	return actions
+}
+
+// Add validates and schedules a new action
+func (sc *Scheduler) Add(entityID, action string, runAt time.Time, every time.Duration) (ScheduledAction, error) {
+	scheduled := &ScheduledAction{
+		EntityID: entityID,
+		Action:   action,
+		RunAt:    runAt,
+	}
+	if every > 0 {
+		scheduled.Every = every.String()
+	}
+	return sc.Schedule(scheduled)
+}
+
+// Schedule persists and arms an action filled in by the caller; the ID and creation time
+// are set here
+func (sc *Scheduler) Schedule(scheduled *ScheduledAction) (ScheduledAction, error) {
+	scheduled.ID = newID()
+	scheduled.CreatedAt = time.Now()
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.actions[scheduled.ID] = scheduled
+	if err := sc.save(); err != nil {
+		delete(sc.actions, scheduled.ID)
+		return ScheduledAction{}, fmt.Errorf("failed to persist schedule: %v", err)
+	}
+	sc.arm(scheduled)
+
+	sc.service.logger.Printf("Scheduled %s at %s (id %s, every %q, cron %q)", scheduled.target(), scheduled.RunAt.Format(time.RFC3339), scheduled.ID, scheduled.Every, scheduled.Cron)
+	return *scheduled, nil
+}
+
+// SetEnabled pauses or resumes an action; a repeating action resumes at its next
+// occurrence, a one-off action that became due while disabled runs right away
+func (sc *Scheduler) SetEnabled(id string, enabled bool) (ScheduledAction, error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	action, exists := sc.actions[id]
+	if !exists {
+		return ScheduledAction{}, fmt.Errorf("scheduled action %s not found", id)
+	}
+	if action.Disabled == !enabled {
+		return *action, nil
+	}
+
+	action.Disabled = !enabled
+	if timer, exists := sc.timers[id]; exists {
+		timer.Stop()
+		delete(sc.timers, id)
+	}
+	if enabled {
+		if next := action.nextRun(time.Now()); !next.IsZero() {
+			action.RunAt = next
+		}
+		sc.arm(action)
+	}
+
+	sc.service.logger.Printf("Scheduled action %s (%s) enabled: %v", id, action.target(), enabled)
+	return *action, sc.save()
+}
+
+// Cancel removes a scheduled action
+func (sc *Scheduler) Cancel(id string) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if _, exists := sc.actions[id]; !exists {
+		return fmt.Errorf("scheduled action %s not found", id)
+	}
+
+	if timer, exists := sc.timers[id]; exists {
+		timer.Stop()
+		delete(sc.timers, id)
+	}
+	delete(sc.actions, id)
+
+	sc.service.logger.Printf("Cancelled scheduled action %s", id)
+	return sc.save()
+}
+
+// List returns all scheduled actions ordered by next run
+func (sc *Scheduler) List() []ScheduledAction {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.listLocked()
+}
+
+// run executes a due action, then re-arms it if it repeats or removes it otherwise
+func (sc *Scheduler) run(id string) {
+	sc.mu.Lock()
+	action, exists := sc.actions[id]
+	if !exists {
+		sc.mu.Unlock()
+		return
+	}
+	if action.Disabled {
+		sc.mu.Unlock()
+		return
+	}
+	entityID, verb, macroName, target, bucket, profile := action.EntityID, action.Action, action.Macro, action.target(), action.Session, action.Profile
+	sc.mu.Unlock()
+
+	// Writes count against the scheduling session and stay within its profile
+	ctx, err := sc.service.withProfileName(withWriteBucket(context.Background(), bucket), profile)
+	switch {
+	case err != nil:
+	case macroName != "":
+		err = sc.runMacro(ctx, macroName)
+	default:
+		// Long enough for the request and an approval, if the entity needs one
+		ctx, cancel := context.WithTimeout(ctx, sc.service.requestTimeout+sc.service.approvalTimeout)
+		err = sc.service.controlEntity(ctx, entityID, verb)
+		cancel()
+	}
+	if err != nil {
+		sc.service.logger.Printf("Scheduled action %s (%s) failed: %v", id, target, err)
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	// Cancelled while running
+	action, exists = sc.actions[id]
+	if !exists {
+		return
+	}
+
+	action.LastRun = time.Now()
+	action.LastError = ""
+	if err != nil {
+		action.LastError = err.Error()
+	}
+
+	if next := action.nextRun(time.Now()); !next.IsZero() {
+		action.RunAt = next
+		if !action.Disabled {
+			sc.arm(action)
+		}
+	} else {
+		delete(sc.actions, id)
+		delete(sc.timers, id)
+	}
+
+	if err := sc.save(); err != nil {
+		sc.service.logger.Printf("Failed to persist schedule: %v", err)
+	}
+}
+
+// runMacro runs a configured macro for a scheduled action; the macro may have been removed
+// from the configuration since it was scheduled
+func (sc *Scheduler) runMacro(ctx context.Context, name string) error {
+	_, macro, exists := sc.service.findMacro(name)
+	if !exists {
+		return fmt.Errorf("macro %s is no longer configured", name)
+	}
+
+	// Enough for the macro's delays and a request and approval per step
+	ctx, cancel := context.WithTimeout(ctx, maxMacroDelay+time.Duration(len(macro.Steps))*(sc.service.requestTimeout+sc.service.approvalTimeout))
+	defer cancel()
+	_, err := sc.service.runMacro(ctx, macro)
+	return err
+}
+
+// schedule_action handler
+func scheduleActionHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	scheduled := &ScheduledAction{}
+	if macroName := request.GetString("macro", ""); macroName != "" {
+		name, macro, exists := haService.findMacro(macroName)
+		if !exists {
+			return mcp.NewToolResultError(fmt.Sprintf("Macro %s not found, see list_macros", macroName)), nil
+		}
+		for _, step := range macro.Steps {
+			if step.EntityID == "" {
+				continue
+			}
+			entityID, err := haService.canonicalEntityID(step.EntityID)
+			if err != nil {
+				return toolError("Failed to resolve entity", err), nil
+			}
+			if err := haService.checkEntityAccess(ctx, entityID); err != nil {
+				return toolError("Cannot schedule action", err), nil
+			}
+		}
+		scheduled.Macro = name
+	} else {
+		entityID, err := haService.resolveEntityRef(ctx, request.GetString("entity_id", ""), request.GetString("name", ""))
+		if err != nil {
+			return toolError("Failed to resolve entity", err), nil
+		}
+		if err := haService.checkEntityAccess(ctx, entityID); err != nil {
+			return toolError("Cannot schedule action", err), nil
+		}
+
+		action := request.GetString("action", "")
+		if action == "" {
+			return mcp.NewToolResultError("action parameter is required"), nil
+		}
+		scheduled.EntityID, scheduled.Action = entityID, action
+	}
+
+	var err error
+	runAtStr := request.GetString("run_at", "")
+	delayStr := request.GetString("delay", "")
+	cronStr := request.GetString("cron", "")
+	switch {
+	case cronStr != "" && (runAtStr != "" || delayStr != "" || request.GetString("every", "") != ""):
+		return mcp.NewToolResultError("Use either cron or run_at/delay/every, not both"), nil
+	case cronStr != "":
+		schedule, err := parseCron(cronStr)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid cron: %v", err)), nil
+		}
+		scheduled.Cron = cronStr
+		scheduled.RunAt = schedule.next(time.Now())
+	case runAtStr != "" && delayStr != "":
+		return mcp.NewToolResultError("Use either run_at or delay, not both"), nil
+	case runAtStr != "":
+		scheduled.RunAt, err = time.Parse(time.RFC3339, runAtStr)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid run_at %q, expected RFC3339 (e.g. 2025-01-31T18:30:00+01:00): %v", runAtStr, err)), nil
+		}
+	case delayStr != "":
+		delay, err := time.ParseDuration(delayStr)
+		if err != nil || delay < 0 {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid delay %q, expected a duration such as 90s, 15m or 2h", delayStr)), nil
+		}
+		scheduled.RunAt = time.Now().Add(delay)
+	default:
+		return mcp.NewToolResultError("run_at, delay or cron parameter is required"), nil
+	}
+
+	if everyStr := request.GetString("every", ""); everyStr != "" {
+		every, err := time.ParseDuration(everyStr)
+		if err != nil || every < time.Minute {
+			return mcp.NewToolResultError(fmt.Sprintf("Invalid every %q, expected a duration of at least 1m such as 24h", everyStr)), nil
+		}
+		scheduled.Every = every.String()
+	}
+
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		scheduled.Session = writeBucket(session.SessionID())
+	}
+	if profile, enforced := profileFromContext(ctx); enforced && profile != nil {
+		scheduled.Profile = profile.Name
+	}
+
+	if err := haService.checkScheduledConfirmation(ctx, scheduled); err != nil {
+		return toolError("Cannot schedule action", err), nil
+	}
+
+	result, err := scheduler.Schedule(scheduled)
+	if err != nil {
+		return toolError("Failed to schedule action", err), nil
+	}
+
+	scheduledJSON, err := json.Marshal(result)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize scheduled action: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Scheduled %s at %s:\n%s", result.target(), result.RunAt.Format(time.RFC3339), string(scheduledJSON))), nil
+}
+
+// list_scheduled_actions handler
+func listScheduledActionsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	actions := scheduler.List()
+
+	actionsJSON, err := json.Marshal(actions)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize scheduled actions: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Found %d scheduled actions:\n%s", len(actions), string(actionsJSON))), nil
+}
+
+// cancel_scheduled_action handler
+func cancelScheduledActionHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, err := request.RequireString("id")
+	if err != nil {
+		return mcp.NewToolResultError("id parameter is required"), nil
+	}
+
+	if err := scheduler.Cancel(id); err != nil {
+		return toolError("Failed to cancel scheduled action", err), nil
+	}
+
+	return mcp.NewToolResultText(localize(ctx, "Cancelled scheduled action %s", id)), nil
+}
+
+// enable_scheduled_action and disable_scheduled_action handler
+func setScheduledActionEnabledHandler(enabled bool) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		id, err := request.RequireString("id")
+		if err != nil {
+			return mcp.NewToolResultError("id parameter is required"), nil
+		}
+
+		action, err := scheduler.SetEnabled(id, enabled)
+		if err != nil {
+			return toolError("Failed to update scheduled action", err), nil
+		}
+
+		actionJSON, err := json.Marshal(action)
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize scheduled action: %v", err)), nil
+		}
+		verb := "Disabled"
+		if enabled {
+			verb = "Enabled"
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("%s scheduled action %s:\n%s", verb, id, string(actionJSON))), nil
+	}
+}
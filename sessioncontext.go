@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Calls remembered per session, and how long an idle session is remembered
+const (
+	maxSessionCalls = 20
+	sessionIdleTTL  = time.Hour
+)
+
+// touchedCall is a tool call that queried or controlled entities
+type touchedCall struct {
+	Tool       string    `json:"tool"`
+	EntityIDs  []string  `json:"entity_ids"`
+	Controlled bool      `json:"controlled"`
+	At         time.Time `json:"at"`
+}
+
+// sessionHistory is the remembered calls of one session, oldest first
+type sessionHistory struct {
+	calls    []touchedCall
+	lastSeen time.Time
+}
+
+// sessionMemory remembers the entities each MCP session touched, so agents can refer back
+// to them with @last references
+type sessionMemory struct {
+	mu       sync.Mutex
+	sessions map[string]*sessionHistory
+}
+
+var sessionContexts = &sessionMemory{sessions: make(map[string]*sessionHistory)}
+
+// record adds a call to the session's history
+func (m *sessionMemory) record(session string, call touchedCall) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, history := range m.sessions {
+		if call.At.Sub(history.lastSeen) > sessionIdleTTL {
+			delete(m.sessions, id)
+		}
+	}
+
+	history, exists := m.sessions[session]
+	if !exists {
+		history = &sessionHistory{}
+		m.sessions[session] = history
+	}
+	history.calls = append(history.calls, call)
+	if len(history.calls) > maxSessionCalls {
+		history.calls = history.calls[len(history.calls)-maxSessionCalls:]
+	}
+	history.lastSeen = call.At
+}
+
+// calls returns a copy of the session's history, oldest first
+func (m *sessionMemory) calls(session string) []touchedCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	history, exists := m.sessions[session]
+	if !exists {
+		return nil
+	}
+	return append([]touchedCall(nil), history.calls...)
+}
+
+// resolveReference expands "@last" to the entities of the session's latest call, and
+// "@last:light" to the lights of the latest call that touched any
+func resolveReference(calls []touchedCall, ref string) ([]string, error) {
+	name, domain, _ := strings.Cut(ref, ":")
+	if name != "@last" {
+		return nil, fmt.Errorf("unknown reference %s, use @last or @last:<domain>", ref)
+	}
+
+	for i := len(calls) - 1; i >= 0; i-- {
+		var matched []string
+		for _, entityID := range calls[i].EntityIDs {
+			if domain == "" || strings.HasPrefix(entityID, domain+".") {
+				matched = append(matched, entityID)
+			}
+		}
+		if len(matched) > 0 {
+			return matched, nil
+		}
+	}
+	return nil, fmt.Errorf("%s doesn't refer to any entity yet in this session", ref)
+}
+
+func isReference(value interface{}) bool {
+	s, ok := value.(string)
+	return ok && strings.HasPrefix(s, "@")
+}
+
+// expandReferences replaces references in the entity_id, entity_ids and entities arguments.
+// In lists a reference expands to all its entities; a single entity_id must refer to one.
+func expandReferences(calls []touchedCall, arguments map[string]interface{}) (map[string]interface{}, error) {
+	expanded := make(map[string]interface{}, len(arguments))
+	for key, value := range arguments {
+		expanded[key] = value
+	}
+
+	if isReference(expanded["entity_id"]) {
+		ref := expanded["entity_id"].(string)
+		entityIDs, err := resolveReference(calls, ref)
+		if err != nil {
+			return nil, err
+		}
+		if len(entityIDs) != 1 {
+			return nil, fmt.Errorf("%s refers to %d entities (%s) but entity_id takes one; use a tool that takes a list",
+				ref, len(entityIDs), strings.Join(entityIDs, ", "))
+		}
+		expanded["entity_id"] = entityIDs[0]
+	}
+
+	for _, key := range []string{"entity_ids", "entities"} {
+		items, ok := expanded[key].([]interface{})
+		if !ok {
+			continue
+		}
+		list := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			if !isReference(item) {
+				list = append(list, item)
+				continue
+			}
+			entityIDs, err := resolveReference(calls, item.(string))
+			if err != nil {
+				return nil, err
+			}
+			for _, entityID := range entityIDs {
+				list = append(list, entityID)
+			}
+		}
+		expanded[key] = list
+	}
+	return expanded, nil
+}
+
+// argumentEntityIDs returns the entities named by a call's arguments
+func (h *HAService) argumentEntityIDs(arguments map[string]interface{}) []string {
+	var refs []string
+	if entityID, ok := arguments["entity_id"].(string); ok && entityID != "" {
+		refs = append(refs, entityID)
+	}
+	for _, key := range []string{"entity_ids", "entities"} {
+		items, _ := arguments[key].([]interface{})
+		for _, item := range items {
+			switch v := item.(type) {
+			case string:
+				refs = append(refs, v)
+			case map[string]interface{}:
+				if entityID, ok := v["entity_id"].(string); ok {
+					refs = append(refs, entityID)
+				}
+			}
+		}
+	}
+
+	var entityIDs []string
+	for _, ref := range refs {
+		if entityID, err := h.canonicalEntityID(ref); err == nil {
+			entityIDs = append(entityIDs, entityID)
+		}
+	}
+	return entityIDs
+}
+
+// sessionCall collects the entities a tool call controls through callService
+type sessionCall struct {
+	mu         sync.Mutex
+	controlled []string
+}
+
+type sessionCallKey struct{}
+
+// recordControlled notes the entities a service call changed, for the tool call in ctx
+func recordControlled(ctx context.Context, entityIDs []string) {
+	if call, ok := ctx.Value(sessionCallKey{}).(*sessionCall); ok {
+		call.mu.Lock()
+		call.controlled = append(call.controlled, entityIDs...)
+		call.mu.Unlock()
+	}
+}
+
+// sessionContextMiddleware resolves @last references in the entity arguments and, once the
+// call succeeded, remembers the entities it queried or controlled for the session
+func sessionContextMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		session := server.ClientSessionFromContext(ctx)
+		if session == nil {
+			return next(ctx, request)
+		}
+
+		arguments, err := expandReferences(sessionContexts.calls(session.SessionID()), request.GetArguments())
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		request.Params.Arguments = arguments
+
+		call := &sessionCall{}
+		result, err := next(context.WithValue(ctx, sessionCallKey{}, call), request)
+		if err != nil || result == nil || result.IsError {
+			return result, err
+		}
+
+		touched := touchedCall{
+			Tool:       request.Params.Name,
+			Controlled: len(call.controlled) > 0 || containsString(writeTools, request.Params.Name),
+			At:         time.Now(),
+		}
+		for _, entityID := range append(haService.argumentEntityIDs(arguments), call.controlled...) {
+			if !containsString(touched.EntityIDs, entityID) {
+				touched.EntityIDs = append(touched.EntityIDs, entityID)
+			}
+		}
+		if len(touched.EntityIDs) > 0 {
+			sessionContexts.record(session.SessionID(), touched)
+		}
+		return result, nil
+	}
+}
+
+// get_session_context handler
+func getSessionContextHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	session := server.ClientSessionFromContext(ctx)
+	if session == nil {
+		return mcp.NewToolResultError("No MCP session, nothing is remembered"), nil
+	}
+	calls := sessionContexts.calls(session.SessionID())
+
+	type entityInfo struct {
+		EntityID    string    `json:"entity_id"`
+		LastTool    string    `json:"last_tool"`
+		Controlled  bool      `json:"controlled"`
+		LastTouched time.Time `json:"last_touched"`
+	}
+	// Most recently touched first
+	entities := []entityInfo{}
+	seen := make(map[string]bool)
+	references := make(map[string][]string)
+	for i := len(calls) - 1; i >= 0; i-- {
+		for _, entityID := range calls[i].EntityIDs {
+			domain, _, _ := strings.Cut(entityID, ".")
+			if _, exists := references["@last:"+domain]; !exists {
+				references["@last:"+domain], _ = resolveReference(calls, "@last:"+domain)
+			}
+			if seen[entityID] {
+				continue
+			}
+			seen[entityID] = true
+			entities = append(entities, entityInfo{
+				EntityID:    entityID,
+				LastTool:    calls[i].Tool,
+				Controlled:  calls[i].Controlled,
+				LastTouched: calls[i].At,
+			})
+		}
+	}
+	if len(calls) > 0 {
+		references["@last"] = calls[len(calls)-1].EntityIDs
+	}
+
+	recent := make([]touchedCall, 0, len(calls))
+	for i := len(calls) - 1; i >= 0; i-- {
+		recent = append(recent, calls[i])
+	}
+
+	contextJSON, err := json.Marshal(map[string]interface{}{
+		"session_id":   session.SessionID(),
+		"recent_calls": recent,
+		"entities":     entities,
+		"references":   references,
+	})
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize session context: %v", err)), nil
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("%d entities touched in this session:\n%s", len(entities), string(contextJSON))), nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// setupPrompter reads answers line by line for the setup wizard
+type setupPrompter struct {
+	in  *bufio.Scanner
+	out io.Writer
+}
+
+// ask prints question and returns the trimmed answer, or fallback for an empty one
+func (p *setupPrompter) ask(question, fallback string) (string, error) {
+	if fallback != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, fallback)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	if !p.in.Scan() {
+		if err := p.in.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	answer := strings.TrimSpace(p.in.Text())
+	if answer == "" {
+		return fallback, nil
+	}
+	return answer, nil
+}
+
+// choose lists options with numbers and returns the ones picked by number or name, all of
+// them for an empty answer
+func (p *setupPrompter) choose(question string, options []string, labels map[string]string) ([]string, error) {
+	for i, option := range options {
+		fmt.Fprintf(p.out, "  %2d) %s\n", i+1, labels[option])
+	}
+	for {
+		answer, err := p.ask(question+" (numbers or names, comma separated, empty for all)", "")
+		if err != nil {
+			return nil, err
+		}
+		if answer == "" {
+			return nil, nil
+		}
+
+		var picked []string
+		var unknown []string
+		for _, item := range strings.Split(answer, ",") {
+			item = strings.TrimSpace(item)
+			if n, err := strconv.Atoi(item); err == nil && n >= 1 && n <= len(options) {
+				picked = append(picked, options[n-1])
+			} else if containsString(options, item) {
+				picked = append(picked, item)
+			} else if item != "" {
+				unknown = append(unknown, item)
+			}
+		}
+		if len(unknown) == 0 {
+			return picked, nil
+		}
+		fmt.Fprintf(p.out, "Unknown choice: %s\n", strings.Join(unknown, ", "))
+	}
+}
+
+// runSetup walks through URL, token and exposed domains/areas, tests the connection and
+// writes the config file; it returns the process exit code
+func runSetup(h *HAService, configFile string, in io.Reader, out io.Writer) int {
+	p := &setupPrompter{in: bufio.NewScanner(in), out: out}
+	if err := h.setup(p, configFile); err != nil {
+		fmt.Fprintf(os.Stderr, "Setup failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func (h *HAService) setup(p *setupPrompter, configFile string) error {
+	ctx := context.Background()
+	fmt.Fprintln(p.out, "Home Assistant MCP Server setup")
+
+	if configFile == "" {
+		configFile = filepath.Join(h.executableDir, configFileNames[0])
+	}
+	if _, err := os.Stat(configFile); err == nil {
+		answer, err := p.ask(fmt.Sprintf("%s exists, overwrite it? (y/N)", configFile), "n")
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(strings.ToLower(answer), "y") {
+			return fmt.Errorf("%s left unchanged", configFile)
+		}
+	}
+
+	fmt.Fprintln(p.out, "Looking for Home Assistant on the local network...")
+	suggested, err := h.discoverHomeAssistant(ctx)
+	if err != nil {
+		suggested = "http://homeassistant.local:8123"
+	}
+
+	// Ask again until the URL and token work
+	for {
+		url, err := p.ask("Home Assistant URL", suggested)
+		if err != nil {
+			return err
+		}
+		h.config.HAURL = url
+		if err := h.applyClientConfig(); err != nil {
+			fmt.Fprintf(p.out, "%v\n", err)
+			continue
+		}
+		suggested = h.config.HAURL
+
+		fmt.Fprintf(p.out, "Create a long-lived access token at %s/profile/security (Long-lived access tokens, Create token) and paste it here.\n", h.config.HAURL)
+		token, err := p.ask("Access token", "")
+		if err != nil {
+			return err
+		}
+		h.config.HAToken = token
+
+		if err := h.checkConnectivity(ctx); err != nil {
+			fmt.Fprintf(p.out, "Connection failed: %v\n", err)
+			continue
+		}
+		fmt.Fprintf(p.out, "Connected to Home Assistant at %s\n", h.config.HAURL)
+		break
+	}
+
+	states, err := h.fetchStates(ctx)
+	if err != nil {
+		return err
+	}
+	if err := h.updateAreaCache(ctx); err != nil {
+		return err
+	}
+
+	config := map[string]interface{}{
+		"ha_url":   h.config.HAURL,
+		"ha_token": h.config.HAToken,
+	}
+
+	domainCounts := make(map[string]int)
+	for _, state := range states {
+		domain, _, _ := strings.Cut(state.EntityID, ".")
+		domainCounts[domain]++
+	}
+	domains := make([]string, 0, len(domainCounts))
+	labels := make(map[string]string)
+	for domain, count := range domainCounts {
+		domains = append(domains, domain)
+		labels[domain] = fmt.Sprintf("%s (%d entities)", domain, count)
+	}
+	sort.Strings(domains)
+
+	fmt.Fprintln(p.out, "Domains:")
+	pickedDomains, err := p.choose("Domains to expose", domains, labels)
+	if err != nil {
+		return err
+	}
+	if len(pickedDomains) > 0 {
+		var filter []string
+		for _, domain := range pickedDomains {
+			filter = append(filter, domain+".*")
+		}
+		config["entity_filter"] = filter
+	}
+
+	areaCache.mu.RLock()
+	areaIDs := make([]string, 0, len(areaCache.areas))
+	labels = make(map[string]string)
+	for id, area := range areaCache.areas {
+		areaIDs = append(areaIDs, id)
+		labels[id] = fmt.Sprintf("%s (%s)", area.Name, id)
+	}
+	areaCache.mu.RUnlock()
+	sort.Strings(areaIDs)
+
+	if len(areaIDs) > 0 {
+		fmt.Fprintln(p.out, "Areas:")
+		pickedAreas, err := p.choose("Areas to expose", areaIDs, labels)
+		if err != nil {
+			return err
+		}
+		if len(pickedAreas) > 0 {
+			config["area_filter"] = pickedAreas
+		}
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(configFile, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(p.out, "Wrote %s. Start the server with:\n  ha-mcp-server --config %s\n", configFile, configFile)
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// press_button handler
+func pressButtonHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	entityID, err := haService.resolveDomainEntity(ctx, request, "button", "input_button")
+	if err != nil {
+		return toolError("Failed to press button", err), nil
+	}
+
+	domain, _, _ := strings.Cut(entityID, ".")
+	if err := haService.callService(ctx, domain, "press", map[string]interface{}{"entity_id": entityID}); err != nil {
+		return toolError("Failed to press button", err), nil
+	}
+
+	return mcp.NewToolResultText(localize(ctx, "Successfully pressed %s", entityID)), nil
+}
+
+// control_siren handler
+func controlSirenHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	entityID, err := haService.resolveDomainEntity(ctx, request, "siren")
+	if err != nil {
+		return toolError("Failed to control siren", err), nil
+	}
+	args := request.GetArguments()
+
+	var step serviceStep
+	switch action, _ := request.RequireString("action"); action {
+	case "on", "turn_on":
+		step = serviceStep{service: "turn_on", data: map[string]interface{}{}}
+		if tone := request.GetString("tone", ""); tone != "" {
+			state, err := haService.fetchEntityState(ctx, entityID, 0)
+			if err != nil {
+				return toolError("Failed to get entity state", err), nil
+			}
+			if err := checkMode(state, "tone", "available_tones", tone); err != nil {
+				return toolError("Failed to control siren", err), nil
+			}
+			step.data["tone"] = tone
+		}
+		if _, ok := args["duration"]; ok {
+			step.data["duration"] = request.GetInt("duration", 0)
+		}
+		if _, ok := args["volume_level"]; ok {
+			step.data["volume_level"] = request.GetFloat("volume_level", 0)
+		}
+	case "off", "turn_off":
+		step = serviceStep{service: "turn_off"}
+	case "":
+		return mcp.NewToolResultError("action parameter is required"), nil
+	default:
+		return mcp.NewToolResultError(fmt.Sprintf("Unsupported action: %s", action)), nil
+	}
+
+	return runServiceCalls(ctx, "siren", entityID, []serviceStep{step}, "Failed to control siren"), nil
+}
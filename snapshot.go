@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Captured state of one entity, enough to put it back
+type EntitySnapshot struct {
+	EntityID        string        `json:"entity_id"`
+	State           string        `json:"state"`
+	Brightness      interface{}   `json:"brightness,omitempty"`
+	ColorTempKelvin interface{}   `json:"color_temp_kelvin,omitempty"`
+	RGBColor        []interface{} `json:"rgb_color,omitempty"`
+}
+
+// Snapshot of a set of entities, kept in memory until the server stops
+type Snapshot struct {
+	ID        string           `json:"id"`
+	Name      string           `json:"name,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+	Entities  []EntitySnapshot `json:"entities"`
+}
+
+var snapshots = struct {
+	mu   sync.Mutex
+	byID map[string]*Snapshot
+}{
+	byID: make(map[string]*Snapshot),
+}
+
+// selectStates returns the exposed lights and switches matching entity IDs (aliases
+// allowed) and/or an area. With neither, nothing is selected.
+func (h *HAService) selectStates(ctx context.Context, entityIDs []string, area string) ([]HAState, error) {
+	if len(entityIDs) == 0 && area == "" {
+		return nil, fmt.Errorf("entity_ids or area parameter is required")
+	}
+
+	wanted := make(map[string]bool, len(entityIDs))
+	for _, ref := range entityIDs {
+		entityID, err := h.canonicalEntityID(ref)
+		if err != nil {
+			return nil, err
+		}
+		wanted[entityID] = true
+	}
+
+	states, err := h.getAllStates(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []HAState
+	for _, state := range states {
+		if !isSwitchable(state.EntityID) {
+			continue
+		}
+		if wanted[state.EntityID] || (area != "" && matchesArea(state.Area, area)) {
+			selected = append(selected, state)
+			delete(wanted, state.EntityID)
+		}
+	}
+
+	if len(wanted) > 0 {
+		missing := make([]string, 0, len(wanted))
+		for entityID := range wanted {
+			missing = append(missing, entityID)
+		}
+		return nil, fmt.Errorf("entities not found: %s", strings.Join(missing, ", "))
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no lights or switches found in area %q", area)
+	}
+	return selected, nil
+}
+
+func captureEntity(state HAState) EntitySnapshot {
+	snapshot := EntitySnapshot{
+		EntityID: state.EntityID,
+		State:    state.State,
+	}
+	if state.State != "on" || !strings.HasPrefix(state.EntityID, "light.") {
+		return snapshot
+	}
+
+	snapshot.Brightness = state.Attributes["brightness"]
+	// Restore the color the light is actually in, not both
+	switch state.Attributes["color_mode"] {
+	case "color_temp":
+		snapshot.ColorTempKelvin = state.Attributes["color_temp_kelvin"]
+	case "hs", "xy", "rgb", "rgbw", "rgbww":
+		snapshot.RGBColor, _ = state.Attributes["rgb_color"].([]interface{})
+	}
+	return snapshot
+}
+
+// captureEntities reads the live state of entityIDs; every entity must exist, so it can be
+// put back later
+func (h *HAService) captureEntities(ctx context.Context, entityIDs []string) (map[string]EntitySnapshot, error) {
+	states, err := h.getRawStates(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool, len(entityIDs))
+	for _, entityID := range entityIDs {
+		wanted[entityID] = true
+	}
+	captured := make(map[string]EntitySnapshot, len(entityIDs))
+	for _, state := range states {
+		if wanted[state.EntityID] {
+			captured[state.EntityID] = captureEntity(state)
+		}
+	}
+	for _, entityID := range entityIDs {
+		if _, exists := captured[entityID]; !exists {
+			return nil, &EntityNotFoundError{EntityID: entityID}
+		}
+	}
+	return captured, nil
+}
+
+// restoreEntity puts an entity back into its captured state
+func (h *HAService) restoreEntity(ctx context.Context, snapshot EntitySnapshot) error {
+	if err := h.checkEntityAccess(ctx, snapshot.EntityID); err != nil {
+		return err
+	}
+
+	domain, _, _ := strings.Cut(snapshot.EntityID, ".")
+
+	switch snapshot.State {
+	case "on":
+		data := map[string]interface{}{"entity_id": snapshot.EntityID}
+		if snapshot.Brightness != nil {
+			data["brightness"] = snapshot.Brightness
+		}
+		if snapshot.ColorTempKelvin != nil {
+			data["color_temp_kelvin"] = snapshot.ColorTempKelvin
+		}
+		if snapshot.RGBColor != nil {
+			data["rgb_color"] = snapshot.RGBColor
+		}
+		return h.callService(ctx, domain, "turn_on", data)
+	case "off":
+		return h.callService(ctx, domain, "turn_off", map[string]interface{}{"entity_id": snapshot.EntityID})
+	default:
+		return fmt.Errorf("cannot restore state %q", snapshot.State)
+	}
+}
+
+// snapshot_states handler
+func snapshotStatesHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	states, err := haService.selectStates(ctx, request.GetStringSlice("entity_ids", nil), request.GetString("area", ""))
+	if err != nil {
+		return toolError("Failed to select entities", err), nil
+	}
+
+	snapshot := &Snapshot{
+		ID:        newID(),
+		Name:      request.GetString("name", ""),
+		CreatedAt: time.Now(),
+	}
+	for _, state := range states {
+		snapshot.Entities = append(snapshot.Entities, captureEntity(state))
+	}
+
+	snapshots.mu.Lock()
+	snapshots.byID[snapshot.ID] = snapshot
+	snapshots.mu.Unlock()
+
+	haService.logger.Printf("Snapshot %s captured %d entities", snapshot.ID, len(snapshot.Entities))
+
+	snapshotJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize snapshot: %v", err)), nil
+	}
+
+	return mcp.NewToolResultText(fmt.Sprintf("Snapshot %s captured %d entities:\n%s", snapshot.ID, len(snapshot.Entities), string(snapshotJSON))), nil
+}
+
+// restore_snapshot handler
+func restoreSnapshotHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, err := request.RequireString("id")
+	if err != nil {
+		return mcp.NewToolResultError("id parameter is required"), nil
+	}
+
+	snapshots.mu.Lock()
+	snapshot, exists := snapshots.byID[id]
+	snapshots.mu.Unlock()
+	if !exists {
+		return mcp.NewToolResultError(fmt.Sprintf("Snapshot %s not found", id)), nil
+	}
+	if err := haService.checkBatchSize(len(snapshot.Entities)); err != nil {
+		return toolError("Failed to restore snapshot", err), nil
+	}
+
+	var errors []string
+	for _, entity := range snapshot.Entities {
+		if err := ctx.Err(); err != nil {
+			return toolError("Restore cancelled", err), nil
+		}
+		if err := haService.restoreEntity(ctx, entity); err != nil {
+			errors = append(errors, fmt.Sprintf("Entity %s: %v", entity.EntityID, err))
+		}
+	}
+
+	restored := len(snapshot.Entities) - len(errors)
+	haService.logger.Printf("Snapshot %s restored: %d successful, %d failed", id, restored, len(errors))
+
+	if len(errors) > 0 {
+		return mcp.NewToolResultError(fmt.Sprintf("Restored %d of %d entities from snapshot %s:\n%s",
+			restored, len(snapshot.Entities), id, strings.Join(errors, "\n"))), nil
+	}
+	return mcp.NewToolResultText(localize(ctx, "Restored %d entities from snapshot %s", restored, id)), nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Default bounds of the state cache
+const (
+	defaultStateCacheMaxEntities       = 10000
+	defaultStateCacheMaxAttributeBytes = 16 * 1024
+)
+
+// Snapshot of all HA states, refreshed by every /api/states read and the optional poller
+type StateCache struct {
+	mu        sync.RWMutex
+	states    []HAState
+	index     map[string]int // entity_id -> position in states
+	complete  bool           // false when entities were evicted, so all() can't serve the snapshot
+	updatedAt time.Time
+
+	maxEntities       int // most recently updated entities kept, unlimited when 0
+	maxAttributeBytes int // larger attribute values are truncated, unlimited when 0
+}
+
+// setLimits applies state_cache_max_entities and state_cache_max_attribute_bytes; 0 picks
+// the default and a negative value removes the bound
+func (c *StateCache) setLimits(maxEntities, maxAttributeBytes int) {
+	bound := func(value, fallback int) int {
+		switch {
+		case value == 0:
+			return fallback
+		case value < 0:
+			return 0
+		}
+		return value
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.maxEntities = bound(maxEntities, defaultStateCacheMaxEntities)
+	c.maxAttributeBytes = bound(maxAttributeBytes, defaultStateCacheMaxAttributeBytes)
+}
+
+// store replaces the snapshot, keeping the most recently updated entities when there are
+// more than maxEntities and truncating oversized attributes (camera tokens, long source
+// lists) so a long-lived process doesn't grow with them. It returns how many entities were
+// evicted and how many attributes truncated.
+func (c *StateCache) store(states []HAState) (evicted, truncated int) {
+	c.mu.RLock()
+	maxEntities, maxAttributeBytes := c.maxEntities, c.maxAttributeBytes
+	c.mu.RUnlock()
+
+	if maxEntities > 0 && len(states) > maxEntities {
+		// Sort a copy, the caller still returns states in HA's order
+		states = append([]HAState(nil), states...)
+		sort.SliceStable(states, func(i, j int) bool {
+			return states[i].LastUpdated > states[j].LastUpdated
+		})
+		evicted = len(states) - maxEntities
+		states = states[:maxEntities]
+	}
+	if maxAttributeBytes > 0 {
+		states, truncated = truncateAttributes(states, maxAttributeBytes)
+	}
+
+	index := make(map[string]int, len(states))
+	for i, state := range states {
+		index[state.EntityID] = i
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.states = states
+	c.index = index
+	c.complete = evicted == 0
+	c.updatedAt = time.Now()
+	return evicted, truncated
+}
+
+// truncateAttributes returns states with every attribute value larger than maxBytes cut
+// down; the attribute maps are shared with the caller, so changed states get a copy
+func truncateAttributes(states []HAState, maxBytes int) ([]HAState, int) {
+	truncated := 0
+	copied := false
+	for i, state := range states {
+		var attributes map[string]interface{}
+		for key, value := range state.Attributes {
+			shortened, changed := truncateAttribute(value, maxBytes)
+			if !changed {
+				continue
+			}
+			if attributes == nil {
+				attributes = make(map[string]interface{}, len(state.Attributes))
+				for k, v := range state.Attributes {
+					attributes[k] = v
+				}
+			}
+			attributes[key] = shortened
+			truncated++
+		}
+		if attributes == nil {
+			continue
+		}
+		if !copied {
+			states = append([]HAState(nil), states...)
+			copied = true
+		}
+		states[i].Attributes = attributes
+	}
+	return states, truncated
+}
+
+// truncateAttribute shortens strings and lists to about maxBytes of JSON; other values too
+// large are replaced by a note of their size
+func truncateAttribute(value interface{}, maxBytes int) (interface{}, bool) {
+	switch v := value.(type) {
+	case nil, bool, float64:
+		return value, false
+	case string:
+		if len(v) <= maxBytes {
+			return value, false
+		}
+		cut := maxBytes
+		for cut > 0 && !utf8.RuneStart(v[cut]) {
+			cut--
+		}
+		return v[:cut] + "…", true
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil || len(encoded) <= maxBytes {
+		return value, false
+	}
+	if list, ok := value.([]interface{}); ok {
+		size := 2 // brackets
+		kept := 0
+		for _, item := range list {
+			itemJSON, err := json.Marshal(item)
+			if err != nil || size+len(itemJSON)+1 > maxBytes {
+				break
+			}
+			size += len(itemJSON) + 1
+			kept++
+		}
+		return list[:kept:kept], true
+	}
+	return fmt.Sprintf("<%d bytes omitted>", len(encoded)), true
+}
+
+// all returns a copy of the cached states if they are not older than maxAge; a snapshot
+// with evicted entities is never served as the full list
+func (c *StateCache) all(maxAge time.Duration) ([]HAState, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.updatedAt.IsZero() || time.Since(c.updatedAt) > maxAge || !c.complete {
+		return nil, false
+	}
+	return append([]HAState(nil), c.states...), true
+}
+
+// get returns one cached state if the cache is not older than maxAge
+func (c *StateCache) get(entityID string, maxAge time.Duration) (HAState, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.updatedAt.IsZero() || time.Since(c.updatedAt) > maxAge {
+		return HAState{}, false
+	}
+	i, exists := c.index[entityID]
+	if !exists {
+		return HAState{}, false
+	}
+	return c.states[i], true
+}
+
+func (c *StateCache) age() (time.Duration, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.updatedAt.IsZero() {
+		return 0, false
+	}
+	return time.Since(c.updatedAt), true
+}
+
+// startStatePoller keeps the state cache warm by reading /api/states every interval
+func (h *HAService) startStatePoller(interval time.Duration) {
+	h.logger.Printf("State cache poller started, interval %v", interval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if _, err := h.fetchStates(context.Background()); err != nil {
+				h.logger.Printf("State cache poll failed: %v", err)
+			}
+		}
+	}()
+}
+
+// warmCaches fills the area/registry cache and the state cache in the background, opening
+// the persistent WebSocket on the way, so the first tool call doesn't pay for it
+func (h *HAService) warmCaches() {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*h.requestTimeout)
+		defer cancel()
+
+		start := time.Now()
+		if err := h.updateAreaCache(ctx); err != nil {
+			h.logger.Printf("Cache warming: registries failed: %v", err)
+		}
+		states, err := h.fetchStates(ctx)
+		if err != nil {
+			h.logger.Printf("Cache warming: states failed: %v", err)
+			return
+		}
+		h.logger.Printf("Cache warming: %d states and registries loaded in %v", len(states), time.Since(start))
+	}()
+}
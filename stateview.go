@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Attributes dropped in compact mode: capability lists and UI hints that rarely
+// help an agent but make up most of a light's payload
+var verboseAttributes = map[string]bool{
+	"supported_color_modes": true,
+	"supported_features":    true,
+	"effect_list":           true,
+	"min_mireds":            true,
+	"max_mireds":            true,
+	"min_color_temp_kelvin": true,
+	"max_color_temp_kelvin": true,
+	"hs_color":              true,
+	"xy_color":              true,
+	"entity_picture":        true,
+	"icon":                  true,
+	"attribution":           true,
+}
+
+// selectAttributes returns copies of states with only the requested attributes.
+// fields, when set, wins over compact. The original attribute maps are shared with
+// the state cache and are never modified.
+func selectAttributes(states []HAState, fields []string, compact bool) []HAState {
+	if len(fields) == 0 && !compact {
+		return states
+	}
+
+	wanted := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		wanted[field] = true
+	}
+
+	result := make([]HAState, len(states))
+	for i, state := range states {
+		attributes := make(map[string]interface{})
+		for key, value := range state.Attributes {
+			if len(wanted) > 0 {
+				if wanted[key] {
+					attributes[key] = value
+				}
+			} else if !verboseAttributes[key] {
+				attributes[key] = value
+			}
+		}
+		state.Attributes = attributes
+		result[i] = state
+	}
+	return result
+}
+
+// paginateStates sorts states by entity_id for stable pages and returns the page
+// plus the offset of the next page (0 when this is the last one)
+func paginateStates(states []HAState, offset, limit int) ([]HAState, int) {
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].EntityID < states[j].EntityID
+	})
+
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(states) {
+		return []HAState{}, 0
+	}
+	if limit <= 0 || offset+limit >= len(states) {
+		return states[offset:], 0
+	}
+	return states[offset : offset+limit], offset + limit
+}
+
+// matchesArea compares an area filter against the area ID or name, case-insensitively
+func matchesArea(area *HAArea, filter string) bool {
+	if area == nil {
+		return false
+	}
+	filter = strings.ToLower(strings.TrimSpace(filter))
+	return strings.ToLower(area.AreaID) == filter ||
+		strings.ToLower(area.Name) == filter ||
+		strings.ReplaceAll(filter, " ", "_") == strings.ToLower(area.AreaID)
+}
+
+// filterStatesBy keeps states matching all non-empty filters (area, domain, state)
+func filterStatesBy(states []HAState, area, domain, state string) []HAState {
+	if area == "" && domain == "" && state == "" {
+		return states
+	}
+
+	var filtered []HAState
+	for _, s := range states {
+		if area != "" && !matchesArea(s.Area, area) {
+			continue
+		}
+		if domain != "" && !strings.HasPrefix(s.EntityID, strings.TrimSuffix(domain, ".")+".") {
+			continue
+		}
+		if state != "" && !strings.EqualFold(s.State, state) {
+			continue
+		}
+		filtered = append(filtered, s)
+	}
+	return filtered
+}
+
+// Entities of one area with on/off counts, used by group_by "area"
+type AreaGroup struct {
+	AreaID   string    `json:"area_id"`
+	Name     string    `json:"name"`
+	On       int       `json:"on"`
+	Off      int       `json:"off"`
+	Other    int       `json:"other,omitempty"` // unavailable, unknown, ...
+	Entities []HAState `json:"entities"`
+}
+
+// groupStatesByArea nests states under their area, sorted by area name, with
+// entities without an area collected in a trailing "Unassigned" group
+func groupStatesByArea(states []HAState) []AreaGroup {
+	groups := make(map[string]*AreaGroup)
+	var order []string
+
+	for _, state := range states {
+		areaID, name := "", "Unassigned"
+		if state.Area != nil {
+			areaID, name = state.Area.AreaID, state.Area.Name
+		}
+
+		group, exists := groups[areaID]
+		if !exists {
+			group = &AreaGroup{AreaID: areaID, Name: name}
+			groups[areaID] = group
+			order = append(order, areaID)
+		}
+
+		switch state.State {
+		case "on":
+			group.On++
+		case "off":
+			group.Off++
+		default:
+			group.Other++
+		}
+
+		// Area is implied by the group
+		state.Area = nil
+		group.Entities = append(group.Entities, state)
+	}
+
+	sort.Slice(order, func(i, j int) bool {
+		if order[i] == "" || order[j] == "" {
+			return order[j] == ""
+		}
+		return groups[order[i]].Name < groups[order[j]].Name
+	})
+
+	result := make([]AreaGroup, 0, len(order))
+	for _, areaID := range order {
+		result = append(result, *groups[areaID])
+	}
+	return result
+}
+
+// Attribute allow/deny lists; an empty allow list allows everything
+type AttributeRule struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// Attribute policy applied to every state before it is returned
+type AttributePolicy struct {
+	AttributeRule
+	PerDomain map[string]AttributeRule `json:"per_domain,omitempty"`
+}
+
+func (p AttributePolicy) isEmpty() bool {
+	return len(p.Allow) == 0 && len(p.Deny) == 0 && len(p.PerDomain) == 0
+}
+
+// applyAttributePolicy strips attributes according to the configured policy. A domain
+// allow list replaces the global one, deny lists are combined. friendly_name is always kept.
+func (h *HAService) applyAttributePolicy(states []HAState) []HAState {
+	policy := h.config.Attributes
+	if policy.isEmpty() {
+		return states
+	}
+
+	result := make([]HAState, len(states))
+	for i, state := range states {
+		domain, _, _ := strings.Cut(state.EntityID, ".")
+		allow, deny := policy.Allow, policy.Deny
+		if rule, exists := policy.PerDomain[domain]; exists {
+			if len(rule.Allow) > 0 {
+				allow = rule.Allow
+			}
+			deny = append(append([]string(nil), deny...), rule.Deny...)
+		}
+
+		attributes := make(map[string]interface{}, len(state.Attributes))
+		for key, value := range state.Attributes {
+			if key != "friendly_name" {
+				if len(allow) > 0 && !containsString(allow, key) {
+					continue
+				}
+				if containsString(deny, key) {
+					continue
+				}
+			}
+			attributes[key] = value
+		}
+		state.Attributes = attributes
+		result[i] = state
+	}
+	return result
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// addChangeAge fills in how long each state has been unchanged, so agents can answer
+// "how long has the porch light been on" without date arithmetic
+func addChangeAge(states []HAState, now time.Time, language string) {
+	for i := range states {
+		changed, err := time.Parse(time.RFC3339Nano, states[i].LastChanged)
+		if err != nil {
+			continue
+		}
+		age := max(now.Sub(changed), 0)
+		states[i].SecondsSinceChange = int64(age / time.Second)
+		states[i].StateFor = humanizeDuration(age, language)
+	}
+}
+
+// humanizeDuration renders a duration with its two most significant units in language,
+// e.g. "45 seconds", "12 minutes", "3 hours 5 minutes" or "2 days 4 hours"
+func humanizeDuration(d time.Duration, language string) string {
+	seconds := int64(d / time.Second)
+	days := seconds / 86400
+	hours := seconds % 86400 / 3600
+	minutes := seconds % 3600 / 60
+
+	switch {
+	case days > 0:
+		return joinUnits(days, "day", hours, "hour", language)
+	case hours > 0:
+		return joinUnits(hours, "hour", minutes, "minute", language)
+	case minutes > 0:
+		return pluralize(minutes, "minute", language)
+	default:
+		return pluralize(seconds, "second", language)
+	}
+}
+
+func joinUnits(major int64, majorUnit string, minor int64, minorUnit string, language string) string {
+	if minor == 0 {
+		return pluralize(major, majorUnit, language)
+	}
+	return pluralize(major, majorUnit, language) + " " + pluralize(minor, minorUnit, language)
+}
+
+// pluralize picks the unit's form for n; Czech has a separate form for 2 to 4
+func pluralize(n int64, unit string, language string) string {
+	forms, exists := durationUnits[language][unit]
+	if !exists {
+		forms = durationUnits["en"][unit]
+	}
+	switch {
+	case n == 1:
+		return "1 " + forms[0]
+	case n >= 2 && n <= 4:
+		return fmt.Sprintf("%d %s", n, forms[1])
+	}
+	return fmt.Sprintf("%d %s", n, forms[2])
+}
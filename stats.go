@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Latencies kept per tool or endpoint for the percentiles
+const statsSamples = 1000
+
+// Path prefixes whose next segment is an ID, collapsed so each endpoint is one row
+var statsIDPrefixes = []string{
+	"/api/states/",
+	"/api/history/period/",
+	"/api/config/automation/config/",
+	"/api/config/scene/config/",
+	"/api/config/config_entries/entry/",
+}
+
+// callStats counts the calls of one tool or endpoint and keeps its recent latencies
+type callStats struct {
+	calls     int64
+	errors    int64
+	latencies []time.Duration // ring buffer of the last statsSamples calls
+	next      int
+}
+
+func (c *callStats) record(duration time.Duration, failed bool) {
+	c.calls++
+	if failed {
+		c.errors++
+	}
+	if len(c.latencies) < statsSamples {
+		c.latencies = append(c.latencies, duration)
+		return
+	}
+	c.latencies[c.next] = duration
+	c.next = (c.next + 1) % statsSamples
+}
+
+// CallStats is one row of the get_bridge_stats response
+type CallStats struct {
+	Name      string  `json:"name"`
+	Calls     int64   `json:"calls"`
+	Errors    int64   `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+	P50Ms     int64   `json:"p50_ms"`
+	P95Ms     int64   `json:"p95_ms"`
+	MaxMs     int64   `json:"max_ms"` // of the sampled calls
+}
+
+func (c *callStats) summary(name string) CallStats {
+	sorted := append([]time.Duration(nil), c.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	percentile := func(p float64) int64 {
+		if len(sorted) == 0 {
+			return 0
+		}
+		return sorted[int(p*float64(len(sorted)-1))].Milliseconds()
+	}
+
+	stats := CallStats{
+		Name:   name,
+		Calls:  c.calls,
+		Errors: c.errors,
+		P50Ms:  percentile(0.5),
+		P95Ms:  percentile(0.95),
+		MaxMs:  percentile(1),
+	}
+	if c.calls > 0 {
+		stats.ErrorRate = float64(c.errors) / float64(c.calls)
+	}
+	return stats
+}
+
+// BridgeStats is the get_bridge_stats response
+type BridgeStats struct {
+	Since     string      `json:"since"`
+	Tools     []CallStats `json:"tools"`
+	Endpoints []CallStats `json:"endpoints"` // REST paths and WebSocket command types
+}
+
+// bridgeStats aggregates tool calls and HA requests since the start of the process
+type bridgeStats struct {
+	mu        sync.Mutex
+	since     time.Time
+	tools     map[string]*callStats
+	endpoints map[string]*callStats
+}
+
+var stats = &bridgeStats{
+	since:     time.Now(),
+	tools:     make(map[string]*callStats),
+	endpoints: make(map[string]*callStats),
+}
+
+func (b *bridgeStats) record(table map[string]*callStats, name string, duration time.Duration, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := table[name]
+	if !ok {
+		c = &callStats{}
+		table[name] = c
+	}
+	c.record(duration, failed)
+}
+
+func (b *bridgeStats) recordTool(name string, duration time.Duration, failed bool) {
+	b.record(b.tools, name, duration, failed)
+}
+
+func (b *bridgeStats) recordEndpoint(name string, duration time.Duration, failed bool) {
+	b.record(b.endpoints, name, duration, failed)
+}
+
+// snapshot returns the rows of both tables, most called first
+func (b *bridgeStats) snapshot() BridgeStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	rows := func(table map[string]*callStats) []CallStats {
+		result := make([]CallStats, 0, len(table))
+		for name, c := range table {
+			result = append(result, c.summary(name))
+		}
+		sort.Slice(result, func(i, j int) bool {
+			if result[i].Calls != result[j].Calls {
+				return result[i].Calls > result[j].Calls
+			}
+			return result[i].Name < result[j].Name
+		})
+		return result
+	}
+
+	return BridgeStats{
+		Since:     b.since.Format(time.RFC3339),
+		Tools:     rows(b.tools),
+		Endpoints: rows(b.endpoints),
+	}
+}
+
+// statsEndpoint names the row of a REST request: method and path, without the query and
+// with entity and other IDs replaced
+func statsEndpoint(method, endpoint string) string {
+	path, _, _ := strings.Cut(endpoint, "?")
+	for _, prefix := range statsIDPrefixes {
+		if rest, ok := strings.CutPrefix(path, prefix); ok {
+			_, tail, hasTail := strings.Cut(rest, "/")
+			path = prefix + "{id}"
+			if hasTail {
+				path += "/" + tail
+			}
+			break
+		}
+	}
+	return method + " " + path
+}
+
+// statsMiddleware records the duration and outcome of every tool call
+func statsMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		start := time.Now()
+		result, err := next(ctx, request)
+		stats.recordTool(request.Params.Name, time.Since(start), err != nil || (result != nil && result.IsError))
+		return result, err
+	}
+}
+
+// get_bridge_stats handler
+func getBridgeStatsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	snapshot := stats.snapshot()
+
+	statsJSON, err := json.Marshal(snapshot)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize bridge stats: %v", err)), nil
+	}
+
+	var calls, errors int64
+	for _, tool := range snapshot.Tools {
+		calls += tool.Calls
+		errors += tool.Errors
+	}
+	summary := fmt.Sprintf("%d tool calls (%d failed) and %d endpoints since %s", calls, errors, len(snapshot.Endpoints), snapshot.Since)
+	return mcp.NewToolResultText(fmt.Sprintf("%s:\n%s", summary, string(statsJSON))), nil
+}
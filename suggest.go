@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Closest entity IDs offered when an entity doesn't exist
+const maxSuggestions = 3
+
+// EntityNotFoundError is returned when HA doesn't know an entity; Suggestions holds the
+// closest exposed entity IDs
+type EntityNotFoundError struct {
+	EntityID    string
+	Suggestions []string
+}
+
+func (e *EntityNotFoundError) Error() string {
+	message := fmt.Sprintf("entity %s not found", e.EntityID)
+	switch len(e.Suggestions) {
+	case 0:
+		return message
+	case 1:
+		return fmt.Sprintf("%s, did you mean %s?", message, e.Suggestions[0])
+	default:
+		last := len(e.Suggestions) - 1
+		return fmt.Sprintf("%s, did you mean %s or %s?", message, strings.Join(e.Suggestions[:last], ", "), e.Suggestions[last])
+	}
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+// suggestEntities returns the exposed entity IDs closest to entityID, comparing both the
+// full ID and the object ID against the friendly name so "light.livingroom_lamp" finds
+// "light.living_room_lamp" and a friendly name typed as ID finds its entity
+func (h *HAService) suggestEntities(ctx context.Context, entityID string) []string {
+	states, err := h.getRawStates(ctx, nameIndexMaxAge)
+	if err != nil {
+		h.logger.Printf("No suggestions for %s: %v", entityID, err)
+		return nil
+	}
+	states = h.filterExposed(ctx, states)
+
+	wanted := strings.ToLower(entityID)
+	_, wantedObject, _ := strings.Cut(wanted, ".")
+	wantedName := normalizeName(wantedObject)
+
+	type scored struct {
+		entityID string
+		distance int
+	}
+	candidates := make([]scored, 0, len(states))
+	for _, state := range states {
+		distance := editDistance(wanted, state.EntityID)
+		if friendlyName, _ := state.Attributes["friendly_name"].(string); friendlyName != "" && wantedName != "" {
+			distance = min(distance, editDistance(wantedName, normalizeName(friendlyName)))
+		}
+		candidates = append(candidates, scored{state.EntityID, distance})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].entityID < candidates[j].entityID
+	})
+
+	var suggestions []string
+	for _, candidate := range candidates[:min(maxSuggestions, len(candidates))] {
+		suggestions = append(suggestions, candidate.entityID)
+	}
+	return suggestions
+}
+
+// withSuggestions adds the closest entity IDs to an EntityNotFoundError; the lookup reads
+// all states, so only the tools an agent names entities in use it
+func (h *HAService) withSuggestions(ctx context.Context, err error) error {
+	var notFound *EntityNotFoundError
+	if errors.As(err, &notFound) && notFound.Suggestions == nil {
+		notFound.Suggestions = h.suggestEntities(ctx, notFound.EntityID)
+	}
+	return err
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Solar events reported by sun.sun, by attribute and by the sun integration's sensor
+var sunEvents = []struct{ name, attribute, sensor string }{
+	{"dawn", "next_dawn", "sensor.sun_next_dawn"},
+	{"sunrise", "next_rising", "sensor.sun_next_rising"},
+	{"noon", "next_noon", "sensor.sun_next_noon"},
+	{"sunset", "next_setting", "sensor.sun_next_setting"},
+	{"dusk", "next_dusk", "sensor.sun_next_dusk"},
+	{"midnight", "next_midnight", "sensor.sun_next_midnight"},
+}
+
+// SunEvent is the next occurrence of a solar event
+type SunEvent struct {
+	Event     string `json:"event"`
+	At        string `json:"at"`    // RFC 3339, UTC as reported by HA
+	Local     string `json:"local"` // in the server's time zone
+	InSeconds int64  `json:"in_seconds"`
+	In        string `json:"in"`
+}
+
+// SunInfo is the get_sun_info response
+type SunInfo struct {
+	State     string      `json:"state"` // above_horizon or below_horizon
+	Elevation interface{} `json:"elevation,omitempty"`
+	Azimuth   interface{} `json:"azimuth,omitempty"`
+	Rising    interface{} `json:"rising,omitempty"`
+	Events    []SunEvent  `json:"next_events"` // soonest first
+}
+
+// getSunInfo reads sun.sun and lists the upcoming solar events; newer HA versions may only
+// report them through the sun sensors
+func (h *HAService) getSunInfo(ctx context.Context, maxAge time.Duration, now time.Time) (*SunInfo, error) {
+	sun, err := h.getEntityState(ctx, "sun.sun", maxAge)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &SunInfo{
+		State:     sun.State,
+		Elevation: sun.Attributes["elevation"],
+		Azimuth:   sun.Attributes["azimuth"],
+		Rising:    sun.Attributes["rising"],
+		Events:    []SunEvent{},
+	}
+
+	for _, event := range sunEvents {
+		at := formatValue(sun.Attributes[event.attribute])
+		if at == "" && h.entityIDExposed(ctx, event.sensor) {
+			if sensor, err := h.fetchEntityState(ctx, event.sensor, maxAge); err == nil {
+				at = sensor.State
+			}
+		}
+
+		t, err := time.Parse(time.RFC3339Nano, at)
+		if err != nil {
+			continue
+		}
+		until := max(t.Sub(now), 0)
+		info.Events = append(info.Events, SunEvent{
+			Event:     event.name,
+			At:        at,
+			Local:     t.Local().Format(time.RFC3339),
+			InSeconds: int64(until / time.Second),
+			In:        humanizeDuration(until, languageFromContext(ctx)),
+		})
+	}
+
+	sort.Slice(info.Events, func(i, j int) bool {
+		return info.Events[i].InSeconds < info.Events[j].InSeconds
+	})
+	return info, nil
+}
+
+// get_sun_info handler
+func getSunInfoHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	maxAge := time.Duration(request.GetFloat("max_age", 0) * float64(time.Second))
+
+	info, err := haService.getSunInfo(ctx, maxAge, time.Now())
+	if err != nil {
+		return toolError("Failed to get sun info", err), nil
+	}
+
+	infoJSON, err := json.Marshal(info)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize sun info: %v", err)), nil
+	}
+
+	summary := fmt.Sprintf("Sun is %s", info.State)
+	if len(info.Events) > 0 {
+		summary += fmt.Sprintf(", next %s in %s", info.Events[0].Event, info.Events[0].In)
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("%s:\n%s", summary, string(infoJSON))), nil
+}
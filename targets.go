@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// entityHasLabel matches a label ID or a label name against the entity registry labels
+func entityHasLabel(entityID, label string) bool {
+	areaCache.mu.RLock()
+	defer areaCache.mu.RUnlock()
+
+	wanted := slugify(label)
+	for _, labelID := range areaCache.labels[entityID] {
+		if labelID == label || labelID == wanted {
+			return true
+		}
+	}
+	return false
+}
+
+// expandTargets returns the exposed lights and switches matching all given selectors
+func (h *HAService) expandTargets(ctx context.Context, area, domain, label string) ([]string, error) {
+	states, err := h.getAllStates(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	states = filterStatesBy(states, area, domain, "")
+
+	var targets []string
+	for _, state := range states {
+		// Only lights and switches are turned on and off in bulk
+		if !isSwitchable(state.EntityID) {
+			continue
+		}
+		if label != "" && !entityHasLabel(state.EntityID, label) {
+			continue
+		}
+		targets = append(targets, state.EntityID)
+	}
+
+	if len(targets) == 0 {
+		var selectors []string
+		for _, selector := range [][2]string{{"area", area}, {"domain", domain}, {"label", label}} {
+			if selector[1] != "" {
+				selectors = append(selectors, fmt.Sprintf("%s=%q", selector[0], selector[1]))
+			}
+		}
+		return nil, fmt.Errorf("no lights or switches match %s", strings.Join(selectors, ", "))
+	}
+
+	h.logger.Printf("Expanded area=%q domain=%q label=%q to %d entities", area, domain, label, len(targets))
+	return targets, nil
+}
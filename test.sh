@@ -35,6 +35,9 @@ run_with_timeout() {
     fi
 }
 
+# Tests below run without a reachable Home Assistant, skip the startup check failure
+export HA_DEGRADED_MODE=true
+
 echo "🧪 Running MCP Server tests..."
 echo ""
 
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Bounds of the timeout_ms argument
+const (
+	minCallTimeout = 500 * time.Millisecond
+	maxCallTimeout = 2 * time.Minute
+)
+
+type callTimeoutKey struct{}
+
+// withCallTimeout overrides the request timeout for HA requests made with the returned context
+func withCallTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, callTimeoutKey{}, timeout)
+}
+
+// callTimeout returns the per-call timeout override of ctx, if any
+func callTimeout(ctx context.Context) (time.Duration, bool) {
+	timeout, ok := ctx.Value(callTimeoutKey{}).(time.Duration)
+	return timeout, ok
+}
+
+// timeoutParam declares the timeout_ms argument of the control tools
+func timeoutParam() mcp.ToolOption {
+	return mcp.WithNumber("timeout_ms",
+		mcp.Description("Wait up to this many milliseconds for Home Assistant to acknowledge, for slow devices such as covers or Zigbee groups (default: the server's request timeout)"),
+		mcp.Min(float64(minCallTimeout/time.Millisecond)),
+		mcp.Max(float64(maxCallTimeout/time.Millisecond)),
+	)
+}
+
+// timeoutMiddleware applies a call's timeout_ms argument to the HA requests made by its handler
+func timeoutMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if _, ok := request.GetArguments()["timeout_ms"]; !ok {
+			return next(ctx, request)
+		}
+
+		timeout := time.Duration(request.GetFloat("timeout_ms", 0) * float64(time.Millisecond))
+		if timeout < minCallTimeout || timeout > maxCallTimeout {
+			return mcp.NewToolResultError(fmt.Sprintf("timeout_ms must be between %d and %d",
+				minCallTimeout/time.Millisecond, maxCallTimeout/time.Millisecond)), nil
+		}
+		return next(withCallTimeout(ctx, timeout), request)
+	}
+}
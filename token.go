@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// dockerSecretPath is where Docker and Compose mount a secret named ha_token
+const dockerSecretPath = "/run/secrets/ha_token"
+
+func dockerSecretExists() bool {
+	_, err := os.Stat(dockerSecretPath)
+	return err == nil
+}
+
+// tokenCommandTimeout bounds token_command and token_refresh_command
+const tokenCommandTimeout = 30 * time.Second
+
+// UnauthorizedError is returned when HA rejects the access token
+type UnauthorizedError struct {
+	Message string
+}
+
+func (e *UnauthorizedError) Error() string {
+	return "unauthorized: " + e.Message
+}
+
+// token returns the current HA access token
+func (h *HAService) token() string {
+	h.tokenMu.RLock()
+	defer h.tokenMu.RUnlock()
+	return h.config.HAToken
+}
+
+func (h *HAService) setToken(token string) {
+	h.tokenMu.Lock()
+	defer h.tokenMu.Unlock()
+	h.config.HAToken = token
+}
+
+// runCommand runs a shell command and returns its trimmed stdout
+func runCommand(ctx context.Context, command string) (string, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// readTokenSource reads the token from token_file, token_command or the Docker secret,
+// returning an empty token when none of them is configured
+func (h *HAService) readTokenSource(ctx context.Context) (string, error) {
+	switch {
+	case h.config.TokenFile != "":
+		path := h.resolvePath(h.config.TokenFile)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read token file %s: %v", path, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+
+	case h.config.TokenCommand != "":
+		token, err := runCommand(ctx, h.config.TokenCommand)
+		if err != nil {
+			return "", fmt.Errorf("token command failed: %v", err)
+		}
+		return token, nil
+
+	case dockerSecretExists():
+		data, err := os.ReadFile(dockerSecretPath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read Docker secret %s: %v", dockerSecretPath, err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return "", nil
+}
+
+// loadToken fills in ha_token from its external source when it isn't set inline
+func (h *HAService) loadToken() error {
+	if h.config.HAToken != "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), tokenCommandTimeout)
+	defer cancel()
+
+	token, err := h.readTokenSource(ctx)
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		return fmt.Errorf("no Home Assistant token configured (set ha_token, token_file or token_command)")
+	}
+
+	h.config.HAToken = token
+	return nil
+}
+
+// refreshToken obtains a new token after failedToken was rejected and reports whether
+// a different token is now available. Concurrent callers share one refresh.
+func (h *HAService) refreshToken(ctx context.Context, failedToken string) bool {
+	h.refreshMu.Lock()
+	defer h.refreshMu.Unlock()
+
+	// Another caller already refreshed while we waited
+	if h.token() != failedToken {
+		return true
+	}
+
+	cmdCtx, cancel := context.WithTimeout(ctx, tokenCommandTimeout)
+	defer cancel()
+
+	// Without a refresh command, re-read the token source in case it was rotated
+	var token string
+	var err error
+	if h.config.TokenRefreshCommand != "" {
+		h.logger.Println("Access token rejected, running token refresh command")
+		token, err = runCommand(cmdCtx, h.config.TokenRefreshCommand)
+	} else {
+		token, err = h.readTokenSource(cmdCtx)
+	}
+	if err != nil {
+		h.logger.Printf("Token refresh failed: %v", err)
+		return false
+	}
+	if token == "" || token == failedToken {
+		h.logger.Println("Token refresh returned no new token")
+		return false
+	}
+
+	h.setToken(token)
+	h.logger.Println("Access token refreshed")
+	return true
+}
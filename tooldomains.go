@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Tools that only act on entities of these domains; with dynamic_tools they are hidden
+// while Home Assistant has none of them. Tools not listed are always offered.
+var toolDomains = map[string][]string{
+	"control_entity":            {"light", "switch"},
+	"control_multiple_entities": {"light", "switch"},
+	"create_scene_from_area":    {"light", "switch"},
+	"control_irrigation":        {"switch"},
+	"get_climate":               {"climate", "humidifier"},
+	"control_climate":           {"climate", "humidifier"},
+	"control_water_heater":      {"water_heater"},
+	"control_valve":             {"valve"},
+	"press_button":              {"button", "input_button"},
+	"control_siren":             {"siren"},
+	"send_remote_command":       {"remote"},
+	"set_entity_value":          {"number", "select", "text"},
+	"control_lawn_mower":        {"lawn_mower"},
+	"get_occupancy":             {"binary_sensor", "person"},
+	"get_person_summary":        {"person"},
+	"get_sun_info":              {"sun"},
+	"get_automation_trace":      {"automation", "script"},
+}
+
+// toolAvailability tracks which tools dynamic_tools currently hides
+type toolAvailability struct {
+	mu     sync.RWMutex
+	hidden map[string]bool
+}
+
+var dynamicTools = &toolAvailability{}
+
+func (t *toolAvailability) isHidden(tool string) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.hidden[tool]
+}
+
+func (t *toolAvailability) hiddenCount() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.hidden)
+}
+
+// update replaces the hidden tools and reports whether the set changed
+func (t *toolAvailability) update(hidden map[string]bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	changed := len(hidden) != len(t.hidden)
+	for tool := range hidden {
+		if !t.hidden[tool] {
+			changed = true
+		}
+	}
+	t.hidden = hidden
+	return changed
+}
+
+// refreshToolDomains hides the tools whose domains have no exposed entities and tells
+// connected clients when the tool list changed
+func (h *HAService) refreshToolDomains(ctx context.Context) error {
+	states, err := h.getRawStates(ctx, 0)
+	if err != nil {
+		return err
+	}
+	present := make(map[string]bool)
+	for _, state := range h.filterExposed(ctx, states) {
+		domain, _, _ := strings.Cut(state.EntityID, ".")
+		present[domain] = true
+	}
+
+	hidden := make(map[string]bool)
+	for tool, domains := range toolDomains {
+		if h.config.ReadOnly && containsString(writeTools, tool) {
+			continue // never registered
+		}
+		found := false
+		for _, domain := range domains {
+			if present[domain] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			hidden[tool] = true
+		}
+	}
+
+	if !dynamicTools.update(hidden) {
+		return nil
+	}
+	names := make([]string, 0, len(hidden))
+	for tool := range hidden {
+		names = append(names, tool)
+	}
+	sort.Strings(names)
+	h.logger.Printf("Tools without matching entities hidden: %v", names)
+
+	if h.mcpServer != nil {
+		h.mcpServer.SendNotificationToAllClients(mcp.MethodNotificationToolsListChanged, nil)
+	}
+	return nil
+}
+
+// unavailableToolError explains why a hidden tool can't be called
+func unavailableToolError(tool string) string {
+	return fmt.Sprintf("Tool %s is not available: Home Assistant has no %s entities", tool, strings.Join(toolDomains[tool], " or "))
+}
+
+// filterToolsForDomains hides tools from tools/list whose domains have no entities
+func filterToolsForDomains(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+	if dynamicTools.hiddenCount() == 0 {
+		return tools
+	}
+	var available []mcp.Tool
+	for _, tool := range tools {
+		if !dynamicTools.isHidden(tool.Name) {
+			available = append(available, tool)
+		}
+	}
+	return available
+}
+
+// dynamicToolsMiddleware rejects calls to hidden tools from clients with a stale tool list
+func dynamicToolsMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		if dynamicTools.isHidden(request.Params.Name) {
+			return mcp.NewToolResultError(unavailableToolError(request.Params.Name)), nil
+		}
+		return next(ctx, request)
+	}
+}
+
+// toolServer is the MCP server remembering which tools are registered, so the tool count
+// follows AddTool and DeleteTools instead of being kept by hand
+type toolServer struct {
+	*server.MCPServer
+	tools map[string]bool
+}
+
+func (s *toolServer) AddTool(tool mcp.Tool, handler server.ToolHandlerFunc) {
+	s.MCPServer.AddTool(tool, handler)
+	s.tools[tool.Name] = true
+}
+
+func (s *toolServer) DeleteTools(names ...string) {
+	s.MCPServer.DeleteTools(names...)
+	for _, name := range names {
+		delete(s.tools, name)
+	}
+}
+
+func (s *toolServer) toolCount() int {
+	return len(s.tools)
+}
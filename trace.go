@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Number of earlier runs listed next to the returned trace
+const traceRunsListed = 10
+
+// TraceSummary is one stored run of an automation or script, as returned by trace/list
+type TraceSummary struct {
+	RunID     string `json:"run_id"`
+	State     string `json:"state"`
+	Execution string `json:"script_execution,omitempty"` // finished, failed_conditions, error, ...
+	Trigger   string `json:"trigger,omitempty"`
+	LastStep  string `json:"last_step,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Timestamp struct {
+		Start  string `json:"start"`
+		Finish string `json:"finish,omitempty"`
+	} `json:"timestamp"`
+}
+
+// TraceStep is one executed step of a trace, keyed by its path in the config
+type TraceStep struct {
+	Path             string          `json:"path"`
+	Timestamp        string          `json:"timestamp"`
+	Result           json.RawMessage `json:"result,omitempty"`
+	Error            string          `json:"error,omitempty"`
+	ChangedVariables json.RawMessage `json:"changed_variables,omitempty"`
+}
+
+// AutomationTrace is the get_automation_trace response
+type AutomationTrace struct {
+	EntityID string          `json:"entity_id"`
+	Run      TraceSummary    `json:"run"`
+	Steps    []TraceStep     `json:"steps"`
+	Config   json.RawMessage `json:"config,omitempty"`
+	Runs     []TraceSummary  `json:"recent_runs"`
+}
+
+// traceItem maps an automation or script entity to the trace domain and item ID; automations
+// are traced by the id in their config, scripts by their object ID
+func (h *HAService) traceItem(ctx context.Context, entityID string) (string, string, error) {
+	domain, objectID, _ := strings.Cut(entityID, ".")
+	switch domain {
+	case "script":
+		return domain, objectID, nil
+	case "automation":
+		state, err := h.getEntityState(ctx, entityID, accessCheckMaxAge)
+		if err != nil {
+			return "", "", err
+		}
+		itemID := formatValue(state.Attributes["id"])
+		if itemID == "" {
+			return "", "", &InvalidRequestError{fmt.Sprintf("%s has no id in its configuration, so Home Assistant keeps no traces for it", entityID)}
+		}
+		return domain, itemID, nil
+	default:
+		return "", "", &InvalidRequestError{fmt.Sprintf("%s is not an automation or script", entityID)}
+	}
+}
+
+// getAutomationTrace returns one run's trace (the latest unless runID is set) and the
+// most recent runs
+func (h *HAService) getAutomationTrace(ctx context.Context, entityID, runID string, includeConfig bool) (*AutomationTrace, error) {
+	domain, itemID, err := h.traceItem(ctx, entityID)
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []TraceSummary
+	if err := h.ws.CommandInto(ctx, "trace/list", map[string]interface{}{"domain": domain, "item_id": itemID}, &runs); err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, &InvalidRequestError{fmt.Sprintf("no stored traces for %s", entityID)}
+	}
+
+	// Newest first
+	sort.Slice(runs, func(i, j int) bool {
+		return laterTimestamp(runs[i].Timestamp.Start, runs[j].Timestamp.Start)
+	})
+	if runID == "" {
+		runID = runs[0].RunID
+	}
+
+	var trace struct {
+		TraceSummary
+		Trace  map[string][]TraceStep `json:"trace"`
+		Config json.RawMessage        `json:"config"`
+	}
+	fields := map[string]interface{}{"domain": domain, "item_id": itemID, "run_id": runID}
+	if err := h.ws.CommandInto(ctx, "trace/get", fields, &trace); err != nil {
+		return nil, err
+	}
+
+	result := &AutomationTrace{
+		EntityID: entityID,
+		Run:      trace.TraceSummary,
+		Steps:    []TraceStep{},
+		Runs:     runs[:min(len(runs), traceRunsListed)],
+	}
+	if includeConfig {
+		result.Config = trace.Config
+	}
+	for path, steps := range trace.Trace {
+		for _, step := range steps {
+			step.Path = path
+			result.Steps = append(result.Steps, step)
+		}
+	}
+	sort.SliceStable(result.Steps, func(i, j int) bool {
+		return laterTimestamp(result.Steps[j].Timestamp, result.Steps[i].Timestamp)
+	})
+	return result, nil
+}
+
+// get_automation_trace handler
+func getAutomationTraceHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	entityID, err := haService.resolveDomainEntity(ctx, request, "automation", "script")
+	if err != nil {
+		return toolError("Failed to get trace", err), nil
+	}
+
+	trace, err := haService.getAutomationTrace(ctx, entityID, request.GetString("run_id", ""), request.GetBool("include_config", false))
+	if err != nil {
+		return toolError("Failed to get trace", err), nil
+	}
+
+	traceJSON, err := json.Marshal(trace)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to serialize trace: %v", err)), nil
+	}
+
+	started := trace.Run.Timestamp.Start
+	if t, err := time.Parse(time.RFC3339Nano, started); err == nil {
+		started = t.Local().Format(time.RFC1123)
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Trace of %s run %s (started %s, %s):\n%s",
+		entityID, trace.Run.RunID, started, trace.Run.Execution, string(traceJSON))), nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingConfig enables OpenTelemetry tracing of tool calls and the HA requests they make
+type TracingConfig struct {
+	Endpoint    string  `json:"endpoint,omitempty"`     // OTLP/HTTP collector, e.g. "http://otel-collector:4318"
+	ServiceName string  `json:"service_name,omitempty"` // defaults to ha-mcp-server
+	SampleRatio float64 `json:"sample_ratio,omitempty"` // fraction of tool calls traced, 0 means all
+}
+
+// tracer creates the spans; it is a no-op until startTracing installs a provider
+var tracer trace.Tracer = otel.Tracer("ha-mcp-server")
+
+// startTracing exports spans over OTLP/HTTP and returns a function flushing the remaining
+// ones on shutdown
+func startTracing(ctx context.Context, config TracingConfig) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(config.Endpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName := config.ServiceName
+	if serviceName == "" {
+		serviceName = "ha-mcp-server"
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(serverVersion),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if config.SampleRatio > 0 && config.SampleRatio < 1 {
+		sampler = sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+	)
+	otel.SetTracerProvider(provider)
+	tracer = provider.Tracer("ha-mcp-server")
+	return provider.Shutdown, nil
+}
+
+// endSpan records err on span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracingMiddleware wraps each tool call in a span; the HA requests made by the handler
+// become its children
+func tracingMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, span := tracer.Start(ctx, "tool "+request.Params.Name, trace.WithAttributes(
+			attribute.String("mcp.tool", request.Params.Name),
+		))
+		start := time.Now()
+
+		result, err := next(ctx, request)
+		span.SetAttributes(attribute.Int64("mcp.duration_ms", time.Since(start).Milliseconds()))
+		if err == nil && result != nil && result.IsError {
+			span.SetAttributes(attribute.Bool("mcp.tool_error", true))
+			span.SetStatus(codes.Error, "tool returned an error")
+		}
+		endSpan(span, err)
+		return result, err
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	transportStdio = "stdio"
+	transportSSE   = "sse"
+	transportHTTP  = "http"
+)
+
+// ServerConfig secures the sse and http transports
+type ServerConfig struct {
+	APIKey       string `json:"api_key,omitempty"`        // static key accepted with full access
+	TLSCert      string `json:"tls_cert,omitempty"`       // serve HTTPS with this certificate
+	TLSKey       string `json:"tls_key,omitempty"`        // and key
+	ClientCAFile string `json:"client_ca_file,omitempty"` // require client certificates signed by this CA (mTLS)
+}
+
+// checkServerConfig verifies the HTTP transports are secured before they start listening
+func (h *HAService) checkServerConfig() error {
+	cfg := h.config.Server
+	if cfg.APIKey == "" && cfg.ClientCAFile == "" && len(h.profiles) == 0 {
+		return fmt.Errorf("the sse and http transports require server.api_key, server.client_ca_file or profiles")
+	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return fmt.Errorf("server.tls_cert and server.tls_key must be set together")
+	}
+	if cfg.ClientCAFile != "" && cfg.TLSCert == "" {
+		return fmt.Errorf("server.client_ca_file requires server.tls_cert and server.tls_key")
+	}
+	return nil
+}
+
+// serverTLSConfig returns the TLS settings for the HTTP transports, nil for plain HTTP
+func (h *HAService) serverTLSConfig() (*tls.Config, error) {
+	cfg := h.config.Server
+	if cfg.TLSCert == "" {
+		return nil, nil
+	}
+
+	certFile := h.resolvePath(cfg.TLSCert)
+	keyFile := h.resolvePath(cfg.TLSKey)
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate %s: %v", certFile, err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.ClientCAFile != "" {
+		caFile := h.resolvePath(cfg.ClientCAFile)
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file %s: %v", caFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificates found in client CA file %s", caFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		h.logger.Printf("Requiring client certificates signed by %s", caFile)
+	}
+	return tlsConfig, nil
+}
+
+// isStaticAPIKey reports whether key is the configured server.api_key
+func (h *HAService) isStaticAPIKey(key string) bool {
+	return h.config.Server.APIKey != "" && key != "" &&
+		subtle.ConstantTimeCompare([]byte(h.config.Server.APIKey), []byte(key)) == 1
+}
+
+// requireAPIKey rejects requests without server.api_key or a profile key; with only mTLS
+// configured the verified client certificate is enough
+func (h *HAService) requireAPIKey(next http.Handler) http.Handler {
+	if h.config.Server.APIKey == "" && len(h.profiles) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := apiKeyFromRequest(r)
+		if !h.isStaticAPIKey(key) && h.profileForKey(key) == nil {
+			h.logger.Printf("Rejected unauthenticated %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="ha-mcp-server"`)
+			http.Error(w, "missing or invalid API key", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serve runs the MCP server on the selected transport until it stops
+func serve(s *server.MCPServer, transport, listenAddr string) error {
+	if transport == transportStdio {
+		return serveStdio(s)
+	}
+
+	if err := haService.checkServerConfig(); err != nil {
+		return err
+	}
+	tlsConfig, err := haService.serverTLSConfig()
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	if transport == transportSSE {
+		mux.Handle("/", haService.requireAPIKey(sseCompletionHandler(server.NewSSEServer(s, server.WithSSEContextFunc(haService.profileContextFunc)))))
+	} else {
+		mux.Handle("/mcp", haService.requireAPIKey(completionHandler(server.NewStreamableHTTPServer(s, server.WithHTTPContextFunc(haService.profileContextFunc)))))
+	}
+
+	httpServer := &http.Server{
+		Addr:      listenAddr,
+		Handler:   mux,
+		TLSConfig: tlsConfig,
+	}
+	if tlsConfig != nil {
+		haService.logger.Printf("Serving MCP over HTTPS on %s", listenAddr)
+		return httpServer.ListenAndServeTLS("", "")
+	}
+	haService.logger.Printf("Serving MCP over plain HTTP on %s", listenAddr)
+	return httpServer.ListenAndServe()
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Unit systems that responses can be converted to
+const (
+	unitsMetric   = "metric"
+	unitsImperial = "imperial"
+)
+
+// Quantities converted between unit systems
+const (
+	quantityTemperature = "temperature"
+	quantityPressure    = "pressure"
+	quantitySpeed       = "wind_speed"
+)
+
+// Attributes holding a quantity expressed in HA's configured unit system
+var attributeQuantities = map[string]string{
+	"temperature":         quantityTemperature,
+	"current_temperature": quantityTemperature,
+	"target_temp_high":    quantityTemperature,
+	"target_temp_low":     quantityTemperature,
+	"min_temp":            quantityTemperature,
+	"max_temp":            quantityTemperature,
+	"pressure":            quantityPressure,
+	"wind_speed":          quantitySpeed,
+	"wind_gust_speed":     quantitySpeed,
+}
+
+// Display units per target unit system
+var targetUnits = map[string]map[string]string{
+	unitsMetric: {
+		quantityTemperature: "°C",
+		quantityPressure:    "hPa",
+		quantitySpeed:       "km/h",
+	},
+	unitsImperial: {
+		quantityTemperature: "°F",
+		quantityPressure:    "psi",
+		quantitySpeed:       "mph",
+	},
+}
+
+// Linear units as factor to the base unit (Pa for pressure, m/s for speed)
+var unitFactors = map[string]struct {
+	quantity string
+	factor   float64
+}{
+	"Pa":   {quantityPressure, 1},
+	"hPa":  {quantityPressure, 100},
+	"mbar": {quantityPressure, 100},
+	"kPa":  {quantityPressure, 1000},
+	"bar":  {quantityPressure, 100000},
+	"psi":  {quantityPressure, 6894.757},
+	"inHg": {quantityPressure, 3386.389},
+	"mmHg": {quantityPressure, 133.322},
+	"m/s":  {quantitySpeed, 1},
+	"km/h": {quantitySpeed, 1 / 3.6},
+	"mph":  {quantitySpeed, 0.44704},
+	"kn":   {quantitySpeed, 0.514444},
+	"ft/s": {quantitySpeed, 0.3048},
+}
+
+// convertUnit converts value between two units of the same quantity
+func convertUnit(value float64, from, to string) (float64, bool) {
+	if from == to {
+		return value, true
+	}
+
+	switch {
+	case from == "°C" && to == "°F":
+		return value*9/5 + 32, true
+	case from == "°F" && to == "°C":
+		return (value - 32) * 5 / 9, true
+	}
+
+	fromUnit, fromOK := unitFactors[from]
+	toUnit, toOK := unitFactors[to]
+	if !fromOK || !toOK || fromUnit.quantity != toUnit.quantity {
+		return 0, false
+	}
+	return value * fromUnit.factor / toUnit.factor, true
+}
+
+// getUnitSystem reads HA's unit system from /api/config once and caches it
+func (h *HAService) getUnitSystem(ctx context.Context) (map[string]string, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.unitSystem != nil {
+		return h.unitSystem, nil
+	}
+
+	resp, err := h.makeHARequest(ctx, "GET", "/api/config", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("HA API returned status %d for config", resp.StatusCode)
+	}
+
+	var haConfig struct {
+		UnitSystem map[string]string `json:"unit_system"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&haConfig); err != nil {
+		return nil, err
+	}
+
+	h.unitSystem = haConfig.UnitSystem
+	h.logger.Printf("HA unit system: %v", h.unitSystem)
+	return h.unitSystem, nil
+}
+
+// convertUnits returns copies of states with temperature, pressure and speed values
+// converted to the target unit system. Attributes use HA's configured units, the
+// state itself is converted when it carries a unit_of_measurement.
+func (h *HAService) convertUnits(ctx context.Context, states []HAState, target string) ([]HAState, error) {
+	units, exists := targetUnits[target]
+	if !exists {
+		return nil, fmt.Errorf("unsupported unit system: %s", target)
+	}
+
+	source, err := h.getUnitSystem(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read HA unit system: %v", err)
+	}
+
+	result := make([]HAState, len(states))
+	for i, state := range states {
+		attributes := make(map[string]interface{}, len(state.Attributes))
+		for key, value := range state.Attributes {
+			attributes[key] = value
+
+			quantity, known := attributeQuantities[key]
+			number, isNumber := value.(float64)
+			if !known || !isNumber {
+				continue
+			}
+			if converted, ok := convertUnit(number, source[quantity], units[quantity]); ok {
+				attributes[key] = roundTo(converted, 1)
+			}
+		}
+
+		if from, ok := attributes["unit_of_measurement"].(string); ok {
+			var number float64
+			if _, err := fmt.Sscanf(state.State, "%g", &number); err == nil {
+				for _, to := range units {
+					if converted, ok := convertUnit(number, from, to); ok && from != to {
+						state.State = fmt.Sprint(roundTo(converted, 1))
+						attributes["unit_of_measurement"] = to
+						break
+					}
+				}
+			}
+		}
+
+		state.Attributes = attributes
+		result[i] = state
+	}
+	return result, nil
+}
+
+func roundTo(value float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(value*p) / p
+}
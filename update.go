@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Latest release of the bridge on GitHub
+const releasesURL = "https://api.github.com/repos/jrydval/MCP-HomeAssistant-Server-for-N8N-in-Golang/releases/latest"
+
+// How long the startup update check may take
+const updateCheckTimeout = 10 * time.Second
+
+// UpdateStatus is the result of the startup update check
+type UpdateStatus struct {
+	LatestVersion   string `json:"latest_version,omitempty"`
+	UpdateAvailable bool   `json:"update_available"`
+	ReleaseURL      string `json:"release_url,omitempty"`
+	CheckedAt       string `json:"checked_at,omitempty"`
+	Error           string `json:"error,omitempty"`
+}
+
+var (
+	updateMu     sync.Mutex
+	updateStatus *UpdateStatus // nil until a check finished, or when checks are disabled
+)
+
+// currentUpdateStatus returns the result of the last update check, if any
+func currentUpdateStatus() *UpdateStatus {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+	return updateStatus
+}
+
+// compareVersions compares dotted versions such as "v2.1.0" and "2.0.0" numerically,
+// ignoring a leading v and pre-release suffixes; it returns -1, 0 or 1
+func compareVersions(a, b string) int {
+	parts := func(v string) []int {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+		v, _, _ = strings.Cut(v, "-")
+		var numbers []int
+		for _, field := range strings.Split(v, ".") {
+			n, _ := strconv.Atoi(field)
+			numbers = append(numbers, n)
+		}
+		return numbers
+	}
+
+	pa, pb := parts(a), parts(b)
+	for i := 0; i < max(len(pa), len(pb)); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// checkForUpdate asks GitHub for the latest release; it never talks to Home Assistant, so it
+// uses its own client instead of the HA one with its TLS settings
+func (h *HAService) checkForUpdate(ctx context.Context) *UpdateStatus {
+	status := &UpdateStatus{CheckedAt: time.Now().Format(time.RFC3339)}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", releasesURL, nil)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "ha-mcp-server/"+serverVersion)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		status.Error = fmt.Sprintf("GitHub returned status %d", resp.StatusCode)
+		return status
+	}
+
+	var release struct {
+		TagName string `json:"tag_name"`
+		HTMLURL string `json:"html_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		status.Error = err.Error()
+		return status
+	}
+
+	status.LatestVersion = strings.TrimPrefix(release.TagName, "v")
+	status.ReleaseURL = release.HTMLURL
+	status.UpdateAvailable = compareVersions(release.TagName, serverVersion) > 0
+	return status
+}
+
+// startUpdateCheck checks for a newer release in the background, unless disabled
+func (h *HAService) startUpdateCheck() {
+	if h.config.DisableUpdateCheck {
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), updateCheckTimeout)
+		defer cancel()
+
+		status := h.checkForUpdate(ctx)
+		switch {
+		case status.Error != "":
+			h.logger.Printf("Update check failed: %s", status.Error)
+		case status.UpdateAvailable:
+			h.logger.Printf("A newer version is available: %s (running %s), see %s", status.LatestVersion, serverVersion, status.ReleaseURL)
+		default:
+			h.logger.Printf("Running the latest version (%s)", serverVersion)
+		}
+
+		updateMu.Lock()
+		updateStatus = status
+		updateMu.Unlock()
+	}()
+}
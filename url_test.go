@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeBaseURL(t *testing.T) {
+	tests := []struct {
+		haURL   string
+		want    string
+		wantErr bool
+	}{
+		{haURL: "http://homeassistant.local:8123", want: "http://homeassistant.local:8123"},
+		{haURL: "http://homeassistant.local:8123/", want: "http://homeassistant.local:8123"},
+		{haURL: " http://homeassistant.local:8123/api ", want: "http://homeassistant.local:8123"},
+		{haURL: "http://homeassistant.local:8123/api/", want: "http://homeassistant.local:8123"},
+		{haURL: "https://example.com/ha", want: "https://example.com/ha"},
+		{haURL: "https://example.com/ha/", want: "https://example.com/ha"},
+		{haURL: "https://example.com/ha//", want: "https://example.com/ha"},
+		{haURL: "https://example.com/ha/api", want: "https://example.com/ha"},
+		{haURL: "https://example.com/ha/api/", want: "https://example.com/ha"},
+		{haURL: "https://example.com/apiary", want: "https://example.com/apiary"},
+		{haURL: "https://example.com/ha/?token=x#frag", want: "https://example.com/ha"},
+		{haURL: "ftp://example.com", wantErr: true},
+		{haURL: "example.com:8123", wantErr: true},
+		{haURL: "http://", wantErr: true},
+		{haURL: "http://exa mple.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeBaseURL(tt.haURL)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("normalizeBaseURL(%q) = %q, want an error", tt.haURL, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("normalizeBaseURL(%q) failed: %v", tt.haURL, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("normalizeBaseURL(%q) = %q, want %q", tt.haURL, got, tt.want)
+		}
+	}
+}
+
+func TestBuildWebSocketURL(t *testing.T) {
+	tests := []struct {
+		haURL   string
+		wsURL   string
+		want    string
+		wantErr bool
+	}{
+		{haURL: "http://homeassistant.local:8123", want: "ws://homeassistant.local:8123/api/websocket"},
+		{haURL: "https://example.com", want: "wss://example.com/api/websocket"},
+		{haURL: "https://example.com/ha", want: "wss://example.com/ha/api/websocket"},
+		{haURL: "https://example.com/ha/", want: "wss://example.com/ha/api/websocket"},
+		{haURL: "https://example.com/ha", wsURL: "wss://ws.example.com/custom", want: "wss://ws.example.com/custom"},
+		{haURL: "https://example.com", wsURL: "https://example.com/api/websocket", wantErr: true},
+		{haURL: "ftp://example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := buildWebSocketURL(tt.haURL, tt.wsURL)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("buildWebSocketURL(%q, %q) = %q, want an error", tt.haURL, tt.wsURL, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("buildWebSocketURL(%q, %q) failed: %v", tt.haURL, tt.wsURL, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("buildWebSocketURL(%q, %q) = %q, want %q", tt.haURL, tt.wsURL, got, tt.want)
+		}
+	}
+}
+
+// A normalized ha_url behind a reverse proxy path prefix reaches the REST API and the
+// WebSocket under that prefix, however the prefix was written
+func TestPathPrefixURLs(t *testing.T) {
+	var requested string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		w.Write([]byte("{}"))
+	}))
+	defer ts.Close()
+
+	for _, haURL := range []string{ts.URL + "/ha", ts.URL + "/ha/", ts.URL + "/ha/api", ts.URL + "/ha/api/"} {
+		normalized, err := normalizeBaseURL(haURL)
+		if err != nil {
+			t.Fatalf("normalizeBaseURL(%q) failed: %v", haURL, err)
+		}
+
+		h := NewHAService()
+		h.config.HAURL = normalized
+		resp, err := h.makeHARequest(context.Background(), "GET", "/api/config", nil)
+		if err != nil {
+			t.Fatalf("request with ha_url %q failed: %v", haURL, err)
+		}
+		resp.Body.Close()
+		if requested != "/ha/api/config" {
+			t.Errorf("ha_url %q requested %s, want /ha/api/config", haURL, requested)
+		}
+
+		wsURL, err := buildWebSocketURL(normalized, "")
+		if err != nil {
+			t.Fatalf("buildWebSocketURL(%q) failed: %v", normalized, err)
+		}
+		if want := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ha/api/websocket"; wsURL != want {
+			t.Errorf("ha_url %q derived WebSocket URL %s, want %s", haURL, wsURL, want)
+		}
+	}
+}
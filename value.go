@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// validateNumber checks value against a number entity's min, max and step attributes
+func validateNumber(state *HAState, value float64) error {
+	min, hasMin := state.Attributes["min"].(float64)
+	max, hasMax := state.Attributes["max"].(float64)
+	if (hasMin && value < min) || (hasMax && value > max) {
+		return &InvalidRequestError{fmt.Sprintf("value %v for %s is outside %v..%v", value, state.EntityID, min, max)}
+	}
+	if step, ok := state.Attributes["step"].(float64); ok && step > 0 {
+		// Steps count from min; allow for float rounding
+		steps := (value - min) / step
+		if math.Abs(steps-math.Round(steps)) > 1e-6 {
+			return &InvalidRequestError{fmt.Sprintf("value %v for %s is not a multiple of step %v from %v", value, state.EntityID, step, min)}
+		}
+	}
+	return nil
+}
+
+// validateText checks value against a text entity's min, max (length) and pattern attributes
+func validateText(state *HAState, value string) error {
+	length := float64(utf8.RuneCountInString(value))
+	if min, ok := state.Attributes["min"].(float64); ok && length < min {
+		return &InvalidRequestError{fmt.Sprintf("text for %s must be at least %v characters", state.EntityID, min)}
+	}
+	if max, ok := state.Attributes["max"].(float64); ok && length > max {
+		return &InvalidRequestError{fmt.Sprintf("text for %s must be at most %v characters", state.EntityID, max)}
+	}
+	if pattern, ok := state.Attributes["pattern"].(string); ok && pattern != "" {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err == nil && !re.MatchString(value) {
+			return &InvalidRequestError{fmt.Sprintf("text for %s must match %s", state.EntityID, pattern)}
+		}
+	}
+	return nil
+}
+
+// valueStep validates value for a number, select or text entity and returns the service
+// call that sets it
+func valueStep(state *HAState, value interface{}) (serviceStep, error) {
+	text := formatValue(value)
+	domain, _, _ := strings.Cut(state.EntityID, ".")
+
+	switch domain {
+	case "number":
+		number, ok := value.(float64)
+		if !ok {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+			if err != nil {
+				return serviceStep{}, &InvalidRequestError{fmt.Sprintf("value %q for %s is not a number", text, state.EntityID)}
+			}
+			number = parsed
+		}
+		if err := validateNumber(state, number); err != nil {
+			return serviceStep{}, err
+		}
+		return serviceStep{service: "set_value", data: map[string]interface{}{"value": number}}, nil
+	case "select":
+		if err := checkMode(state, "option", "options", text); err != nil {
+			return serviceStep{}, err
+		}
+		return serviceStep{service: "select_option", data: map[string]interface{}{"option": text}}, nil
+	default:
+		if err := validateText(state, text); err != nil {
+			return serviceStep{}, err
+		}
+		return serviceStep{service: "set_value", data: map[string]interface{}{"value": text}}, nil
+	}
+}
+
+// set_entity_value handler
+func setEntityValueHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	entityID, err := haService.resolveDomainEntity(ctx, request, "number", "select", "text")
+	if err != nil {
+		return toolError("Failed to set value", err), nil
+	}
+
+	value, ok := request.GetArguments()["value"]
+	if !ok || value == nil {
+		return mcp.NewToolResultError("value parameter is required"), nil
+	}
+
+	state, err := haService.fetchEntityState(ctx, entityID, 0)
+	if err != nil {
+		return toolError("Failed to get entity state", err), nil
+	}
+
+	step, err := valueStep(state, value)
+	if err != nil {
+		return toolError("Failed to set value", err), nil
+	}
+
+	domain, _, _ := strings.Cut(entityID, ".")
+	result := runServiceCalls(ctx, domain, entityID, []serviceStep{step}, "Failed to set value")
+	if result.IsError {
+		return result, nil
+	}
+	return mcp.NewToolResultText(localize(ctx, "Successfully set %s to %s", entityID, formatValue(value))), nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// How long control_entity waits for a verified state change, and how often it re-reads it
+const (
+	verifyTimeout  = 3 * time.Second
+	verifyInterval = 250 * time.Millisecond
+)
+
+// StateSnapshot is the state of an entity at one point of a control call
+type StateSnapshot struct {
+	State       string `json:"state"`
+	LastChanged string `json:"last_changed"`
+}
+
+// StateTransition is the control_entity response: the state before the call and, when
+// verification is on, the state after it
+type StateTransition struct {
+	EntityID string         `json:"entity_id"`
+	Action   string         `json:"action"`
+	Previous *StateSnapshot `json:"previous_state,omitempty"`
+	Current  *StateSnapshot `json:"new_state,omitempty"`
+	Verified *bool          `json:"verified,omitempty"` // new_state reached the requested state
+}
+
+func snapshotOf(state *HAState) *StateSnapshot {
+	return &StateSnapshot{State: state.State, LastChanged: state.LastChanged}
+}
+
+// waitForState re-reads entityID from HA until it reports want or verifyTimeout passes, and
+// returns the last state read
+func (h *HAService) waitForState(ctx context.Context, entityID, want string) (*HAState, bool, error) {
+	deadline := time.Now().Add(verifyTimeout)
+	for {
+		state, err := h.fetchEntityState(ctx, entityID, 0)
+		if err != nil {
+			return nil, false, err
+		}
+		if state.State == want || time.Now().After(deadline) {
+			return state, state.State == want, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return state, false, ctx.Err()
+		case <-time.After(verifyInterval):
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// valve.* supported_features bit for set_valve_position
+const valveFeatureSetPosition = 4
+
+// resolveDomainEntity resolves an entity_id argument (aliases allowed) and checks that it
+// belongs to one of domains and is exposed
+func (h *HAService) resolveDomainEntity(ctx context.Context, request mcp.CallToolRequest, domains ...string) (string, error) {
+	entityID, err := request.RequireString("entity_id")
+	if err != nil {
+		return "", &InvalidRequestError{"entity_id parameter is required"}
+	}
+	entityID, err = h.canonicalEntityID(entityID)
+	if err != nil {
+		return "", err
+	}
+	if domain, _, _ := strings.Cut(entityID, "."); !containsString(domains, domain) {
+		return "", &InvalidRequestError{fmt.Sprintf("%s is not a %s entity", entityID, strings.Join(domains, " or "))}
+	}
+	if err := h.checkEntityAccess(ctx, entityID); err != nil {
+		return "", err
+	}
+	return entityID, nil
+}
+
+// control_water_heater handler
+func controlWaterHeaterHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	entityID, err := haService.resolveDomainEntity(ctx, request, "water_heater")
+	if err != nil {
+		return toolError("Failed to control water heater", err), nil
+	}
+	args := request.GetArguments()
+
+	var calls []serviceStep
+	switch action := request.GetString("action", ""); action {
+	case "":
+	case "on", "turn_on":
+		calls = append(calls, serviceStep{service: "turn_on"})
+	case "off", "turn_off":
+		calls = append(calls, serviceStep{service: "turn_off"})
+	default:
+		return mcp.NewToolResultError(fmt.Sprintf("Unsupported action: %s", action)), nil
+	}
+
+	if mode := request.GetString("operation_mode", ""); mode != "" {
+		state, err := haService.fetchEntityState(ctx, entityID, 0)
+		if err != nil {
+			return toolError("Failed to get entity state", err), nil
+		}
+		if err := checkMode(state, "operation_mode", "operation_list", mode); err != nil {
+			return toolError("Failed to control water heater", err), nil
+		}
+		calls = append(calls, serviceStep{service: "set_operation_mode", data: map[string]interface{}{"operation_mode": mode}})
+	}
+	if _, ok := args["away_mode"]; ok {
+		calls = append(calls, serviceStep{service: "set_away_mode", data: map[string]interface{}{"away_mode": request.GetBool("away_mode", false)}})
+	}
+	if _, ok := args["temperature"]; ok {
+		calls = append(calls, serviceStep{service: "set_temperature", data: map[string]interface{}{"temperature": request.GetFloat("temperature", 0)}})
+	}
+	if len(calls) == 0 {
+		return mcp.NewToolResultError("Nothing to change: give an action, operation_mode, away_mode or temperature"), nil
+	}
+
+	return runServiceCalls(ctx, "water_heater", entityID, calls, "Failed to control water heater"), nil
+}
+
+// control_valve handler
+func controlValveHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	entityID, err := haService.resolveDomainEntity(ctx, request, "valve")
+	if err != nil {
+		return toolError("Failed to control valve", err), nil
+	}
+
+	var call serviceStep
+	switch action := request.GetString("action", ""); action {
+	case "open":
+		call.service = "open_valve"
+	case "close":
+		call.service = "close_valve"
+	case "stop":
+		call.service = "stop_valve"
+	case "set_position":
+		if _, ok := request.GetArguments()["position"]; !ok {
+			return mcp.NewToolResultError("position parameter is required for set_position"), nil
+		}
+		state, err := haService.fetchEntityState(ctx, entityID, 0)
+		if err != nil {
+			return toolError("Failed to get entity state", err), nil
+		}
+		features, _ := state.Attributes["supported_features"].(float64)
+		if int(features)&valveFeatureSetPosition == 0 {
+			return mcp.NewToolResultError(fmt.Sprintf("%s can only be opened and closed, not set to a position", entityID)), nil
+		}
+		call = serviceStep{service: "set_valve_position", data: map[string]interface{}{"position": request.GetInt("position", 0)}}
+	case "":
+		return mcp.NewToolResultError("action parameter is required"), nil
+	default:
+		return mcp.NewToolResultError(fmt.Sprintf("Unsupported action: %s", action)), nil
+	}
+
+	return runServiceCalls(ctx, "valve", entityID, []serviceStep{call}, "Failed to control valve"), nil
+}
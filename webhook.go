@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultWebhookRetries = 3
+	webhookQueueSize      = 256
+	webhookTimeout        = 10 * time.Second
+)
+
+// WebhookConfig forwards matching HA events to an HTTP endpoint such as an n8n webhook
+type WebhookConfig struct {
+	URL      string   `json:"url"`
+	Events   []string `json:"events,omitempty"`   // event types, default state_changed
+	Entities []string `json:"entities,omitempty"` // entity ID patterns for state_changed, all when empty
+	Domains  []string `json:"domains,omitempty"`  // entity domains for state_changed, all when empty
+	Secret   string   `json:"secret,omitempty"`   // signs the body as X-Signature-256: sha256=<hmac>
+	Retries  *int     `json:"retries,omitempty"`  // extra attempts after a failed delivery, default 3
+}
+
+// HA event as delivered over the WebSocket subscription
+type haEvent struct {
+	EventType string          `json:"event_type"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// webhook is a compiled WebhookConfig with its delivery queue
+type webhook struct {
+	config   WebhookConfig
+	entities []entityPattern
+	retries  int
+	queue    chan []byte
+}
+
+// Webhooks subscribes to the configured event types and delivers matching events
+type Webhooks struct {
+	service  *HAService
+	client   *http.Client
+	webhooks []*webhook
+}
+
+func newWebhooks(h *HAService, configs []WebhookConfig) (*Webhooks, error) {
+	w := &Webhooks{
+		service: h,
+		client:  &http.Client{Timeout: webhookTimeout},
+	}
+
+	for i, config := range configs {
+		if u, err := url.Parse(config.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("webhooks[%d]: url must be an http or https URL", i)
+		}
+		if len(config.Events) == 0 {
+			config.Events = []string{"state_changed"}
+		}
+		for _, eventType := range config.Events {
+			if strings.TrimSpace(eventType) == "" {
+				return nil, fmt.Errorf("webhooks[%d]: events must not contain empty event types", i)
+			}
+		}
+
+		entities, err := compilePatterns(fmt.Sprintf("webhooks[%d].entities", i), config.Entities)
+		if err != nil {
+			return nil, err
+		}
+
+		retries := defaultWebhookRetries
+		if config.Retries != nil {
+			retries = max(*config.Retries, 0)
+		}
+
+		w.webhooks = append(w.webhooks, &webhook{
+			config:   config,
+			entities: entities,
+			retries:  retries,
+			queue:    make(chan []byte, webhookQueueSize),
+		})
+	}
+	return w, nil
+}
+
+// Start runs one delivery worker per webhook and one subscription per event type
+func (w *Webhooks) Start(ctx context.Context) {
+	var eventTypes []string
+	for _, hook := range w.webhooks {
+		go w.deliver(ctx, hook)
+		for _, eventType := range hook.config.Events {
+			if !containsString(eventTypes, eventType) {
+				eventTypes = append(eventTypes, eventType)
+			}
+		}
+	}
+
+	for _, eventType := range eventTypes {
+		go w.service.ws.Subscribe(ctx, eventType, w.dispatch)
+	}
+	w.service.logger.Printf("Webhooks started: %d targets, event types %v", len(w.webhooks), eventTypes)
+}
+
+// dispatch queues an event for every webhook it matches; it runs on the WebSocket reader
+// so a full queue drops the event instead of blocking
+func (w *Webhooks) dispatch(raw json.RawMessage) {
+	var event haEvent
+	if err := json.Unmarshal(raw, &event); err != nil {
+		w.service.logger.Printf("Failed to parse event: %v", err)
+		return
+	}
+
+	var entityID string
+	if event.EventType == "state_changed" {
+		var data struct {
+			EntityID string   `json:"entity_id"`
+			NewState *HAState `json:"new_state"`
+			OldState *HAState `json:"old_state"`
+		}
+		json.Unmarshal(event.Data, &data)
+		entityID = data.EntityID
+
+		// Never leak entities the server's filters hide
+		state := data.NewState
+		if state == nil {
+			state = data.OldState
+		}
+		if !w.service.stateEventExposed(entityID, state) {
+			return
+		}
+	}
+
+	for _, hook := range w.webhooks {
+		if !hook.matches(event.EventType, entityID) {
+			continue
+		}
+		select {
+		case hook.queue <- raw:
+		default:
+			w.service.logger.Printf("Webhook queue for %s is full, dropping %s event", hook.config.URL, event.EventType)
+		}
+	}
+}
+
+func (hook *webhook) matches(eventType, entityID string) bool {
+	if !containsString(hook.config.Events, eventType) {
+		return false
+	}
+	if eventType != "state_changed" {
+		return true
+	}
+	if len(hook.entities) > 0 && !matchesAny(hook.entities, entityID) {
+		return false
+	}
+	if len(hook.config.Domains) > 0 {
+		domain, _, _ := strings.Cut(entityID, ".")
+		return containsString(hook.config.Domains, domain)
+	}
+	return true
+}
+
+// deliver POSTs queued events in order, retrying failures with a growing pause
+func (w *Webhooks) deliver(ctx context.Context, hook *webhook) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case body := <-hook.queue:
+			for attempt := 0; ; attempt++ {
+				retry, err := w.post(ctx, hook, body)
+				if err == nil {
+					break
+				}
+				w.service.logger.Printf("Webhook delivery to %s failed (attempt %d): %v", hook.config.URL, attempt+1, err)
+				if !retry || attempt >= hook.retries {
+					w.service.logger.Printf("Giving up on webhook delivery to %s", hook.config.URL)
+					break
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Duration(1<<attempt) * time.Second):
+				}
+			}
+		}
+	}
+}
+
+// post sends one delivery and reports whether a failure is worth retrying
+func (w *Webhooks) post(ctx context.Context, hook *webhook, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", hook.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ha-mcp-server/"+serverVersion)
+	if hook.config.Secret != "" {
+		req.Header.Set("X-Signature-256", "sha256="+signPayload(hook.config.Secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		// Client errors other than timeouts and rate limiting won't go away by retrying
+		retry := resp.StatusCode >= 500 || resp.StatusCode == 408 || resp.StatusCode == 429
+		return retry, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return false, nil
+}
+
+// signPayload returns the hex HMAC-SHA256 of body, as GitHub-style webhooks do
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
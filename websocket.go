@@ -0,0 +1,434 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// How often an idle connection is pinged; a connection that doesn't answer within the
+// read timeout after that is considered dead
+const wsPingInterval = 30 * time.Second
+
+// Response to a WebSocket command
+type wsResponse struct {
+	ID      int             `json:"id"`
+	Type    string          `json:"type"`
+	Success bool            `json:"success"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Event   json.RawMessage `json:"event,omitempty"`
+	Error   *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// Shared, authenticated WebSocket connection to HA. Commands get unique IDs from an
+// atomic counter and a single reader routes each response to its caller by ID, so any
+// number of commands can run concurrently over one connection. Events for
+// subscriptions are routed the same way, by the ID of their subscribe command.
+type WSClient struct {
+	service *HAService
+	nextID  atomic.Int64
+
+	mu            sync.Mutex // guards conn, dialing, lastErr, pending, subscriptions and closed
+	conn          *websocket.Conn
+	dialing       *wsDial // the dial in progress, which other callers wait for
+	lastErr       error   // why the last dial failed or the connection dropped
+	pending       map[int]chan wsResponse
+	subscriptions map[int]func(json.RawMessage)
+	closed        chan struct{} // closed when conn drops
+
+	writeMu sync.Mutex // gorilla/websocket allows one concurrent writer
+}
+
+func (c *WSClient) dialAndAuthenticate(ctx context.Context) (*websocket.Conn, error) {
+	conn, err := c.service.openWebSocket(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(c.service.readTimeout))
+	if err := c.service.authenticateWebSocket(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Time{})
+	return conn, nil
+}
+
+// wsDial is a dial in progress; err is set when done is closed
+type wsDial struct {
+	done chan struct{}
+	err  error
+}
+
+// connect returns the shared connection, dialing and authenticating it if needed. The
+// dial runs outside mu, and concurrent callers wait for it instead of dialing again.
+func (c *WSClient) connect(ctx context.Context) (*websocket.Conn, error) {
+	for {
+		c.mu.Lock()
+		if c.conn != nil {
+			conn := c.conn
+			c.mu.Unlock()
+			return conn, nil
+		}
+		dialing := c.dialing
+		if dialing == nil {
+			break // dial ourselves, still holding mu
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-dialing.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// Another caller's cancelled dial says nothing about ours, so try again
+		if dialing.err != nil && !errors.Is(dialing.err, context.Canceled) && !errors.Is(dialing.err, context.DeadlineExceeded) {
+			return nil, dialing.err
+		}
+	}
+
+	dialing := &wsDial{done: make(chan struct{})}
+	c.dialing = dialing
+	c.mu.Unlock()
+
+	// Remember the token used so a concurrent refresh isn't repeated
+	token := c.service.token()
+
+	conn, err := c.dialAndAuthenticate(ctx)
+	var unauthorizedErr *UnauthorizedError
+	if errors.As(err, &unauthorizedErr) && c.service.refreshToken(ctx, token) {
+		conn, err = c.dialAndAuthenticate(ctx)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dialing = nil
+	dialing.err = err
+	close(dialing.done)
+	if err != nil {
+		c.lastErr = err
+		return nil, err
+	}
+	c.lastErr = nil
+
+	c.service.logger.Println("WebSocket authentication successful")
+
+	c.conn = conn
+	c.pending = make(map[int]chan wsResponse)
+	c.subscriptions = make(map[int]func(json.RawMessage))
+	c.closed = make(chan struct{})
+	go c.readLoop(conn)
+	go c.keepAlive(conn, c.closed)
+	return conn, nil
+}
+
+// keepAlive pings conn until it drops, so that a half-open connection fails the reader's
+// deadline instead of looking connected forever
+func (c *WSClient) keepAlive(conn *websocket.Conn, closed <-chan struct{}) {
+	ticker := time.NewTicker(wsPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+		}
+		if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.service.requestTimeout)); err != nil {
+			c.service.logger.Printf("WebSocket ping failed: %v", err)
+			c.drop(conn, err)
+			return
+		}
+	}
+}
+
+// readLoop routes frames until the connection fails. Nothing assumes the next frame
+// answers the last command: HA interleaves events and results of concurrent commands, so
+// every frame is dispatched by its type and ID, and frames nobody waits for are dropped.
+func (c *WSClient) readLoop(conn *websocket.Conn) {
+	// Every frame and pong proves the connection alive until the next ping is due
+	deadline := wsPingInterval + c.service.readTimeout
+	conn.SetReadDeadline(time.Now().Add(deadline))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(deadline))
+	})
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			c.service.logger.Printf("WebSocket connection lost: %v", err)
+			c.drop(conn, err)
+			return
+		}
+		conn.SetReadDeadline(time.Now().Add(deadline))
+
+		// HA may coalesce several messages into one JSON array frame
+		var responses []wsResponse
+		if trimmed := bytes.TrimSpace(message); len(trimmed) > 0 && trimmed[0] == '[' {
+			err = json.Unmarshal(trimmed, &responses)
+		} else {
+			var response wsResponse
+			err = json.Unmarshal(message, &response)
+			responses = append(responses, response)
+		}
+		if err != nil {
+			c.service.logger.Printf("Failed to parse WebSocket message: %v", err)
+			continue
+		}
+
+		for _, response := range responses {
+			c.dispatch(response)
+		}
+	}
+}
+
+// dispatch hands one frame to the subscription or command it belongs to
+func (c *WSClient) dispatch(response wsResponse) {
+	switch response.Type {
+	case "event":
+		c.mu.Lock()
+		onEvent := c.subscriptions[response.ID]
+		c.mu.Unlock()
+
+		if onEvent == nil {
+			c.service.debugf("Ignoring event for unknown subscription %d", response.ID)
+			return
+		}
+		onEvent(response.Event)
+	case "result", "pong":
+		// A pong answers a ping command and carries no success flag
+		if response.Type == "pong" {
+			response.Success = true
+		}
+
+		c.mu.Lock()
+		ch, exists := c.pending[response.ID]
+		delete(c.pending, response.ID)
+		c.mu.Unlock()
+
+		if !exists {
+			c.service.debugf("Ignoring %s for command %d, nobody is waiting for it", response.Type, response.ID)
+			return
+		}
+		ch <- response
+	default:
+		c.service.debugf("Ignoring unsolicited %q WebSocket message", response.Type)
+	}
+}
+
+// status reports why the shared connection is not up, without dialing it
+func (c *WSClient) status() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case c.conn != nil:
+		return nil
+	case c.dialing != nil:
+		return fmt.Errorf("connecting")
+	case c.lastErr != nil:
+		return c.lastErr
+	}
+	return fmt.Errorf("not connected yet")
+}
+
+// drop closes conn, after reason, and fails every command waiting on it; the next command
+// reconnects
+func (c *WSClient) drop(conn *websocket.Conn, reason error) {
+	c.mu.Lock()
+	var pending map[int]chan wsResponse
+	if c.conn == conn {
+		pending = c.pending
+		c.lastErr = reason
+		close(c.closed)
+		c.conn = nil
+		c.pending = nil
+		c.subscriptions = nil
+	}
+	c.mu.Unlock()
+
+	conn.Close()
+	for _, ch := range pending {
+		close(ch)
+	}
+}
+
+func (c *WSClient) forget(id int) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	delete(c.subscriptions, id)
+	c.mu.Unlock()
+}
+
+// Command sends a command of the given type with optional extra fields and waits for
+// its result, bounded by ctx and the configured read timeout
+func (c *WSClient) Command(ctx context.Context, commandType string, fields map[string]interface{}) (json.RawMessage, error) {
+	result, _, _, err := c.command(ctx, commandType, fields, nil)
+	return result, err
+}
+
+// Subscribe passes events of eventType ("" for all) to onEvent until ctx is done,
+// subscribing again whenever the connection is re-established, and then unsubscribes.
+// onEvent runs on the reader goroutine and must not block.
+func (c *WSClient) Subscribe(ctx context.Context, eventType string, onEvent func(json.RawMessage)) {
+	fields := map[string]interface{}{}
+	if eventType != "" {
+		fields["event_type"] = eventType
+	}
+
+	backoff := time.Second
+	for ctx.Err() == nil {
+		_, id, closed, err := c.command(ctx, "subscribe_events", fields, onEvent)
+		if err != nil {
+			c.service.logger.Printf("Subscribing to %q events failed, retrying in %v: %v", eventType, backoff, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, 30*time.Second)
+			continue
+		}
+
+		c.service.logger.Printf("Subscribed to %q events", eventType)
+		backoff = time.Second
+		select {
+		case <-ctx.Done():
+			c.unsubscribe(id, closed)
+			c.service.logger.Printf("Unsubscribed from %q events", eventType)
+		case <-closed:
+			c.service.logger.Printf("Subscription to %q events lost with the connection, resubscribing", eventType)
+		}
+	}
+}
+
+// unsubscribe stops the events of the subscribe command id, unless the connection it was
+// made on has closed and ended it already
+func (c *WSClient) unsubscribe(id int, closed <-chan struct{}) {
+	c.forget(id)
+	select {
+	case <-closed:
+		return
+	default:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.service.requestTimeout)
+	defer cancel()
+	if _, err := c.Command(ctx, "unsubscribe_events", map[string]interface{}{"subscription": id}); err != nil {
+		c.service.debugf("Unsubscribing %d failed: %v", id, err)
+	}
+}
+
+// command runs Command and returns the command's ID; with onEvent set, events carrying the
+// ID are passed to it until the connection drops, which the returned channel signals
+func (c *WSClient) command(ctx context.Context, commandType string, fields map[string]interface{}, onEvent func(json.RawMessage)) (_ json.RawMessage, _ int, _ <-chan struct{}, err error) {
+	ctx, span := tracer.Start(ctx, "HA ws "+commandType, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("ha.ws.type", commandType),
+	))
+	start := time.Now()
+	defer func() {
+		endSpan(span, err)
+		stats.recordEndpoint("ws "+commandType, time.Since(start), err != nil)
+	}()
+
+	if err := c.service.rateLimiter.allow(""); err != nil {
+		return nil, 0, nil, err
+	}
+
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	id := int(c.nextID.Add(1))
+	command := map[string]interface{}{}
+	for key, value := range fields {
+		command[key] = value
+	}
+	command["id"] = id
+	command["type"] = commandType
+
+	ch := make(chan wsResponse, 1)
+	c.mu.Lock()
+	if c.conn != conn {
+		c.mu.Unlock()
+		return nil, 0, nil, fmt.Errorf("WebSocket connection closed")
+	}
+	c.pending[id] = ch
+	if onEvent != nil {
+		c.subscriptions[id] = onEvent
+	}
+	closed := c.closed
+	c.mu.Unlock()
+
+	c.writeMu.Lock()
+	conn.SetWriteDeadline(time.Now().Add(c.service.requestTimeout))
+	err = conn.WriteJSON(command)
+	c.writeMu.Unlock()
+	if err != nil {
+		c.service.logger.Printf("Failed to send %s: %v", commandType, err)
+		c.drop(conn, err)
+		return nil, 0, nil, err
+	}
+
+	readTimeout := c.service.readTimeout
+	timeout, perCall := callTimeout(ctx)
+	if perCall {
+		readTimeout = timeout
+	}
+	timer := time.NewTimer(readTimeout)
+	defer timer.Stop()
+
+	select {
+	case response, ok := <-ch:
+		if !ok {
+			return nil, 0, nil, fmt.Errorf("WebSocket connection closed while waiting for %s", commandType)
+		}
+		if !response.Success {
+			c.forget(id)
+			if response.Error != nil {
+				return nil, 0, nil, fmt.Errorf("%s failed: %s (%s)", commandType, response.Error.Message, response.Error.Code)
+			}
+			return nil, 0, nil, fmt.Errorf("%s failed", commandType)
+		}
+		return response.Result, id, closed, nil
+	case <-ctx.Done():
+		c.forget(id)
+		return nil, 0, nil, ctx.Err()
+	case <-timer.C:
+		err := fmt.Errorf("timed out waiting for %s after %v", commandType, readTimeout)
+		if perCall {
+			// The caller's own timeout_ms says nothing about the connection, which other
+			// clients and the subscriptions share
+			c.forget(id)
+			return nil, 0, nil, err
+		}
+		// HA answers every command, so the connection is likely dead; the next command
+		// reconnects and subscriptions resubscribe
+		c.service.logger.Printf("No answer to %s after %v, reconnecting the WebSocket", commandType, readTimeout)
+		c.drop(conn, err)
+		return nil, 0, nil, err
+	}
+}
+
+// CommandInto runs Command and decodes the result into target
+func (c *WSClient) CommandInto(ctx context.Context, commandType string, fields map[string]interface{}, target interface{}) error {
+	result, err := c.Command(ctx, commandType, fields)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(result, target); err != nil {
+		return fmt.Errorf("failed to parse %s result: %v", commandType, err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Entities a single tool call may change when max_batch_entities is not set
+const defaultMaxBatchEntities = 50
+
+// Limits that contain a runaway or prompt-injected agent
+type WriteLimitConfig struct {
+	MaxBatchEntities int `json:"max_batch_entities,omitempty"` // entities one call may change, 50 when 0, unlimited when negative
+	WritesPerMinute  int `json:"writes_per_minute,omitempty"`  // service calls per client session, unlimited when 0
+}
+
+// maxBatchEntities returns the blast-radius cap of one tool call, 0 meaning none
+func (c WriteLimitConfig) maxBatchEntities() int {
+	switch {
+	case c.MaxBatchEntities == 0:
+		return defaultMaxBatchEntities
+	case c.MaxBatchEntities < 0:
+		return 0
+	}
+	return c.MaxBatchEntities
+}
+
+// checkBatchSize rejects a tool call that would change more than max_batch_entities
+// entities
+func (h *HAService) checkBatchSize(count int) error {
+	limit := h.config.WriteLimits.maxBatchEntities()
+	if limit > 0 && count > limit {
+		h.logger.Printf("Call to change %d entities rejected, the limit is %d", count, limit)
+		return &InvalidRequestError{fmt.Sprintf("this call would change %d entities, at most %d are allowed per call (max_batch_entities); split it up or narrow the targets", count, limit)}
+	}
+	return nil
+}
+
+// sessionWrites counts service calls per client session over the last minute
+type sessionWrites struct {
+	mu       sync.Mutex
+	sessions map[string][]time.Time
+}
+
+var writeCounts = &sessionWrites{sessions: make(map[string][]time.Time)}
+
+// allow records a write for session, or returns a RateLimitError once limit writes were
+// made in the last minute
+func (w *sessionWrites) allow(session string, limit int, now time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Drop the writes that left the window, and sessions that went quiet
+	for id, writes := range w.sessions {
+		kept := writes[:0]
+		for _, t := range writes {
+			if now.Sub(t) < time.Minute {
+				kept = append(kept, t)
+			}
+		}
+		if len(kept) == 0 {
+			delete(w.sessions, id)
+		} else {
+			w.sessions[id] = kept
+		}
+	}
+
+	writes := w.sessions[session]
+	if len(writes) >= limit {
+		return &RateLimitError{Scope: "session writes", RetryAfter: writes[0].Add(time.Minute).Sub(now)}
+	}
+	w.sessions[session] = append(writes, now)
+	return nil
+}
+
+// Bucket shared by the writes that belong to no client session, such as actions scheduled
+// before their session was recorded
+const sessionlessWrites = "none"
+
+// writeBucket names the writes_per_minute bucket of a client session. Scheduled actions
+// keep it, so it is a hash: listing them mustn't reveal session IDs.
+func writeBucket(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:8])
+}
+
+type writeBucketKey struct{}
+
+// withWriteBucket counts the writes made with ctx, outside the session's tool calls, against
+// that session's bucket
+func withWriteBucket(ctx context.Context, bucket string) context.Context {
+	return context.WithValue(ctx, writeBucketKey{}, bucket)
+}
+
+// checkWriteRate applies writes_per_minute to the MCP session of ctx, or to the session
+// that scheduled the action being run; other writes share one bucket
+func (h *HAService) checkWriteRate(ctx context.Context) error {
+	limit := h.config.WriteLimits.WritesPerMinute
+	if limit <= 0 {
+		return nil
+	}
+	bucket, _ := ctx.Value(writeBucketKey{}).(string)
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		bucket = writeBucket(session.SessionID())
+	}
+	if bucket == "" {
+		bucket = sessionlessWrites
+	}
+	if err := writeCounts.allow(bucket, limit, time.Now()); err != nil {
+		h.logger.Printf("Write rejected for session %s: %v", bucket, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// entityQueue serializes writes per entity: commands for the same entity run one at a time in
+// the order they arrived, commands for different entities still run in parallel. The zero
+// value is ready to use.
+type entityQueue struct {
+	mu    sync.Mutex
+	slots map[string]chan struct{} // one-slot semaphore per entity; waiting senders queue FIFO
+}
+
+type heldEntitiesKey struct{}
+
+func (q *entityQueue) slot(entityID string) chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.slots == nil {
+		q.slots = make(map[string]chan struct{})
+	}
+	slot, ok := q.slots[entityID]
+	if !ok {
+		slot = make(chan struct{}, 1)
+		q.slots[entityID] = slot
+	}
+	return slot
+}
+
+// acquire waits for its turn on each of entityIDs and returns a context recording them, so
+// nested writes with that context (a multi-step change calling services one by one) don't
+// wait for themselves. Entities are taken in sorted order to rule out deadlocks between
+// multi-entity calls. release must be called once the writes are done.
+func (q *entityQueue) acquire(ctx context.Context, entityIDs []string) (context.Context, func(), error) {
+	held, _ := ctx.Value(heldEntitiesKey{}).(map[string]bool)
+
+	var wanted []string
+	for _, id := range entityIDs {
+		if !held[id] && !containsString(wanted, id) {
+			wanted = append(wanted, id)
+		}
+	}
+	if len(wanted) == 0 {
+		return ctx, func() {}, nil
+	}
+	sort.Strings(wanted)
+
+	var taken []chan struct{}
+	release := func() {
+		for _, slot := range taken {
+			<-slot
+		}
+	}
+	for _, id := range wanted {
+		slot := q.slot(id)
+		select {
+		case slot <- struct{}{}:
+			taken = append(taken, slot)
+		case <-ctx.Done():
+			release()
+			return ctx, nil, ctx.Err()
+		}
+	}
+
+	nowHeld := make(map[string]bool, len(held)+len(wanted))
+	for id := range held {
+		nowHeld[id] = true
+	}
+	for _, id := range wanted {
+		nowHeld[id] = true
+	}
+	return context.WithValue(ctx, heldEntitiesKey{}, nowHeld), release, nil
+}
+
+// serviceEntityIDs returns the entity_id targets of service data, a single ID or a list
+func serviceEntityIDs(data map[string]interface{}) []string {
+	switch v := data["entity_id"].(type) {
+	case string:
+		return []string{v}
+	case []string:
+		return v
+	case []interface{}:
+		var ids []string
+		for _, item := range v {
+			if id, ok := item.(string); ok {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ha_ws_command handler; the command runs with the server's token and bypasses the
+// entity filters, which is why it is an admin tool
+func haWSCommandHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	commandType, err := request.RequireString("type")
+	if err != nil {
+		return mcp.NewToolResultError("type parameter is required"), nil
+	}
+	// Subscriptions would keep sending events nobody reads
+	if strings.HasPrefix(commandType, "subscribe_") || strings.HasPrefix(commandType, "unsubscribe_") || commandType == "auth" {
+		return mcp.NewToolResultError(fmt.Sprintf("Command type %s is not supported, only commands with a single result are", commandType)), nil
+	}
+
+	payload := map[string]interface{}{}
+	if raw, ok := request.GetArguments()["payload"]; ok && raw != nil {
+		payload, ok = raw.(map[string]interface{})
+		if !ok {
+			return mcp.NewToolResultError("payload must be a JSON object"), nil
+		}
+	}
+
+	haService.logger.Printf("Running raw WebSocket command %s", commandType)
+	result, err := haService.ws.Command(ctx, commandType, payload)
+	if err != nil {
+		return toolError("WebSocket command failed", err), nil
+	}
+
+	if len(result) == 0 {
+		result = json.RawMessage("null")
+	}
+	return mcp.NewToolResultText(fmt.Sprintf("Result of %s:\n%s", commandType, string(result))), nil
+}